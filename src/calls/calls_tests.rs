@@ -0,0 +1,219 @@
+/// Call graph tests: calls are resolved to definitions by name and scope, and
+/// the shortest chains between endpoints are enumerated.
+
+#[cfg(test)]
+mod calls_tests {
+    use crate::calls::{CallGraph, MAX_CALL_TARGETS};
+    use crate::db::calls::CallRecord;
+
+    /// The row of a definition starting at `line`.
+    fn def(file: &str, caller: &str, line: u32) -> CallRecord {
+        CallRecord {
+            file_path: file.to_string(),
+            language: if file.ends_with(".rs") { "rust" } else { "python" }.to_string(),
+            caller: caller.to_string(),
+            caller_line: line,
+            caller_end_line: line + 5,
+            callee: String::new(),
+            qualifier: String::new(),
+            line,
+        }
+    }
+
+    /// A call from the definition `caller` starting at `caller_line`.
+    fn call(
+        file: &str,
+        caller: &str,
+        caller_line: u32,
+        callee: &str,
+        qualifier: &str,
+        line: u32,
+    ) -> CallRecord {
+        CallRecord {
+            callee: callee.to_string(),
+            qualifier: qualifier.to_string(),
+            line,
+            ..def(file, caller, caller_line)
+        }
+    }
+
+    /// Every edge as (caller, callee, call line), sorted.
+    fn edges(graph: &CallGraph) -> Vec<(&str, &str, u32)> {
+        let mut edges: Vec<(&str, &str, u32)> = graph
+            .edges
+            .iter()
+            .enumerate()
+            .flat_map(|(from, out)| {
+                out.iter().map(move |&(to, line)| {
+                    (graph.nodes[from].caller.as_str(), graph.nodes[to].caller.as_str(), line)
+                })
+            })
+            .collect();
+        edges.sort();
+        edges
+    }
+
+    fn node(graph: &CallGraph, caller: &str) -> usize {
+        graph.nodes.iter().position(|n| n.caller == caller).unwrap()
+    }
+
+    /// Paths as caller names with the line each step is called at.
+    fn chains(
+        graph: &CallGraph,
+        paths: Vec<Vec<(usize, Option<u32>)>>,
+    ) -> Vec<Vec<(&str, Option<u32>)>> {
+        paths
+            .into_iter()
+            .map(|p| p.into_iter().map(|(n, line)| (graph.nodes[n].caller.as_str(), line)).collect())
+            .collect()
+    }
+
+    #[test]
+    fn calls_become_edges_to_definitions_with_the_called_name() {
+        let graph = CallGraph::build(vec![
+            def("src/main.rs", "main", 0),
+            def("src/db.rs", "open", 10),
+            call("src/main.rs", "main", 0, "open", "", 2),
+            // The first call to a definition gives the edge its line
+            call("src/main.rs", "main", 0, "open", "", 3),
+            call("src/main.rs", "main", 0, "println", "", 4),
+            // A call from a definition with no row of its own is dropped
+            call("src/main.rs", "helper", 20, "open", "", 21),
+        ]);
+        assert_eq!(graph.nodes.len(), 2);
+        assert_eq!(edges(&graph), vec![("main", "open", 2)]);
+    }
+
+    #[test]
+    fn qualified_calls_go_to_definitions_in_that_scope() {
+        let graph = CallGraph::build(vec![
+            def("src/main.rs", "main", 0),
+            def("src/db.rs", "Store::open", 10),
+            def("src/file.rs", "File::open", 10),
+            def("src/db.rs", "Store::check", 30),
+            def("src/file.rs", "File::check", 30),
+            call("src/main.rs", "main", 0, "open", "Store", 2),
+            // A path's last segment names the scope
+            call("src/main.rs", "main", 0, "check", "crate::db::Store", 3),
+            // `Self` is the caller's own type
+            call("src/db.rs", "Store::open", 10, "check", "Self", 12),
+            // A qualifier matching no definition's scope falls back to all
+            call("src/file.rs", "File::check", 30, "open", "fs", 31),
+        ]);
+        assert_eq!(
+            edges(&graph),
+            vec![
+                ("File::check", "File::open", 31),
+                ("File::check", "Store::open", 31),
+                ("Store::open", "Store::check", 12),
+                ("main", "Store::check", 3),
+                ("main", "Store::open", 2),
+            ]
+        );
+    }
+
+    #[test]
+    fn common_names_resolve_only_within_the_calling_file() {
+        let defs_of_new = |n: usize| -> Vec<CallRecord> {
+            (0..n).map(|i| def(&format!("src/m{i}.rs"), "new", 0)).collect()
+        };
+
+        let mut rows = defs_of_new(MAX_CALL_TARGETS);
+        rows.push(call("src/m0.rs", "new", 0, "new", "", 1));
+        let graph = CallGraph::build(rows);
+        assert_eq!(graph.edges[0].len(), MAX_CALL_TARGETS);
+
+        let mut rows = defs_of_new(MAX_CALL_TARGETS + 1);
+        rows.push(def("src/m0.rs", "run", 10));
+        rows.push(call("src/m0.rs", "run", 10, "new", "", 11));
+        let graph = CallGraph::build(rows);
+        let run = node(&graph, "run");
+        assert_eq!(graph.edges[run], vec![(0, 11)]);
+    }
+
+    #[test]
+    fn named_matches_the_name_and_the_innermost_scopes_given() {
+        let graph = CallGraph::build(vec![
+            def("src/db.rs", "db::Store::search", 0),
+            def("src/index.rs", "Index::search", 0),
+            def("src/lib.rs", "search", 0),
+            def("app/parser.py", "Parser.parse", 0),
+        ]);
+        let named = |name| -> Vec<&str> {
+            graph.named(name).into_iter().map(|i| graph.nodes[i].caller.as_str()).collect()
+        };
+        assert_eq!(named("search"), vec!["db::Store::search", "Index::search", "search"]);
+        assert_eq!(named("Store::search"), vec!["db::Store::search"]);
+        assert_eq!(named("db::Store::search"), vec!["db::Store::search"]);
+        assert!(named("Other::search").is_empty());
+        // Any separator matches any language's
+        assert_eq!(named("Parser::parse"), vec!["Parser.parse"]);
+        assert_eq!(named("Parser#parse"), vec!["Parser.parse"]);
+        assert!(named("").is_empty());
+        assert!(named("sea").is_empty());
+    }
+
+    /// a calls b and c, which both call d, which calls e.
+    fn diamond() -> CallGraph {
+        CallGraph::build(vec![
+            def("src/a.rs", "a", 0),
+            def("src/a.rs", "b", 10),
+            def("src/a.rs", "c", 20),
+            def("src/a.rs", "d", 30),
+            def("src/a.rs", "e", 40),
+            call("src/a.rs", "a", 0, "b", "", 1),
+            call("src/a.rs", "a", 0, "c", "", 2),
+            call("src/a.rs", "b", 10, "d", "", 11),
+            call("src/a.rs", "c", 20, "d", "", 21),
+            call("src/a.rs", "d", 30, "e", "", 31),
+        ])
+    }
+
+    #[test]
+    fn every_shortest_chain_is_found_in_call_order() {
+        let graph = diamond();
+        let (a, d) = (node(&graph, "a"), node(&graph, "d"));
+        let paths = graph.shortest_paths(&[a], &[d], 8, 10);
+        assert_eq!(
+            chains(&graph, paths),
+            vec![
+                vec![("a", None), ("b", Some(1)), ("d", Some(11))],
+                vec![("a", None), ("c", Some(2)), ("d", Some(21))],
+            ]
+        );
+        assert_eq!(graph.shortest_paths(&[a], &[d], 8, 1).len(), 1);
+    }
+
+    #[test]
+    fn only_the_nearest_targets_are_reported() {
+        let graph = diamond();
+        let (a, b, e) = (node(&graph, "a"), node(&graph, "b"), node(&graph, "e"));
+        let paths = graph.shortest_paths(&[a], &[e, b], 8, 10);
+        assert_eq!(chains(&graph, paths), vec![vec![("a", None), ("b", Some(1))]]);
+    }
+
+    #[test]
+    fn chains_longer_than_the_depth_limit_are_not_searched() {
+        let graph = diamond();
+        let (a, e) = (node(&graph, "a"), node(&graph, "e"));
+        assert!(graph.shortest_paths(&[a], &[e], 2, 10).is_empty());
+        assert_eq!(graph.shortest_paths(&[a], &[e], 3, 10).len(), 2);
+    }
+
+    #[test]
+    fn a_source_that_is_also_a_target_is_not_an_empty_chain() {
+        let graph = diamond();
+        let (a, b, d) = (node(&graph, "a"), node(&graph, "b"), node(&graph, "d"));
+        // b is already where the search starts, so the chains lead on to d
+        let paths = graph.shortest_paths(&[a, b], &[b, d], 8, 10);
+        assert_eq!(chains(&graph, paths), vec![vec![("b", None), ("d", Some(11))]]);
+        assert!(graph.shortest_paths(&[b], &[b], 8, 10).is_empty());
+    }
+
+    #[test]
+    fn unreachable_targets_give_no_chain() {
+        let graph = diamond();
+        let (a, e) = (node(&graph, "a"), node(&graph, "e"));
+        assert!(graph.shortest_paths(&[e], &[a], 8, 10).is_empty());
+    }
+}
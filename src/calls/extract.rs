@@ -0,0 +1,218 @@
+use std::collections::HashMap;
+use std::path::Path;
+
+use tree_sitter::{Parser, Query, QueryCursor, StreamingIterator};
+
+use crate::indexer::parser::{grammar_for, parse_definitions};
+use crate::routes::extract::capture;
+
+#[cfg(test)]
+#[path = "extract_tests.rs"]
+mod extract_tests;
+
+/// A definition with the calls made directly inside it (not inside nested
+/// definitions, which are listed on their own).
+#[derive(Debug, Clone, PartialEq)]
+pub struct Function {
+    /// Name qualified by the enclosing definitions: `Store::search` in Rust,
+    /// `Parser.parse` elsewhere
+    pub name: String,
+    /// 0-based lines of the whole definition
+    pub start_line: u32,
+    pub end_line: u32,
+    pub calls: Vec<Call>,
+}
+
+#[derive(Debug, Clone, PartialEq)]
+pub struct Call {
+    /// Called name, without receiver or path
+    pub callee: String,
+    /// Type, module or variable written before the called name (`Store` in
+    /// `Store::open(..)`, `os` in `os.getenv(..)`), or empty
+    pub qualifier: String,
+    /// 0-based line of the call
+    pub line: u32,
+}
+
+/// Queries recognising calls, per language. Captures:
+/// - `@callee`    — the called name
+/// - `@qualifier` — a plain path or identifier the name is accessed on
+///
+/// A qualified call also matches the unqualified pattern; the match with a
+/// qualifier wins.
+const QUERIES: &[(&str, &str)] = &[
+    (
+        "rust",
+        r#"
+        (call_expression function: (identifier) @callee)
+        (call_expression function: (scoped_identifier path: (_) @qualifier name: (identifier) @callee))
+        (call_expression function: (field_expression field: (field_identifier) @callee))
+        (call_expression function: (generic_function function: (identifier) @callee))
+        (call_expression
+          function: (generic_function
+            function: (scoped_identifier path: (_) @qualifier name: (identifier) @callee)))
+        (call_expression
+          function: (generic_function function: (field_expression field: (field_identifier) @callee)))
+        "#,
+    ),
+    (
+        "python",
+        r#"
+        (call function: (identifier) @callee)
+        (call function: (attribute object: (identifier) @qualifier attribute: (identifier) @callee))
+        (call function: (attribute attribute: (identifier) @callee))
+        "#,
+    ),
+    ("javascript", JS_QUERY),
+    ("typescript", JS_QUERY),
+    ("tsx", JS_QUERY),
+    (
+        "go",
+        r#"
+        (call_expression function: (identifier) @callee)
+        (call_expression
+          function: (selector_expression operand: (identifier) @qualifier field: (field_identifier) @callee))
+        (call_expression function: (selector_expression field: (field_identifier) @callee))
+        "#,
+    ),
+    (
+        "java",
+        r#"
+        (method_invocation object: (identifier) @qualifier name: (identifier) @callee)
+        (method_invocation name: (identifier) @callee)
+        (object_creation_expression type: (type_identifier) @callee)
+        "#,
+    ),
+    (
+        "csharp",
+        r#"
+        (invocation_expression function: (identifier) @callee)
+        (invocation_expression
+          function: (member_access_expression expression: (identifier) @qualifier name: (identifier) @callee))
+        (invocation_expression function: (member_access_expression name: (identifier) @callee))
+        (object_creation_expression type: (identifier) @callee)
+        "#,
+    ),
+    (
+        "kotlin",
+        r#"
+        (call_expression . (simple_identifier) @callee)
+        (call_expression
+          . (navigation_expression
+              . (simple_identifier) @qualifier
+              (navigation_suffix (simple_identifier) @callee)))
+        (call_expression . (navigation_expression (navigation_suffix (simple_identifier) @callee)))
+        "#,
+    ),
+    (
+        "scala",
+        r#"
+        (call_expression function: (identifier) @callee)
+        (call_expression
+          function: (field_expression value: (identifier) @qualifier field: (identifier) @callee))
+        (call_expression function: (field_expression field: (identifier) @callee))
+        "#,
+    ),
+    ("haskell", r#"(apply function: (variable) @callee)"#),
+    (
+        "ruby",
+        r#"
+        (call receiver: (constant) @qualifier method: (identifier) @callee)
+        (call method: (identifier) @callee)
+        "#,
+    ),
+];
+
+const JS_QUERY: &str = r#"
+    (call_expression function: (identifier) @callee)
+    (call_expression
+      function: (member_expression object: (identifier) @qualifier property: (property_identifier) @callee))
+    (call_expression function: (member_expression property: (property_identifier) @callee))
+    (new_expression constructor: (identifier) @callee)
+"#;
+
+/// Separator between a definition's name and its enclosing definitions.
+pub fn scope_separator(language: &str) -> &'static str {
+    if language == "rust" { "::" } else { "." }
+}
+
+/// Extract the definitions of a file, in source order, with the calls each
+/// makes. Calls outside every definition (top-level statements) are dropped.
+/// Returns an empty list for unsupported languages.
+#[tracing::instrument(skip_all, fields(path = %path.display()))]
+pub fn extract_calls(path: &Path, content: &str) -> Vec<Function> {
+    let Some((language, lang_name, _)) = grammar_for(path) else {
+        return vec![];
+    };
+    let definitions = parse_definitions(path, content);
+    let sep = scope_separator(lang_name);
+    let mut functions: Vec<Function> = definitions
+        .iter()
+        .map(|d| {
+            let mut name: Vec<&str> = d.scope.iter().map(|(n, _)| n.as_str()).collect();
+            name.push(&d.symbol);
+            Function {
+                name: name.join(sep),
+                start_line: d.start.0,
+                end_line: d.end.0,
+                calls: vec![],
+            }
+        })
+        .collect();
+
+    let Some((_, source)) = QUERIES.iter().find(|(lang, _)| *lang == lang_name) else {
+        return functions;
+    };
+    let query = match Query::new(&language, source) {
+        Ok(q) => q,
+        Err(e) => {
+            tracing::warn!("call query for {lang_name} is invalid: {e}");
+            return functions;
+        }
+    };
+    let mut parser = Parser::new();
+    if parser.set_language(&language).is_err() {
+        return functions;
+    }
+    let Some(tree) = parser.parse(content, None) else {
+        return functions;
+    };
+
+    // Keyed by the callee node, so overlapping patterns record a call once
+    let mut calls: HashMap<usize, (usize, Call)> = HashMap::new();
+    let mut cursor = QueryCursor::new();
+    let mut matches = cursor.matches(&query, tree.root_node(), content.as_bytes());
+    while let Some(m) = matches.next() {
+        let Some(callee) = capture(&query, m, "callee") else {
+            continue;
+        };
+        let position = callee.start_position();
+        let position = (position.row as u32, position.column as u32);
+        // Definitions are in source order, so the innermost one starts last
+        let Some(owner) = definitions
+            .iter()
+            .rposition(|d| d.start <= position && position < d.end)
+        else {
+            continue;
+        };
+        let qualifier = capture(&query, m, "qualifier")
+            .map(|n| content[n.byte_range()].to_string())
+            .unwrap_or_default();
+        let call = Call {
+            callee: content[callee.byte_range()].to_string(),
+            qualifier,
+            line: position.0,
+        };
+        let entry = calls.entry(callee.start_byte()).or_insert((owner, call.clone()));
+        if entry.1.qualifier.is_empty() {
+            entry.1 = call;
+        }
+    }
+
+    let mut calls: Vec<(usize, (usize, Call))> = calls.into_iter().collect();
+    calls.sort_by_key(|(byte, _)| *byte);
+    for (_, (owner, call)) in calls {
+        functions[owner].calls.push(call);
+    }
+    functions
+}
@@ -0,0 +1,119 @@
+/// Call extractor tests: each call is attributed to the innermost definition
+/// containing it, with the path or receiver it was written on.
+
+#[cfg(test)]
+mod extract_tests {
+    use crate::calls::extract::extract_calls;
+    use std::path::Path;
+
+    /// (caller, callee, qualifier) for every call in a file.
+    fn calls(file: &str, content: &str) -> Vec<(String, String, String)> {
+        extract_calls(Path::new(file), content)
+            .into_iter()
+            .flat_map(|f| {
+                f.calls.into_iter().map(move |c| (f.name.clone(), c.callee, c.qualifier))
+            })
+            .collect()
+    }
+
+    fn triple(caller: &str, callee: &str, qualifier: &str) -> (String, String, String) {
+        (caller.to_string(), callee.to_string(), qualifier.to_string())
+    }
+
+    #[test]
+    fn rust_calls_are_attributed_to_methods_inside_impls() {
+        let content = r#"
+struct Store;
+
+impl Store {
+    fn open() -> Self {
+        let conn = connect();
+        Self::check(&conn);
+        Store
+    }
+
+    fn search(&self) {
+        self.table.query().limit(10);
+        helpers::distance::<f32>();
+    }
+}
+"#;
+        assert_eq!(
+            calls("src/db/store.rs", content),
+            vec![
+                triple("Store::open", "connect", ""),
+                triple("Store::open", "check", "Self"),
+                triple("Store::search", "query", ""),
+                triple("Store::search", "limit", ""),
+                triple("Store::search", "distance", "helpers"),
+            ]
+        );
+    }
+
+    #[test]
+    fn definitions_without_calls_are_listed() {
+        let content = "fn leaf() -> u32 { 1 }\n";
+        let functions = extract_calls(Path::new("lib.rs"), content);
+        assert_eq!(functions.len(), 1);
+        assert_eq!(functions[0].name, "leaf");
+        assert!(functions[0].calls.is_empty());
+    }
+
+    #[test]
+    fn python_attribute_calls_keep_their_receiver() {
+        let content = r#"
+import os
+
+class Config:
+    def load(self):
+        path = os.getenv("APP_CONFIG")
+        return self.parse(read(path))
+"#;
+        assert_eq!(
+            calls("app/config.py", content),
+            vec![
+                triple("Config.load", "getenv", "os"),
+                triple("Config.load", "parse", "self"),
+                triple("Config.load", "read", ""),
+            ]
+        );
+    }
+
+    #[test]
+    fn javascript_calls_and_constructors() {
+        let content = r#"
+function handle(req) {
+  const db = new Database();
+  return db.save(parse(req));
+}
+"#;
+        assert_eq!(
+            calls("src/handler.js", content),
+            vec![
+                triple("handle", "Database", ""),
+                triple("handle", "save", "db"),
+                triple("handle", "parse", ""),
+            ]
+        );
+    }
+
+    #[test]
+    fn go_selector_calls() {
+        let content = r#"
+package main
+
+func main() {
+	fmt.Println(run())
+}
+"#;
+        assert_eq!(
+            calls("main.go", content),
+            vec![triple("main", "Println", "fmt"), triple("main", "run", "")]
+        );
+    }
+
+    #[test]
+    fn top_level_calls_are_dropped() {
+        assert!(calls("script.py", "main()\n").is_empty());
+    }
+}
@@ -0,0 +1,360 @@
+pub mod extract;
+
+use std::collections::{HashMap, HashSet, VecDeque};
+use std::path::Path;
+use std::sync::Arc;
+
+use serde::Serialize;
+
+use crate::calls::extract::scope_separator;
+use crate::cli::{OutputFormat, PathArgs};
+use crate::config::AppConfig;
+use crate::db::calls::CallRecord;
+use crate::db::overlay;
+use crate::db::store::Store;
+use crate::embed::nomic::NomicEmbedder;
+use crate::error::{AppError, Result};
+use crate::rag::retriever::{self, SearchMode, SearchOptions};
+
+#[cfg(test)]
+#[path = "calls_tests.rs"]
+mod calls_tests;
+
+/// Names defined more often than this (`new`, `get`, `run`) are too
+/// ambiguous to follow from an unqualified call outside their own file.
+const MAX_CALL_TARGETS: usize = 10;
+
+/// Definitions as nodes, calls resolved by name as edges.
+struct CallGraph {
+    nodes: Vec<CallRecord>,
+    /// Per node: (callee node, line of the first call)
+    edges: Vec<Vec<(usize, u32)>>,
+}
+
+#[derive(Serialize)]
+struct JsonPath<'a> {
+    calls: usize,
+    steps: Vec<JsonStep<'a>>,
+}
+
+#[derive(Serialize)]
+struct JsonStep<'a> {
+    symbol: &'a str,
+    file_path: &'a str,
+    start_line: u32,
+    end_line: u32,
+    /// Line in the previous step's function where this one is called
+    #[serde(skip_serializing_if = "Option::is_none")]
+    call_line: Option<u32>,
+}
+
+/// Print the shortest call chains from `args.from` to `args.to`. Each
+/// endpoint is a function name, or a prompt whose best search results supply
+/// the functions.
+pub async fn path_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: PathArgs,
+) -> Result<()> {
+    let overlay = overlay::current(target_dir);
+    let store = Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay)
+        .await?
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("No index found. Run `index` first.")))?;
+
+    let graph = CallGraph::build(store.calls().all().await?);
+    let mut embedder = None;
+    let mut endpoints = Vec::with_capacity(2);
+    for arg in [&args.from, &args.to] {
+        let mut nodes =
+            if arg.contains(char::is_whitespace) { Vec::new() } else { graph.named(arg) };
+        if nodes.is_empty() {
+            nodes = search_endpoints(config, &store, target_dir, &graph, &mut embedder, arg, args.top)
+                .await?;
+            if matches!(args.format, OutputFormat::Text) {
+                println!("'{arg}': {} function(s) in the best search matches", nodes.len());
+            }
+        }
+        if nodes.is_empty() {
+            return Err(AppError::Other(anyhow::anyhow!("no indexed function matches '{arg}'")));
+        }
+        endpoints.push(nodes);
+    }
+
+    let paths = graph.shortest_paths(&endpoints[0], &endpoints[1], args.max_depth, args.limit);
+    match args.format {
+        OutputFormat::Text => {
+            if paths.is_empty() {
+                println!(
+                    "No call chain from '{}' to '{}' within {} calls.",
+                    args.from, args.to, args.max_depth
+                );
+            }
+            for (i, path) in paths.iter().enumerate() {
+                println!("Path {} ({} call(s)):", i + 1, path.len() - 1);
+                for (j, &(node, call_line)) in path.iter().enumerate() {
+                    let n = &graph.nodes[node];
+                    let arrow = if j == 0 { "  " } else { "→ " };
+                    let called_at = call_line
+                        .map(|l| format!("  (called at line {})", l + 1))
+                        .unwrap_or_default();
+                    println!(
+                        "  {arrow}{}:{}-{}  {}{called_at}",
+                        n.file_path,
+                        n.caller_line + 1,
+                        n.caller_end_line + 1,
+                        n.caller
+                    );
+                }
+                println!();
+            }
+        }
+        OutputFormat::Json => {
+            let json: Vec<JsonPath> = paths
+                .iter()
+                .map(|path| JsonPath {
+                    calls: path.len() - 1,
+                    steps: path
+                        .iter()
+                        .map(|&(node, call_line)| {
+                            let n = &graph.nodes[node];
+                            JsonStep {
+                                symbol: &n.caller,
+                                file_path: &n.file_path,
+                                start_line: n.caller_line,
+                                end_line: n.caller_end_line,
+                                call_line,
+                            }
+                        })
+                        .collect(),
+                })
+                .collect();
+            println!(
+                "{}",
+                serde_json::to_string_pretty(&json).map_err(|e| AppError::Other(e.into()))?
+            );
+        }
+    }
+    Ok(())
+}
+
+/// Functions inside the `top` best search results for `prompt`. Of nested
+/// definitions only the innermost are kept: methods rather than their class.
+async fn search_endpoints(
+    config: &AppConfig,
+    store: &Store,
+    target_dir: &Path,
+    graph: &CallGraph,
+    embedder: &mut Option<Arc<NomicEmbedder>>,
+    prompt: &str,
+    top: usize,
+) -> Result<Vec<usize>> {
+    let plan = retriever::plan_search(
+        config,
+        target_dir,
+        SearchMode::Find,
+        prompt,
+        &SearchOptions::default(),
+    )
+    .await?;
+    let loaded = embedder.clone();
+    let rendered = plan.prompt.clone();
+    let (loaded, vector) = tokio::task::spawn_blocking(move || {
+        let embedder = match loaded {
+            Some(e) => e,
+            None => Arc::new(NomicEmbedder::load()?),
+        };
+        let vector = embedder.embed_prompt(&rendered)?;
+        anyhow::Ok((embedder, vector))
+    })
+    .await
+    .map_err(|e| AppError::Other(e.into()))?
+    .map_err(|e| AppError::Embed(e.to_string()))?;
+    *embedder = Some(loaded);
+
+    let mut found = Vec::new();
+    for r in retriever::search(store, &vector, SearchMode::Find, top, &plan).await? {
+        let overlapping: Vec<usize> = (0..graph.nodes.len())
+            .filter(|&i| {
+                let n = &graph.nodes[i];
+                n.file_path == r.file_path
+                    && n.caller_line <= r.end_line
+                    && r.start_line <= n.caller_end_line
+            })
+            .collect();
+        let encloses = |outer: &CallRecord, inner: &CallRecord| {
+            let (outer, inner) = (
+                (outer.caller_line, outer.caller_end_line),
+                (inner.caller_line, inner.caller_end_line),
+            );
+            outer != inner && outer.0 <= inner.0 && inner.1 <= outer.1
+        };
+        found.extend(overlapping.iter().copied().filter(|&i| {
+            !overlapping
+                .iter()
+                .any(|&j| j != i && encloses(&graph.nodes[i], &graph.nodes[j]))
+        }));
+    }
+    found.sort_unstable();
+    found.dedup();
+    Ok(found)
+}
+
+impl CallGraph {
+    fn build(rows: Vec<CallRecord>) -> Self {
+        let (nodes, calls): (Vec<CallRecord>, Vec<CallRecord>) =
+            rows.into_iter().partition(|r| r.callee.is_empty());
+
+        let index: HashMap<(&str, u32, &str), usize> = nodes
+            .iter()
+            .enumerate()
+            .map(|(i, n)| ((n.file_path.as_str(), n.caller_line, n.caller.as_str()), i))
+            .collect();
+        let mut by_name: HashMap<&str, Vec<usize>> = HashMap::new();
+        for (i, n) in nodes.iter().enumerate() {
+            by_name.entry(name_and_scope(n).0).or_default().push(i);
+        }
+
+        let mut edges: Vec<Vec<(usize, u32)>> = vec![Vec::new(); nodes.len()];
+        for call in &calls {
+            let key = (call.file_path.as_str(), call.caller_line, call.caller.as_str());
+            let Some(&from) = index.get(&key) else {
+                continue;
+            };
+            let candidates = by_name.get(call.callee.as_str()).map_or(&[][..], Vec::as_slice);
+            for to in resolve(&nodes, from, call, candidates) {
+                if !edges[from].iter().any(|&(t, _)| t == to) {
+                    edges[from].push((to, call.line));
+                }
+            }
+        }
+        Self { nodes, edges }
+    }
+
+    /// Functions called `name`, which may be qualified by its enclosing
+    /// definitions (`Store::search`, `Parser.parse`).
+    fn named(&self, name: &str) -> Vec<usize> {
+        let parts: Vec<&str> = name
+            .split(|c: char| matches!(c, ':' | '.' | '#'))
+            .filter(|p| !p.is_empty())
+            .collect();
+        let Some((last, scope)) = parts.split_last() else {
+            return vec![];
+        };
+        (0..self.nodes.len())
+            .filter(|&i| {
+                let n = &self.nodes[i];
+                let sep = scope_separator(&n.language);
+                let enclosing: Vec<&str> = n.caller.split(sep).collect();
+                let (own, enclosing) = enclosing.split_last().expect("split yields one part");
+                own == last
+                    && enclosing.len() >= scope.len()
+                    && enclosing.iter().rev().zip(scope.iter().rev()).all(|(a, b)| a == b)
+            })
+            .collect()
+    }
+
+    /// Up to `limit` of the shortest chains, of at most `max_depth` calls,
+    /// from a node in `from` to a node in `to`. Each step is a node and the
+    /// line where the previous step calls it.
+    fn shortest_paths(
+        &self,
+        from: &[usize],
+        to: &[usize],
+        max_depth: usize,
+        limit: usize,
+    ) -> Vec<Vec<(usize, Option<u32>)>> {
+        let targets: HashSet<usize> = to.iter().copied().collect();
+        let mut depth: Vec<Option<usize>> = vec![None; self.nodes.len()];
+        // Every predecessor on a shortest route, with the call line
+        let mut parents: Vec<Vec<(usize, u32)>> = vec![Vec::new(); self.nodes.len()];
+        let mut queue = VecDeque::new();
+        for &s in from {
+            depth[s] = Some(0);
+            queue.push_back(s);
+        }
+
+        let mut reached = Vec::new();
+        while let Some(node) = queue.pop_front() {
+            let d = depth[node].expect("queued nodes have a depth");
+            if d >= max_depth || reached.first().is_some_and(|&r| depth[r] <= Some(d)) {
+                continue;
+            }
+            for &(next, line) in &self.edges[node] {
+                match depth[next] {
+                    None => {
+                        depth[next] = Some(d + 1);
+                        parents[next].push((node, line));
+                        if targets.contains(&next) {
+                            reached.push(next);
+                        }
+                        queue.push_back(next);
+                    }
+                    Some(nd) if nd == d + 1 => parents[next].push((node, line)),
+                    _ => {}
+                }
+            }
+        }
+
+        let mut paths = Vec::new();
+        for target in reached {
+            // Walk back to a source, enumerating predecessors depth-first
+            let mut stack = vec![vec![(target, None::<u32>)]];
+            while let Some(path) = stack.pop() {
+                if paths.len() == limit {
+                    return paths;
+                }
+                let (head, _) = path[0];
+                if depth[head] == Some(0) {
+                    paths.push(path);
+                    continue;
+                }
+                for &(parent, line) in parents[head].iter().rev() {
+                    let mut longer = Vec::with_capacity(path.len() + 1);
+                    longer.push((parent, None));
+                    longer.extend(path.iter().copied());
+                    longer[1].1 = Some(line);
+                    stack.push(longer);
+                }
+            }
+        }
+        paths
+    }
+}
+
+/// Definitions a call may reach among `candidates`, the definitions with the
+/// called name: those in the qualifying type or module when the call names
+/// one, otherwise all of them, unless the name is too common to tell — then
+/// only those in the calling file.
+fn resolve(nodes: &[CallRecord], from: usize, call: &CallRecord, candidates: &[usize]) -> Vec<usize> {
+    let caller = &nodes[from];
+    let qualifier = call.qualifier.rsplit([':', '.']).next().unwrap_or("");
+    let qualifier = match qualifier {
+        // The caller's own type
+        "Self" | "self" | "this" | "cls" => name_and_scope(caller).1.unwrap_or(""),
+        q => q,
+    };
+    if !qualifier.is_empty() {
+        let scoped: Vec<usize> = candidates
+            .iter()
+            .copied()
+            .filter(|&i| name_and_scope(&nodes[i]).1 == Some(qualifier))
+            .collect();
+        if !scoped.is_empty() {
+            return scoped;
+        }
+    }
+    if candidates.len() <= MAX_CALL_TARGETS {
+        return candidates.to_vec();
+    }
+    candidates.iter().copied().filter(|&i| nodes[i].file_path == caller.file_path).collect()
+}
+
+/// A definition's own name and the innermost definition enclosing it.
+fn name_and_scope(n: &CallRecord) -> (&str, Option<&str>) {
+    let sep = scope_separator(&n.language);
+    match n.caller.rsplit_once(sep) {
+        Some((scope, name)) => (name, Some(scope.rsplit(sep).next().unwrap_or(scope))),
+        None => (&n.caller, None),
+    }
+}
@@ -23,6 +23,10 @@ pub struct Cli {
     #[arg(short, long, global = true, action = clap::ArgAction::Count)]
     pub verbose: u8,
 
+    /// Write a Chrome-trace / Perfetto compatible span trace to this file
+    #[arg(long, global = true, value_name = "FILE")]
+    pub trace_out: Option<PathBuf>,
+
     #[command(subcommand)]
     pub command: Commands,
 }
@@ -38,6 +42,46 @@ pub enum Commands {
     /// Search using both content and summary embeddings, merged with RRF
     Query(FindArgs),
 
+    /// Interactive search session with follow-up refinement of results
+    Repl(ReplArgs),
+
+    /// Export symbol definitions of indexed files as ctags, SCIP or LSIF
+    Export(ExportArgs),
+
+    /// Import precise symbols from a SCIP index (replaces any previous import)
+    ImportScip(ImportScipArgs),
+
+    /// Show where a symbol is defined, from the imported SCIP index
+    Def(SymbolArgs),
+
+    /// Show the references to a symbol, grouped by caller
+    Callers(SymbolArgs),
+
+    /// Import test coverage and map it onto indexed chunks
+    Coverage(CoverageArgs),
+
+    /// Import a runtime profile and map its samples onto indexed chunks
+    Profile(ProfileArgs),
+
+    /// List HTTP route registrations and the chunks that handle them
+    Routes(RoutesArgs),
+
+    /// Show where environment variables and config keys are read
+    ConfigUsage(ConfigUsageArgs),
+
+    /// Write the import dependency graph of files, directories or modules
+    Graph(GraphArgs),
+
+    /// Find the shortest call chains from one function to another
+    Path(PathArgs),
+
+    /// List the symbols of an indexed file with kinds, lines and summaries
+    Outline(OutlineArgs),
+
+    /// Tune retrieval settings against a golden set of queries and write the
+    /// best ones to the project maharajah.toml
+    Tune(TuneArgs),
+
     /// Manage the vector database (stats, clear)
     Db(DbArgs),
 
@@ -94,6 +138,310 @@ pub struct FindArgs {
     /// Output format
     #[arg(long, value_enum, default_value_t = OutputFormat::Text)]
     pub format: OutputFormat,
+
+    /// Named search intent from the `[search.intents]` config section
+    /// (e.g. tests, config, definition) — selects the query instruction and default filters
+    #[arg(long, value_name = "NAME")]
+    pub intent: Option<String>,
+
+    /// Only return chunks whose file path matches this glob (repeatable; overrides the intent's paths)
+    #[arg(long = "path", value_name = "GLOB")]
+    pub paths: Vec<String>,
+
+    /// Only return chunks in this language (repeatable; overrides the intent's languages)
+    #[arg(long = "lang", value_name = "LANG")]
+    pub languages: Vec<String>,
+
+    /// Multiply scores of results under a path glob, e.g. 'src/**=1.5' (repeatable;
+    /// replaces the `[ranking.paths]` entry for the same glob, 1.0 disables it)
+    #[arg(long = "boost", value_name = "GLOB=FACTOR", value_parser = parse_boost)]
+    pub boosts: Vec<(String, f32)>,
+
+    /// Ignore the `[ranking.paths]` config for this search
+    #[arg(long)]
+    pub no_boosts: bool,
+
+    /// Boost results in files you changed recently (uncommitted changes and
+    /// your own recent commits; file mtimes outside git)
+    #[arg(long)]
+    pub boost_recent: bool,
+
+    /// Only return chunks that read this environment variable or config key;
+    /// without a value, chunks reading any environment variable
+    #[arg(long, value_name = "KEY", num_args = 0..=1, default_missing_value = "*")]
+    pub uses_env: Option<String>,
+
+    /// Only return chunks no test executes, per the imported coverage report
+    #[arg(long)]
+    pub uncovered: bool,
+
+    /// Only return chunks on at least this percentage of the imported
+    /// profile's samples (default 1)
+    #[arg(long, value_name = "MIN_PERCENT", num_args = 0..=1, default_missing_value = "1")]
+    pub hot: Option<f32>,
+
+    /// Boost results by their share of the imported profile's samples
+    #[arg(long)]
+    pub boost_hot: bool,
+}
+
+#[derive(Args, Debug)]
+pub struct ReplArgs {
+    /// Maximum number of results to show per search
+    #[arg(short = 'n', long, default_value_t = 10)]
+    pub limit: usize,
+
+    /// Only return chunks whose file path matches this glob (repeatable)
+    #[arg(long = "path", value_name = "GLOB")]
+    pub paths: Vec<String>,
+
+    /// Only return chunks in this language (repeatable)
+    #[arg(long = "lang", value_name = "LANG")]
+    pub languages: Vec<String>,
+
+    /// Boost results in files you changed recently
+    #[arg(long)]
+    pub boost_recent: bool,
+}
+
+fn parse_boost(s: &str) -> Result<(String, f32), String> {
+    let (glob, factor) = s
+        .rsplit_once('=')
+        .ok_or_else(|| format!("expected GLOB=FACTOR, got '{s}'"))?;
+    let factor: f32 = factor
+        .parse()
+        .map_err(|_| format!("invalid boost factor '{factor}'"))?;
+    Ok((glob.to_string(), factor))
+}
+
+#[derive(Args, Debug)]
+pub struct ExportArgs {
+    /// Output format
+    #[arg(long, value_enum)]
+    pub format: ExportFormat,
+
+    /// Output file, or '-' for stdout (default: tags, index.scip or dump.lsif
+    /// in the project directory)
+    #[arg(short, long, value_name = "FILE")]
+    pub output: Option<PathBuf>,
+}
+
+#[derive(clap::ValueEnum, Debug, Clone)]
+pub enum ExportFormat {
+    /// Universal Ctags extended format, for editors
+    Ctags,
+    /// SCIP protobuf index, for Sourcegraph-style code navigation
+    Scip,
+    /// LSIF JSON lines dump
+    Lsif,
+}
+
+#[derive(Args, Debug)]
+pub struct ImportScipArgs {
+    /// SCIP index file, e.g. the index.scip written by scip-rust or scip-typescript
+    pub path: PathBuf,
+}
+
+#[derive(Args, Debug)]
+pub struct CoverageArgs {
+    #[command(subcommand)]
+    pub action: CoverageAction,
+}
+
+#[derive(Subcommand, Debug)]
+pub enum CoverageAction {
+    /// Replace the chunk coverage with that of a report: an lcov tracefile,
+    /// Cobertura XML, or coverage.py / Istanbul JSON
+    Import {
+        /// Coverage report, e.g. lcov.info, cobertura.xml or coverage.json
+        path: PathBuf,
+    },
+}
+
+#[derive(Args, Debug)]
+pub struct ProfileArgs {
+    #[command(subcommand)]
+    pub action: ProfileAction,
+}
+
+#[derive(Subcommand, Debug)]
+pub enum ProfileAction {
+    /// Replace the chunk hotness with that of a profile: pprof, folded stacks
+    /// (perf, py-spy, async-profiler) or a Chrome .cpuprofile
+    Import {
+        /// Profile file, e.g. cpu.pprof, out.folded or app.cpuprofile
+        path: PathBuf,
+    },
+}
+
+#[derive(Args, Debug)]
+pub struct SymbolArgs {
+    /// Symbol name: a plain name, a qualified name (Parser::parse, Parser.parse)
+    /// or a full SCIP symbol
+    pub name: String,
+
+    /// Output format
+    #[arg(long, value_enum, default_value_t = OutputFormat::Text)]
+    pub format: OutputFormat,
+}
+
+#[derive(Args, Debug)]
+pub struct RoutesArgs {
+    /// Only show routes serving this request path (e.g. /users/42 matches /users/{id})
+    #[arg(long, value_name = "PATH")]
+    pub path: Option<String>,
+
+    /// Output format
+    #[arg(long, value_enum, default_value_t = OutputFormat::Text)]
+    pub format: OutputFormat,
+}
+
+#[derive(Args, Debug)]
+pub struct ConfigUsageArgs {
+    /// Environment variable or config key (e.g. MAHARAJAH_CONFIG, server.port);
+    /// omit to list every key read in the index
+    pub key: Option<String>,
+
+    /// Output format
+    #[arg(long, value_enum, default_value_t = OutputFormat::Text)]
+    pub format: OutputFormat,
+}
+
+#[derive(Args, Debug)]
+pub struct GraphArgs {
+    /// Graph nodes: files, directories, or modules (directories with a build manifest)
+    #[arg(long, value_enum, default_value_t = GraphLevel::File)]
+    pub level: GraphLevel,
+
+    /// Output format
+    #[arg(long, value_enum, default_value_t = GraphFormat::Dot)]
+    pub format: GraphFormat,
+
+    /// Only include the files most relevant to this search prompt
+    #[arg(long, value_name = "PROMPT")]
+    pub query: Option<String>,
+
+    /// Number of files kept with --query
+    #[arg(long, default_value_t = 20)]
+    pub top: usize,
+
+    /// Output file, or '-' for stdout (default: stdout)
+    #[arg(short, long, value_name = "FILE")]
+    pub output: Option<PathBuf>,
+}
+
+#[derive(clap::ValueEnum, Debug, Clone)]
+pub enum GraphLevel {
+    File,
+    Dir,
+    Module,
+}
+
+impl GraphLevel {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            GraphLevel::File => "file",
+            GraphLevel::Dir => "dir",
+            GraphLevel::Module => "module",
+        }
+    }
+}
+
+#[derive(clap::ValueEnum, Debug, Clone)]
+pub enum GraphFormat {
+    /// Graphviz DOT
+    Dot,
+    /// Mermaid flowchart, for Markdown docs
+    Mermaid,
+    Json,
+}
+
+#[derive(Args, Debug)]
+pub struct PathArgs {
+    /// Starting function (e.g. find_cmd, Store::search), or a search prompt
+    /// whose best matches are the starting points
+    pub from: String,
+
+    /// Target function, or a search prompt
+    pub to: String,
+
+    /// Maximum number of chains shown
+    #[arg(long, default_value_t = 3)]
+    pub limit: usize,
+
+    /// Longest chain searched, in calls
+    #[arg(long, default_value_t = 8)]
+    pub max_depth: usize,
+
+    /// Search results used as endpoints when an endpoint is a prompt
+    #[arg(long, default_value_t = 3)]
+    pub top: usize,
+
+    /// Output format
+    #[arg(long, value_enum, default_value_t = OutputFormat::Text)]
+    pub format: OutputFormat,
+}
+
+#[derive(Args, Debug)]
+pub struct OutlineArgs {
+    /// File to outline, relative to the working directory or the target directory
+    pub file: PathBuf,
+
+    /// Output format
+    #[arg(long, value_enum, default_value_t = OutputFormat::Text)]
+    pub format: OutputFormat,
+}
+
+#[derive(Args, Debug)]
+pub struct TuneArgs {
+    /// JSON lines file of golden queries, e.g.
+    /// {"query": "insert chunks", "expected": ["src/db/store.rs", "src/indexer/mod.rs:120"]}
+    pub golden: PathBuf,
+
+    /// Try every combination of values, or a random sample of them
+    #[arg(long, value_enum, default_value_t = TuneStrategy::Grid)]
+    pub strategy: TuneStrategy,
+
+    /// Settings sampled by the random strategy
+    #[arg(long, default_value_t = 50)]
+    pub trials: usize,
+
+    /// Seed for the random strategy (default: time-based)
+    #[arg(long)]
+    pub seed: Option<u64>,
+
+    /// Results per query that count towards the metrics
+    #[arg(short, default_value_t = 10)]
+    pub k: usize,
+
+    /// Metric the best settings maximise
+    #[arg(long, value_enum, default_value_t = TuneMetric::Mrr)]
+    pub metric: TuneMetric,
+
+    /// Chunk sizes to try, in lines (comma-separated); each is indexed into a
+    /// scratch database reusing the embeddings of unchanged chunks
+    #[arg(long, value_name = "LINES", value_delimiter = ',')]
+    pub chunk_lines: Vec<usize>,
+
+    /// Report the best settings without writing maharajah.toml
+    #[arg(long)]
+    pub dry_run: bool,
+}
+
+#[derive(clap::ValueEnum, Debug, Clone, Copy)]
+pub enum TuneStrategy {
+    Grid,
+    Random,
+}
+
+#[derive(clap::ValueEnum, Debug, Clone, Copy, PartialEq)]
+pub enum TuneMetric {
+    /// Mean reciprocal rank of the first relevant hit
+    Mrr,
+    /// Share of expected hits found
+    Recall,
+    /// Share of queries with any relevant hit
+    HitRate,
 }
 
 #[derive(Args, Debug)]
@@ -111,6 +459,13 @@ pub enum DbAction {
         #[arg(long)]
         yes: bool,
     },
+    /// List the branch overlays in the index and the files each maps
+    Overlays,
+    /// Remove the overlay of a branch that no longer exists
+    DropOverlay {
+        /// Overlay name, as listed by `db overlays`
+        name: String,
+    },
 }
 
 #[derive(clap::ValueEnum, Debug, Clone)]
@@ -3,6 +3,7 @@ use figment::{
     Figment,
 };
 use serde::{Deserialize, Serialize};
+use std::collections::BTreeMap;
 use std::path::{Path, PathBuf};
 
 use crate::error::Result;
@@ -12,6 +13,11 @@ pub struct AppConfig {
     pub embed: EmbedConfig,
     pub db: DbConfig,
     pub index: IndexConfig,
+    pub search: SearchConfig,
+    pub retrieval: RetrievalConfig,
+    pub ranking: RankingConfig,
+    pub watch: WatchConfig,
+    pub highlight: HighlightConfig,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -19,6 +25,22 @@ pub struct EmbedConfig {
     /// HuggingFace model ID to use for embeddings.
     /// Defaults to "nomic-ai/CodeRankEmbed" (~550 MB, downloaded on first run).
     pub model_id: String,
+    /// Context lines prepended to each chunk's text before it is embedded,
+    /// in this order. Copies of a chunk share a row only when their headers
+    /// match, so `path` keeps copies in different files apart. Changing them
+    /// needs `mh index --reindex`.
+    pub header: Vec<HeaderField>,
+    /// Rewrites applied to chunk text before it is embedded
+    pub preprocess: PreprocessConfig,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct PreprocessConfig {
+    /// Steps applied in order to the text sent to the model; the stored
+    /// content is unchanged. Changing them needs `mh index --reindex`.
+    pub steps: Vec<PreprocessStep>,
+    /// Longest string literal kept whole by `truncate_strings`
+    pub max_string_chars: usize,
 }
 
 #[derive(Debug, Clone, Serialize, Deserialize)]
@@ -37,6 +59,136 @@ pub struct IndexConfig {
     pub default_extensions: Vec<String>,
     /// Glob patterns for paths to exclude from indexing
     pub default_excludes: Vec<String>,
+    /// Files larger than this are skipped (generated code, data dumps, minified bundles)
+    pub max_file_bytes: u64,
+    /// Maximum number of chunks (and their vectors) held in memory at once;
+    /// files producing more chunks are embedded and written in batches
+    pub max_batch_chunks: usize,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct SearchConfig {
+    /// Query instruction template per search mode (`find`, `query`).
+    /// `{query}` is replaced with the prompt; a template without the
+    /// placeholder is used as a prefix.
+    pub templates: BTreeMap<String, String>,
+    /// Named intents selectable with `--intent`, each bundling a template
+    /// with default result filters
+    pub intents: BTreeMap<String, IntentConfig>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct IntentConfig {
+    /// Query instruction template, as in `search.templates`
+    pub template: String,
+    /// Only return chunks whose file path matches one of these globs
+    #[serde(default)]
+    pub paths: Vec<String>,
+    /// Only return chunks in these languages (e.g. "rust", "python")
+    #[serde(default)]
+    pub languages: Vec<String>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct RetrievalConfig {
+    /// RRF rank constant of `query`'s merge; larger values flatten the gap
+    /// between neighbouring ranks
+    pub rrf_k: f32,
+    /// Weight of the content-vector ranking in the RRF merge
+    pub content_weight: f32,
+    /// Weight of the summary-vector ranking in the RRF merge
+    pub summary_weight: f32,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct RankingConfig {
+    /// Score multipliers keyed by path glob, applied after retrieval.
+    /// Values above 1.0 boost matching files, below 1.0 penalise them;
+    /// when several globs match, their multipliers are multiplied together.
+    pub paths: BTreeMap<String, f32>,
+    /// Decay of the `--boost-recent` working-set boost
+    pub recent: RecentConfig,
+    /// Multiplier for results defining a symbol named in the prompt, once
+    /// precise symbols have been imported with `import-scip` (1.0 disables)
+    pub symbol_match: f32,
+    /// Multiplier for the hottest chunk under `--boost-hot`, once a profile
+    /// has been imported with `profile import`; cooler chunks get a
+    /// proportionally smaller boost
+    pub hot_boost: f32,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct RecentConfig {
+    /// Multiplier for a file touched just now
+    pub max_boost: f32,
+    /// Hours after which a file's boost (above 1.0) has halved
+    pub half_life_hours: f32,
+    /// How many days of your own commits count as recent work
+    pub commit_days: u32,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct WatchConfig {
+    /// How `server` detects file changes
+    pub backend: WatchBackend,
+    /// Scan interval of the polling backend, in milliseconds
+    pub poll_interval_ms: u64,
+    /// Seconds between full hash sweeps of the project that catch changes the
+    /// watcher missed (0 disables)
+    pub reconcile_interval_secs: u64,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct HighlightConfig {
+    /// Pick the most relevant lines of each result (costs one batched
+    /// embedding pass over the candidate windows)
+    pub enabled: bool,
+    /// Lines per highlighted window
+    pub window_lines: usize,
+    /// Windows per result embedded after the lexical prefilter
+    pub candidates: usize,
+    /// Weight of the share of prompt words a window contains, added to its
+    /// cosine similarity to the query
+    pub lexical_weight: f32,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum HeaderField {
+    /// File path relative to the indexed directory
+    Path,
+    Language,
+    /// Enclosing definitions, e.g. `impl Store` for a part of its methods
+    Scope,
+    /// First line of the doc comment or docstring
+    Summary,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum PreprocessStep {
+    /// Drop comment blocks mentioning a license or copyright
+    StripLicense,
+    /// Drop indentation and blank lines, collapse runs of spaces
+    CollapseWhitespace,
+    /// Drop import, use and require statements
+    DropImports,
+    /// Shorten long string literals to `max_string_chars`
+    TruncateStrings,
+    /// Rewrite `parseFile` and `parse_file` as `parse file`
+    SplitIdentifiers,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum WatchBackend {
+    /// Native OS notifications, falling back to polling if they can't be set up
+    Auto,
+    /// Native OS notifications only (inotify, FSEvents, ReadDirectoryChangesW)
+    Native,
+    /// Periodic scans; for network filesystems and containers where native
+    /// notifications are never delivered
+    Poll,
 }
 
 impl Default for AppConfig {
@@ -44,6 +196,15 @@ impl Default for AppConfig {
         Self {
             embed: EmbedConfig {
                 model_id: "nomic-ai/CodeRankEmbed".into(),
+                header: vec![
+                    HeaderField::Language,
+                    HeaderField::Scope,
+                    HeaderField::Summary,
+                ],
+                preprocess: PreprocessConfig {
+                    steps: vec![],
+                    max_string_chars: 64,
+                },
             },
             db: DbConfig {
                 table_name: "chunks".into(),
@@ -102,11 +263,84 @@ impl Default for AppConfig {
                     "**/bin/Release/**".into(),
                     "**/obj/**".into(),
                 ],
+                max_file_bytes: 1024 * 1024,
+                max_batch_chunks: 64,
+            },
+            search: SearchConfig {
+                templates: BTreeMap::from([
+                    ("find".into(), DEFAULT_QUERY_TEMPLATE.into()),
+                    ("query".into(), DEFAULT_QUERY_TEMPLATE.into()),
+                ]),
+                intents: BTreeMap::from([
+                    (
+                        "tests".into(),
+                        IntentConfig {
+                            template: "Represent this query for searching test code that exercises: {query}".into(),
+                            paths: vec![
+                                "**/test/**".into(),
+                                "**/tests/**".into(),
+                                "**/*test*".into(),
+                                "**/*spec*".into(),
+                            ],
+                            languages: vec![],
+                        },
+                    ),
+                    (
+                        "config".into(),
+                        IntentConfig {
+                            template: "Represent this query for searching code where this setting is configured or read: {query}".into(),
+                            paths: vec![],
+                            languages: vec![],
+                        },
+                    ),
+                    (
+                        "definition".into(),
+                        IntentConfig {
+                            template: "Represent this query for searching the definition of: {query}".into(),
+                            paths: vec![],
+                            languages: vec![],
+                        },
+                    ),
+                ]),
+            },
+            retrieval: RetrievalConfig {
+                rrf_k: 60.0,
+                content_weight: 1.0,
+                summary_weight: 1.0,
+            },
+            ranking: RankingConfig {
+                paths: BTreeMap::from([
+                    ("**/generated/**".into(), 0.5),
+                    ("**/migrations/**".into(), 0.7),
+                    ("examples/**".into(), 0.8),
+                ]),
+                recent: RecentConfig {
+                    max_boost: 1.5,
+                    half_life_hours: 24.0,
+                    commit_days: 7,
+                },
+                symbol_match: 1.5,
+                hot_boost: 1.5,
+            },
+            watch: WatchConfig {
+                backend: WatchBackend::Auto,
+                poll_interval_ms: 2000,
+                reconcile_interval_secs: 600,
+            },
+            highlight: HighlightConfig {
+                enabled: true,
+                window_lines: 3,
+                candidates: 8,
+                lexical_weight: 0.5,
             },
         }
     }
 }
 
+/// Instruction CodeRankEmbed expects in front of natural-language queries.
+pub const DEFAULT_QUERY_TEMPLATE: &str =
+    "Represent this query for searching relevant code: {query}";
+
 /// Returns the default global config path: ~/.maharajah/maharajah.toml
 pub fn global_config_path() -> PathBuf {
     dirs::home_dir()
@@ -116,9 +350,10 @@ pub fn global_config_path() -> PathBuf {
 }
 
 /// Returns the LanceDB directory path for a given target directory.
-/// The database lives at <target_dir>/.maharajah/db (a directory, not a file).
+/// The database lives at <target_dir>/.maharajah/db (a directory, not a file);
+/// linked git worktrees share the one of their main worktree.
 pub fn db_path(target_dir: &Path) -> PathBuf {
-    target_dir.join(".maharajah").join("db")
+    crate::db::overlay::index_root(target_dir).join(".maharajah").join("db")
 }
 
 /// Ensures the global config file exists, creating it with defaults on first launch.
@@ -140,6 +375,17 @@ const DEFAULT_GLOBAL_CONFIG: &str = r#"# maharajah global configuration
 
 [embed]
 model_id = "nomic-ai/CodeRankEmbed"   # ~550 MB, downloaded from HuggingFace Hub on first run
+# Context prepended to each chunk before embedding: "path", "language", "scope", "summary".
+# "path" embeds copies of a chunk in different files separately.
+# Run `mh index --reindex` after changing it.
+header = ["language", "scope", "summary"]
+
+[embed.preprocess]
+# Applied in order to chunk text before embedding; displayed content is unchanged.
+# Available: "strip_license", "drop_imports", "truncate_strings", "collapse_whitespace",
+# "split_identifiers". Run `mh index --reindex` after changing them.
+steps = []
+max_string_chars = 64
 
 [db]
 table_name = "chunks"
@@ -170,6 +416,61 @@ default_excludes = [
     "**/bin/Release/**",
     "**/obj/**",
 ]
+max_file_bytes = 1048576   # larger files are skipped
+max_batch_chunks = 64      # chunks embedded and held in memory at once
+
+# Query instruction per search mode; {query} is replaced with the prompt.
+[search.templates]
+find = "Represent this query for searching relevant code: {query}"
+query = "Represent this query for searching relevant code: {query}"
+
+# Named intents for `find --intent <name>`: a template plus default filters.
+[search.intents.tests]
+template = "Represent this query for searching test code that exercises: {query}"
+paths = ["**/test/**", "**/tests/**", "**/*test*", "**/*spec*"]
+
+[search.intents.config]
+template = "Represent this query for searching code where this setting is configured or read: {query}"
+
+[search.intents.definition]
+template = "Represent this query for searching the definition of: {query}"
+
+# Merge of content and summary rankings in `query` (tune with `mh tune`).
+[retrieval]
+rrf_k = 60.0            # rank constant; larger values flatten the gap between ranks
+content_weight = 1.0
+summary_weight = 1.0
+
+[ranking]
+# Multiplier for results defining a symbol named in the prompt (needs `mh import-scip`).
+symbol_match = 1.5
+# Multiplier for the hottest chunk under `--boost-hot` (needs `mh profile import`).
+hot_boost = 1.5
+
+# Score multipliers by path glob, applied after retrieval (>1 boosts, <1 penalises).
+[ranking.paths]
+"**/generated/**" = 0.5
+"**/migrations/**" = 0.7
+"examples/**" = 0.8
+
+# Working-set boost for `--boost-recent`: files you changed recently rank higher.
+[ranking.recent]
+max_boost = 1.5          # multiplier for a file touched just now
+half_life_hours = 24.0   # the boost halves every this many hours
+commit_days = 7          # how far back your own commits count
+
+# File watching in `mh server`.
+[watch]
+backend = "auto"               # "auto", "native" or "poll" (network filesystems)
+poll_interval_ms = 2000        # scan interval of the "poll" backend
+reconcile_interval_secs = 600  # full sweep for missed changes; 0 disables
+
+# Most relevant lines of each search result, shown instead of its first lines.
+[highlight]
+enabled = true
+window_lines = 3       # lines per highlighted window
+candidates = 8         # windows per result embedded after the lexical prefilter
+lexical_weight = 0.5   # weight of prompt-word overlap next to embedding similarity
 "#;
 
 /// Load configuration using figment's layered system:
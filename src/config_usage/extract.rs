@@ -0,0 +1,311 @@
+use std::path::Path;
+use std::sync::OnceLock;
+
+use tree_sitter::{Language, Parser, Query, QueryCursor, StreamingIterator};
+
+use crate::indexer::parser::grammar_for;
+use crate::routes::extract::{capture, unquote};
+
+#[cfg(test)]
+#[path = "extract_tests.rs"]
+mod extract_tests;
+
+/// What kind of setting a usage reads.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum UsageKind {
+    /// An environment variable. Keys ending in `*` are prefixes read as a
+    /// group (figment `Env::prefixed`)
+    Env,
+    /// A key of a configuration library: figment, viper, Spring, .NET
+    Config,
+}
+
+impl UsageKind {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            UsageKind::Env => "env",
+            UsageKind::Config => "config",
+        }
+    }
+}
+
+/// A literal configuration read found in a source file.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Usage {
+    pub kind: UsageKind,
+    pub key: String,
+    /// 0-based line of the read
+    pub line: u32,
+}
+
+/// Queries recognising configuration reads, per language. Captures:
+/// - `@usage`      — the read; its start line is reported (required)
+/// - `@key`        — string literal or identifier naming an environment variable
+/// - `@prefix`     — string literal naming an environment variable prefix
+/// - `@config_key` — string literal naming a configuration key; Spring
+///   `${placeholder:default}` expressions contribute each placeholder
+///
+/// Only literal keys are recorded: `env::var(name)` can't be resolved statically.
+const QUERIES: &[(&str, &str)] = &[
+    (
+        "rust",
+        r#"
+        ; std::env::var("KEY"), env::var_os("KEY")
+        (call_expression
+          function: (scoped_identifier
+            path: (_) @_env
+            name: (identifier) @_fn)
+          arguments: (arguments . (string_literal) @key)
+          (#match? @_env "(^|::)env$")
+          (#match? @_fn "^var(_os)?$")) @usage
+
+        ; env!("KEY"), option_env!("KEY")
+        (macro_invocation
+          macro: (identifier) @_macro
+          (token_tree . (string_literal) @key)
+          (#match? @_macro "^(option_)?env$")) @usage
+
+        ; #[arg(long, env = "KEY")]
+        (attribute
+          (identifier) @_attr
+          arguments: (token_tree (identifier) @_env . (string_literal) @key)
+          (#match? @_attr "^(arg|clap)$")
+          (#eq? @_env "env")) @usage
+
+        ; Env::prefixed("APP_")
+        (call_expression
+          function: (scoped_identifier path: (identifier) @_type name: (identifier) @_fn)
+          arguments: (arguments . (string_literal) @prefix)
+          (#eq? @_type "Env")
+          (#eq? @_fn "prefixed")) @usage
+
+        ; figment.extract_inner::<T>("key"), figment.find_value("key")
+        (call_expression
+          function: [
+            (field_expression field: (field_identifier) @_fn)
+            (generic_function function: (field_expression field: (field_identifier) @_fn))
+          ]
+          arguments: (arguments . (string_literal) @config_key)
+          (#match? @_fn "^(extract_inner|find_value)$")) @usage
+        "#,
+    ),
+    (
+        "python",
+        r#"
+        ; os.getenv("KEY"), os.environ.get("KEY")
+        (call
+          function: [(attribute) (identifier)] @_fn
+          arguments: (argument_list . (string) @key)
+          (#match? @_fn "^((os\\.)?getenv|(os\\.)?environ\\.get)$")) @usage
+
+        ; os.environ["KEY"]
+        (subscript
+          value: [(attribute) (identifier)] @_env
+          subscript: (string) @key
+          (#match? @_env "^(os\\.)?environ$")) @usage
+        "#,
+    ),
+    (
+        "javascript",
+        JS_QUERY,
+    ),
+    (
+        "typescript",
+        JS_QUERY,
+    ),
+    (
+        "tsx",
+        JS_QUERY,
+    ),
+    (
+        "java",
+        r#"
+        ; System.getenv("KEY")
+        (method_invocation
+          object: (identifier) @_system
+          name: (identifier) @_fn
+          arguments: (argument_list . (string_literal) @key)
+          (#eq? @_system "System")
+          (#eq? @_fn "getenv")) @usage
+
+        ; System.getProperty("key"), environment.getProperty("key")
+        (method_invocation
+          name: (identifier) @_fn
+          arguments: (argument_list . (string_literal) @config_key)
+          (#eq? @_fn "getProperty")) @usage
+
+        ; @Value("${key:default}")
+        (annotation
+          name: (identifier) @_value
+          arguments: (annotation_argument_list . (string_literal) @config_key)
+          (#eq? @_value "Value")) @usage
+        "#,
+    ),
+    (
+        "csharp",
+        r#"
+        ; Environment.GetEnvironmentVariable("KEY")
+        (invocation_expression
+          function: (member_access_expression name: (identifier) @_fn)
+          arguments: (argument_list . (argument (string_literal) @key))
+          (#eq? @_fn "GetEnvironmentVariable")) @usage
+
+        ; configuration.GetValue<T>("Key"), GetSection("Key"), GetConnectionString("Key")
+        (invocation_expression
+          function: (member_access_expression name: (_) @_fn)
+          arguments: (argument_list . (argument (string_literal) @config_key))
+          (#match? @_fn "^(GetValue|GetSection|GetConnectionString)")) @usage
+
+        ; configuration["Section:Key"]
+        (element_access_expression
+          expression: (_) @_config
+          subscript: (bracketed_argument_list . (argument (string_literal) @config_key))
+          (#match? @_config "[Cc]onfig")) @usage
+        "#,
+    ),
+    (
+        "go",
+        r#"
+        ; os.Getenv("KEY"), os.LookupEnv("KEY")
+        (call_expression
+          function: (selector_expression operand: (identifier) @_os field: (field_identifier) @_fn)
+          arguments: (argument_list . (interpreted_string_literal) @key)
+          (#eq? @_os "os")
+          (#match? @_fn "^(Getenv|LookupEnv)$")) @usage
+
+        ; viper.GetString("key"), viper.IsSet("key")
+        (call_expression
+          function: (selector_expression operand: (identifier) @_viper field: (field_identifier) @_fn)
+          arguments: (argument_list . (interpreted_string_literal) @config_key)
+          (#eq? @_viper "viper")
+          (#match? @_fn "^(Get[A-Za-z0-9]*|IsSet|SetDefault|BindEnv)$")) @usage
+        "#,
+    ),
+    (
+        "ruby",
+        r#"
+        ; ENV["KEY"]
+        (element_reference
+          object: (constant) @_env
+          (string) @key
+          (#eq? @_env "ENV")) @usage
+
+        ; ENV.fetch("KEY")
+        (call
+          receiver: (constant) @_env
+          method: (identifier) @_fn
+          arguments: (argument_list . (string) @key)
+          (#eq? @_env "ENV")
+          (#eq? @_fn "fetch")) @usage
+        "#,
+    ),
+];
+
+const JS_QUERY: &str = r#"
+    ; process.env.KEY
+    (member_expression
+      object: (member_expression
+        object: (identifier) @_process
+        property: (property_identifier) @_env)
+      property: (property_identifier) @key
+      (#eq? @_process "process")
+      (#eq? @_env "env")) @usage
+
+    ; process.env["KEY"]
+    (subscript_expression
+      object: (member_expression
+        object: (identifier) @_process
+        property: (property_identifier) @_env)
+      index: (string) @key
+      (#eq? @_process "process")
+      (#eq? @_env "env")) @usage
+
+    ; const { KEY } = process.env
+    (variable_declarator
+      name: (object_pattern (shorthand_property_identifier_pattern) @key)
+      value: (member_expression
+        object: (identifier) @_process
+        property: (property_identifier) @_env)
+      (#eq? @_process "process")
+      (#eq? @_env "env")) @usage
+"#;
+
+/// `QUERIES` compiled on first use, by position. Compiling a query costs far
+/// more than running it over one file, and indexing runs it over every file.
+static COMPILED: [OnceLock<Option<Query>>; QUERIES.len()] =
+    [const { OnceLock::new() }; QUERIES.len()];
+
+/// The compiled query for a language, or `None` when it has none or its query
+/// doesn't compile against the grammar (reported once).
+fn compiled_query(language: &Language, lang_name: &str) -> Option<&'static Query> {
+    let i = QUERIES.iter().position(|(lang, _)| *lang == lang_name)?;
+    COMPILED[i]
+        .get_or_init(|| match Query::new(language, QUERIES[i].1) {
+            Ok(q) => Some(q),
+            Err(e) => {
+                tracing::warn!("config usage query for {lang_name} is invalid: {e}");
+                None
+            }
+        })
+        .as_ref()
+}
+
+/// Extract the literal environment and configuration reads in a file, in
+/// source order. Returns an empty list for unsupported languages.
+#[tracing::instrument(skip_all, fields(path = %path.display()))]
+pub fn extract_usages(path: &Path, content: &str) -> Vec<Usage> {
+    let Some((language, lang_name, _)) = grammar_for(path) else {
+        return vec![];
+    };
+    let Some(query) = compiled_query(&language, lang_name) else {
+        return vec![];
+    };
+
+    let mut parser = Parser::new();
+    if parser.set_language(&language).is_err() {
+        return vec![];
+    }
+    let Some(tree) = parser.parse(content, None) else {
+        return vec![];
+    };
+
+    let mut usages = Vec::new();
+    let mut cursor = QueryCursor::new();
+    let mut matches = cursor.matches(query, tree.root_node(), content.as_bytes());
+    while let Some(m) = matches.next() {
+        let Some(usage) = capture(query, m, "usage") else {
+            continue;
+        };
+        let line = usage.start_position().row as u32;
+        let text = |name| capture(query, m, name).map(|n| unquote(&content[n.byte_range()]));
+
+        if let Some(key) = text("key") {
+            usages.push(Usage { kind: UsageKind::Env, key, line });
+        } else if let Some(prefix) = text("prefix") {
+            usages.push(Usage { kind: UsageKind::Env, key: format!("{prefix}*"), line });
+        } else if let Some(key) = text("config_key") {
+            for key in placeholder_keys(&key) {
+                usages.push(Usage { kind: UsageKind::Config, key, line });
+            }
+        }
+    }
+
+    usages.retain(|u| !u.key.is_empty() && u.key != "*");
+    usages.sort_by(|a, b| (a.line, &a.key).cmp(&(b.line, &b.key)));
+    usages.dedup();
+    usages
+}
+
+/// Keys referenced by a configuration string: each `${key:default}`
+/// placeholder's key, or the whole string when it has none.
+fn placeholder_keys(value: &str) -> Vec<String> {
+    if !value.contains("${") {
+        return vec![value.to_string()];
+    }
+    value
+        .split("${")
+        .skip(1)
+        .filter_map(|rest| rest.split_once('}'))
+        .map(|(inner, _)| inner.split(':').next().unwrap_or("").trim().to_string())
+        .collect()
+}
@@ -0,0 +1,100 @@
+/// Config usage extractor tests: literal environment and configuration reads
+/// are recognised per language, dynamic keys are ignored.
+
+#[cfg(test)]
+mod extract_tests {
+    use crate::config_usage::extract::{UsageKind, extract_usages};
+    use std::path::Path;
+
+    fn usages(file: &str, content: &str) -> Vec<(&'static str, String, u32)> {
+        extract_usages(Path::new(file), content)
+            .into_iter()
+            .map(|u| (u.kind.as_str(), u.key, u.line))
+            .collect()
+    }
+
+    #[test]
+    fn rust_env_reads_clap_env_args_and_figment_prefixes() {
+        let content = r#"
+#[derive(Parser)]
+struct Cli {
+    #[arg(short, long, env = "MAHARAJAH_CONFIG")]
+    config: Option<PathBuf>,
+}
+
+fn load() {
+    let home = std::env::var("HOME").unwrap();
+    let name = std::env::var(key);
+    let figment = Figment::new().merge(Env::prefixed("MAHARAJAH_").split("__"));
+}
+"#;
+        assert_eq!(
+            usages("config.rs", content),
+            vec![
+                ("env", "MAHARAJAH_CONFIG".to_string(), 3),
+                ("env", "HOME".to_string(), 8),
+                ("env", "MAHARAJAH_*".to_string(), 10),
+            ]
+        );
+    }
+
+    #[test]
+    fn python_getenv_and_environ() {
+        let content = r#"
+import os
+debug = os.getenv("DEBUG", "0")
+url = os.environ["DATABASE_URL"]
+"#;
+        assert_eq!(
+            usages("settings.py", content),
+            vec![("env", "DEBUG".to_string(), 2), ("env", "DATABASE_URL".to_string(), 3)]
+        );
+    }
+
+    #[test]
+    fn javascript_process_env_forms() {
+        let content = r#"
+const port = process.env.PORT;
+const host = process.env["HOST"];
+const { API_KEY } = process.env;
+"#;
+        let found = extract_usages(Path::new("server.js"), content);
+        assert!(found.iter().all(|u| u.kind == UsageKind::Env));
+        assert_eq!(
+            found.iter().map(|u| u.key.as_str()).collect::<Vec<_>>(),
+            vec!["PORT", "HOST", "API_KEY"]
+        );
+    }
+
+    #[test]
+    fn java_getenv_and_spring_value_placeholders() {
+        let content = r#"
+public class Settings {
+    @Value("${server.port:8080}")
+    private int port;
+
+    String token() { return System.getenv("TOKEN"); }
+}
+"#;
+        assert_eq!(
+            usages("Settings.java", content),
+            vec![("config", "server.port".to_string(), 2), ("env", "TOKEN".to_string(), 5)]
+        );
+    }
+
+    #[test]
+    fn go_os_getenv_and_viper_keys() {
+        let content = r#"
+package main
+
+func main() {
+	addr := os.Getenv("ADDR")
+	level := viper.GetString("log.level")
+}
+"#;
+        assert_eq!(
+            usages("main.go", content),
+            vec![("env", "ADDR".to_string(), 4), ("config", "log.level".to_string(), 5)]
+        );
+    }
+}
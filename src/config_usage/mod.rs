@@ -0,0 +1,159 @@
+pub mod extract;
+
+use std::collections::{BTreeMap, HashMap};
+use std::path::Path;
+
+use serde::Serialize;
+
+use crate::cli::{ConfigUsageArgs, OutputFormat};
+use crate::config::AppConfig;
+use crate::db::config_usages::ConfigUsageRecord;
+use crate::db::overlay;
+use crate::db::store::{LocationRecord, Store};
+use crate::error::{AppError, Result};
+
+#[derive(Serialize)]
+struct JsonKey<'a> {
+    kind: &'a str,
+    key: &'a str,
+    usages: usize,
+}
+
+#[derive(Serialize)]
+struct JsonUsage<'a> {
+    kind: &'a str,
+    key: &'a str,
+    file_path: &'a str,
+    line: u32,
+    /// Symbol of the innermost indexed chunk containing the read
+    symbol: Option<&'a str>,
+}
+
+/// List where a setting is read, or every setting read in the index when no
+/// key is given.
+pub async fn config_usage_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: ConfigUsageArgs,
+) -> Result<()> {
+    let overlay = overlay::current(target_dir);
+    let Some(store) =
+        Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay).await?
+    else {
+        println!("No index found. Run `index` first.");
+        return Ok(());
+    };
+
+    let mut usages = store.config_usages().all().await?;
+    let Some(wanted) = args.key else {
+        return list_keys(&usages, args.format);
+    };
+    usages.retain(|u| key_matches(&u.kind, &u.key, &wanted));
+    usages.sort_by(|a, b| (&a.file_path, a.line, &a.key).cmp(&(&b.file_path, b.line, &b.key)));
+    let symbols = enclosing_symbols(&store, &usages).await?;
+
+    match args.format {
+        OutputFormat::Text => {
+            if usages.is_empty() {
+                println!("No reads of '{wanted}' found.");
+            }
+            for (u, symbol) in usages.iter().zip(&symbols) {
+                let mut line = format!("{}:{}", u.file_path, u.line + 1);
+                if let Some(symbol) = symbol {
+                    line.push_str(&format!("  {symbol}"));
+                }
+                if u.key != wanted {
+                    line.push_str(&format!("  ({} {})", u.kind, u.key));
+                }
+                println!("{line}");
+            }
+        }
+        OutputFormat::Json => {
+            let json: Vec<JsonUsage> = usages
+                .iter()
+                .zip(&symbols)
+                .map(|(u, symbol)| JsonUsage {
+                    kind: &u.kind,
+                    key: &u.key,
+                    file_path: &u.file_path,
+                    line: u.line,
+                    symbol: symbol.as_deref(),
+                })
+                .collect();
+            println!(
+                "{}",
+                serde_json::to_string_pretty(&json).map_err(|e| AppError::Other(e.into()))?
+            );
+        }
+    }
+    Ok(())
+}
+
+/// Every distinct setting with the number of places it is read.
+fn list_keys(usages: &[ConfigUsageRecord], format: OutputFormat) -> Result<()> {
+    let mut counts: BTreeMap<(&str, &str), usize> = BTreeMap::new();
+    for u in usages {
+        *counts.entry((u.key.as_str(), u.kind.as_str())).or_default() += 1;
+    }
+
+    match format {
+        OutputFormat::Text => {
+            if counts.is_empty() {
+                println!("No configuration reads found.");
+            }
+            for ((key, kind), count) in &counts {
+                println!("{kind:<6} {key}  ({count})");
+            }
+        }
+        OutputFormat::Json => {
+            let json: Vec<JsonKey> = counts
+                .iter()
+                .map(|(&(key, kind), &usages)| JsonKey { kind, key, usages })
+                .collect();
+            println!(
+                "{}",
+                serde_json::to_string_pretty(&json).map_err(|e| AppError::Other(e.into()))?
+            );
+        }
+    }
+    Ok(())
+}
+
+/// Symbol of the innermost chunk containing each usage.
+async fn enclosing_symbols(
+    store: &Store,
+    usages: &[ConfigUsageRecord],
+) -> Result<Vec<Option<String>>> {
+    let mut by_file: HashMap<String, Vec<LocationRecord>> = HashMap::new();
+    let mut symbols = Vec::with_capacity(usages.len());
+    for u in usages {
+        if !by_file.contains_key(&u.file_path) {
+            let locations = store.file_locations(&u.file_path).await?;
+            by_file.insert(u.file_path.clone(), locations);
+        }
+        let symbol = by_file[&u.file_path]
+            .iter()
+            .filter(|l| l.start_line <= u.line && u.line <= l.end_line)
+            .min_by_key(|l| l.end_line - l.start_line)
+            .map(|l| l.symbol.clone());
+        symbols.push(symbol);
+    }
+    Ok(symbols)
+}
+
+/// Whether a recorded read satisfies a lookup. Besides exact matches, an
+/// environment prefix (`APP_*`) matches the variables it covers, reading a
+/// config section (`server`) counts as reading the keys below it
+/// (`server.port`), and `*` matches any environment variable.
+pub fn key_matches(kind: &str, key: &str, wanted: &str) -> bool {
+    if key == wanted {
+        return true;
+    }
+    if kind == "env" {
+        return wanted == "*" || key.strip_suffix('*').is_some_and(|p| wanted.starts_with(p));
+    }
+    wanted
+        .strip_prefix(key)
+        .is_some_and(|rest| rest.starts_with('.') || rest.starts_with(':'))
+}
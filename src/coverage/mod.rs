@@ -0,0 +1,107 @@
+pub mod report;
+
+use std::collections::{BTreeMap, HashSet};
+use std::path::Path;
+
+use crate::cli::{CoverageAction, CoverageArgs};
+use crate::config::AppConfig;
+use crate::db::coverage::{CoverageRecord, CoverageTable};
+use crate::db::overlay;
+use crate::db::store::{self, Store};
+use crate::error::{AppError, Result};
+
+pub async fn coverage_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: CoverageArgs,
+) -> Result<()> {
+    match args.action {
+        CoverageAction::Import { path } => import(config, db_path, target_dir, &path).await,
+    }
+}
+
+/// Replace the per-chunk coverage with that of a coverage report.
+async fn import(config: &AppConfig, db_path: &Path, target_dir: &Path, path: &Path) -> Result<()> {
+    let text = std::fs::read_to_string(path).map_err(|e| {
+        AppError::Other(anyhow::anyhow!("cannot read {}: {e}", path.display()))
+    })?;
+    let (report, format) = report::parse(&text)
+        .map_err(|e| AppError::Other(anyhow::anyhow!("{}: {e}", path.display())))?;
+
+    let overlay = overlay::current(target_dir);
+    let store = Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay)
+        .await?
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("No index found. Run `index` first.")))?;
+    let indexed = store.list_files().await?;
+
+    let mut files: BTreeMap<String, &BTreeMap<u32, bool>> = BTreeMap::new();
+    let mut unmatched = 0usize;
+    for (reported, lines) in &report.files {
+        match index_path(reported, target_dir, &indexed) {
+            Some(file) => {
+                files.insert(file, lines);
+            }
+            None => unmatched += 1,
+        }
+    }
+
+    let names: Vec<String> = files.keys().cloned().collect();
+    let mut records = Vec::new();
+    for location in store.locations_in_files(&names).await? {
+        let lines = files[&location.file_path].range(location.start_line..=location.end_line);
+        let (covered, coverable) =
+            lines.fold((0u32, 0u32), |(c, n), (_, &executed)| (c + executed as u32, n + 1));
+        // Chunks without instrumented lines (type declarations, comments) have no coverage
+        if coverable > 0 {
+            records.push(CoverageRecord {
+                id: location.id,
+                content_hash: location.content_hash,
+                file_path: location.file_path,
+                covered_lines: covered,
+                coverable_lines: coverable,
+            });
+        }
+    }
+
+    let conn = store::connect(db_path).await?;
+    CoverageTable::replace(&conn, &config.db.table_name, &records).await?;
+
+    let uncovered = records.iter().filter(|r| r.covered_lines == 0).count();
+    println!(
+        "Imported {format} coverage of {} file(s): {} chunk(s) with coverable lines, {uncovered} never executed.",
+        files.len(),
+        records.len()
+    );
+    if unmatched > 0 {
+        println!("{unmatched} file(s) in the report are not in the index and were skipped.");
+    }
+    Ok(())
+}
+
+/// The indexed file a report names. Reports may use absolute paths, or paths
+/// relative to another directory (a CI checkout, a package's source root);
+/// those match the one indexed file they share their trailing components with.
+pub(crate) fn index_path(reported: &str, target_dir: &Path, indexed: &HashSet<String>) -> Option<String> {
+    let reported = reported.replace('\\', "/");
+    let root = format!("{}/", target_dir.to_string_lossy().replace('\\', "/"));
+    let reported = reported.strip_prefix(&root).unwrap_or(&reported);
+    let reported = reported.trim_start_matches("./");
+    if indexed.contains(reported) {
+        return Some(reported.to_string());
+    }
+    let mut candidates = indexed
+        .iter()
+        .filter(|f| ends_with_path(reported, f) || ends_with_path(f, reported));
+    match (candidates.next(), candidates.next()) {
+        (Some(file), None) => Some(file.clone()),
+        _ => None,
+    }
+}
+
+/// Whether `path` ends with the whole components of `suffix`.
+fn ends_with_path(path: &str, suffix: &str) -> bool {
+    path.len() > suffix.len()
+        && path.ends_with(suffix)
+        && path.as_bytes()[path.len() - suffix.len() - 1] == b'/'
+}
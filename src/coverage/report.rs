@@ -0,0 +1,169 @@
+use std::collections::BTreeMap;
+
+use serde_json::Value;
+
+use crate::error::{AppError, Result};
+
+#[cfg(test)]
+#[path = "report_tests.rs"]
+mod report_tests;
+
+/// Line coverage read from a report: per file, as the report names it, the
+/// instrumented lines (0-based) and whether any test executed them.
+#[derive(Default)]
+pub struct Report {
+    pub files: BTreeMap<String, BTreeMap<u32, bool>>,
+}
+
+impl Report {
+    /// Record a 1-based line. Files listed more than once (lcov written by
+    /// several test binaries, Cobertura methods repeating their class's lines)
+    /// count a line as executed if any record does.
+    fn record(&mut self, file: &str, line: u32, executed: bool) {
+        let Some(line) = line.checked_sub(1) else {
+            return;
+        };
+        *self.files.entry(file.to_string()).or_default().entry(line).or_default() |= executed;
+    }
+}
+
+/// Parse an lcov tracefile, Cobertura XML or coverage JSON (coverage.py's
+/// `coverage json`, Istanbul's `coverage-final.json`), telling them apart by
+/// content. Returns the report and the name of its format.
+pub fn parse(text: &str) -> Result<(Report, &'static str)> {
+    let parsed = match text.trim_start().chars().next() {
+        Some('<') => (parse_cobertura(text), "Cobertura"),
+        Some('{') => parse_json(text)?,
+        _ => (parse_lcov(text), "lcov"),
+    };
+    if parsed.0.files.is_empty() {
+        return Err(AppError::Other(anyhow::anyhow!(
+            "no line coverage found (read as {})",
+            parsed.1
+        )));
+    }
+    Ok(parsed)
+}
+
+/// `SF:<path>` starts a file's record, `DA:<line>,<hits>[,<checksum>]` gives a
+/// line's execution count.
+fn parse_lcov(text: &str) -> Report {
+    let mut report = Report::default();
+    let mut file: Option<&str> = None;
+    for line in text.lines().map(str::trim) {
+        if let Some(path) = line.strip_prefix("SF:") {
+            file = Some(path);
+        } else if line == "end_of_record" {
+            file = None;
+        } else if let (Some(file), Some(data)) = (file, line.strip_prefix("DA:")) {
+            let mut fields = data.split(',');
+            let number = fields.next().and_then(|n| n.trim().parse().ok());
+            let hits = fields.next().and_then(|h| h.trim().parse::<f64>().ok());
+            if let (Some(number), Some(hits)) = (number, hits) {
+                report.record(file, number, hits > 0.0);
+            }
+        }
+    }
+    report
+}
+
+/// `<line number=".." hits=".."/>` elements under `<class filename="..">`.
+fn parse_cobertura(text: &str) -> Report {
+    let mut report = Report::default();
+    let mut file: Option<String> = None;
+    let mut rest = text;
+    while let Some(start) = rest.find('<') {
+        let Some(len) = rest[start..].find('>') else {
+            break;
+        };
+        let tag = &rest[start + 1..start + len];
+        rest = &rest[start + len + 1..];
+        let name = tag.split(|c: char| c.is_whitespace() || c == '/').next().unwrap_or("");
+        match name {
+            "class" => file = xml_attribute(tag, "filename"),
+            "/class" => file = None,
+            "line" => {
+                let number = xml_attribute(tag, "number").and_then(|n| n.parse().ok());
+                let hits = xml_attribute(tag, "hits").and_then(|h| h.parse::<f64>().ok());
+                if let (Some(file), Some(number), Some(hits)) = (&file, number, hits) {
+                    report.record(file, number, hits > 0.0);
+                }
+            }
+            _ => {}
+        }
+    }
+    report
+}
+
+/// Value of attribute `name` in the text of an XML start tag, unescaped.
+fn xml_attribute(tag: &str, name: &str) -> Option<String> {
+    let mut rest = tag;
+    while let Some(at) = rest.find(name) {
+        let before = rest[..at].chars().next_back();
+        let after = rest[at + name.len()..].trim_start();
+        rest = &rest[at + name.len()..];
+        if !before.is_some_and(char::is_whitespace) {
+            continue;
+        }
+        let Some(value) = after.strip_prefix('=').map(str::trim_start) else {
+            continue;
+        };
+        let quote = value.chars().next().filter(|q| matches!(q, '"' | '\''))?;
+        let value = &value[1..];
+        let end = value.find(quote)?;
+        return Some(
+            value[..end]
+                .replace("&lt;", "<")
+                .replace("&gt;", ">")
+                .replace("&quot;", "\"")
+                .replace("&apos;", "'")
+                .replace("&amp;", "&"),
+        );
+    }
+    None
+}
+
+/// coverage.py lists `executed_lines` and `missing_lines` per file under
+/// `files`; Istanbul maps each file to a `statementMap` and statement hit
+/// counts `s`, of which the start lines are used, as `lcov` output does.
+fn parse_json(text: &str) -> Result<(Report, &'static str)> {
+    let json: Value = serde_json::from_str(text)
+        .map_err(|e| AppError::Other(anyhow::anyhow!("invalid coverage JSON: {e}")))?;
+    let mut report = Report::default();
+
+    if let Some(files) = json.get("files").and_then(Value::as_object) {
+        for (path, file) in files {
+            for (key, executed) in [("executed_lines", true), ("missing_lines", false)] {
+                let lines = file.get(key).and_then(Value::as_array).map_or(&[][..], Vec::as_slice);
+                for line in lines.iter().filter_map(Value::as_u64) {
+                    report.record(path, line as u32, executed);
+                }
+            }
+        }
+        return Ok((report, "coverage.py JSON"));
+    }
+
+    let Some(files) = json.as_object().filter(|o| o.values().any(|f| f.get("statementMap").is_some()))
+    else {
+        return Err(AppError::Other(anyhow::anyhow!(
+            "unrecognised coverage JSON: expected coverage.py's `coverage json` or Istanbul's coverage-final.json"
+        )));
+    };
+    for (key, file) in files {
+        let path = file.get("path").and_then(Value::as_str).unwrap_or(key);
+        let (Some(statements), Some(hits)) = (
+            file.get("statementMap").and_then(Value::as_object),
+            file.get("s").and_then(Value::as_object),
+        ) else {
+            continue;
+        };
+        for (id, statement) in statements {
+            let line = statement.pointer("/start/line").and_then(Value::as_u64);
+            let hits = hits.get(id).and_then(Value::as_u64);
+            if let (Some(line), Some(hits)) = (line, hits) {
+                report.record(path, line as u32, hits > 0);
+            }
+        }
+    }
+    Ok((report, "Istanbul JSON"))
+}
@@ -0,0 +1,83 @@
+/// Coverage report parsing: each format yields the instrumented lines of each
+/// file, 0-based, and whether they were executed.
+
+#[cfg(test)]
+mod report_tests {
+    use crate::coverage::report::parse;
+
+    fn lines(report: &crate::coverage::report::Report, file: &str) -> Vec<(u32, bool)> {
+        report.files[file].iter().map(|(&l, &e)| (l, e)).collect()
+    }
+
+    #[test]
+    fn lcov_records_are_merged_per_file() {
+        let text = concat!(
+            "TN:\n",
+            "SF:src/pay.rs\n",
+            "DA:1,3\n",
+            "DA:2,0\n",
+            "DA:4,0,abc123\n",
+            "end_of_record\n",
+            "SF:src/pay.rs\n",
+            "DA:2,1\n",
+            "end_of_record\n",
+        );
+        let (report, format) = parse(text).unwrap();
+        assert_eq!(format, "lcov");
+        assert_eq!(lines(&report, "src/pay.rs"), vec![(0, true), (1, true), (3, false)]);
+    }
+
+    #[test]
+    fn cobertura_lines_belong_to_their_class_file() {
+        let text = concat!(
+            "<?xml version=\"1.0\" ?>\n",
+            "<coverage line-rate=\"0.5\">\n",
+            "  <packages><package name=\"pay\"><classes>\n",
+            "    <class name=\"retry.py\" filename=\"pay/retry.py\" line-rate=\"0.5\">\n",
+            "      <methods/>\n",
+            "      <lines>\n",
+            "        <line number=\"3\" hits=\"2\"/>\n",
+            "        <line number=\"5\" hits=\"0\" branch=\"true\"/>\n",
+            "      </lines>\n",
+            "    </class>\n",
+            "    <class name=\"a&amp;b.py\" filename='pay/a&amp;b.py'>\n",
+            "      <lines><line hits=\"1\" number=\"1\"/></lines>\n",
+            "    </class>\n",
+            "  </classes></package></packages>\n",
+            "</coverage>\n",
+        );
+        let (report, format) = parse(text).unwrap();
+        assert_eq!(format, "Cobertura");
+        assert_eq!(lines(&report, "pay/retry.py"), vec![(2, true), (4, false)]);
+        assert_eq!(lines(&report, "pay/a&b.py"), vec![(0, true)]);
+    }
+
+    #[test]
+    fn coverage_py_json_lists_executed_and_missing_lines() {
+        let text = r#"{"meta": {"version": "7.4"}, "files": {"pay/retry.py": {"executed_lines": [1, 2], "missing_lines": [4], "excluded_lines": [9]}}}"#;
+        let (report, format) = parse(text).unwrap();
+        assert_eq!(format, "coverage.py JSON");
+        assert_eq!(lines(&report, "pay/retry.py"), vec![(0, true), (1, true), (3, false)]);
+    }
+
+    #[test]
+    fn istanbul_json_uses_statement_start_lines() {
+        let text = r#"{"/ci/app/src/retry.js": {
+            "path": "/ci/app/src/retry.js",
+            "statementMap": {
+                "0": {"start": {"line": 1, "column": 0}, "end": {"line": 3, "column": 1}},
+                "1": {"start": {"line": 2, "column": 2}, "end": {"line": 2, "column": 9}}
+            },
+            "s": {"0": 1, "1": 0}
+        }}"#;
+        let (report, format) = parse(text).unwrap();
+        assert_eq!(format, "Istanbul JSON");
+        assert_eq!(lines(&report, "/ci/app/src/retry.js"), vec![(0, true), (1, false)]);
+    }
+
+    #[test]
+    fn unrecognised_reports_are_errors() {
+        assert!(parse("{\"foo\": 1}").is_err());
+        assert!(parse("not a report\n").is_err());
+    }
+}
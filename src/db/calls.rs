@@ -0,0 +1,161 @@
+use std::sync::Arc;
+
+use arrow_array::{
+    RecordBatch, RecordBatchIterator,
+    builder::{StringBuilder, UInt32Builder},
+};
+use arrow_schema::{ArrowError, SchemaRef};
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::calls_schema;
+use crate::db::store::{
+    ensure_overlay_column, get_str_col, get_u32_col, open_or_create_table, overlay_filter,
+};
+use crate::error::{AppError, Result};
+
+/// A call inside a definition, or the definition itself when `callee` is
+/// empty, so that definitions making no calls are still known.
+pub struct CallRecord {
+    pub file_path: String,
+    pub language: String,
+    /// Definition making the call, qualified by its enclosing definitions
+    pub caller: String,
+    pub caller_line: u32,
+    pub caller_end_line: u32,
+    /// Called name; empty for the definition's own row
+    pub callee: String,
+    /// Path before the called name when written as one (`Store` in
+    /// `Store::open`), otherwise empty
+    pub qualifier: String,
+    pub line: u32,
+}
+
+pub(super) fn calls_table_name(table_name: &str) -> String {
+    format!("{table_name}_calls")
+}
+
+/// Calls extracted at index time. Called names are resolved to definitions
+/// when a path is searched, so that definitions added later are picked up
+/// without re-indexing their callers.
+pub struct CallTable {
+    table: lancedb::Table,
+    overlay: String,
+}
+
+impl CallTable {
+    pub async fn open_or_create(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        overlay: &str,
+    ) -> Result<Self> {
+        let table =
+            open_or_create_table(conn, &calls_table_name(table_name), calls_schema()).await?;
+        ensure_overlay_column(&table, overlay).await?;
+        Ok(Self { table, overlay: overlay.to_string() })
+    }
+
+    #[tracing::instrument(skip_all, fields(calls = calls.len()))]
+    pub async fn add(&self, calls: &[CallRecord]) -> Result<()> {
+        if calls.is_empty() {
+            return Ok(());
+        }
+        let schema = calls_schema();
+        let batch = calls_batch(calls, &self.overlay, schema.clone())?;
+        let reader = RecordBatchIterator::new(
+            vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
+            schema,
+        );
+        self.table.add(reader).execute().await?;
+        Ok(())
+    }
+
+    pub async fn delete_file(&self, file_path: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(&self.overlay));
+        self.table.delete(&filter).await?;
+        Ok(())
+    }
+
+    /// Copy another overlay's rows for `file_path` into this one.
+    pub async fn copy_file(&self, file_path: &str, from_overlay: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(from_overlay));
+        self.add(&self.select(&filter).await?).await
+    }
+
+    pub async fn drop_overlay(&self, overlay: &str) -> Result<()> {
+        self.table.delete(&overlay_filter(overlay)).await?;
+        Ok(())
+    }
+
+    pub async fn clear(&self) -> Result<()> {
+        self.table.delete("1 = 1").await?;
+        Ok(())
+    }
+
+    /// The current overlay's rows.
+    pub async fn all(&self) -> Result<Vec<CallRecord>> {
+        self.select(&overlay_filter(&self.overlay)).await
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<CallRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut calls = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                calls.push(CallRecord {
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    language: get_str_col(&batch, "language", i)?,
+                    caller: get_str_col(&batch, "caller", i)?,
+                    caller_line: get_u32_col(&batch, "caller_line", i)?,
+                    caller_end_line: get_u32_col(&batch, "caller_end_line", i)?,
+                    callee: get_str_col(&batch, "callee", i)?,
+                    qualifier: get_str_col(&batch, "qualifier", i)?,
+                    line: get_u32_col(&batch, "line", i)?,
+                });
+            }
+        }
+        Ok(calls)
+    }
+}
+
+fn calls_batch(calls: &[CallRecord], overlay: &str, schema: SchemaRef) -> Result<RecordBatch> {
+    let mut file_path_builder = StringBuilder::new();
+    let mut language_builder = StringBuilder::new();
+    let mut caller_builder = StringBuilder::new();
+    let mut caller_line_builder = UInt32Builder::new();
+    let mut caller_end_line_builder = UInt32Builder::new();
+    let mut callee_builder = StringBuilder::new();
+    let mut qualifier_builder = StringBuilder::new();
+    let mut line_builder = UInt32Builder::new();
+    let mut overlay_builder = StringBuilder::new();
+
+    for c in calls {
+        file_path_builder.append_value(&c.file_path);
+        language_builder.append_value(&c.language);
+        caller_builder.append_value(&c.caller);
+        caller_line_builder.append_value(c.caller_line);
+        caller_end_line_builder.append_value(c.caller_end_line);
+        callee_builder.append_value(&c.callee);
+        qualifier_builder.append_value(&c.qualifier);
+        line_builder.append_value(c.line);
+        overlay_builder.append_value(overlay);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(file_path_builder.finish()),
+            Arc::new(language_builder.finish()),
+            Arc::new(caller_builder.finish()),
+            Arc::new(caller_line_builder.finish()),
+            Arc::new(caller_end_line_builder.finish()),
+            Arc::new(callee_builder.finish()),
+            Arc::new(qualifier_builder.finish()),
+            Arc::new(line_builder.finish()),
+            Arc::new(overlay_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
@@ -0,0 +1,150 @@
+use std::sync::Arc;
+
+use arrow_array::{
+    RecordBatch, RecordBatchIterator,
+    builder::{StringBuilder, UInt32Builder},
+};
+use arrow_schema::{ArrowError, SchemaRef};
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::config_usages_schema;
+use crate::db::store::{
+    ensure_overlay_column, get_nullable_str_col, get_str_col, get_u32_col, open_or_create_table,
+    overlay_filter,
+};
+use crate::error::{AppError, Result};
+
+/// One read of an environment variable or configuration key.
+pub struct ConfigUsageRecord {
+    pub file_path: String,
+    pub kind: String,
+    pub key: String,
+    pub line: u32,
+    /// Content hash of the enclosing chunk, if any
+    pub content_hash: Option<String>,
+}
+
+pub(super) fn config_usages_table_name(table_name: &str) -> String {
+    format!("{table_name}_config_usages")
+}
+
+/// Configuration reads extracted at index time; like routes, a file's rows
+/// are replaced whenever it is re-indexed.
+pub struct ConfigUsageTable {
+    table: lancedb::Table,
+    overlay: String,
+}
+
+impl ConfigUsageTable {
+    pub async fn open_or_create(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        overlay: &str,
+    ) -> Result<Self> {
+        let table = open_or_create_table(
+            conn,
+            &config_usages_table_name(table_name),
+            config_usages_schema(),
+        )
+        .await?;
+        ensure_overlay_column(&table, overlay).await?;
+        Ok(Self { table, overlay: overlay.to_string() })
+    }
+
+    #[tracing::instrument(skip_all, fields(usages = usages.len()))]
+    pub async fn add(&self, usages: &[ConfigUsageRecord]) -> Result<()> {
+        if usages.is_empty() {
+            return Ok(());
+        }
+        let schema = config_usages_schema();
+        let batch = config_usages_batch(usages, &self.overlay, schema.clone())?;
+        let reader = RecordBatchIterator::new(
+            vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
+            schema,
+        );
+        self.table.add(reader).execute().await?;
+        Ok(())
+    }
+
+    pub async fn delete_file(&self, file_path: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(&self.overlay));
+        self.table.delete(&filter).await?;
+        Ok(())
+    }
+
+    /// Copy another overlay's rows for `file_path` into this one.
+    pub async fn copy_file(&self, file_path: &str, from_overlay: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(from_overlay));
+        self.add(&self.select(&filter).await?).await
+    }
+
+    pub async fn drop_overlay(&self, overlay: &str) -> Result<()> {
+        self.table.delete(&overlay_filter(overlay)).await?;
+        Ok(())
+    }
+
+    pub async fn clear(&self) -> Result<()> {
+        self.table.delete("1 = 1").await?;
+        Ok(())
+    }
+
+    /// The current overlay's rows.
+    pub async fn all(&self) -> Result<Vec<ConfigUsageRecord>> {
+        self.select(&overlay_filter(&self.overlay)).await
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<ConfigUsageRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut usages = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                usages.push(ConfigUsageRecord {
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    kind: get_str_col(&batch, "kind", i)?,
+                    key: get_str_col(&batch, "key", i)?,
+                    line: get_u32_col(&batch, "line", i)?,
+                    content_hash: get_nullable_str_col(&batch, "content_hash", i)?,
+                });
+            }
+        }
+        Ok(usages)
+    }
+}
+
+fn config_usages_batch(
+    usages: &[ConfigUsageRecord],
+    overlay: &str,
+    schema: SchemaRef,
+) -> Result<RecordBatch> {
+    let mut file_path_builder = StringBuilder::new();
+    let mut kind_builder = StringBuilder::new();
+    let mut key_builder = StringBuilder::new();
+    let mut line_builder = UInt32Builder::new();
+    let mut content_hash_builder = StringBuilder::new();
+    let mut overlay_builder = StringBuilder::new();
+
+    for u in usages {
+        file_path_builder.append_value(&u.file_path);
+        kind_builder.append_value(&u.kind);
+        key_builder.append_value(&u.key);
+        line_builder.append_value(u.line);
+        content_hash_builder.append_option(u.content_hash.as_deref());
+        overlay_builder.append_value(overlay);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(file_path_builder.finish()),
+            Arc::new(kind_builder.finish()),
+            Arc::new(key_builder.finish()),
+            Arc::new(line_builder.finish()),
+            Arc::new(content_hash_builder.finish()),
+            Arc::new(overlay_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
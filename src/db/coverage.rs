@@ -0,0 +1,136 @@
+use std::sync::Arc;
+
+use arrow_array::{RecordBatch, builder::{StringBuilder, UInt32Builder}};
+use arrow_schema::SchemaRef;
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::coverage_schema;
+use crate::db::store::{
+    IN_LIST_BATCH, get_str_col, get_u32_col, open_snapshot, replace_snapshot, sql_in,
+};
+use crate::error::{AppError, Result};
+
+/// Test coverage of one chunk location, from an imported coverage report.
+pub struct CoverageRecord {
+    /// Location id (`file_path:start_line`)
+    pub id: String,
+    /// Content of the chunk when the report was imported; coverage is only
+    /// shown while the chunk is unchanged
+    pub content_hash: String,
+    pub file_path: String,
+    /// Lines of the chunk the tests executed
+    pub covered_lines: u32,
+    /// Lines of the chunk the coverage tool instrumented
+    pub coverable_lines: u32,
+}
+
+/// Line coverage of a search result.
+#[derive(Clone, Copy, serde::Serialize)]
+pub struct ChunkCoverage {
+    pub percent: f32,
+    pub covered_lines: u32,
+    pub coverable_lines: u32,
+}
+
+impl From<&CoverageRecord> for ChunkCoverage {
+    fn from(r: &CoverageRecord) -> Self {
+        ChunkCoverage {
+            percent: r.covered_lines as f32 * 100.0 / r.coverable_lines.max(1) as f32,
+            covered_lines: r.covered_lines,
+            coverable_lines: r.coverable_lines,
+        }
+    }
+}
+
+fn coverage_table_name(table_name: &str) -> String {
+    format!("{table_name}_coverage")
+}
+
+/// Per-chunk coverage imported from a test coverage report. Like the SCIP
+/// symbols this is a snapshot, replaced wholesale by each import.
+pub struct CoverageTable {
+    table: lancedb::Table,
+}
+
+impl CoverageTable {
+    /// Open the coverage table if a report has been imported.
+    pub async fn open(conn: &lancedb::Connection, table_name: &str) -> Result<Option<Self>> {
+        let table = open_snapshot(conn, &coverage_table_name(table_name)).await?;
+        Ok(table.map(|table| Self { table }))
+    }
+
+    /// Replace any previous import with `records`.
+    #[tracing::instrument(skip_all, fields(records = records.len()))]
+    pub async fn replace(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        records: &[CoverageRecord],
+    ) -> Result<Self> {
+        let name = coverage_table_name(table_name);
+        let table =
+            replace_snapshot(conn, &name, coverage_schema(), records, coverage_batch).await?;
+        Ok(Self { table })
+    }
+
+    /// Coverage of the chunk locations with the given ids.
+    pub async fn for_locations(&self, ids: &[String]) -> Result<Vec<CoverageRecord>> {
+        let mut records = Vec::new();
+        for group in ids.chunks(IN_LIST_BATCH) {
+            records.extend(self.select(&sql_in("id", group)).await?);
+        }
+        Ok(records)
+    }
+
+    /// Content hashes of the chunks no test executed when the report was
+    /// imported.
+    pub async fn uncovered(&self) -> Result<Vec<String>> {
+        let records = self.select("covered_lines = 0").await?;
+        Ok(records.into_iter().map(|r| r.content_hash).collect())
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<CoverageRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut records = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                records.push(CoverageRecord {
+                    id: get_str_col(&batch, "id", i)?,
+                    content_hash: get_str_col(&batch, "content_hash", i)?,
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    covered_lines: get_u32_col(&batch, "covered_lines", i)?,
+                    coverable_lines: get_u32_col(&batch, "coverable_lines", i)?,
+                });
+            }
+        }
+        Ok(records)
+    }
+}
+
+fn coverage_batch(records: &[CoverageRecord], schema: SchemaRef) -> Result<RecordBatch> {
+    let mut id_builder = StringBuilder::new();
+    let mut content_hash_builder = StringBuilder::new();
+    let mut file_path_builder = StringBuilder::new();
+    let mut covered_builder = UInt32Builder::new();
+    let mut coverable_builder = UInt32Builder::new();
+
+    for r in records {
+        id_builder.append_value(&r.id);
+        content_hash_builder.append_value(&r.content_hash);
+        file_path_builder.append_value(&r.file_path);
+        covered_builder.append_value(r.covered_lines);
+        coverable_builder.append_value(r.coverable_lines);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(id_builder.finish()),
+            Arc::new(content_hash_builder.finish()),
+            Arc::new(file_path_builder.finish()),
+            Arc::new(covered_builder.finish()),
+            Arc::new(coverable_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
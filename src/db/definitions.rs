@@ -0,0 +1,177 @@
+use std::sync::Arc;
+
+use arrow_array::{
+    RecordBatch, RecordBatchIterator,
+    builder::{StringBuilder, UInt32Builder},
+};
+use arrow_schema::{ArrowError, SchemaRef};
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::definitions_schema;
+use crate::db::store::{
+    IN_LIST_BATCH, ensure_overlay_column, get_nullable_str_col, get_str_col, get_u32_col,
+    open_or_create_table, overlay_filter, sql_in,
+};
+use crate::error::{AppError, Result};
+
+/// A definition in a file, nested ones included.
+pub struct DefinitionRecord {
+    pub file_path: String,
+    pub language: String,
+    pub name: String,
+    /// Enclosing definitions joined by the language's scope separator
+    pub scope: String,
+    pub kind: String,
+    pub start_line: u32,
+    pub end_line: u32,
+    pub summary: Option<String>,
+}
+
+pub(super) fn definitions_table_name(table_name: &str) -> String {
+    format!("{table_name}_definitions")
+}
+
+/// Definitions recorded at index time, so a file's outline can be listed
+/// without reading or parsing it again.
+pub struct DefinitionTable {
+    table: lancedb::Table,
+    overlay: String,
+}
+
+impl DefinitionTable {
+    pub async fn open_or_create(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        overlay: &str,
+    ) -> Result<Self> {
+        let table =
+            open_or_create_table(conn, &definitions_table_name(table_name), definitions_schema())
+                .await?;
+        ensure_overlay_column(&table, overlay).await?;
+        Ok(Self { table, overlay: overlay.to_string() })
+    }
+
+    #[tracing::instrument(skip_all, fields(definitions = definitions.len()))]
+    pub async fn add(&self, definitions: &[DefinitionRecord]) -> Result<()> {
+        if definitions.is_empty() {
+            return Ok(());
+        }
+        let schema = definitions_schema();
+        let batch = definitions_batch(definitions, &self.overlay, schema.clone())?;
+        let reader = RecordBatchIterator::new(
+            vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
+            schema,
+        );
+        self.table.add(reader).execute().await?;
+        Ok(())
+    }
+
+    pub async fn delete_file(&self, file_path: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(&self.overlay));
+        self.table.delete(&filter).await?;
+        Ok(())
+    }
+
+    /// Copy another overlay's rows for `file_path` into this one.
+    pub async fn copy_file(&self, file_path: &str, from_overlay: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(from_overlay));
+        self.add(&self.select(&filter).await?).await
+    }
+
+    pub async fn drop_overlay(&self, overlay: &str) -> Result<()> {
+        self.table.delete(&overlay_filter(overlay)).await?;
+        Ok(())
+    }
+
+    pub async fn clear(&self) -> Result<()> {
+        self.table.delete("1 = 1").await?;
+        Ok(())
+    }
+
+    /// The current overlay's definitions in `file_path`, in source order.
+    pub async fn in_file(&self, file_path: &str) -> Result<Vec<DefinitionRecord>> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(&self.overlay));
+        let mut definitions = self.select(&filter).await?;
+        // Outer definitions before the ones they contain
+        definitions.sort_by_key(|d| (d.start_line, std::cmp::Reverse(d.end_line)));
+        Ok(definitions)
+    }
+
+    /// The current overlay's definitions with any of the given names.
+    pub async fn named(&self, names: &[String]) -> Result<Vec<DefinitionRecord>> {
+        let mut definitions = Vec::new();
+        for group in names.chunks(IN_LIST_BATCH) {
+            let filter = format!("{} AND {}", overlay_filter(&self.overlay), sql_in("name", group));
+            definitions.extend(self.select(&filter).await?);
+        }
+        Ok(definitions)
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<DefinitionRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut definitions = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                definitions.push(DefinitionRecord {
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    language: get_str_col(&batch, "language", i)?,
+                    name: get_str_col(&batch, "name", i)?,
+                    scope: get_str_col(&batch, "scope", i)?,
+                    kind: get_str_col(&batch, "kind", i)?,
+                    start_line: get_u32_col(&batch, "start_line", i)?,
+                    end_line: get_u32_col(&batch, "end_line", i)?,
+                    summary: get_nullable_str_col(&batch, "summary", i)?,
+                });
+            }
+        }
+        Ok(definitions)
+    }
+}
+
+fn definitions_batch(
+    definitions: &[DefinitionRecord],
+    overlay: &str,
+    schema: SchemaRef,
+) -> Result<RecordBatch> {
+    let mut file_path_builder = StringBuilder::new();
+    let mut language_builder = StringBuilder::new();
+    let mut name_builder = StringBuilder::new();
+    let mut scope_builder = StringBuilder::new();
+    let mut kind_builder = StringBuilder::new();
+    let mut start_line_builder = UInt32Builder::new();
+    let mut end_line_builder = UInt32Builder::new();
+    let mut summary_builder = StringBuilder::new();
+    let mut overlay_builder = StringBuilder::new();
+
+    for d in definitions {
+        file_path_builder.append_value(&d.file_path);
+        language_builder.append_value(&d.language);
+        name_builder.append_value(&d.name);
+        scope_builder.append_value(&d.scope);
+        kind_builder.append_value(&d.kind);
+        start_line_builder.append_value(d.start_line);
+        end_line_builder.append_value(d.end_line);
+        summary_builder.append_option(d.summary.as_deref());
+        overlay_builder.append_value(overlay);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(file_path_builder.finish()),
+            Arc::new(language_builder.finish()),
+            Arc::new(name_builder.finish()),
+            Arc::new(scope_builder.finish()),
+            Arc::new(kind_builder.finish()),
+            Arc::new(start_line_builder.finish()),
+            Arc::new(end_line_builder.finish()),
+            Arc::new(summary_builder.finish()),
+            Arc::new(overlay_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
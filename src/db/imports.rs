@@ -0,0 +1,140 @@
+use std::sync::Arc;
+
+use arrow_array::{
+    RecordBatch, RecordBatchIterator,
+    builder::{StringBuilder, UInt32Builder},
+};
+use arrow_schema::{ArrowError, SchemaRef};
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::imports_schema;
+use crate::db::store::{
+    ensure_overlay_column, get_str_col, get_u32_col, open_or_create_table, overlay_filter,
+};
+use crate::error::{AppError, Result};
+
+/// One import statement, unresolved.
+pub struct ImportRecord {
+    pub file_path: String,
+    pub language: String,
+    pub target: String,
+    pub line: u32,
+}
+
+pub(super) fn imports_table_name(table_name: &str) -> String {
+    format!("{table_name}_imports")
+}
+
+/// Imports extracted at index time. Targets are resolved to project files
+/// when a graph is built, so that files added later are picked up without
+/// re-indexing their importers.
+pub struct ImportTable {
+    table: lancedb::Table,
+    overlay: String,
+}
+
+impl ImportTable {
+    pub async fn open_or_create(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        overlay: &str,
+    ) -> Result<Self> {
+        let table =
+            open_or_create_table(conn, &imports_table_name(table_name), imports_schema()).await?;
+        ensure_overlay_column(&table, overlay).await?;
+        Ok(Self { table, overlay: overlay.to_string() })
+    }
+
+    #[tracing::instrument(skip_all, fields(imports = imports.len()))]
+    pub async fn add(&self, imports: &[ImportRecord]) -> Result<()> {
+        if imports.is_empty() {
+            return Ok(());
+        }
+        let schema = imports_schema();
+        let batch = imports_batch(imports, &self.overlay, schema.clone())?;
+        let reader = RecordBatchIterator::new(
+            vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
+            schema,
+        );
+        self.table.add(reader).execute().await?;
+        Ok(())
+    }
+
+    pub async fn delete_file(&self, file_path: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(&self.overlay));
+        self.table.delete(&filter).await?;
+        Ok(())
+    }
+
+    /// Copy another overlay's rows for `file_path` into this one.
+    pub async fn copy_file(&self, file_path: &str, from_overlay: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(from_overlay));
+        self.add(&self.select(&filter).await?).await
+    }
+
+    pub async fn drop_overlay(&self, overlay: &str) -> Result<()> {
+        self.table.delete(&overlay_filter(overlay)).await?;
+        Ok(())
+    }
+
+    pub async fn clear(&self) -> Result<()> {
+        self.table.delete("1 = 1").await?;
+        Ok(())
+    }
+
+    /// The current overlay's rows.
+    pub async fn all(&self) -> Result<Vec<ImportRecord>> {
+        self.select(&overlay_filter(&self.overlay)).await
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<ImportRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut imports = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                imports.push(ImportRecord {
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    language: get_str_col(&batch, "language", i)?,
+                    target: get_str_col(&batch, "target", i)?,
+                    line: get_u32_col(&batch, "line", i)?,
+                });
+            }
+        }
+        Ok(imports)
+    }
+}
+
+fn imports_batch(
+    imports: &[ImportRecord],
+    overlay: &str,
+    schema: SchemaRef,
+) -> Result<RecordBatch> {
+    let mut file_path_builder = StringBuilder::new();
+    let mut language_builder = StringBuilder::new();
+    let mut target_builder = StringBuilder::new();
+    let mut line_builder = UInt32Builder::new();
+    let mut overlay_builder = StringBuilder::new();
+
+    for i in imports {
+        file_path_builder.append_value(&i.file_path);
+        language_builder.append_value(&i.language);
+        target_builder.append_value(&i.target);
+        line_builder.append_value(i.line);
+        overlay_builder.append_value(overlay);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(file_path_builder.finish()),
+            Arc::new(language_builder.finish()),
+            Arc::new(target_builder.finish()),
+            Arc::new(line_builder.finish()),
+            Arc::new(overlay_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
@@ -1,2 +1,11 @@
+pub mod calls;
+pub mod config_usages;
+pub mod coverage;
+pub mod definitions;
+pub mod imports;
+pub mod overlay;
+pub mod profile;
+pub mod routes;
 pub mod schema;
 pub mod store;
+pub mod symbols;
@@ -0,0 +1,61 @@
+use std::path::{Path, PathBuf};
+use std::process::Command;
+
+/// Overlay used outside git checkouts.
+pub const DEFAULT_OVERLAY: &str = "default";
+
+/// Name of the overlay for the checkout at `target_dir`.
+///
+/// Chunk rows are shared by every overlay; an overlay maps the files of one
+/// checkout onto them. Overlays are named after the checked-out branch, which
+/// git allows in only one worktree at a time, so they are per worktree too. A
+/// detached HEAD gets one overlay per worktree; outside git there is a
+/// single [`DEFAULT_OVERLAY`].
+pub fn current(target_dir: &Path) -> String {
+    if let Some(branch) = git(target_dir, &["symbolic-ref", "--short", "-q", "HEAD"]) {
+        return branch;
+    }
+    match git(target_dir, &["rev-parse", "--absolute-git-dir"]) {
+        Some(git_dir) => {
+            // .git for the main worktree, .git/worktrees/<name> for linked ones
+            let worktree = Path::new(&git_dir)
+                .file_name()
+                .and_then(|n| n.to_str())
+                .filter(|n| *n != ".git")
+                .unwrap_or("main")
+                .to_string();
+            format!("(detached {worktree})")
+        }
+        None => DEFAULT_OVERLAY.to_string(),
+    }
+}
+
+/// Directory whose `.maharajah/` holds the index for `target_dir`: for a
+/// linked git worktree, the same directory in the main worktree, so that all
+/// worktrees of a repository share chunk rows and embeddings; otherwise
+/// `target_dir` itself.
+pub fn index_root(target_dir: &Path) -> PathBuf {
+    let shared = || -> Option<PathBuf> {
+        let git_dir = git(target_dir, &["rev-parse", "--absolute-git-dir"])?;
+        let common_dir = git(target_dir, &["rev-parse", "--git-common-dir"])?;
+        let common_dir = target_dir.join(common_dir).canonicalize().ok()?;
+        if Path::new(&git_dir) == common_dir || common_dir.file_name()? != ".git" {
+            // Main worktree, or a bare repository without one
+            return None;
+        }
+        // Path of target_dir inside the repository, e.g. "crates/core/"
+        let prefix = git(target_dir, &["rev-parse", "--show-prefix"]).unwrap_or_default();
+        Some(common_dir.parent()?.join(prefix))
+    };
+    shared().unwrap_or_else(|| target_dir.to_path_buf())
+}
+
+/// Trimmed stdout of a successful, non-empty git command.
+fn git(dir: &Path, args: &[&str]) -> Option<String> {
+    let output = Command::new("git").arg("-C").arg(dir).args(args).output().ok()?;
+    if !output.status.success() {
+        return None;
+    }
+    let out = String::from_utf8(output.stdout).ok()?.trim().to_string();
+    (!out.is_empty()).then_some(out)
+}
@@ -0,0 +1,144 @@
+use std::sync::Arc;
+
+use arrow_array::{RecordBatch, builder::{Float32Builder, StringBuilder}};
+use arrow_schema::SchemaRef;
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::profile_schema;
+use crate::db::store::{
+    IN_LIST_BATCH, get_f32_col, get_str_col, open_snapshot, replace_snapshot, sql_in,
+};
+use crate::error::{AppError, Result};
+
+/// Time a runtime profile spent in one chunk location.
+pub struct ProfileRecord {
+    /// Location id (`file_path:start_line`)
+    pub id: String,
+    /// Content of the chunk when the profile was imported; hotness is only
+    /// shown while the chunk is unchanged
+    pub content_hash: String,
+    pub file_path: String,
+    /// Share of samples, in percent, whose innermost indexed frame is in the
+    /// chunk: time spent in its own code and in the libraries it calls
+    pub self_percent: f32,
+    /// Share of samples, in percent, with the chunk anywhere on the stack
+    pub total_percent: f32,
+    /// `self_percent` relative to the hottest chunk, from 0 to 1
+    pub score: f32,
+}
+
+/// Runtime hotness of a search result.
+#[derive(Clone, Copy, serde::Serialize)]
+pub struct ChunkHotness {
+    /// `self_percent` relative to the hottest chunk, from 0 to 1
+    pub score: f32,
+    pub self_percent: f32,
+    pub total_percent: f32,
+}
+
+impl From<&ProfileRecord> for ChunkHotness {
+    fn from(r: &ProfileRecord) -> Self {
+        ChunkHotness {
+            score: r.score,
+            self_percent: r.self_percent,
+            total_percent: r.total_percent,
+        }
+    }
+}
+
+fn profile_table_name(table_name: &str) -> String {
+    format!("{table_name}_profile")
+}
+
+/// Per-chunk sample shares imported from a runtime profile. Like the SCIP
+/// symbols this is a snapshot, replaced wholesale by each import.
+pub struct ProfileTable {
+    table: lancedb::Table,
+}
+
+impl ProfileTable {
+    /// Open the profile table if a profile has been imported.
+    pub async fn open(conn: &lancedb::Connection, table_name: &str) -> Result<Option<Self>> {
+        let table = open_snapshot(conn, &profile_table_name(table_name)).await?;
+        Ok(table.map(|table| Self { table }))
+    }
+
+    /// Replace any previous import with `records`.
+    #[tracing::instrument(skip_all, fields(records = records.len()))]
+    pub async fn replace(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        records: &[ProfileRecord],
+    ) -> Result<Self> {
+        let name = profile_table_name(table_name);
+        let table =
+            replace_snapshot(conn, &name, profile_schema(), records, profile_batch).await?;
+        Ok(Self { table })
+    }
+
+    /// Profile records of the chunk locations with the given ids.
+    pub async fn for_locations(&self, ids: &[String]) -> Result<Vec<ProfileRecord>> {
+        let mut records = Vec::new();
+        for group in ids.chunks(IN_LIST_BATCH) {
+            records.extend(self.select(&sql_in("id", group)).await?);
+        }
+        Ok(records)
+    }
+
+    /// Content hashes of the chunks on at least `min_percent` of the samples
+    /// when the profile was imported.
+    pub async fn hot(&self, min_percent: f32) -> Result<Vec<String>> {
+        let records = self.select(&format!("total_percent >= {min_percent}")).await?;
+        Ok(records.into_iter().map(|r| r.content_hash).collect())
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<ProfileRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut records = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                records.push(ProfileRecord {
+                    id: get_str_col(&batch, "id", i)?,
+                    content_hash: get_str_col(&batch, "content_hash", i)?,
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    self_percent: get_f32_col(&batch, "self_percent", i)?,
+                    total_percent: get_f32_col(&batch, "total_percent", i)?,
+                    score: get_f32_col(&batch, "score", i)?,
+                });
+            }
+        }
+        Ok(records)
+    }
+}
+
+fn profile_batch(records: &[ProfileRecord], schema: SchemaRef) -> Result<RecordBatch> {
+    let mut id_builder = StringBuilder::new();
+    let mut content_hash_builder = StringBuilder::new();
+    let mut file_path_builder = StringBuilder::new();
+    let mut self_builder = Float32Builder::new();
+    let mut total_builder = Float32Builder::new();
+    let mut score_builder = Float32Builder::new();
+
+    for r in records {
+        id_builder.append_value(&r.id);
+        content_hash_builder.append_value(&r.content_hash);
+        file_path_builder.append_value(&r.file_path);
+        self_builder.append_value(r.self_percent);
+        total_builder.append_value(r.total_percent);
+        score_builder.append_value(r.score);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(id_builder.finish()),
+            Arc::new(content_hash_builder.finish()),
+            Arc::new(file_path_builder.finish()),
+            Arc::new(self_builder.finish()),
+            Arc::new(total_builder.finish()),
+            Arc::new(score_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
@@ -0,0 +1,149 @@
+use std::sync::Arc;
+
+use arrow_array::{
+    RecordBatch, RecordBatchIterator,
+    builder::{StringBuilder, UInt32Builder},
+};
+use arrow_schema::{ArrowError, SchemaRef};
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::routes_schema;
+use crate::db::store::{
+    ensure_overlay_column, get_str_col, get_u32_col, open_or_create_table, overlay_filter,
+};
+use crate::error::{AppError, Result};
+
+/// One HTTP route registration.
+pub struct RouteRecord {
+    pub file_path: String,
+    pub framework: String,
+    pub method: String,
+    pub path: String,
+    pub handler: String,
+    pub line: u32,
+}
+
+pub(super) fn routes_table_name(table_name: &str) -> String {
+    format!("{table_name}_routes")
+}
+
+/// Route registrations extracted at index time, kept in step with the
+/// locations table: a file's routes are replaced whenever it is re-indexed.
+pub struct RouteTable {
+    table: lancedb::Table,
+    overlay: String,
+}
+
+impl RouteTable {
+    pub async fn open_or_create(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        overlay: &str,
+    ) -> Result<Self> {
+        let table =
+            open_or_create_table(conn, &routes_table_name(table_name), routes_schema()).await?;
+        ensure_overlay_column(&table, overlay).await?;
+        Ok(Self { table, overlay: overlay.to_string() })
+    }
+
+    #[tracing::instrument(skip_all, fields(routes = routes.len()))]
+    pub async fn add(&self, routes: &[RouteRecord]) -> Result<()> {
+        if routes.is_empty() {
+            return Ok(());
+        }
+        let schema = routes_schema();
+        let batch = routes_batch(routes, &self.overlay, schema.clone())?;
+        let reader = RecordBatchIterator::new(
+            vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
+            schema,
+        );
+        self.table.add(reader).execute().await?;
+        Ok(())
+    }
+
+    pub async fn delete_file(&self, file_path: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(&self.overlay));
+        self.table.delete(&filter).await?;
+        Ok(())
+    }
+
+    /// Copy another overlay's rows for `file_path` into this one.
+    pub async fn copy_file(&self, file_path: &str, from_overlay: &str) -> Result<()> {
+        let escaped = file_path.replace('\'', "''");
+        let filter = format!("{} AND file_path = '{escaped}'", overlay_filter(from_overlay));
+        self.add(&self.select(&filter).await?).await
+    }
+
+    pub async fn drop_overlay(&self, overlay: &str) -> Result<()> {
+        self.table.delete(&overlay_filter(overlay)).await?;
+        Ok(())
+    }
+
+    pub async fn clear(&self) -> Result<()> {
+        self.table.delete("1 = 1").await?;
+        Ok(())
+    }
+
+    /// The current overlay's rows.
+    pub async fn all(&self) -> Result<Vec<RouteRecord>> {
+        self.select(&overlay_filter(&self.overlay)).await
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<RouteRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut routes = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                routes.push(RouteRecord {
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    framework: get_str_col(&batch, "framework", i)?,
+                    method: get_str_col(&batch, "method", i)?,
+                    path: get_str_col(&batch, "path", i)?,
+                    handler: get_str_col(&batch, "handler", i)?,
+                    line: get_u32_col(&batch, "line", i)?,
+                });
+            }
+        }
+        Ok(routes)
+    }
+}
+
+fn routes_batch(
+    routes: &[RouteRecord],
+    overlay: &str,
+    schema: SchemaRef,
+) -> Result<RecordBatch> {
+    let mut file_path_builder = StringBuilder::new();
+    let mut framework_builder = StringBuilder::new();
+    let mut method_builder = StringBuilder::new();
+    let mut path_builder = StringBuilder::new();
+    let mut handler_builder = StringBuilder::new();
+    let mut line_builder = UInt32Builder::new();
+    let mut overlay_builder = StringBuilder::new();
+
+    for r in routes {
+        file_path_builder.append_value(&r.file_path);
+        framework_builder.append_value(&r.framework);
+        method_builder.append_value(&r.method);
+        path_builder.append_value(&r.path);
+        handler_builder.append_value(&r.handler);
+        line_builder.append_value(r.line);
+        overlay_builder.append_value(overlay);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(file_path_builder.finish()),
+            Arc::new(framework_builder.finish()),
+            Arc::new(method_builder.finish()),
+            Arc::new(path_builder.finish()),
+            Arc::new(handler_builder.finish()),
+            Arc::new(line_builder.finish()),
+            Arc::new(overlay_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
@@ -3,8 +3,15 @@ use std::sync::Arc;
 
 /// Arrow schema for indexed code chunks stored in LanceDB.
 ///
+/// There is one row per unique chunk content; every place that content occurs
+/// is recorded in the locations table (see [`locations_schema`]). The location
+/// columns here describe the occurrence that was indexed first.
+///
 /// Columns:
 /// - id             : unique chunk identifier (file_path:start_line)
+/// - content_hash   : chunk key (unique per row): SHA-256 hex of the chunk's
+///                    language, summary, embedding header and content, each
+///                    length-prefixed (see `indexer::chunk_key`)
 /// - file_path      : source file path
 /// - file_hash      : SHA-256 hex of file content (for incremental updates)
 /// - language       : detected language (rust, python, ...)
@@ -18,6 +25,7 @@ use std::sync::Arc;
 pub fn chunks_schema(embedding_dim: usize) -> Arc<Schema> {
     Arc::new(Schema::new(Fields::from(vec![
         Field::new("id", DataType::Utf8, false),
+        Field::new("content_hash", DataType::Utf8, false),
         Field::new("file_path", DataType::Utf8, false),
         Field::new("file_hash", DataType::Utf8, false),
         Field::new("language", DataType::Utf8, false),
@@ -44,3 +52,224 @@ pub fn chunks_schema(embedding_dim: usize) -> Arc<Schema> {
         ),
     ])))
 }
+
+/// Arrow schema for chunk locations: one row per occurrence of a chunk in a
+/// file, referencing the shared chunk row by content hash.
+///
+/// Columns:
+/// - id           : location identifier (file_path:start_line)
+/// - content_hash : chunk key of the content here (joins to the chunks table)
+/// - file_path    : source file path
+/// - file_hash    : SHA-256 hex of file content (for incremental updates)
+/// - symbol       : tree-sitter node name at this location
+/// - start_line   : 0-based start line in file
+/// - end_line     : 0-based end line in file
+/// - overlay      : checkout the location belongs to (see [`OVERLAY_FIELD`])
+pub fn locations_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("id", DataType::Utf8, false),
+        Field::new("content_hash", DataType::Utf8, false),
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("file_hash", DataType::Utf8, false),
+        Field::new("symbol", DataType::Utf8, false),
+        Field::new("start_line", DataType::UInt32, false),
+        Field::new("end_line", DataType::UInt32, false),
+        overlay_field(),
+    ])))
+}
+
+/// Arrow schema for precise symbol occurrences imported from a SCIP index.
+///
+/// Columns:
+/// - symbol           : SCIP symbol (e.g. "rust-analyzer cargo app 0.1.0 parser/Parser#parse().")
+/// - name             : short display name of the symbol ("parse")
+/// - file_path        : source file path
+/// - line             : 0-based line of the occurrence
+/// - column           : 0-based column of the occurrence
+/// - end_line         : 0-based last line of the definition's enclosing range
+///                      (the occurrence line for references)
+/// - is_definition    : whether the occurrence defines the symbol
+/// - enclosing_symbol : for references, the innermost definition containing them (nullable)
+pub fn symbols_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("symbol", DataType::Utf8, false),
+        Field::new("name", DataType::Utf8, false),
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("line", DataType::UInt32, false),
+        Field::new("column", DataType::UInt32, false),
+        Field::new("end_line", DataType::UInt32, false),
+        Field::new("is_definition", DataType::Boolean, false),
+        Field::new("enclosing_symbol", DataType::Utf8, true),
+    ])))
+}
+
+/// Arrow schema for per-chunk test coverage imported from a coverage report.
+///
+/// Columns:
+/// - id              : chunk location identifier (file_path:start_line)
+/// - content_hash    : chunk key of the location when the report was imported; a
+///                     change to the chunk, its summary or its header makes the
+///                     coverage stale
+/// - file_path       : source file path
+/// - covered_lines   : lines of the chunk executed by the tests
+/// - coverable_lines : lines of the chunk instrumented by the coverage tool
+pub fn coverage_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("id", DataType::Utf8, false),
+        Field::new("content_hash", DataType::Utf8, false),
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("covered_lines", DataType::UInt32, false),
+        Field::new("coverable_lines", DataType::UInt32, false),
+    ])))
+}
+
+/// Arrow schema for per-chunk sample shares imported from a runtime profile.
+///
+/// Columns:
+/// - id            : chunk location identifier (file_path:start_line)
+/// - content_hash  : chunk key of the location when the profile was imported; a
+///                   change to the chunk, its summary or its header makes the
+///                   sample shares stale
+/// - file_path     : source file path
+/// - self_percent  : share of samples whose innermost indexed frame is in the chunk
+/// - total_percent : share of samples with the chunk anywhere on the stack
+/// - score         : self_percent relative to the hottest chunk (0 to 1)
+pub fn profile_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("id", DataType::Utf8, false),
+        Field::new("content_hash", DataType::Utf8, false),
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("self_percent", DataType::Float32, false),
+        Field::new("total_percent", DataType::Float32, false),
+        Field::new("score", DataType::Float32, false),
+    ])))
+}
+
+/// Arrow schema for HTTP route registrations found while indexing.
+///
+/// Columns:
+/// - file_path : source file containing the registration
+/// - framework : extractor that recognised it (e.g. "actix-web", "express")
+/// - method    : upper-case HTTP method, or "ANY"
+/// - path      : route path pattern as written, with any class-level prefix
+/// - handler   : handler expression (empty for inline closures)
+/// - line      : 0-based line of the registration
+/// - overlay   : checkout the route belongs to
+pub fn routes_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("framework", DataType::Utf8, false),
+        Field::new("method", DataType::Utf8, false),
+        Field::new("path", DataType::Utf8, false),
+        Field::new("handler", DataType::Utf8, false),
+        Field::new("line", DataType::UInt32, false),
+        overlay_field(),
+    ])))
+}
+
+/// Arrow schema for environment-variable and configuration-key reads found
+/// while indexing.
+///
+/// Columns:
+/// - file_path    : source file containing the read
+/// - kind         : "env" or "config"
+/// - key          : variable or key name; env prefixes end in `*`
+/// - line         : 0-based line of the read
+/// - content_hash : chunk key of the chunk containing the read (nullable —
+///                  reads outside any chunk, such as top-level statements)
+/// - overlay      : checkout the read belongs to
+pub fn config_usages_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("kind", DataType::Utf8, false),
+        Field::new("key", DataType::Utf8, false),
+        Field::new("line", DataType::UInt32, false),
+        Field::new("content_hash", DataType::Utf8, true),
+        overlay_field(),
+    ])))
+}
+
+/// Arrow schema for import statements found while indexing.
+///
+/// Columns:
+/// - file_path : source file containing the import
+/// - language  : language of the file (selects how `target` is resolved)
+/// - target    : imported module, package or path as written, with `use`
+///               groups expanded (e.g. "crate::db::store::Store", "./util")
+/// - line      : 0-based line of the import
+/// - overlay   : checkout the import belongs to
+pub fn imports_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("language", DataType::Utf8, false),
+        Field::new("target", DataType::Utf8, false),
+        Field::new("line", DataType::UInt32, false),
+        overlay_field(),
+    ])))
+}
+
+/// Schema for the calls table (`{table_name}_calls`). One row per call
+/// expression, plus one per definition with an empty callee.
+///
+/// Columns:
+/// - file_path       : relative path of the file
+/// - language        : language of the file
+/// - caller          : definition containing the call, with its enclosing
+///                     definitions (e.g. "Store::search", "Parser.parse")
+/// - caller_line     : 0-based start line of the caller
+/// - caller_end_line : 0-based end line of the caller
+/// - callee          : called name without receiver or path (e.g. "search")
+/// - qualifier       : path written before the called name ("Store" in
+///                     `Store::open`), or empty
+/// - line            : 0-based line of the call
+/// - overlay         : checkout the call belongs to
+pub fn calls_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("language", DataType::Utf8, false),
+        Field::new("caller", DataType::Utf8, false),
+        Field::new("caller_line", DataType::UInt32, false),
+        Field::new("caller_end_line", DataType::UInt32, false),
+        Field::new("callee", DataType::Utf8, false),
+        Field::new("qualifier", DataType::Utf8, false),
+        Field::new("line", DataType::UInt32, false),
+        overlay_field(),
+    ])))
+}
+
+/// Schema for the definitions table (`{table_name}_definitions`), the
+/// symbol outline of each indexed file.
+///
+/// Columns:
+/// - file_path  : relative path of the file
+/// - language   : language of the file
+/// - name       : the definition's own name (e.g. "search")
+/// - scope      : enclosing definitions joined by the language's separator
+///                (e.g. "Store", "a::b"), or empty at the top level
+/// - kind       : symbol kind (e.g. "function", "method", "struct")
+/// - start_line : 0-based first line of the definition
+/// - end_line   : 0-based last line of the definition
+/// - summary    : docstring or preceding comment (nullable)
+/// - overlay    : checkout the definition belongs to
+pub fn definitions_schema() -> Arc<Schema> {
+    Arc::new(Schema::new(Fields::from(vec![
+        Field::new("file_path", DataType::Utf8, false),
+        Field::new("language", DataType::Utf8, false),
+        Field::new("name", DataType::Utf8, false),
+        Field::new("scope", DataType::Utf8, false),
+        Field::new("kind", DataType::Utf8, false),
+        Field::new("start_line", DataType::UInt32, false),
+        Field::new("end_line", DataType::UInt32, false),
+        Field::new("summary", DataType::Utf8, true),
+        overlay_field(),
+    ])))
+}
+
+/// Column naming the checkout (branch overlay) a per-file row belongs to.
+pub const OVERLAY_FIELD: &str = "overlay";
+
+/// Nullable only because tables from before overlays gain the column through
+/// a migration, which can't declare it non-null; every row written has one.
+fn overlay_field() -> Field {
+    Field::new(OVERLAY_FIELD, DataType::Utf8, true)
+}
@@ -1,19 +1,39 @@
+use std::collections::{HashMap, HashSet};
 use std::path::Path;
 use std::sync::Arc;
 
 use arrow_array::{
-    Array, Float32Array, RecordBatch, RecordBatchIterator, StringArray, UInt32Array,
+    Array, FixedSizeListArray, Float32Array, RecordBatch, RecordBatchIterator, StringArray,
+    UInt32Array,
     builder::{FixedSizeListBuilder, Float32Builder, StringBuilder, UInt32Builder},
 };
-use arrow_schema::ArrowError;
+use arrow_schema::{ArrowError, SchemaRef};
 use futures::TryStreamExt;
-use lancedb::query::{ExecutableQuery, QueryBase};
+use lancedb::query::{ExecutableQuery, QueryBase, Select};
+use lancedb::table::{AddDataMode, NewColumnTransform};
 
-use crate::db::schema::chunks_schema;
+use crate::db::schema::{OVERLAY_FIELD, chunks_schema, locations_schema};
+use crate::db::config_usages::{ConfigUsageTable, config_usages_table_name};
+use crate::db::calls::{CallTable, calls_table_name};
+use crate::db::coverage::{ChunkCoverage, CoverageTable};
+use crate::db::definitions::{DefinitionTable, definitions_table_name};
+use crate::db::imports::{ImportTable, imports_table_name};
+use crate::db::profile::{ChunkHotness, ProfileTable};
+use crate::db::routes::{RouteTable, routes_table_name};
+use crate::db::symbols::SymbolTable;
 use crate::error::{AppError, Result};
 
+#[cfg(test)]
+#[path = "store_tests.rs"]
+mod store_tests;
+
+/// Maximum number of literals placed in a single SQL `IN (...)` predicate.
+pub(super) const IN_LIST_BATCH: usize = 256;
+
+/// A unique chunk: its content, embeddings, and the location it was first seen at.
 pub struct ChunkRecord {
     pub id: String,
+    pub content_hash: String,
     pub file_path: String,
     pub file_hash: String,
     pub language: String,
@@ -26,21 +46,104 @@ pub struct ChunkRecord {
     pub summary_vector: Option<Vec<f32>>,
 }
 
-#[derive(serde::Serialize)]
+/// One occurrence of a chunk's content in a file.
+#[derive(Clone)]
+pub struct LocationRecord {
+    pub id: String,
+    pub content_hash: String,
+    pub file_path: String,
+    pub file_hash: String,
+    pub symbol: String,
+    pub start_line: u32,
+    pub end_line: u32,
+}
+
+#[derive(Clone, serde::Serialize)]
 pub struct SearchResult {
     pub id: String,
     pub file_path: String,
+    pub language: String,
     pub start_line: u32,
     pub end_line: u32,
     pub symbol: String,
     pub content: String,
     pub score: f32,
     pub summary: Option<String>,
+    /// Other locations with byte-identical content, as "file_path:start_line"
+    pub also_at: Vec<String>,
+    /// SCIP symbol defined by the chunk, when a SCIP index has been imported
+    pub qualified_symbol: Option<String>,
+    /// Line coverage of the chunk, when a coverage report has been imported
+    pub coverage: Option<ChunkCoverage>,
+    /// Runtime hotness of the chunk, when a profile has been imported
+    pub hotness: Option<ChunkHotness>,
+    /// Lines of the chunk most relevant to the query, set by `rag::highlight`
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub highlight_lines: Vec<u32>,
+    #[serde(skip)]
+    pub content_hash: String,
+}
+
+#[cfg(test)]
+impl SearchResult {
+    /// A hit with the given location and content and every other field empty;
+    /// tests override what they need with struct update syntax.
+    pub fn for_test(file_path: &str, start_line: u32, end_line: u32, content: &str) -> Self {
+        SearchResult {
+            id: format!("{file_path}:{start_line}"),
+            file_path: file_path.to_string(),
+            language: String::new(),
+            start_line,
+            end_line,
+            symbol: String::new(),
+            content: content.to_string(),
+            score: 0.0,
+            summary: None,
+            also_at: Vec::new(),
+            qualified_symbol: None,
+            coverage: None,
+            hotness: None,
+            highlight_lines: Vec::new(),
+            content_hash: String::new(),
+        }
+    }
+}
+
+/// Location columns used to resolve search hits.
+struct Location {
+    id: String,
+    file_path: String,
+    symbol: String,
+    start_line: u32,
+    end_line: u32,
 }
 
 pub struct Store {
     table: lancedb::Table,
+    locations: lancedb::Table,
+    routes: RouteTable,
+    config_usages: ConfigUsageTable,
+    imports: ImportTable,
+    calls: CallTable,
+    definitions: DefinitionTable,
+    /// Present once a SCIP index has been imported
+    symbols: Option<SymbolTable>,
+    /// Present once a coverage report has been imported
+    coverage: Option<CoverageTable>,
+    /// Present once a runtime profile has been imported
+    profile: Option<ProfileTable>,
     embedding_dim: usize,
+    /// Checkout whose locations and per-file rows this store reads and writes
+    overlay: String,
+}
+
+pub(crate) async fn connect(db_path: &Path) -> Result<lancedb::Connection> {
+    let uri = db_path.to_str().expect("db path is not valid UTF-8");
+    Ok(lancedb::connect(uri).execute().await?)
+}
+
+fn locations_table_name(table_name: &str) -> String {
+    format!("{table_name}_locations")
 }
 
 impl Store {
@@ -48,32 +151,48 @@ impl Store {
         db_path: &Path,
         embedding_dim: usize,
         table_name: &str,
+        overlay: &str,
         reindex: bool,
     ) -> Result<Self> {
-        let uri = db_path.to_str().expect("db path is not valid UTF-8");
-        let conn = lancedb::connect(uri).execute().await?;
+        let conn = connect(db_path).await?;
+        let locations_name = locations_table_name(table_name);
 
         if reindex {
             let _ = conn.drop_table(table_name, &[]).await;
+            let _ = conn.drop_table(&locations_name, &[]).await;
+            let _ = conn.drop_table(&routes_table_name(table_name), &[]).await;
+            let _ = conn.drop_table(&config_usages_table_name(table_name), &[]).await;
+            let _ = conn.drop_table(&imports_table_name(table_name), &[]).await;
+            let _ = conn.drop_table(&calls_table_name(table_name), &[]).await;
+            let _ = conn.drop_table(&definitions_table_name(table_name), &[]).await;
         }
 
-        let schema = chunks_schema(embedding_dim);
-        let table = match conn.open_table(table_name).execute().await {
-            Ok(t) => t,
-            Err(lancedb::Error::TableNotFound { .. }) => {
-                // First run — create the table from scratch
-                conn.create_empty_table(table_name, schema).execute().await?
-            }
-            Err(e) => {
-                // Corruption, schema mismatch, I/O error, etc.
-                // Propagate — user can recover with `index --reindex`
-                return Err(AppError::Database(e));
-            }
-        };
+        let table = open_or_create_table(&conn, table_name, chunks_schema(embedding_dim)).await?;
+        check_schema(&table).await?;
+        let locations = open_or_create_table(&conn, &locations_name, locations_schema()).await?;
+        ensure_overlay_column(&locations, overlay).await?;
+        let routes = RouteTable::open_or_create(&conn, table_name, overlay).await?;
+        let config_usages = ConfigUsageTable::open_or_create(&conn, table_name, overlay).await?;
+        let imports = ImportTable::open_or_create(&conn, table_name, overlay).await?;
+        let calls = CallTable::open_or_create(&conn, table_name, overlay).await?;
+        let definitions = DefinitionTable::open_or_create(&conn, table_name, overlay).await?;
+        let symbols = SymbolTable::open(&conn, table_name).await?;
+        let coverage = CoverageTable::open(&conn, table_name).await?;
+        let profile = ProfileTable::open(&conn, table_name).await?;
 
         Ok(Store {
             table,
+            locations,
+            routes,
+            config_usages,
+            imports,
+            calls,
+            definitions,
+            symbols,
+            coverage,
+            profile,
             embedding_dim,
+            overlay: overlay.to_string(),
         })
     }
 
@@ -81,31 +200,111 @@ impl Store {
         db_path: &Path,
         embedding_dim: usize,
         table_name: &str,
+        overlay: &str,
     ) -> Result<Option<Self>> {
-        let uri = db_path.to_str().expect("db path is not valid UTF-8");
-        let conn = lancedb::connect(uri).execute().await?;
-        match conn.open_table(table_name).execute().await {
-            Ok(table) => Ok(Some(Store { table, embedding_dim })),
-            Err(lancedb::Error::TableNotFound { .. }) => Ok(None),
-            Err(e) => Err(AppError::Database(e)),
-        }
+        let conn = connect(db_path).await?;
+        let table = match conn.open_table(table_name).execute().await {
+            Ok(table) => table,
+            Err(lancedb::Error::TableNotFound { .. }) => return Ok(None),
+            Err(e) => return Err(AppError::Database(e)),
+        };
+        check_schema(&table).await?;
+        let locations =
+            open_or_create_table(&conn, &locations_table_name(table_name), locations_schema())
+                .await?;
+        ensure_overlay_column(&locations, overlay).await?;
+        let routes = RouteTable::open_or_create(&conn, table_name, overlay).await?;
+        let config_usages = ConfigUsageTable::open_or_create(&conn, table_name, overlay).await?;
+        let imports = ImportTable::open_or_create(&conn, table_name, overlay).await?;
+        let calls = CallTable::open_or_create(&conn, table_name, overlay).await?;
+        let definitions = DefinitionTable::open_or_create(&conn, table_name, overlay).await?;
+        let symbols = SymbolTable::open(&conn, table_name).await?;
+        let coverage = CoverageTable::open(&conn, table_name).await?;
+        let profile = ProfileTable::open(&conn, table_name).await?;
+        Ok(Some(Store {
+            table,
+            locations,
+            routes,
+            config_usages,
+            imports,
+            calls,
+            definitions,
+            symbols,
+            coverage,
+            profile,
+            embedding_dim,
+            overlay: overlay.to_string(),
+        }))
     }
 
+    /// Number of unique chunk rows (one per distinct chunk content), shared by
+    /// every overlay.
     pub async fn count_rows(&self) -> Result<usize> {
-        let mut total = 0usize;
-        let mut stream = self.table.query().execute().await?;
+        Ok(self.table.count_rows(None).await?)
+    }
+
+    /// Number of chunk occurrences across the checkout's files, duplicates included.
+    pub async fn count_locations(&self) -> Result<usize> {
+        Ok(self.locations.count_rows(Some(self.in_overlay("1 = 1"))).await?)
+    }
+
+    /// Number of distinct chunk rows the checkout's locations reference.
+    pub async fn count_unique(&self) -> Result<usize> {
+        Ok(self.location_hashes(&self.in_overlay("1 = 1")).await?.len())
+    }
+
+    /// Name of the checkout this store reads and writes.
+    pub fn overlay(&self) -> &str {
+        &self.overlay
+    }
+
+    /// Every overlay with the number of files it maps.
+    pub async fn list_overlays(&self) -> Result<Vec<(String, usize)>> {
+        let mut files: HashMap<String, HashSet<String>> = HashMap::new();
+        let mut stream = self
+            .locations
+            .query()
+            .select(Select::Columns(vec![OVERLAY_FIELD.into(), "file_path".into()]))
+            .execute()
+            .await?;
         while let Some(batch) = stream.try_next().await? {
-            total += batch.num_rows();
+            for i in 0..batch.num_rows() {
+                let overlay = get_nullable_str_col(&batch, OVERLAY_FIELD, i)?.unwrap_or_default();
+                files.entry(overlay).or_default().insert(get_str_col(&batch, "file_path", i)?);
+            }
         }
-        Ok(total)
+        let mut overlays: Vec<(String, usize)> =
+            files.into_iter().map(|(name, files)| (name, files.len())).collect();
+        overlays.sort();
+        Ok(overlays)
+    }
+
+    /// Remove another checkout's overlay, and the chunk rows only it referenced.
+    pub async fn drop_overlay(&self, overlay: &str) -> Result<()> {
+        let filter = overlay_filter(overlay);
+        let hashes = self.location_hashes(&filter).await?;
+        self.locations.delete(&filter).await?;
+        self.routes.drop_overlay(overlay).await?;
+        self.config_usages.drop_overlay(overlay).await?;
+        self.imports.drop_overlay(overlay).await?;
+        self.calls.drop_overlay(overlay).await?;
+        self.definitions.drop_overlay(overlay).await?;
+        self.delete_orphans(hashes.into_iter().collect()).await
+    }
+
+    /// Restrict a locations filter to the current overlay.
+    fn in_overlay(&self, filter: &str) -> String {
+        format!("{} AND ({filter})", overlay_filter(&self.overlay))
     }
 
-    pub async fn list_files(&self) -> Result<std::collections::HashSet<String>> {
-        let mut files = std::collections::HashSet::new();
+    #[tracing::instrument(skip_all)]
+    pub async fn list_files(&self) -> Result<HashSet<String>> {
+        let mut files = HashSet::new();
         let mut stream = self
-            .table
+            .locations
             .query()
-            .select(lancedb::query::Select::Columns(vec!["file_path".into()]))
+            .only_if(self.in_overlay("1 = 1"))
+            .select(Select::Columns(vec!["file_path".into()]))
             .execute()
             .await?;
         while let Some(batch) = stream.try_next().await? {
@@ -127,16 +326,23 @@ impl Store {
     }
 
     pub async fn clear(&self) -> Result<()> {
+        self.locations.delete("1 = 1").await?;
         self.table.delete("1 = 1").await?;
+        self.routes.clear().await?;
+        self.config_usages.clear().await?;
+        self.imports.clear().await?;
+        self.calls.clear().await?;
+        self.definitions.clear().await?;
         Ok(())
     }
 
+    #[tracing::instrument(skip(self))]
     pub async fn get_file_hash(&self, file_path: &str) -> Result<Option<String>> {
         let escaped = file_path.replace('\'', "''");
         let mut stream = self
-            .table
+            .locations
             .query()
-            .only_if(format!("file_path = '{}'", escaped))
+            .only_if(self.in_overlay(&format!("file_path = '{}'", escaped)))
             .limit(1)
             .execute()
             .await?;
@@ -156,22 +362,168 @@ impl Store {
         Ok(None)
     }
 
+    /// Remove everything the current overlay records for `file_path` —
+    /// locations, routes, config usages, imports, calls, definitions — and the
+    /// chunk rows whose content no longer occurs anywhere else, in any overlay.
+    #[tracing::instrument(skip(self))]
     pub async fn delete_file(&self, file_path: &str) -> Result<()> {
         let escaped = file_path.replace('\'', "''");
-        self.table
-            .delete(&format!("file_path = '{}'", escaped))
+        let filter = self.in_overlay(&format!("file_path = '{}'", escaped));
+        let hashes = self.location_hashes(&filter).await?;
+        self.locations.delete(&filter).await?;
+        self.routes.delete_file(file_path).await?;
+        self.config_usages.delete_file(file_path).await?;
+        self.imports.delete_file(file_path).await?;
+        self.calls.delete_file(file_path).await?;
+        self.definitions.delete_file(file_path).await?;
+        self.delete_orphans(hashes.into_iter().collect()).await
+    }
+
+    /// Map `file_path` onto the rows another overlay recorded for the same file
+    /// content, so a branch switch re-uses chunks, embeddings and extracted
+    /// routes, config usages, imports, calls and definitions instead of
+    /// re-parsing the file.
+    /// Returns whether such an overlay was found.
+    #[tracing::instrument(skip(self))]
+    pub async fn adopt_file(&self, file_path: &str, file_hash: &str) -> Result<bool> {
+        let escaped_path = file_path.replace('\'', "''");
+        let escaped_hash = file_hash.replace('\'', "''");
+        let same_file = format!("file_path = '{escaped_path}' AND file_hash = '{escaped_hash}'");
+        let mut stream = self
+            .locations
+            .query()
+            .only_if(format!("NOT ({}) AND {same_file}", overlay_filter(&self.overlay)))
+            .select(Select::Columns(vec![OVERLAY_FIELD.into()]))
+            .limit(1)
+            .execute()
+            .await?;
+        let mut source = None;
+        while let Some(batch) = stream.try_next().await? {
+            if batch.num_rows() > 0 {
+                source = get_nullable_str_col(&batch, OVERLAY_FIELD, 0)?;
+                break;
+            }
+        }
+        let Some(source) = source else {
+            return Ok(false);
+        };
+
+        let filter = format!("{} AND {same_file}", overlay_filter(&source));
+        let mut locations = self.select_rows(&filter).await?;
+        for l in &mut locations {
+            l.file_hash.clear();
+        }
+        self.insert(&[], &locations).await?;
+        self.routes.copy_file(file_path, &source).await?;
+        self.config_usages.copy_file(file_path, &source).await?;
+        self.imports.copy_file(file_path, &source).await?;
+        self.calls.copy_file(file_path, &source).await?;
+        self.definitions.copy_file(file_path, &source).await?;
+        self.stamp_file(file_path, file_hash).await?;
+        Ok(true)
+    }
+
+    /// Set the file hash on the current overlay's locations of `file_path`,
+    /// marking the file as completely stored. Files are written with an empty
+    /// hash first, so one left half-written by an interrupted run doesn't
+    /// match on the next and is indexed again.
+    #[tracing::instrument(skip(self))]
+    pub async fn stamp_file(&self, file_path: &str, file_hash: &str) -> Result<()> {
+        let escaped_path = file_path.replace('\'', "''");
+        self.locations
+            .update()
+            .only_if(self.in_overlay(&format!("file_path = '{escaped_path}'")))
+            .column("file_hash", format!("'{}'", file_hash.replace('\'', "''")))
+            .execute()
             .await?;
         Ok(())
     }
 
-    pub async fn insert(&self, chunks: &[ChunkRecord]) -> Result<()> {
-        if chunks.is_empty() {
-            return Ok(());
+    /// Delete chunk rows for any of `hashes` that no location, in any overlay,
+    /// references any more.
+    async fn delete_orphans(&self, hashes: Vec<String>) -> Result<()> {
+        let mut still_used = HashSet::new();
+        for group in hashes.chunks(IN_LIST_BATCH) {
+            still_used.extend(self.location_hashes(&sql_in("content_hash", group)).await?);
+        }
+        let orphaned: Vec<String> =
+            hashes.into_iter().filter(|h| !still_used.contains(h)).collect();
+        for group in orphaned.chunks(IN_LIST_BATCH) {
+            self.table.delete(&sql_in("content_hash", group)).await?;
+        }
+        Ok(())
+    }
+
+    /// Content hashes of the locations matching `filter`.
+    async fn location_hashes(&self, filter: &str) -> Result<HashSet<String>> {
+        let mut hashes = HashSet::new();
+        let mut stream = self
+            .locations
+            .query()
+            .only_if(filter)
+            .select(Select::Columns(vec!["content_hash".into()]))
+            .execute()
+            .await?;
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                hashes.insert(get_str_col(&batch, "content_hash", i)?);
+            }
+        }
+        Ok(hashes)
+    }
+
+    /// Which of `hashes` already have a chunk row (and therefore embeddings).
+    #[tracing::instrument(skip_all, fields(hashes = hashes.len()))]
+    pub async fn known_content_hashes(&self, hashes: &[String]) -> Result<HashSet<String>> {
+        let mut known = HashSet::new();
+        for group in hashes.chunks(IN_LIST_BATCH) {
+            let mut stream = self
+                .table
+                .query()
+                .only_if(sql_in("content_hash", group))
+                .select(Select::Columns(vec!["content_hash".into()]))
+                .execute()
+                .await?;
+            while let Some(batch) = stream.try_next().await? {
+                for i in 0..batch.num_rows() {
+                    known.insert(get_str_col(&batch, "content_hash", i)?);
+                }
+            }
+        }
+        Ok(known)
+    }
+
+    /// Insert new unique chunk rows and the locations of every occurrence.
+    /// Each `locations` entry must reference either one of `chunks` or a chunk
+    /// row that already exists.
+    #[tracing::instrument(skip_all, fields(chunks = chunks.len(), locations = locations.len()))]
+    pub async fn insert(&self, chunks: &[ChunkRecord], locations: &[LocationRecord]) -> Result<()> {
+        if !chunks.is_empty() {
+            let schema = chunks_schema(self.embedding_dim);
+            let batch = self.chunks_batch(chunks, schema.clone())?;
+            let reader = RecordBatchIterator::new(
+                vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
+                schema,
+            );
+            self.table.add(reader).execute().await?;
+        }
+
+        if !locations.is_empty() {
+            let schema = locations_schema();
+            let batch = locations_batch(locations, &self.overlay, schema.clone())?;
+            let reader = RecordBatchIterator::new(
+                vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
+                schema,
+            );
+            self.locations.add(reader).execute().await?;
         }
 
-        let schema = chunks_schema(self.embedding_dim);
+        Ok(())
+    }
 
+    fn chunks_batch(&self, chunks: &[ChunkRecord], schema: SchemaRef) -> Result<RecordBatch> {
         let mut id_builder = StringBuilder::new();
+        let mut content_hash_builder = StringBuilder::new();
         let mut file_path_builder = StringBuilder::new();
         let mut file_hash_builder = StringBuilder::new();
         let mut language_builder = StringBuilder::new();
@@ -187,6 +539,7 @@ impl Store {
 
         for chunk in chunks {
             id_builder.append_value(&chunk.id);
+            content_hash_builder.append_value(&chunk.content_hash);
             file_path_builder.append_value(&chunk.file_path);
             file_hash_builder.append_value(&chunk.file_hash);
             language_builder.append_value(&chunk.language);
@@ -217,10 +570,11 @@ impl Store {
             }
         }
 
-        let batch = RecordBatch::try_new(
-            schema.clone(),
+        RecordBatch::try_new(
+            schema,
             vec![
                 Arc::new(id_builder.finish()),
+                Arc::new(content_hash_builder.finish()),
                 Arc::new(file_path_builder.finish()),
                 Arc::new(file_hash_builder.finish()),
                 Arc::new(language_builder.finish()),
@@ -233,98 +587,595 @@ impl Store {
                 Arc::new(summary_vector_builder.finish()),
             ],
         )
-        .map_err(|e| AppError::Other(e.into()))?;
-
-        let reader = RecordBatchIterator::new(
-            vec![Ok(batch) as std::result::Result<RecordBatch, ArrowError>],
-            schema,
-        );
+        .map_err(|e| AppError::Other(e.into()))
+    }
 
-        self.table.add(reader).execute().await?;
-        Ok(())
+    /// Nearest chunks to a content vector. With `only`, just the chunks with
+    /// one of those content hashes are searched.
+    #[tracing::instrument(skip(self, vector, only))]
+    pub async fn search(
+        &self,
+        vector: &[f32],
+        limit: usize,
+        only: Option<&[String]>,
+    ) -> Result<Vec<SearchResult>> {
+        self.nearest_located(vector, "vector", None, only, limit).await
     }
 
-    pub async fn search(&self, vector: &[f32], limit: usize) -> Result<Vec<SearchResult>> {
-        let mut stream = self
-            .table
-            .vector_search(vector)?
-            .column("vector")
-            .limit(limit)
-            .execute()
-            .await?;
+    /// Nearest summarised chunks to a summary vector, restricted like `search`.
+    #[tracing::instrument(skip(self, vector, only))]
+    pub async fn search_by_summary(
+        &self,
+        vector: &[f32],
+        limit: usize,
+        only: Option<&[String]>,
+    ) -> Result<Vec<SearchResult>> {
+        self.nearest_located(vector, "summary_vector", Some("summary IS NOT NULL"), only, limit)
+            .await
+    }
 
-        let mut results = Vec::new();
-        while let Some(batch) = stream.try_next().await? {
-            for i in 0..batch.num_rows() {
-                let id = get_str_col(&batch, "id", i)?;
-                let file_path = get_str_col(&batch, "file_path", i)?;
-                let symbol = get_str_col(&batch, "symbol", i)?;
-                let content = get_str_col(&batch, "content", i)?;
-                let start_line = get_u32_col(&batch, "start_line", i)?;
-                let end_line = get_u32_col(&batch, "end_line", i)?;
-                let score = get_f32_col(&batch, "_distance", i).unwrap_or(0.0);
-                let summary = get_nullable_str_col(&batch, "summary", i)?;
-
-                results.push(SearchResult {
-                    id,
-                    file_path,
-                    start_line,
-                    end_line,
-                    symbol,
-                    content,
-                    score,
-                    summary,
-                });
+    /// The `limit` hits nearest to `vector` that have a location in this
+    /// overlay, resolved to it. Chunk rows are shared by every overlay, so
+    /// hits only other checkouts contain are skipped and more are fetched
+    /// until `limit` resolve or the table runs out.
+    async fn nearest_located(
+        &self,
+        vector: &[f32],
+        column: &str,
+        filter: Option<&str>,
+        only: Option<&[String]>,
+        limit: usize,
+    ) -> Result<Vec<SearchResult>> {
+        let mut fetch = limit;
+        loop {
+            let hits = self.nearest(vector, column, filter, only, fetch).await?;
+            let exhausted = hits.len() < fetch;
+            let mut resolved = self.attach_locations(hits).await?;
+            if resolved.len() >= limit || exhausted {
+                resolved.truncate(limit);
+                return Ok(resolved);
             }
+            fetch *= 2;
         }
-
-        Ok(results)
     }
 
-    pub async fn search_by_summary(
+    /// The `limit` rows nearest to `vector` in `column`, best first. `only` is
+    /// applied before the search, so it doesn't cut the result short; a long
+    /// list is searched in groups whose hits are merged.
+    async fn nearest(
         &self,
         vector: &[f32],
+        column: &str,
+        filter: Option<&str>,
+        only: Option<&[String]>,
         limit: usize,
     ) -> Result<Vec<SearchResult>> {
+        let filters: Vec<Option<String>> = match only {
+            None => vec![filter.map(str::to_string)],
+            Some(hashes) => hashes
+                .chunks(IN_LIST_BATCH)
+                .map(|group| {
+                    let only = sql_in("content_hash", group);
+                    Some(match filter {
+                        Some(filter) => format!("{filter} AND {only}"),
+                        None => only,
+                    })
+                })
+                .collect(),
+        };
+
+        let mut results = Vec::new();
+        for filter in &filters {
+            let mut query = self.table.vector_search(vector)?.column(column).limit(limit);
+            if let Some(filter) = filter {
+                query = query.only_if(filter.clone());
+            }
+            let mut stream = query.execute().await?;
+            while let Some(batch) = stream.try_next().await? {
+                push_search_results(&batch, &mut results)?;
+            }
+        }
+        if filters.len() > 1 {
+            results.sort_by(|a, b| a.score.total_cmp(&b.score));
+            results.truncate(limit);
+        }
+        Ok(results)
+    }
+
+    /// Point each hit at the first location of its content (by path, then
+    /// line) and list the remaining occurrences in `also_at`. Hits whose
+    /// content has no location left are dropped.
+    async fn attach_locations(&self, results: Vec<SearchResult>) -> Result<Vec<SearchResult>> {
+        let hashes: Vec<String> = results.iter().map(|r| r.content_hash.clone()).collect();
+        let mut by_hash = self.locations_by_hash(&hashes).await?;
+
+        let mut resolved = Vec::with_capacity(results.len());
+        for mut r in results {
+            let Some(mut locs) = by_hash.remove(&r.content_hash) else {
+                continue;
+            };
+            locs.sort_by(|a, b| {
+                a.file_path.cmp(&b.file_path).then(a.start_line.cmp(&b.start_line))
+            });
+            let primary = locs.remove(0);
+            r.id = primary.id;
+            r.file_path = primary.file_path;
+            r.symbol = primary.symbol;
+            r.start_line = primary.start_line;
+            r.end_line = primary.end_line;
+            r.also_at = locs
+                .iter()
+                .map(|l| format!("{}:{}", l.file_path, l.start_line))
+                .collect();
+            resolved.push(r);
+        }
+        Ok(resolved)
+    }
+
+    pub fn routes(&self) -> &RouteTable {
+        &self.routes
+    }
+
+    pub fn config_usages(&self) -> &ConfigUsageTable {
+        &self.config_usages
+    }
+
+    pub fn imports(&self) -> &ImportTable {
+        &self.imports
+    }
+
+    pub fn calls(&self) -> &CallTable {
+        &self.calls
+    }
+
+    pub fn definitions(&self) -> &DefinitionTable {
+        &self.definitions
+    }
+
+    pub fn symbols(&self) -> Option<&SymbolTable> {
+        self.symbols.as_ref()
+    }
+
+    /// Set `qualified_symbol` on results whose range contains an imported
+    /// definition: the one named like the chunk's tree-sitter symbol if there
+    /// is one, otherwise the first.
+    pub async fn attach_symbols(&self, results: &mut [SearchResult]) -> Result<()> {
+        let Some(symbols) = &self.symbols else {
+            return Ok(());
+        };
+        let files: HashSet<String> = results.iter().map(|r| r.file_path.clone()).collect();
+        let files: Vec<String> = files.into_iter().collect();
+        let mut definitions = symbols.definitions_in_files(&files).await?;
+        definitions.sort_by_key(|d| d.line);
+
+        for r in results.iter_mut() {
+            let inside: Vec<_> = definitions
+                .iter()
+                .filter(|d| {
+                    d.file_path == r.file_path && d.line >= r.start_line && d.line <= r.end_line
+                })
+                .collect();
+            let best = inside.iter().find(|d| d.name == r.symbol).or(inside.first());
+            r.qualified_symbol = best.map(|d| d.symbol.clone());
+        }
+        Ok(())
+    }
+
+    pub fn coverage(&self) -> Option<&CoverageTable> {
+        self.coverage.as_ref()
+    }
+
+    /// Set `coverage` on results whose chunk is unchanged since the coverage
+    /// report was imported.
+    pub async fn attach_coverage(&self, results: &mut [SearchResult]) -> Result<()> {
+        let Some(coverage) = &self.coverage else {
+            return Ok(());
+        };
+        let ids: HashSet<String> = results.iter().map(|r| r.id.clone()).collect();
+        let ids: Vec<String> = ids.into_iter().collect();
+        let by_id: HashMap<String, _> =
+            coverage.for_locations(&ids).await?.into_iter().map(|c| (c.id.clone(), c)).collect();
+        for r in results.iter_mut() {
+            r.coverage = by_id
+                .get(&r.id)
+                .filter(|c| c.content_hash == r.content_hash)
+                .map(ChunkCoverage::from);
+        }
+        Ok(())
+    }
+
+    /// All chunk locations in a file.
+    pub async fn file_locations(&self, file_path: &str) -> Result<Vec<LocationRecord>> {
+        let escaped = file_path.replace('\'', "''");
+        self.select_locations(&format!("file_path = '{escaped}'")).await
+    }
+
+    pub fn profile(&self) -> Option<&ProfileTable> {
+        self.profile.as_ref()
+    }
+
+    /// Set `hotness` on results whose chunk is unchanged since the profile was
+    /// imported.
+    pub async fn attach_hotness(&self, results: &mut [SearchResult]) -> Result<()> {
+        let Some(profile) = &self.profile else {
+            return Ok(());
+        };
+        let ids: HashSet<String> = results.iter().map(|r| r.id.clone()).collect();
+        let ids: Vec<String> = ids.into_iter().collect();
+        let by_id: HashMap<String, _> =
+            profile.for_locations(&ids).await?.into_iter().map(|p| (p.id.clone(), p)).collect();
+        for r in results.iter_mut() {
+            r.hotness = by_id
+                .get(&r.id)
+                .filter(|p| p.content_hash == r.content_hash)
+                .map(ChunkHotness::from);
+        }
+        Ok(())
+    }
+
+    /// All chunk locations in the given files.
+    pub async fn locations_in_files(&self, files: &[String]) -> Result<Vec<LocationRecord>> {
+        let mut locations = Vec::new();
+        for group in files.chunks(IN_LIST_BATCH) {
+            locations.extend(self.select_locations(&sql_in("file_path", group)).await?);
+        }
+        Ok(locations)
+    }
+
+    /// The current overlay's chunk location with the given id
+    /// (`file_path:start_line`).
+    pub async fn location(&self, id: &str) -> Result<Option<LocationRecord>> {
+        let escaped = id.replace('\'', "''");
+        Ok(self.select_locations(&format!("id = '{escaped}'")).await?.into_iter().next())
+    }
+
+    /// Number of chunk locations per indexed file.
+    pub async fn chunks_per_file(&self) -> Result<HashMap<String, usize>> {
+        let mut counts = HashMap::new();
         let mut stream = self
-            .table
-            .vector_search(vector)?
-            .column("summary_vector")
-            .only_if("summary IS NOT NULL")
-            .limit(limit)
+            .locations
+            .query()
+            .only_if(self.in_overlay("1 = 1"))
+            .select(Select::Columns(vec!["file_path".into()]))
             .execute()
             .await?;
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                *counts.entry(get_str_col(&batch, "file_path", i)?).or_insert(0) += 1;
+            }
+        }
+        Ok(counts)
+    }
 
-        let mut results = Vec::new();
+    /// The chunks at `locations`, in the same order, each placed at its own
+    /// location. Scores are zero; `also_at` is left empty.
+    pub async fn chunks_at(&self, locations: &[LocationRecord]) -> Result<Vec<SearchResult>> {
+        let hashes: HashSet<String> = locations.iter().map(|l| l.content_hash.clone()).collect();
+        let hashes: Vec<String> = hashes.into_iter().collect();
+        let mut by_hash = HashMap::new();
+        for group in hashes.chunks(IN_LIST_BATCH) {
+            let mut stream = self
+                .table
+                .query()
+                .only_if(sql_in("content_hash", group))
+                // Everything but the vectors
+                .select(Select::Columns(vec![
+                    "id".into(),
+                    "content_hash".into(),
+                    "file_path".into(),
+                    "language".into(),
+                    "symbol".into(),
+                    "content".into(),
+                    "start_line".into(),
+                    "end_line".into(),
+                    "summary".into(),
+                ]))
+                .execute()
+                .await?;
+            let mut rows = Vec::new();
+            while let Some(batch) = stream.try_next().await? {
+                push_search_results(&batch, &mut rows)?;
+            }
+            by_hash.extend(rows.into_iter().map(|r| (r.content_hash.clone(), r)));
+        }
+
+        Ok(locations
+            .iter()
+            .filter_map(|l| {
+                let mut chunk = by_hash.get(&l.content_hash)?.clone();
+                chunk.id = l.id.clone();
+                chunk.file_path = l.file_path.clone();
+                chunk.symbol = l.symbol.clone();
+                chunk.start_line = l.start_line;
+                chunk.end_line = l.end_line;
+                Some(chunk)
+            })
+            .collect())
+    }
+
+    /// Chunk locations whose tree-sitter symbol is one of `symbols`.
+    pub async fn symbol_locations(&self, symbols: &[String]) -> Result<Vec<LocationRecord>> {
+        let mut locations = Vec::new();
+        for group in symbols.chunks(IN_LIST_BATCH) {
+            locations.extend(self.select_locations(&sql_in("symbol", group)).await?);
+        }
+        Ok(locations)
+    }
+
+    async fn select_locations(&self, filter: &str) -> Result<Vec<LocationRecord>> {
+        self.select_rows(&self.in_overlay(filter)).await
+    }
+
+    /// Location rows matching `filter`, in any overlay.
+    async fn select_rows(&self, filter: &str) -> Result<Vec<LocationRecord>> {
+        let mut stream = self.locations.query().only_if(filter).execute().await?;
+        let mut locations = Vec::new();
         while let Some(batch) = stream.try_next().await? {
             for i in 0..batch.num_rows() {
-                let id = get_str_col(&batch, "id", i)?;
-                let file_path = get_str_col(&batch, "file_path", i)?;
-                let symbol = get_str_col(&batch, "symbol", i)?;
-                let content = get_str_col(&batch, "content", i)?;
-                let start_line = get_u32_col(&batch, "start_line", i)?;
-                let end_line = get_u32_col(&batch, "end_line", i)?;
-                let score = get_f32_col(&batch, "_distance", i).unwrap_or(0.0);
-                let summary = get_nullable_str_col(&batch, "summary", i)?;
-
-                results.push(SearchResult {
-                    id,
-                    file_path,
-                    start_line,
-                    end_line,
-                    symbol,
-                    content,
-                    score,
-                    summary,
+                locations.push(LocationRecord {
+                    id: get_str_col(&batch, "id", i)?,
+                    content_hash: get_str_col(&batch, "content_hash", i)?,
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    file_hash: get_str_col(&batch, "file_hash", i)?,
+                    symbol: get_str_col(&batch, "symbol", i)?,
+                    start_line: get_u32_col(&batch, "start_line", i)?,
+                    end_line: get_u32_col(&batch, "end_line", i)?,
                 });
             }
         }
+        Ok(locations)
+    }
 
-        Ok(results)
+    /// Content embedding vectors for the chunk rows with the given content hashes.
+    pub async fn vectors_for(&self, hashes: &[String]) -> Result<HashMap<String, Vec<f32>>> {
+        let mut vectors = HashMap::new();
+        for group in hashes.chunks(IN_LIST_BATCH) {
+            let mut stream = self
+                .table
+                .query()
+                .only_if(sql_in("content_hash", group))
+                .select(Select::Columns(vec!["content_hash".into(), "vector".into()]))
+                .execute()
+                .await?;
+            while let Some(batch) = stream.try_next().await? {
+                for i in 0..batch.num_rows() {
+                    vectors.insert(
+                        get_str_col(&batch, "content_hash", i)?,
+                        get_vector_col(&batch, "vector", i)?,
+                    );
+                }
+            }
+        }
+        Ok(vectors)
+    }
+
+    /// Content and summary vectors of the chunk rows with the given content
+    /// hashes, so another index of the same files can reuse them.
+    pub async fn embeddings_for(
+        &self,
+        hashes: &[String],
+    ) -> Result<HashMap<String, (Vec<f32>, Option<Vec<f32>>)>> {
+        let mut embeddings = HashMap::new();
+        for group in hashes.chunks(IN_LIST_BATCH) {
+            let mut stream = self
+                .table
+                .query()
+                .only_if(sql_in("content_hash", group))
+                .select(Select::Columns(vec![
+                    "content_hash".into(),
+                    "vector".into(),
+                    "summary_vector".into(),
+                ]))
+                .execute()
+                .await?;
+            while let Some(batch) = stream.try_next().await? {
+                for i in 0..batch.num_rows() {
+                    embeddings.insert(
+                        get_str_col(&batch, "content_hash", i)?,
+                        (
+                            get_vector_col(&batch, "vector", i)?,
+                            get_nullable_vector_col(&batch, "summary_vector", i)?,
+                        ),
+                    );
+                }
+            }
+        }
+        Ok(embeddings)
+    }
+
+    async fn locations_by_hash(&self, hashes: &[String]) -> Result<HashMap<String, Vec<Location>>> {
+        let mut by_hash: HashMap<String, Vec<Location>> = HashMap::new();
+        for group in hashes.chunks(IN_LIST_BATCH) {
+            let mut stream = self
+                .locations
+                .query()
+                .only_if(self.in_overlay(&sql_in("content_hash", group)))
+                .execute()
+                .await?;
+            while let Some(batch) = stream.try_next().await? {
+                for i in 0..batch.num_rows() {
+                    by_hash
+                        .entry(get_str_col(&batch, "content_hash", i)?)
+                        .or_default()
+                        .push(Location {
+                            id: get_str_col(&batch, "id", i)?,
+                            file_path: get_str_col(&batch, "file_path", i)?,
+                            symbol: get_str_col(&batch, "symbol", i)?,
+                            start_line: get_u32_col(&batch, "start_line", i)?,
+                            end_line: get_u32_col(&batch, "end_line", i)?,
+                        });
+                }
+            }
+        }
+        Ok(by_hash)
+    }
+}
+
+pub(super) async fn open_or_create_table(
+    conn: &lancedb::Connection,
+    name: &str,
+    schema: SchemaRef,
+) -> Result<lancedb::Table> {
+    match conn.open_table(name).execute().await {
+        Ok(t) => Ok(t),
+        Err(lancedb::Error::TableNotFound { .. }) => {
+            // First run — create the table from scratch
+            Ok(conn.create_empty_table(name, schema).execute().await?)
+        }
+        Err(e) => {
+            // Corruption, schema mismatch, I/O error, etc.
+            // Propagate — user can recover with `index --reindex`
+            Err(AppError::Database(e))
+        }
+    }
+}
+
+/// Records converted to one Arrow batch when replacing a snapshot table.
+const SNAPSHOT_BATCH: usize = 10_000;
+
+/// Open a snapshot table — imported SCIP symbols, coverage or a profile — if
+/// one has been imported.
+pub(super) async fn open_snapshot(
+    conn: &lancedb::Connection,
+    name: &str,
+) -> Result<Option<lancedb::Table>> {
+    match conn.open_table(name).execute().await {
+        Ok(table) => Ok(Some(table)),
+        Err(lancedb::Error::TableNotFound { .. }) => Ok(None),
+        Err(e) => Err(AppError::Database(e)),
     }
 }
 
-fn get_str_col(batch: &RecordBatch, name: &str, row: usize) -> Result<String> {
+/// Replace the contents of a snapshot table with `records`. Every batch goes
+/// into a single overwrite commit, so searches see either the previous import
+/// or the new one, and a failed write leaves the previous import in place.
+pub(super) async fn replace_snapshot<R>(
+    conn: &lancedb::Connection,
+    name: &str,
+    schema: SchemaRef,
+    records: &[R],
+    to_batch: impl Fn(&[R], SchemaRef) -> Result<RecordBatch>,
+) -> Result<lancedb::Table> {
+    let mut batches: Vec<std::result::Result<RecordBatch, ArrowError>> = Vec::new();
+    for group in records.chunks(SNAPSHOT_BATCH) {
+        batches.push(Ok(to_batch(group, schema.clone())?));
+    }
+    let table = open_or_create_table(conn, name, schema.clone()).await?;
+    let reader = RecordBatchIterator::new(batches, schema);
+    table.add(reader).mode(AddDataMode::Overwrite).execute().await?;
+    Ok(table)
+}
+
+/// Indexes written before chunk deduplication have no `content_hash` column
+/// and must be rebuilt.
+async fn check_schema(table: &lancedb::Table) -> Result<()> {
+    let schema = table.schema().await?;
+    if schema.field_with_name("content_hash").is_err() {
+        return Err(AppError::Other(anyhow::anyhow!(
+            "the index was built by an older version of maharajah; rebuild it with `index --reindex`"
+        )));
+    }
+    Ok(())
+}
+
+fn locations_batch(
+    locations: &[LocationRecord],
+    overlay: &str,
+    schema: SchemaRef,
+) -> Result<RecordBatch> {
+    let mut id_builder = StringBuilder::new();
+    let mut content_hash_builder = StringBuilder::new();
+    let mut file_path_builder = StringBuilder::new();
+    let mut file_hash_builder = StringBuilder::new();
+    let mut symbol_builder = StringBuilder::new();
+    let mut start_line_builder = UInt32Builder::new();
+    let mut end_line_builder = UInt32Builder::new();
+    let mut overlay_builder = StringBuilder::new();
+
+    for loc in locations {
+        id_builder.append_value(&loc.id);
+        content_hash_builder.append_value(&loc.content_hash);
+        file_path_builder.append_value(&loc.file_path);
+        file_hash_builder.append_value(&loc.file_hash);
+        symbol_builder.append_value(&loc.symbol);
+        start_line_builder.append_value(loc.start_line);
+        end_line_builder.append_value(loc.end_line);
+        overlay_builder.append_value(overlay);
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(id_builder.finish()),
+            Arc::new(content_hash_builder.finish()),
+            Arc::new(file_path_builder.finish()),
+            Arc::new(file_hash_builder.finish()),
+            Arc::new(symbol_builder.finish()),
+            Arc::new(start_line_builder.finish()),
+            Arc::new(end_line_builder.finish()),
+            Arc::new(overlay_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
+
+/// Filter selecting the rows of one overlay.
+pub(super) fn overlay_filter(overlay: &str) -> String {
+    format!("{OVERLAY_FIELD} = '{}'", overlay.replace('\'', "''"))
+}
+
+/// Tables written before overlays have no overlay column. Add it, assigning
+/// the existing rows to the current checkout, which is most likely the one
+/// they were indexed from.
+pub(super) async fn ensure_overlay_column(table: &lancedb::Table, overlay: &str) -> Result<()> {
+    let schema = table.schema().await?;
+    if schema.field_with_name(OVERLAY_FIELD).is_ok() {
+        return Ok(());
+    }
+    let literal = format!("'{}'", overlay.replace('\'', "''"));
+    table
+        .add_columns(
+            NewColumnTransform::SqlExpressions(vec![(OVERLAY_FIELD.to_string(), literal)]),
+            None,
+        )
+        .await?;
+    Ok(())
+}
+
+/// Build a `column IN ('a', 'b', ...)` predicate, escaping single quotes.
+pub(super) fn sql_in(column: &str, values: &[String]) -> String {
+    let list: Vec<String> = values
+        .iter()
+        .map(|v| format!("'{}'", v.replace('\'', "''")))
+        .collect();
+    format!("{column} IN ({})", list.join(", "))
+}
+
+/// Decode every row of a vector-search result batch into `out`.
+fn push_search_results(batch: &RecordBatch, out: &mut Vec<SearchResult>) -> Result<()> {
+    for i in 0..batch.num_rows() {
+        out.push(SearchResult {
+            id: get_str_col(batch, "id", i)?,
+            file_path: get_str_col(batch, "file_path", i)?,
+            language: get_str_col(batch, "language", i)?,
+            start_line: get_u32_col(batch, "start_line", i)?,
+            end_line: get_u32_col(batch, "end_line", i)?,
+            symbol: get_str_col(batch, "symbol", i)?,
+            content: get_str_col(batch, "content", i)?,
+            score: get_f32_col(batch, "_distance", i).unwrap_or(0.0),
+            summary: get_nullable_str_col(batch, "summary", i)?,
+            also_at: Vec::new(),
+            qualified_symbol: None,
+            coverage: None,
+            hotness: None,
+            highlight_lines: Vec::new(),
+            content_hash: get_str_col(batch, "content_hash", i)?,
+        });
+    }
+    Ok(())
+}
+
+pub(super) fn get_str_col(batch: &RecordBatch, name: &str, row: usize) -> Result<String> {
     let col = batch
         .column_by_name(name)
         .ok_or_else(|| AppError::Other(anyhow::anyhow!("missing column: {}", name)))?;
@@ -335,7 +1186,7 @@ fn get_str_col(batch: &RecordBatch, name: &str, row: usize) -> Result<String> {
     Ok(arr.value(row).to_string())
 }
 
-fn get_nullable_str_col(
+pub(super) fn get_nullable_str_col(
     batch: &RecordBatch,
     name: &str,
     row: usize,
@@ -356,7 +1207,7 @@ fn get_nullable_str_col(
     }
 }
 
-fn get_u32_col(batch: &RecordBatch, name: &str, row: usize) -> Result<u32> {
+pub(super) fn get_u32_col(batch: &RecordBatch, name: &str, row: usize) -> Result<u32> {
     let col = batch
         .column_by_name(name)
         .ok_or_else(|| AppError::Other(anyhow::anyhow!("missing column: {}", name)))?;
@@ -367,7 +1218,28 @@ fn get_u32_col(batch: &RecordBatch, name: &str, row: usize) -> Result<u32> {
     Ok(arr.value(row))
 }
 
-fn get_f32_col(batch: &RecordBatch, name: &str, row: usize) -> Result<f32> {
+fn get_vector_col(batch: &RecordBatch, name: &str, row: usize) -> Result<Vec<f32>> {
+    let col = batch
+        .column_by_name(name)
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("missing column: {}", name)))?;
+    let list = col
+        .as_any()
+        .downcast_ref::<FixedSizeListArray>()
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("column {} is not FixedSizeListArray", name)))?;
+    let values = list.value(row);
+    let floats = values
+        .as_any()
+        .downcast_ref::<Float32Array>()
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("column {} items are not Float32", name)))?;
+    Ok(floats.values().to_vec())
+}
+
+fn get_nullable_vector_col(batch: &RecordBatch, name: &str, row: usize) -> Result<Option<Vec<f32>>> {
+    let null = batch.column_by_name(name).is_none_or(|c| c.is_null(row));
+    if null { Ok(None) } else { get_vector_col(batch, name, row).map(Some) }
+}
+
+pub(super) fn get_f32_col(batch: &RecordBatch, name: &str, row: usize) -> Result<f32> {
     let col = batch
         .column_by_name(name)
         .ok_or_else(|| AppError::Other(anyhow::anyhow!("missing column: {}", name)))?;
@@ -0,0 +1,311 @@
+/// Store search tests: two checkouts share one database, each seeing only
+/// the chunks its own overlay locates, without coming up short.
+
+#[cfg(test)]
+mod store_tests {
+    use crate::config::AppConfig;
+    use crate::db::store::{ChunkRecord, LocationRecord, SearchResult, Store};
+    use crate::embed::header::{ChunkContext, header};
+    use crate::indexer::chunk_key;
+    use crate::indexer::parser::Chunk;
+    use crate::rag::retriever::{self, SearchMode, SearchOptions};
+    use std::path::{Path, PathBuf};
+
+    const DIM: usize = 4;
+    const QUERY: [f32; DIM] = [1.0, 0.0, 0.0, 0.0];
+
+    fn temp_db(name: &str) -> PathBuf {
+        let dir = std::env::temp_dir().join(format!("mh-store-{name}-{}", std::process::id()));
+        let _ = std::fs::remove_dir_all(&dir);
+        dir
+    }
+
+    async fn open(db: &Path, overlay: &str) -> Store {
+        Store::open_or_create(db, DIM, "chunks", overlay, false).await.unwrap()
+    }
+
+    fn hash(file: &str) -> String {
+        format!("hash-{file}")
+    }
+
+    fn location(file: &str, content_hash: &str) -> LocationRecord {
+        location_at(file, 0, content_hash)
+    }
+
+    fn location_at(file: &str, line: u32, content_hash: &str) -> LocationRecord {
+        LocationRecord {
+            id: format!("{file}:{line}"),
+            content_hash: content_hash.to_string(),
+            file_path: file.to_string(),
+            file_hash: format!("file-{file}"),
+            symbol: "f".to_string(),
+            start_line: line,
+            end_line: line + 1,
+        }
+    }
+
+    /// The row of a chunk first seen in `file`.
+    fn record(file: &str, content_hash: &str, vector: [f32; DIM]) -> ChunkRecord {
+        ChunkRecord {
+            id: format!("{file}:0"),
+            content_hash: content_hash.to_string(),
+            file_path: file.to_string(),
+            file_hash: format!("file-{file}"),
+            language: "rust".to_string(),
+            symbol: "f".to_string(),
+            content: format!("fn f() {{}} // {file}"),
+            start_line: 0,
+            end_line: 1,
+            vector: vector.to_vec(),
+            summary: None,
+            summary_vector: None,
+        }
+    }
+
+    /// Store one chunk per file, each with content of its own.
+    async fn insert(store: &Store, chunks: &[(&str, [f32; DIM])]) {
+        let (chunks, locations): (Vec<ChunkRecord>, Vec<LocationRecord>) = chunks
+            .iter()
+            .map(|(file, vector)| (record(file, &hash(file), *vector), location(file, &hash(file))))
+            .unzip();
+        store.insert(&chunks, &locations).await.unwrap();
+    }
+
+    fn paths(results: &[SearchResult]) -> Vec<&str> {
+        results.iter().map(|r| r.file_path.as_str()).collect()
+    }
+
+    /// `feature` holds the five chunks nearest to `QUERY`, `main` two further off.
+    async fn two_checkouts(db: &Path) -> (Store, Store) {
+        let feature = open(db, "feature").await;
+        insert(
+            &feature,
+            &[
+                ("a.rs", [1.0, 0.0, 0.0, 0.0]),
+                ("b.rs", [0.9, 0.1, 0.0, 0.0]),
+                ("c.rs", [0.9, 0.0, 0.1, 0.0]),
+                ("d.rs", [0.8, 0.2, 0.0, 0.0]),
+                ("e.rs", [0.8, 0.0, 0.2, 0.0]),
+            ],
+        )
+        .await;
+        let main = open(db, "main").await;
+        insert(&main, &[("near.rs", [0.0, 0.5, 0.5, 0.0]), ("far.rs", [0.0, 0.0, 0.0, 1.0])]).await;
+        (main, feature)
+    }
+
+    #[tokio::test]
+    async fn search_fills_the_limit_past_chunks_of_other_overlays() {
+        let db = temp_db("fill");
+        let (main, feature) = two_checkouts(&db).await;
+
+        let results = main.search(&QUERY, 2, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["near.rs", "far.rs"]);
+        let results = feature.search(&QUERY, 2, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["a.rs", "b.rs"]);
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    #[tokio::test]
+    async fn search_returns_fewer_when_the_overlay_runs_out() {
+        let db = temp_db("short");
+        let (main, _) = two_checkouts(&db).await;
+
+        let results = main.search(&QUERY, 10, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["near.rs", "far.rs"]);
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    #[tokio::test]
+    async fn shared_content_resolves_to_each_overlays_own_location() {
+        let db = temp_db("shared");
+        let (main, feature) = two_checkouts(&db).await;
+        // main has a copy of a.rs's content under another name
+        main.insert(&[], &[location("copy.rs", &hash("a.rs"))]).await.unwrap();
+
+        let results = main.search(&QUERY, 1, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["copy.rs"]);
+        assert!(results[0].also_at.is_empty());
+        let results = feature.search(&QUERY, 1, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["a.rs"]);
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    #[tokio::test]
+    async fn only_restricts_the_search_before_the_limit() {
+        let db = temp_db("only");
+        let (main, feature) = two_checkouts(&db).await;
+
+        let only = vec![hash("far.rs")];
+        let results = main.search(&QUERY, 1, Some(&only)).await.unwrap();
+        assert_eq!(paths(&results), vec!["far.rs"]);
+        let only = vec![hash("e.rs"), hash("far.rs")];
+        let results = feature.search(&QUERY, 5, Some(&only)).await.unwrap();
+        assert_eq!(paths(&results), vec!["e.rs"]);
+        assert!(main.search(&QUERY, 5, Some(&[])).await.unwrap().is_empty());
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    /// The key the indexer gives a chunk of `file` under the default header.
+    fn default_key(file: &str) -> String {
+        let chunk = Chunk {
+            language: "rust".to_string(),
+            symbol: "send".to_string(),
+            content: "fn send(&self) {}".to_string(),
+            start_line: 0,
+            end_line: 1,
+            node_kind: "function_item".to_string(),
+            summary: Some("Send the request.".to_string()),
+        };
+        let scope = vec!["impl Client".to_string()];
+        let context = ChunkContext {
+            file_path: file,
+            language: &chunk.language,
+            scope: &scope,
+            summary: chunk.summary.as_deref(),
+        };
+        chunk_key(&chunk, &header(&AppConfig::default().embed.header, &context))
+    }
+
+    #[tokio::test]
+    async fn identical_chunks_in_two_files_share_a_row_by_default() {
+        let db = temp_db("default-header");
+        let store = open(&db, "main").await;
+
+        let key = default_key("vendor/client.rs");
+        assert_eq!(default_key("gen/client.rs"), key);
+        let vendored = record("vendor/client.rs", &key, QUERY);
+        store.insert(&[vendored], &[location("vendor/client.rs", &key)]).await.unwrap();
+        // The indexer only adds a location for content it already stored
+        assert!(store.known_content_hashes(&[key.clone()]).await.unwrap().contains(&key));
+        store.insert(&[], &[location("gen/client.rs", &key)]).await.unwrap();
+
+        assert_eq!(store.count_rows().await.unwrap(), 1);
+        assert_eq!(store.count_locations().await.unwrap(), 2);
+        let results = store.search(&QUERY, 5, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["gen/client.rs"]);
+        assert_eq!(results[0].also_at, vec!["vendor/client.rs:0"]);
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    #[tokio::test]
+    async fn unique_chunks_are_counted_per_overlay() {
+        let db = temp_db("count");
+        let (main, feature) = two_checkouts(&db).await;
+        // A second copy of near.rs's content in main
+        main.insert(&[], &[location("copy.rs", &hash("near.rs"))]).await.unwrap();
+
+        assert_eq!(main.count_rows().await.unwrap(), 7);
+        assert_eq!(main.count_locations().await.unwrap(), 3);
+        assert_eq!(main.count_unique().await.unwrap(), 2);
+        assert_eq!(feature.count_locations().await.unwrap(), 5);
+        assert_eq!(feature.count_unique().await.unwrap(), 5);
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    /// One row whose content occurs in src/stack.rs, at two lines of
+    /// tests/stack.rs and in vendor/stack.rs, and a row only src/other.rs has.
+    async fn copies(store: &Store) {
+        let shared = hash("stack.rs");
+        let locations = [
+            location_at("vendor/stack.rs", 0, &shared),
+            location_at("tests/stack.rs", 30, &shared),
+            location_at("src/stack.rs", 3, &shared),
+            location_at("tests/stack.rs", 10, &shared),
+            location("src/other.rs", &hash("src/other.rs")),
+        ];
+        let rows = [
+            record("vendor/stack.rs", &shared, QUERY),
+            record("src/other.rs", &hash("src/other.rs"), [0.0, 1.0, 0.0, 0.0]),
+        ];
+        store.insert(&rows, &locations).await.unwrap();
+    }
+
+    #[tokio::test]
+    async fn copies_collapse_into_one_hit_at_the_first_location() {
+        let db = temp_db("collapse");
+        let store = open(&db, "main").await;
+        copies(&store).await;
+
+        assert_eq!(store.count_rows().await.unwrap(), 2);
+        assert_eq!(store.count_locations().await.unwrap(), 5);
+        let results = store.search(&QUERY, 5, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["src/stack.rs", "src/other.rs"]);
+        // By path, then line
+        assert_eq!((results[0].id.as_str(), results[0].start_line), ("src/stack.rs:3", 3));
+        assert_eq!(
+            results[0].also_at,
+            vec!["tests/stack.rs:10", "tests/stack.rs:30", "vendor/stack.rs:0"]
+        );
+        assert!(results[1].also_at.is_empty());
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    #[tokio::test]
+    async fn a_path_filter_resolves_a_hit_to_a_matching_copy() {
+        let db = temp_db("relocate");
+        let store = open(&db, "main").await;
+        copies(&store).await;
+
+        let options = SearchOptions { paths: vec!["vendor/**".to_string()], ..Default::default() };
+        let plan =
+            retriever::resolve_plan(&AppConfig::default(), SearchMode::Find, "stack", &options)
+                .unwrap();
+        let results = retriever::search(&store, &QUERY, SearchMode::Find, 5, &plan).await.unwrap();
+        assert_eq!(paths(&results), vec!["vendor/stack.rs"]);
+        assert_eq!(results[0].id, "vendor/stack.rs:0");
+        assert_eq!(
+            results[0].also_at,
+            vec!["src/stack.rs:3", "tests/stack.rs:10", "tests/stack.rs:30"]
+        );
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    #[tokio::test]
+    async fn rows_are_deleted_with_the_last_location_referencing_them() {
+        let db = temp_db("orphans");
+        let store = open(&db, "main").await;
+        copies(&store).await;
+
+        // A changed or removed file is deleted before it is indexed again
+        store.delete_file("src/other.rs").await.unwrap();
+        assert_eq!(store.count_rows().await.unwrap(), 1);
+        store.delete_file("tests/stack.rs").await.unwrap();
+        store.delete_file("src/stack.rs").await.unwrap();
+        assert_eq!(store.count_rows().await.unwrap(), 1);
+        let results = store.search(&QUERY, 5, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["vendor/stack.rs"]);
+        assert!(results[0].also_at.is_empty());
+
+        store.delete_file("vendor/stack.rs").await.unwrap();
+        assert_eq!(store.count_rows().await.unwrap(), 0);
+        assert!(store.search(&QUERY, 5, None).await.unwrap().is_empty());
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+
+    #[tokio::test]
+    async fn rows_another_overlay_references_survive_a_delete() {
+        let db = temp_db("overlay-orphans");
+        let main = open(&db, "main").await;
+        copies(&main).await;
+        let feature = open(&db, "feature").await;
+        feature.insert(&[], &[location("src/stack.rs", &hash("stack.rs"))]).await.unwrap();
+
+        feature.delete_file("src/stack.rs").await.unwrap();
+        assert_eq!(main.count_rows().await.unwrap(), 2);
+        assert!(feature.search(&QUERY, 5, None).await.unwrap().is_empty());
+        let results = main.search(&QUERY, 1, None).await.unwrap();
+        assert_eq!(paths(&results), vec!["src/stack.rs"]);
+
+        std::fs::remove_dir_all(&db).unwrap();
+    }
+}
@@ -0,0 +1,155 @@
+use std::sync::Arc;
+
+use arrow_array::{
+    BooleanArray, RecordBatch,
+    builder::{BooleanBuilder, StringBuilder, UInt32Builder},
+};
+use arrow_schema::SchemaRef;
+use futures::TryStreamExt;
+use lancedb::query::{ExecutableQuery, QueryBase};
+
+use crate::db::schema::symbols_schema;
+use crate::db::store::{
+    IN_LIST_BATCH, get_nullable_str_col, get_str_col, get_u32_col, open_snapshot, replace_snapshot,
+    sql_in,
+};
+use crate::error::{AppError, Result};
+
+/// One occurrence of a precise symbol.
+pub struct SymbolRecord {
+    pub symbol: String,
+    pub name: String,
+    pub file_path: String,
+    pub line: u32,
+    pub column: u32,
+    pub end_line: u32,
+    pub is_definition: bool,
+    pub enclosing_symbol: Option<String>,
+}
+
+fn symbols_table_name(table_name: &str) -> String {
+    format!("{table_name}_symbols")
+}
+
+/// Precise symbol occurrences imported from a SCIP index. Unlike the chunk
+/// tables this is a snapshot: it is replaced wholesale by each import and not
+/// updated by incremental indexing.
+pub struct SymbolTable {
+    table: lancedb::Table,
+}
+
+impl SymbolTable {
+    /// Open the symbols table if a SCIP index has been imported.
+    pub async fn open(conn: &lancedb::Connection, table_name: &str) -> Result<Option<Self>> {
+        let table = open_snapshot(conn, &symbols_table_name(table_name)).await?;
+        Ok(table.map(|table| Self { table }))
+    }
+
+    /// Replace any previous import with `records`.
+    #[tracing::instrument(skip_all, fields(records = records.len()))]
+    pub async fn replace(
+        conn: &lancedb::Connection,
+        table_name: &str,
+        records: &[SymbolRecord],
+    ) -> Result<Self> {
+        let name = symbols_table_name(table_name);
+        let table = replace_snapshot(conn, &name, symbols_schema(), records, symbols_batch).await?;
+        Ok(Self { table })
+    }
+
+    /// Definitions whose display name or full SCIP symbol is `name`.
+    pub async fn definitions_named(&self, name: &str) -> Result<Vec<SymbolRecord>> {
+        let escaped = name.replace('\'', "''");
+        self.select(&format!(
+            "is_definition AND (name = '{escaped}' OR symbol = '{escaped}')"
+        ))
+        .await
+    }
+
+    /// Non-definition occurrences of any of `symbols`.
+    pub async fn references_to(&self, symbols: &[String]) -> Result<Vec<SymbolRecord>> {
+        let mut references = Vec::new();
+        for group in symbols.chunks(IN_LIST_BATCH) {
+            let filter = format!("NOT is_definition AND {}", sql_in("symbol", group));
+            references.extend(self.select(&filter).await?);
+        }
+        Ok(references)
+    }
+
+    pub async fn definitions_in_files(&self, files: &[String]) -> Result<Vec<SymbolRecord>> {
+        let mut definitions = Vec::new();
+        for group in files.chunks(IN_LIST_BATCH) {
+            let filter = format!("is_definition AND {}", sql_in("file_path", group));
+            definitions.extend(self.select(&filter).await?);
+        }
+        Ok(definitions)
+    }
+
+    async fn select(&self, filter: &str) -> Result<Vec<SymbolRecord>> {
+        let mut stream = self.table.query().only_if(filter).execute().await?;
+        let mut records = Vec::new();
+        while let Some(batch) = stream.try_next().await? {
+            for i in 0..batch.num_rows() {
+                records.push(SymbolRecord {
+                    symbol: get_str_col(&batch, "symbol", i)?,
+                    name: get_str_col(&batch, "name", i)?,
+                    file_path: get_str_col(&batch, "file_path", i)?,
+                    line: get_u32_col(&batch, "line", i)?,
+                    column: get_u32_col(&batch, "column", i)?,
+                    end_line: get_u32_col(&batch, "end_line", i)?,
+                    is_definition: get_bool_col(&batch, "is_definition", i)?,
+                    enclosing_symbol: get_nullable_str_col(&batch, "enclosing_symbol", i)?,
+                });
+            }
+        }
+        Ok(records)
+    }
+}
+
+fn symbols_batch(records: &[SymbolRecord], schema: SchemaRef) -> Result<RecordBatch> {
+    let mut symbol_builder = StringBuilder::new();
+    let mut name_builder = StringBuilder::new();
+    let mut file_path_builder = StringBuilder::new();
+    let mut line_builder = UInt32Builder::new();
+    let mut column_builder = UInt32Builder::new();
+    let mut end_line_builder = UInt32Builder::new();
+    let mut is_definition_builder = BooleanBuilder::new();
+    let mut enclosing_builder = StringBuilder::new();
+
+    for r in records {
+        symbol_builder.append_value(&r.symbol);
+        name_builder.append_value(&r.name);
+        file_path_builder.append_value(&r.file_path);
+        line_builder.append_value(r.line);
+        column_builder.append_value(r.column);
+        end_line_builder.append_value(r.end_line);
+        is_definition_builder.append_value(r.is_definition);
+        enclosing_builder.append_option(r.enclosing_symbol.as_deref());
+    }
+
+    RecordBatch::try_new(
+        schema,
+        vec![
+            Arc::new(symbol_builder.finish()),
+            Arc::new(name_builder.finish()),
+            Arc::new(file_path_builder.finish()),
+            Arc::new(line_builder.finish()),
+            Arc::new(column_builder.finish()),
+            Arc::new(end_line_builder.finish()),
+            Arc::new(is_definition_builder.finish()),
+            Arc::new(enclosing_builder.finish()),
+        ],
+    )
+    .map_err(|e| AppError::Other(e.into()))
+}
+
+fn get_bool_col(batch: &RecordBatch, name: &str, row: usize) -> Result<bool> {
+    let col = batch
+        .column_by_name(name)
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("missing column: {}", name)))?;
+    let arr = col
+        .as_any()
+        .downcast_ref::<BooleanArray>()
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("column {} is not BooleanArray", name)))?;
+    Ok(arr.value(row))
+}
@@ -0,0 +1,63 @@
+use crate::config::HeaderField;
+
+#[cfg(test)]
+#[path = "header_tests.rs"]
+mod header_tests;
+
+/// Where a chunk sits, which its text alone doesn't say.
+pub struct ChunkContext<'a> {
+    /// Path relative to the indexed directory
+    pub file_path: &'a str,
+    pub language: &'a str,
+    /// Enclosing definitions, outermost first (`impl Store`, `class Parser`)
+    pub scope: &'a [String],
+    pub summary: Option<&'a str>,
+}
+
+/// Lines prepended to a chunk's text before it is embedded, one per field
+/// in `fields` that has a value, followed by a blank line. Empty when no
+/// field has a value.
+pub fn header(fields: &[HeaderField], context: &ChunkContext) -> String {
+    let mut lines = Vec::with_capacity(fields.len());
+    for field in fields {
+        match field {
+            HeaderField::Path => lines.push(format!("File: {}", context.file_path)),
+            HeaderField::Language => lines.push(format!("Language: {}", context.language)),
+            HeaderField::Scope if !context.scope.is_empty() => {
+                lines.push(format!("In: {}", context.scope.join(" > ")))
+            }
+            HeaderField::Summary => {
+                // The first line is the gist; the whole summary has its own vector
+                if let Some(first) =
+                    context.summary.and_then(|s| s.lines().map(str::trim).find(|l| !l.is_empty()))
+                {
+                    lines.push(format!("Summary: {first}"));
+                }
+            }
+            HeaderField::Scope => {}
+        }
+    }
+    if lines.is_empty() {
+        return String::new();
+    }
+    lines.push(String::new());
+    lines.push(String::new());
+    lines.join("\n")
+}
+
+/// Human-readable form of an enclosing definition: the keyword its node kind
+/// starts with and its name, e.g. `impl_item` Store → `impl Store`.
+pub fn scope_entry(kind: &str, name: &str) -> String {
+    let keyword = kind
+        .trim_end_matches("_item")
+        .trim_end_matches("_declaration")
+        .trim_end_matches("_definition")
+        .trim_end_matches("_decl");
+    match keyword {
+        // Wrappers and grammars whose kinds don't read as a keyword
+        "decorated" | "" => name.to_string(),
+        // Function expressions, named after what they are bound to
+        "arrow_function" | "function_expression" | "lambda" => format!("function {name}"),
+        k => format!("{} {name}", k.replace('_', " ")),
+    }
+}
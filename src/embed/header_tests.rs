@@ -0,0 +1,43 @@
+/// Header tests: fields are rendered in the configured order and fields
+/// without a value are left out.
+
+#[cfg(test)]
+mod header_tests {
+    use crate::config::HeaderField;
+    use crate::embed::header::{ChunkContext, header, scope_entry};
+
+    const ALL: &[HeaderField] =
+        &[HeaderField::Path, HeaderField::Language, HeaderField::Scope, HeaderField::Summary];
+
+    #[test]
+    fn all_fields_are_rendered_before_a_blank_line() {
+        let scope = vec!["impl Store".to_string()];
+        let context = ChunkContext {
+            file_path: "src/db/store.rs",
+            language: "rust",
+            scope: &scope,
+            summary: Some("Insert chunk rows.\n\nLocations are written too."),
+        };
+        assert_eq!(
+            header(ALL, &context),
+            "File: src/db/store.rs\nLanguage: rust\nIn: impl Store\nSummary: Insert chunk rows.\n\n"
+        );
+    }
+
+    #[test]
+    fn fields_without_a_value_are_skipped() {
+        let context =
+            ChunkContext { file_path: "main.go", language: "go", scope: &[], summary: None };
+        assert_eq!(header(&[HeaderField::Scope, HeaderField::Summary], &context), "");
+        assert_eq!(header(&[HeaderField::Path], &context), "File: main.go\n\n");
+    }
+
+    #[test]
+    fn scope_entries_read_as_keywords() {
+        assert_eq!(scope_entry("impl_item", "Store"), "impl Store");
+        assert_eq!(scope_entry("class_declaration", "Parser"), "class Parser");
+        assert_eq!(scope_entry("decorated_definition", "handler"), "handler");
+        assert_eq!(scope_entry("module", "Api"), "module Api");
+        assert_eq!(scope_entry("arrow_function", "handler"), "function handler");
+    }
+}
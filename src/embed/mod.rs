@@ -1 +1,3 @@
+pub mod header;
 pub mod nomic;
+pub mod preprocess;
@@ -3,11 +3,40 @@ use candle_core::{DType, Device, IndexOp, Tensor};
 use candle_nn::VarBuilder;
 use candle_transformers::models::nomic_bert::{Config, NomicBertModel};
 use hf_hub::api::sync::{Api, ApiRepo};
+use serde::{Deserialize, Serialize};
 use tokenizers::Tokenizer;
 
+#[cfg(test)]
+#[path = "nomic_tests.rs"]
+mod nomic_tests;
+
 const QUERY_PREFIX: &str = "Represent this query for searching relevant code: ";
 const MAX_LEN: usize = 8192;
-const MODEL_ID: &str = "nomic-ai/CodeRankEmbed";
+/// Most tokens, padding included, run through the model at once. Attention
+/// grows with the square of the padded length, so no batch costs more than
+/// one text of the full context.
+const MAX_BATCH_TOKENS: usize = MAX_LEN;
+pub const MODEL_ID: &str = "nomic-ai/CodeRankEmbed";
+
+/// How a text is embedded: as code, verbatim, or as a query, behind the
+/// model's task instruction.
+#[derive(Clone, Copy, Debug, Default, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum EmbedMode {
+    #[default]
+    Code,
+    Query,
+}
+
+/// A text's vector and what the model saw of it.
+#[derive(Serialize)]
+pub struct Embedding {
+    pub vector: Vec<f32>,
+    /// Tokens the text encodes to, instruction included
+    pub tokens: usize,
+    /// Whether tokens past the model's context were dropped
+    pub truncated: bool,
+}
 
 // ─── HuggingFace download helper ─────────────────────────────────────────────
 
@@ -37,7 +66,9 @@ fn hf_get(repo: &ApiRepo, repo_id: &str, filename: &str) -> Result<std::path::Pa
 
 // ─── Tokenization ─────────────────────────────────────────────────────────────
 
-fn tokenize(tok: &Tokenizer, text: &str) -> (Vec<i64>, Vec<i64>) {
+/// Token ids and attention mask of `text`, truncated to `MAX_LEN`, and the
+/// number of tokens before truncation.
+fn tokenize(tok: &Tokenizer, text: &str) -> (Vec<i64>, Vec<i64>, usize) {
     let encoding = tok.encode(text, true).expect("tokenize failed");
     let ids: Vec<i64> = encoding
         .get_ids()
@@ -51,17 +82,17 @@ fn tokenize(tok: &Tokenizer, text: &str) -> (Vec<i64>, Vec<i64>) {
         .take(MAX_LEN)
         .map(|&x| x as i64)
         .collect();
-    (ids, mask)
+    (ids, mask, encoding.len())
 }
 
 // ─── Embedding utility ────────────────────────────────────────────────────────
 
-fn cls_pool_and_normalize(hidden: &Tensor) -> Result<Vec<f32>> {
-    // hidden shape: (batch=1, seq_len, n_embd) — take CLS token at position 0
+fn cls_pool_and_normalize(hidden: &Tensor) -> Result<Vec<Vec<f32>>> {
+    // hidden shape: (batch, seq_len, n_embd) — take CLS token at position 0
     let cls = hidden.i((.., 0usize, ..))?;
-    // l2-normalize
-    let norm = cls.broadcast_div(&cls.sqr()?.sum_all()?.sqrt()?)?;
-    Ok(norm.squeeze(0)?.to_vec1::<f32>()?)
+    // l2-normalize each row
+    let norm = cls.broadcast_div(&cls.sqr()?.sum_keepdim(1)?.sqrt()?)?;
+    Ok(norm.to_vec2::<f32>()?)
 }
 
 // ─── Public embedder ──────────────────────────────────────────────────────────
@@ -110,19 +141,117 @@ impl NomicEmbedder {
     }
 
     /// Embed a code snippet. No prefix is prepended.
+    #[tracing::instrument(name = "embed_code", skip_all, fields(bytes = text.len()))]
     pub fn embed_code(&self, text: &str) -> Result<Vec<f32>> {
         self.embed_raw(text)
     }
 
     /// Embed a natural-language query. Prepends the required task instruction.
+    #[tracing::instrument(name = "embed_query", skip_all, fields(bytes = query.len()))]
     pub fn embed_query(&self, query: &str) -> Result<Vec<f32>> {
         let prefixed = format!("{QUERY_PREFIX}{query}");
         self.embed_raw(&prefixed)
     }
 
+    /// Embed a query whose instruction template has already been applied
+    /// (see `search.templates`). No further prefix is prepended.
+    #[tracing::instrument(name = "embed_prompt", skip_all, fields(bytes = prompt.len()))]
+    pub fn embed_prompt(&self, prompt: &str) -> Result<Vec<f32>> {
+        self.embed_raw(prompt)
+    }
+
+    /// Embed several prompts in batched forward passes. Shorter inputs are
+    /// padded and the padding is masked out, so each vector matches
+    /// `embed_prompt`.
+    #[tracing::instrument(name = "embed_prompts", skip_all, fields(count = prompts.len()))]
+    pub fn embed_prompts(&self, prompts: &[String]) -> Result<Vec<Vec<f32>>> {
+        let encoded: Vec<(Vec<i64>, Vec<i64>)> = tracing::trace_span!("tokenize").in_scope(|| {
+            prompts
+                .iter()
+                .map(|p| {
+                    let (ids, mask, _) = tokenize(&self.tokenizer, p);
+                    (ids, mask)
+                })
+                .collect()
+        });
+        self.forward_batch(encoded)
+    }
+
+    /// Embed texts in batched forward passes, as code or as queries, with
+    /// their token counts.
+    #[tracing::instrument(name = "embed_texts", skip_all, fields(count = texts.len()))]
+    pub fn embed_texts(&self, texts: &[String], mode: EmbedMode) -> Result<Vec<Embedding>> {
+        let mut encoded = Vec::with_capacity(texts.len());
+        let mut counts = Vec::with_capacity(texts.len());
+        tracing::trace_span!("tokenize").in_scope(|| {
+            for text in texts {
+                let (ids, mask, tokens) = match mode {
+                    EmbedMode::Code => tokenize(&self.tokenizer, text),
+                    EmbedMode::Query => {
+                        tokenize(&self.tokenizer, &format!("{QUERY_PREFIX}{text}"))
+                    }
+                };
+                encoded.push((ids, mask));
+                counts.push(tokens);
+            }
+        });
+        let vectors = self.forward_batch(encoded)?;
+        Ok(vectors
+            .into_iter()
+            .zip(counts)
+            .map(|(vector, tokens)| Embedding { vector, tokens, truncated: tokens > MAX_LEN })
+            .collect())
+    }
+
+    /// Run tokenized inputs through the model in padded batches of similar
+    /// length, returning vectors in input order.
+    fn forward_batch(&self, encoded: Vec<(Vec<i64>, Vec<i64>)>) -> Result<Vec<Vec<f32>>> {
+        let lengths: Vec<usize> = encoded.iter().map(|(ids, _)| ids.len()).collect();
+        let mut inputs: Vec<Option<_>> = encoded.into_iter().map(Some).collect();
+        let mut vectors = vec![Vec::new(); inputs.len()];
+        for group in sub_batches(&lengths, MAX_BATCH_TOKENS) {
+            let batch = group.iter().filter_map(|&i| inputs[i].take()).collect();
+            for (i, vector) in group.into_iter().zip(self.forward_padded(batch)?) {
+                vectors[i] = vector;
+            }
+        }
+        Ok(vectors)
+    }
+
+    /// Run tokenized inputs through the model as one padded batch.
+    fn forward_padded(&self, encoded: Vec<(Vec<i64>, Vec<i64>)>) -> Result<Vec<Vec<f32>>> {
+        if encoded.is_empty() {
+            return Ok(Vec::new());
+        }
+        let batch = encoded.len();
+        let seq_len = encoded.iter().map(|(ids, _)| ids.len()).max().unwrap_or(0);
+        let _forward = tracing::debug_span!("forward", batch, tokens = seq_len).entered();
+
+        let pad = self.tokenizer.token_to_id("[PAD]").unwrap_or(0) as i64;
+        let mut ids = Vec::with_capacity(batch * seq_len);
+        let mut mask = Vec::with_capacity(batch * seq_len);
+        for (i, m) in encoded {
+            let padding = seq_len - i.len();
+            ids.extend(i.into_iter().chain(std::iter::repeat_n(pad, padding)));
+            mask.extend(m.into_iter().chain(std::iter::repeat_n(0, padding)));
+        }
+
+        let input_ids = Tensor::from_vec(ids, (batch, seq_len), &self.device)?;
+        let attention_mask = Tensor::from_vec(mask, (batch, seq_len), &self.device)?;
+        let token_type_ids = Tensor::zeros((batch, seq_len), DType::I64, &self.device)?;
+
+        let hidden = self
+            .model
+            .forward(&input_ids, Some(&token_type_ids), Some(&attention_mask))?;
+
+        cls_pool_and_normalize(&hidden)
+    }
+
     fn embed_raw(&self, text: &str) -> Result<Vec<f32>> {
-        let (ids, mask) = tokenize(&self.tokenizer, text);
+        let (ids, mask, _) =
+            tracing::trace_span!("tokenize").in_scope(|| tokenize(&self.tokenizer, text));
         let seq_len = ids.len();
+        let _forward = tracing::debug_span!("forward", tokens = seq_len).entered();
 
         let input_ids = Tensor::from_vec(ids, (1, seq_len), &self.device)?;
         let attention_mask = Tensor::from_vec(mask, (1, seq_len), &self.device)?;
@@ -132,6 +261,24 @@ impl NomicEmbedder {
             .model
             .forward(&input_ids, Some(&token_type_ids), Some(&attention_mask))?;
 
-        cls_pool_and_normalize(&hidden)
+        let mut vectors = cls_pool_and_normalize(&hidden)?;
+        Ok(vectors.remove(0))
+    }
+}
+
+/// Indices of inputs of these token lengths, grouped shortest first so each
+/// group pads to at most `budget` tokens in all. An input longer than the
+/// budget is a group of its own.
+fn sub_batches(lengths: &[usize], budget: usize) -> Vec<Vec<usize>> {
+    let mut order: Vec<usize> = (0..lengths.len()).collect();
+    order.sort_by_key(|&i| lengths[i]);
+    let mut groups: Vec<Vec<usize>> = Vec::new();
+    for i in order {
+        // Sorted, so the newest input is the longest and sets the padding
+        match groups.last_mut() {
+            Some(group) if (group.len() + 1) * lengths[i] <= budget => group.push(i),
+            _ => groups.push(vec![i]),
+        }
     }
+    groups
 }
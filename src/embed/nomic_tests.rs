@@ -0,0 +1,42 @@
+/// Embedder batching tests: inputs are grouped by length under a padded
+/// token budget, each exactly once.
+
+#[cfg(test)]
+mod nomic_tests {
+    use crate::embed::nomic::sub_batches;
+
+    #[test]
+    fn short_inputs_share_a_batch() {
+        assert_eq!(sub_batches(&[10, 20, 30], 100), vec![vec![0, 1, 2]]);
+    }
+
+    #[test]
+    fn inputs_are_grouped_shortest_first_under_the_budget() {
+        // Sorted: 10 (1), 20 (3), 40 (0), 50 (2); 3 × 40 overflows, 2 × 50 fits
+        assert_eq!(sub_batches(&[40, 10, 50, 20], 100), vec![vec![1, 3], vec![0, 2]]);
+        assert_eq!(sub_batches(&[40, 10, 50, 20], 80), vec![vec![1, 3], vec![0], vec![2]]);
+    }
+
+    #[test]
+    fn an_input_over_the_budget_runs_alone() {
+        assert_eq!(sub_batches(&[5, 500, 5], 100), vec![vec![0, 2], vec![1]]);
+    }
+
+    #[test]
+    fn every_input_is_in_exactly_one_batch() {
+        let lengths: Vec<usize> = (0..64).map(|i| (i * 37) % 300 + 1).collect();
+        let groups = sub_batches(&lengths, 1024);
+        let mut seen: Vec<usize> = groups.iter().flatten().copied().collect();
+        seen.sort();
+        assert_eq!(seen, (0..64).collect::<Vec<_>>());
+        for group in &groups {
+            let longest = group.iter().map(|&i| lengths[i]).max().unwrap();
+            assert!(group.len() == 1 || group.len() * longest <= 1024);
+        }
+    }
+
+    #[test]
+    fn no_inputs_no_batches() {
+        assert!(sub_batches(&[], 100).is_empty());
+    }
+}
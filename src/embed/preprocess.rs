@@ -0,0 +1,252 @@
+use crate::config::{PreprocessConfig, PreprocessStep};
+
+#[cfg(test)]
+#[path = "preprocess_tests.rs"]
+mod preprocess_tests;
+
+/// Words whose presence marks a comment block as a license banner.
+const LICENSE_MARKERS: &[&str] = &["license", "licence", "copyright", "spdx-license-identifier"];
+
+/// Text of a chunk as sent to the embedding model: `config.steps` applied in
+/// order. The chunk content stored and displayed is never changed.
+pub fn preprocess(content: &str, language: &str, config: &PreprocessConfig) -> String {
+    let mut text = content.to_string();
+    for step in &config.steps {
+        text = match step {
+            PreprocessStep::StripLicense => strip_license(&text, language),
+            PreprocessStep::DropImports => drop_imports(&text, language),
+            PreprocessStep::TruncateStrings => {
+                truncate_strings(&text, language, config.max_string_chars)
+            }
+            PreprocessStep::CollapseWhitespace => collapse_whitespace(&text),
+            PreprocessStep::SplitIdentifiers => split_identifiers(&text),
+        };
+    }
+    // A chunk that is all boilerplate still needs some text to embed
+    if text.trim().is_empty() { content.to_string() } else { text }
+}
+
+fn line_comment(language: &str) -> &'static str {
+    match language {
+        "python" | "ruby" => "#",
+        "haskell" => "--",
+        _ => "//",
+    }
+}
+
+fn block_comment(language: &str) -> Option<(&'static str, &'static str)> {
+    match language {
+        "python" | "ruby" => None,
+        "haskell" => Some(("{-", "-}")),
+        "fsharp" => Some(("(*", "*)")),
+        _ => Some(("/*", "*/")),
+    }
+}
+
+/// Remove comment blocks — runs of line comments, or one block comment —
+/// that mention a license or copyright.
+fn strip_license(text: &str, language: &str) -> String {
+    let lines: Vec<&str> = text.lines().collect();
+    let prefix = line_comment(language);
+    let block = block_comment(language);
+    let mut kept = Vec::with_capacity(lines.len());
+    let mut i = 0;
+    while i < lines.len() {
+        let trimmed = lines[i].trim_start();
+        let end = if trimmed.starts_with(prefix) {
+            let run = lines[i..].iter().take_while(|l| l.trim_start().starts_with(prefix)).count();
+            Some(i + run)
+        } else if let Some((open, close)) = block.filter(|(open, _)| trimmed.starts_with(open)) {
+            let after_open = &trimmed[open.len()..];
+            if after_open.contains(close) {
+                Some(i + 1)
+            } else {
+                lines[i + 1..].iter().position(|l| l.contains(close)).map(|p| i + p + 2)
+            }
+        } else {
+            None
+        };
+        match end {
+            Some(end) if is_license(&lines[i..end]) => i = end,
+            Some(end) => {
+                kept.extend_from_slice(&lines[i..end]);
+                i = end;
+            }
+            None => {
+                kept.push(lines[i]);
+                i += 1;
+            }
+        }
+    }
+    kept.join("\n")
+}
+
+fn is_license(comment: &[&str]) -> bool {
+    comment.iter().any(|l| {
+        let l = l.to_lowercase();
+        LICENSE_MARKERS.iter().any(|m| l.contains(m))
+    })
+}
+
+/// Keywords starting an import statement, per language.
+fn import_keywords(language: &str) -> &'static [&'static str] {
+    match language {
+        "rust" => &["use ", "pub use ", "extern crate "],
+        "python" => &["import ", "from "],
+        "javascript" | "typescript" | "tsx" | "go" | "java" | "kotlin" | "scala" | "haskell" => {
+            &["import "]
+        }
+        "fsharp" => &["open "],
+        "csharp" => &["using ", "global using "],
+        "ruby" => &["require ", "require_relative "],
+        _ => &[],
+    }
+}
+
+/// Remove import statements. A statement continues over the following lines
+/// while it has unclosed brackets (`use a::{`, `import (`).
+fn drop_imports(text: &str, language: &str) -> String {
+    let keywords = import_keywords(language);
+    let mut kept = Vec::new();
+    let mut depth = 0i32;
+    for line in text.lines() {
+        let trimmed = line.trim_start();
+        // `using (var x = ...)` is a C# statement, `from` in Python needs `import`
+        let is_import = depth > 0
+            || (keywords.iter().any(|k| trimmed.starts_with(k))
+                && !(language == "csharp" && trimmed.starts_with("using ("))
+                && !(language == "python"
+                    && trimmed.starts_with("from ")
+                    && !trimmed.contains(" import")));
+        if !is_import {
+            kept.push(line);
+            continue;
+        }
+        for c in trimmed.chars() {
+            match c {
+                '{' | '(' | '[' => depth += 1,
+                '}' | ')' | ']' => depth -= 1,
+                _ => {}
+            }
+        }
+        depth = depth.max(0);
+    }
+    kept.join("\n")
+}
+
+/// Shorten string literals longer than `max_chars` characters, keeping the
+/// start. Literals spanning lines are left alone.
+fn truncate_strings(text: &str, language: &str, max_chars: usize) -> String {
+    let quotes: &[char] = match language {
+        "python" | "ruby" => &['"', '\''],
+        "javascript" | "typescript" | "tsx" => &['"', '\'', '`'],
+        "go" => &['"', '`'],
+        // Single quotes are characters or lifetimes elsewhere
+        _ => &['"'],
+    };
+    let mut out = String::with_capacity(text.len());
+    for (n, line) in text.lines().enumerate() {
+        if n > 0 {
+            out.push('\n');
+        }
+        let mut chars = line.chars();
+        while let Some(c) = chars.next() {
+            out.push(c);
+            if !quotes.contains(&c) {
+                continue;
+            }
+            let mut literal = String::new();
+            let mut closed = false;
+            while let Some(d) = chars.next() {
+                if d == '\\' {
+                    literal.push(d);
+                    if let Some(escaped) = chars.next() {
+                        literal.push(escaped);
+                    }
+                    continue;
+                }
+                if d == c {
+                    closed = true;
+                    break;
+                }
+                literal.push(d);
+            }
+            if closed && literal.chars().count() > max_chars {
+                out.extend(literal.chars().take(max_chars));
+                out.push('…');
+            } else {
+                out.push_str(&literal);
+            }
+            if closed {
+                out.push(c);
+            }
+        }
+    }
+    out
+}
+
+/// Drop indentation, trailing whitespace and blank lines, and collapse runs
+/// of spaces inside lines.
+fn collapse_whitespace(text: &str) -> String {
+    text.lines()
+        .map(|l| l.split_whitespace().collect::<Vec<_>>().join(" "))
+        .filter(|l| !l.is_empty())
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Rewrite compound identifiers as words: `parse_file` and `parseFile`
+/// become `parse file`, `HTTPServer` becomes `http server`.
+fn split_identifiers(text: &str) -> String {
+    let mut out = String::with_capacity(text.len());
+    let mut ident = String::new();
+    for c in text.chars().chain(std::iter::once('\0')) {
+        if c.is_alphanumeric() || c == '_' {
+            ident.push(c);
+            continue;
+        }
+        if !ident.is_empty() {
+            out.push_str(&identifier_words(&ident));
+            ident.clear();
+        }
+        if c != '\0' {
+            out.push(c);
+        }
+    }
+    out
+}
+
+fn identifier_words(ident: &str) -> String {
+    let chars: Vec<char> = ident.chars().collect();
+    let mut words: Vec<String> = Vec::new();
+    let mut word = String::new();
+    for (i, &c) in chars.iter().enumerate() {
+        if c == '_' {
+            if !word.is_empty() {
+                words.push(std::mem::take(&mut word));
+            }
+            continue;
+        }
+        let prev = i.checked_sub(1).map(|p| chars[p]);
+        let next = chars.get(i + 1);
+        // fooBar → foo|Bar; HTTPServer → HTTP|Server
+        let boundary = c.is_uppercase()
+            && prev.is_some_and(|p| {
+                p.is_lowercase()
+                    || p.is_ascii_digit()
+                    || (p.is_uppercase() && next.is_some_and(|n| n.is_lowercase()))
+            });
+        if boundary && !word.is_empty() {
+            words.push(std::mem::take(&mut word));
+        }
+        word.extend(c.to_lowercase());
+    }
+    if !word.is_empty() {
+        words.push(word);
+    }
+    if words.len() < 2 {
+        // Plain words and constants keep their spelling
+        return ident.to_string();
+    }
+    words.join(" ")
+}
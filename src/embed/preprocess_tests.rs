@@ -0,0 +1,81 @@
+/// Preprocessing tests: each step rewrites only the text sent to the model,
+/// and a chunk that would become empty is embedded unchanged.
+
+#[cfg(test)]
+mod preprocess_tests {
+    use crate::config::{PreprocessConfig, PreprocessStep};
+    use crate::embed::preprocess::preprocess;
+
+    fn with(steps: &[PreprocessStep]) -> PreprocessConfig {
+        PreprocessConfig { steps: steps.to_vec(), max_string_chars: 8 }
+    }
+
+    #[test]
+    fn no_steps_keep_the_text() {
+        let text = "fn main() {\n    run();\n}";
+        assert_eq!(preprocess(text, "rust", &with(&[])), text);
+    }
+
+    #[test]
+    fn license_banners_are_stripped_other_comments_kept() {
+        let text = "// Copyright 2024 Acme\n// SPDX-License-Identifier: MIT\n\n// Entry point\nfn main() {}";
+        assert_eq!(
+            preprocess(text, "rust", &with(&[PreprocessStep::StripLicense])),
+            "\n// Entry point\nfn main() {}"
+        );
+        let block = "/*\n * Licensed under the Apache License\n */\nclass A {}";
+        assert_eq!(preprocess(block, "java", &with(&[PreprocessStep::StripLicense])), "class A {}");
+    }
+
+    #[test]
+    fn multi_line_imports_are_dropped() {
+        let text = "use std::io;\nuse crate::{\n    a,\n    b,\n};\n\nfn f() {}";
+        assert_eq!(preprocess(text, "rust", &with(&[PreprocessStep::DropImports])), "\nfn f() {}");
+        let go = "import (\n\t\"fmt\"\n)\n\nfunc main() {}";
+        assert_eq!(preprocess(go, "go", &with(&[PreprocessStep::DropImports])), "\nfunc main() {}");
+    }
+
+    #[test]
+    fn kotlin_open_classes_are_not_imports() {
+        let text = "import a.B\nopen class C";
+        assert_eq!(preprocess(text, "kotlin", &with(&[PreprocessStep::DropImports])), "open class C");
+    }
+
+    #[test]
+    fn long_strings_are_truncated() {
+        let text = r#"let s = "abcdefghijkl"; let c = 'x'; let t = "short";"#;
+        assert_eq!(
+            preprocess(text, "rust", &with(&[PreprocessStep::TruncateStrings])),
+            r#"let s = "abcdefgh…"; let c = 'x'; let t = "short";"#
+        );
+        let escaped = r#"x = 'it\'s a long one'"#;
+        assert_eq!(
+            preprocess(escaped, "python", &with(&[PreprocessStep::TruncateStrings])),
+            r#"x = 'it\'s a …'"#
+        );
+    }
+
+    #[test]
+    fn whitespace_is_collapsed() {
+        let text = "fn f() {\n\n    let  x =   1;\n}\n";
+        assert_eq!(
+            preprocess(text, "rust", &with(&[PreprocessStep::CollapseWhitespace])),
+            "fn f() {\nlet x = 1;\n}"
+        );
+    }
+
+    #[test]
+    fn identifiers_are_split_into_words() {
+        let text = "parseFile(raw_bytes, HTTPServer, MAX_LEN, id)";
+        assert_eq!(
+            preprocess(text, "rust", &with(&[PreprocessStep::SplitIdentifiers])),
+            "parse file(raw bytes, http server, max len, id)"
+        );
+    }
+
+    #[test]
+    fn chunks_of_pure_boilerplate_are_embedded_as_is() {
+        let text = "import os\nimport sys";
+        assert_eq!(preprocess(text, "python", &with(&[PreprocessStep::DropImports])), text);
+    }
+}
@@ -0,0 +1,108 @@
+use std::io::{self, Write};
+
+use crate::export::{Exporter, SymbolKind, definition_kind, display_language};
+use crate::indexer::parser::Definition;
+
+#[cfg(test)]
+#[path = "ctags_tests.rs"]
+mod ctags_tests;
+
+/// Universal Ctags extended format. Tags are sorted by name, as editors
+/// expect for binary search, so all entries are buffered until `finish`.
+pub struct Ctags {
+    entries: Vec<String>,
+}
+
+impl Ctags {
+    pub fn new() -> Self {
+        Self { entries: Vec::new() }
+    }
+}
+
+impl Exporter for Ctags {
+    fn file(
+        &mut self,
+        _out: &mut dyn Write,
+        path: &str,
+        _content: &str,
+        definitions: &[Definition],
+    ) -> io::Result<()> {
+        self.entries.extend(definitions.iter().map(|def| entry(path, def)));
+        Ok(())
+    }
+
+    fn finish(&mut self, out: &mut dyn Write) -> io::Result<()> {
+        // Tab sorts before any name character, so whole-line order is tag order
+        self.entries.sort();
+        writeln!(out, "!_TAG_FILE_FORMAT\t2\t/extended format; --format=1 will not append ;\" to lines/")?;
+        writeln!(out, "!_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/")?;
+        writeln!(out, "!_TAG_OUTPUT_MODE\tu-ctags\t/u-ctags or e-ctags/")?;
+        writeln!(out, "!_TAG_PROGRAM_NAME\tmaharajah\t//")?;
+        writeln!(out, "!_TAG_PROGRAM_VERSION\t{}\t//", env!("CARGO_PKG_VERSION"))?;
+        for entry in &self.entries {
+            writeln!(out, "{entry}")?;
+        }
+        Ok(())
+    }
+}
+
+/// `name<TAB>file<TAB>line;"<TAB>fields...` with 1-based line numbers.
+fn entry(path: &str, def: &Definition) -> String {
+    let line = def.name_start.0 + 1;
+    let mut entry = format!(
+        "{}\t{}\t{};\"\tkind:{}\tline:{}\tlanguage:{}",
+        escape(&def.symbol),
+        escape(path),
+        line,
+        kind_name(definition_kind(def)),
+        line,
+        display_language(def.language),
+    );
+    if let Some((_, scope_kind)) = def.scope.last() {
+        let names: Vec<&str> = def.scope.iter().map(|(name, _)| name.as_str()).collect();
+        let kind = SymbolKind::classify(def.language, scope_kind, false);
+        entry.push_str(&format!("\t{}:{}", kind_name(kind), escape(&names.join("."))));
+    }
+    entry.push_str(&format!("\tend:{}", def.end.0 + 1));
+    entry
+}
+
+/// Escape the characters that would split a tag line, as u-ctags output mode
+/// does: backslash, tab, carriage return and newline.
+fn escape(s: &str) -> String {
+    let mut escaped = String::with_capacity(s.len());
+    for c in s.chars() {
+        match c {
+            '\\' => escaped.push_str("\\\\"),
+            '\t' => escaped.push_str("\\t"),
+            '\r' => escaped.push_str("\\r"),
+            '\n' => escaped.push_str("\\n"),
+            c => escaped.push(c),
+        }
+    }
+    escaped
+}
+
+fn kind_name(kind: SymbolKind) -> &'static str {
+    match kind {
+        SymbolKind::Function => "function",
+        SymbolKind::Method => "method",
+        SymbolKind::Constructor => "constructor",
+        SymbolKind::Class => "class",
+        SymbolKind::Struct => "struct",
+        SymbolKind::Enum => "enum",
+        SymbolKind::Interface => "interface",
+        SymbolKind::Trait => "trait",
+        SymbolKind::Type => "type",
+        SymbolKind::TypeAlias => "typedef",
+        SymbolKind::Union => "union",
+        SymbolKind::Object => "object",
+        SymbolKind::Module => "module",
+        SymbolKind::Namespace => "namespace",
+        SymbolKind::Macro => "macro",
+        SymbolKind::Constant => "constant",
+        SymbolKind::Variable => "variable",
+        SymbolKind::Property => "property",
+        SymbolKind::Implementation => "implementation",
+    }
+}
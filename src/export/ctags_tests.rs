@@ -0,0 +1,68 @@
+/// Ctags tests: the whole tags file for a few definitions, checking sort
+/// order, fields and escaping.
+
+#[cfg(test)]
+mod ctags_tests {
+    use crate::export::Exporter;
+    use crate::export::ctags::Ctags;
+    use crate::indexer::parser::Definition;
+
+    fn def(symbol: &str, node_kind: &str, scope: &[(&str, &str)], start: u32, end: u32) -> Definition {
+        Definition {
+            language: "rust",
+            symbol: symbol.to_string(),
+            node_kind: node_kind.to_string(),
+            scope: scope.iter().map(|(n, k)| (n.to_string(), k.to_string())).collect(),
+            start: (start, 0),
+            end: (end, 1),
+            name_start: (start, 3),
+            name_end: (start, 3 + symbol.len() as u32),
+            summary: None,
+        }
+    }
+
+    #[test]
+    fn tags_are_sorted_escaped_and_carry_their_scope() {
+        let mut ctags = Ctags::new();
+        let mut out = Vec::new();
+        ctags
+            .file(
+                &mut out,
+                "src/b.rs",
+                "",
+                &[def("parse", "function_item", &[], 0, 2)],
+            )
+            .unwrap();
+        ctags
+            .file(
+                &mut out,
+                "src/a.rs",
+                "",
+                &[
+                    def("Parser", "struct_item", &[], 0, 2),
+                    def("parse", "function_item", &[("Parser", "impl_item")], 4, 6),
+                ],
+            )
+            .unwrap();
+        ctags
+            .file(&mut out, "src/we\\ird\tname.rs", "", &[def("odd", "const_item", &[], 9, 9)])
+            .unwrap();
+        // Nothing is written before the entries are sorted
+        assert!(out.is_empty());
+        ctags.finish(&mut out).unwrap();
+
+        let expected = format!(
+            "!_TAG_FILE_FORMAT\t2\t/extended format; --format=1 will not append ;\" to lines/\n\
+             !_TAG_FILE_SORTED\t1\t/0=unsorted, 1=sorted, 2=foldcase/\n\
+             !_TAG_OUTPUT_MODE\tu-ctags\t/u-ctags or e-ctags/\n\
+             !_TAG_PROGRAM_NAME\tmaharajah\t//\n\
+             !_TAG_PROGRAM_VERSION\t{}\t//\n\
+             Parser\tsrc/a.rs\t1;\"\tkind:struct\tline:1\tlanguage:Rust\tend:3\n\
+             odd\tsrc/we\\\\ird\\tname.rs\t10;\"\tkind:constant\tline:10\tlanguage:Rust\tend:10\n\
+             parse\tsrc/a.rs\t5;\"\tkind:method\tline:5\tlanguage:Rust\timplementation:Parser\tend:7\n\
+             parse\tsrc/b.rs\t1;\"\tkind:function\tline:1\tlanguage:Rust\tend:3\n",
+            env!("CARGO_PKG_VERSION")
+        );
+        assert_eq!(String::from_utf8(out).unwrap(), expected);
+    }
+}
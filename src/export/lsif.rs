@@ -0,0 +1,206 @@
+use std::io::{self, Write};
+use std::path::Path;
+
+use serde_json::{Value, json};
+
+use crate::export::{Exporter, SymbolKind, definition_kind, scip};
+use crate::indexer::parser::Definition;
+
+#[cfg(test)]
+#[path = "lsif_tests.rs"]
+mod lsif_tests;
+
+/// LSIF dump (https://microsoft.github.io/language-server-protocol/specifications/lsif/0.6.0/specification/)
+/// as JSON lines. Each definition gets a range, a result set with a
+/// definition result, a hover with its summary when there is one, and an
+/// export moniker carrying the same identifier as the SCIP export.
+pub struct Lsif {
+    next_id: u64,
+    symbol_prefix: String,
+    project_root: String,
+    metadata_written: bool,
+}
+
+impl Lsif {
+    pub fn new(project: &str, target_dir: &Path) -> Self {
+        Self {
+            next_id: 0,
+            symbol_prefix: scip::symbol_prefix(project),
+            project_root: format!("file://{}", target_dir.display()),
+            metadata_written: false,
+        }
+    }
+
+    /// Write a vertex or edge, assigning it the next id.
+    fn emit(&mut self, out: &mut dyn Write, mut element: Value) -> io::Result<u64> {
+        self.next_id += 1;
+        element["id"] = json!(self.next_id);
+        serde_json::to_writer(&mut *out, &element)?;
+        writeln!(out)?;
+        Ok(self.next_id)
+    }
+
+    fn vertex(&mut self, out: &mut dyn Write, label: &str, mut fields: Value) -> io::Result<u64> {
+        fields["type"] = json!("vertex");
+        fields["label"] = json!(label);
+        self.emit(out, fields)
+    }
+
+    fn edge(&mut self, out: &mut dyn Write, label: &str, mut fields: Value) -> io::Result<u64> {
+        fields["type"] = json!("edge");
+        fields["label"] = json!(label);
+        self.emit(out, fields)
+    }
+
+    fn write_metadata(&mut self, out: &mut dyn Write) -> io::Result<()> {
+        if self.metadata_written {
+            return Ok(());
+        }
+        self.metadata_written = true;
+        let root = self.project_root.clone();
+        self.vertex(
+            out,
+            "metaData",
+            json!({
+                "version": "0.6.0",
+                "projectRoot": root,
+                "positionEncoding": "utf-16",
+                "toolInfo": { "name": "maharajah", "version": env!("CARGO_PKG_VERSION") },
+            }),
+        )?;
+        Ok(())
+    }
+}
+
+impl Exporter for Lsif {
+    fn file(
+        &mut self,
+        out: &mut dyn Write,
+        path: &str,
+        content: &str,
+        definitions: &[Definition],
+    ) -> io::Result<()> {
+        self.write_metadata(out)?;
+        let language = definitions.first().map_or("", |d| language_id(d.language));
+        let uri = format!("{}/{}", self.project_root, path);
+        let document = self.vertex(out, "document", json!({ "uri": uri, "languageId": language }))?;
+
+        // LSIF positions count UTF-16 code units; tree-sitter columns are bytes
+        let lines: Vec<&str> = content.split('\n').collect();
+        let position = |(line, column): (u32, u32)| {
+            let character = lines
+                .get(line as usize)
+                .and_then(|l| l.get(..column as usize))
+                .map_or(column as usize, |prefix| prefix.encode_utf16().count());
+            json!({ "line": line, "character": character })
+        };
+
+        let symbols = scip::document_symbols(&self.symbol_prefix, path, definitions);
+        let mut ranges = Vec::new();
+        for (def, symbol) in definitions.iter().zip(symbols) {
+            let Some(symbol) = symbol else { continue };
+            let kind = definition_kind(def);
+            let range = self.vertex(
+                out,
+                "range",
+                json!({
+                    "start": position(def.name_start),
+                    "end": position(def.name_end),
+                    "tag": {
+                        "type": "definition",
+                        "text": def.symbol,
+                        "kind": lsp_kind(kind),
+                        "fullRange": { "start": position(def.start), "end": position(def.end) },
+                    },
+                }),
+            )?;
+            ranges.push(range);
+
+            let result_set = self.vertex(out, "resultSet", json!({}))?;
+            self.edge(out, "next", json!({ "outV": range, "inV": result_set }))?;
+
+            let definition = self.vertex(out, "definitionResult", json!({}))?;
+            self.edge(
+                out,
+                "textDocument/definition",
+                json!({ "outV": result_set, "inV": definition }),
+            )?;
+            self.edge(
+                out,
+                "item",
+                json!({ "outV": definition, "inVs": [range], "document": document }),
+            )?;
+
+            if let Some(summary) = &def.summary {
+                let hover = self.vertex(
+                    out,
+                    "hoverResult",
+                    json!({ "result": { "contents": { "kind": "markdown", "value": summary } } }),
+                )?;
+                self.edge(out, "textDocument/hover", json!({ "outV": result_set, "inV": hover }))?;
+            }
+
+            let moniker = self.vertex(
+                out,
+                "moniker",
+                json!({
+                    "scheme": "maharajah",
+                    "identifier": symbol,
+                    "unique": "scheme",
+                    "kind": "export",
+                }),
+            )?;
+            self.edge(out, "moniker", json!({ "outV": result_set, "inV": moniker }))?;
+        }
+
+        if !ranges.is_empty() {
+            self.edge(out, "contains", json!({ "outV": document, "inVs": ranges }))?;
+        }
+        Ok(())
+    }
+
+    fn finish(&mut self, out: &mut dyn Write) -> io::Result<()> {
+        self.write_metadata(out)
+    }
+}
+
+/// LSP `SymbolKind` values.
+fn lsp_kind(kind: SymbolKind) -> u8 {
+    match kind {
+        SymbolKind::Module => 2,
+        SymbolKind::Namespace => 3,
+        SymbolKind::Class | SymbolKind::Object => 5,
+        SymbolKind::Method => 6,
+        SymbolKind::Property => 7,
+        SymbolKind::Constructor => 9,
+        SymbolKind::Enum => 10,
+        SymbolKind::Interface | SymbolKind::Trait => 11,
+        SymbolKind::Function | SymbolKind::Macro => 12,
+        SymbolKind::Variable => 13,
+        SymbolKind::Constant => 14,
+        SymbolKind::Struct | SymbolKind::Union => 23,
+        SymbolKind::Type | SymbolKind::Implementation => 5,
+        // LSP has no alias kind; TypeParameter is the usual stand-in
+        SymbolKind::TypeAlias => 26,
+    }
+}
+
+/// LSP language identifiers.
+fn language_id(language: &str) -> &'static str {
+    match language {
+        "rust" => "rust",
+        "python" => "python",
+        "java" => "java",
+        "csharp" => "csharp",
+        "scala" => "scala",
+        "haskell" => "haskell",
+        "javascript" => "javascript",
+        "typescript" => "typescript",
+        "tsx" => "typescriptreact",
+        "go" => "go",
+        "ruby" => "ruby",
+        "fsharp" => "fsharp",
+        "kotlin" => "kotlin",
+        _ => "",
+    }
+}
@@ -0,0 +1,87 @@
+/// LSIF export tests: vertex and edge ids, how edges link them, and
+/// positions converted to UTF-16 code units.
+
+#[cfg(test)]
+mod lsif_tests {
+    use std::path::Path;
+
+    use serde_json::{Value, json};
+
+    use crate::export::Exporter;
+    use crate::export::lsif::Lsif;
+    use crate::indexer::parser::Definition;
+
+    #[test]
+    fn a_definition_is_linked_through_its_result_set() {
+        let content = "/// Größe in Bytes.\nfn größe() {}\n";
+        let definition = Definition {
+            language: "rust",
+            symbol: "größe".to_string(),
+            node_kind: "function_item".to_string(),
+            scope: vec![],
+            start: (1, 0),
+            end: (1, 15),
+            name_start: (1, 3),
+            name_end: (1, 10),
+            summary: Some("Größe in Bytes.".to_string()),
+        };
+        let mut lsif = Lsif::new("app", Path::new("/work/app"));
+        let mut out = Vec::new();
+        lsif.file(&mut out, "src/size.rs", content, &[definition]).unwrap();
+        lsif.finish(&mut out).unwrap();
+
+        let elements: Vec<Value> = String::from_utf8(out)
+            .unwrap()
+            .lines()
+            .map(|l| serde_json::from_str(l).unwrap())
+            .collect();
+        let outline: Vec<(u64, &str, &str)> = elements
+            .iter()
+            .map(|e| {
+                (e["id"].as_u64().unwrap(), e["type"].as_str().unwrap(), e["label"].as_str().unwrap())
+            })
+            .collect();
+        assert_eq!(
+            outline,
+            vec![
+                (1, "vertex", "metaData"),
+                (2, "vertex", "document"),
+                (3, "vertex", "range"),
+                (4, "vertex", "resultSet"),
+                (5, "edge", "next"),
+                (6, "vertex", "definitionResult"),
+                (7, "edge", "textDocument/definition"),
+                (8, "edge", "item"),
+                (9, "vertex", "hoverResult"),
+                (10, "edge", "textDocument/hover"),
+                (11, "vertex", "moniker"),
+                (12, "edge", "moniker"),
+                (13, "edge", "contains"),
+            ]
+        );
+
+        let edge = |id: usize| &elements[id - 1];
+        assert_eq!((edge(5)["outV"].clone(), edge(5)["inV"].clone()), (json!(3), json!(4)));
+        assert_eq!((edge(7)["outV"].clone(), edge(7)["inV"].clone()), (json!(4), json!(6)));
+        assert_eq!(edge(8)["outV"], json!(6));
+        assert_eq!(edge(8)["inVs"], json!([3]));
+        assert_eq!(edge(8)["document"], json!(2));
+        assert_eq!((edge(10)["outV"].clone(), edge(10)["inV"].clone()), (json!(4), json!(9)));
+        assert_eq!((edge(12)["outV"].clone(), edge(12)["inV"].clone()), (json!(4), json!(11)));
+        assert_eq!(edge(13)["outV"], json!(2));
+        assert_eq!(edge(13)["inVs"], json!([3]));
+
+        assert_eq!(elements[1]["uri"], json!("file:///work/app/src/size.rs"));
+        assert_eq!(elements[1]["languageId"], json!("rust"));
+        // Byte columns become UTF-16 offsets: "größe" is 7 bytes, 5 code units
+        let range = &elements[2];
+        assert_eq!(range["start"], json!({ "line": 1, "character": 3 }));
+        assert_eq!(range["end"], json!({ "line": 1, "character": 8 }));
+        assert_eq!(range["tag"]["fullRange"]["end"], json!({ "line": 1, "character": 13 }));
+        assert_eq!(range["tag"]["kind"], json!(12));
+        assert_eq!(
+            elements[10]["identifier"],
+            json!("maharajah . app . src/`size.rs`/größe().")
+        );
+    }
+}
@@ -0,0 +1,233 @@
+pub mod ctags;
+pub mod lsif;
+pub mod scip;
+
+use std::fs::File;
+use std::io::{self, BufWriter, Write};
+use std::path::Path;
+
+use crate::cli::{ExportArgs, ExportFormat};
+use crate::config::AppConfig;
+use crate::db::overlay;
+use crate::db::store::Store;
+use crate::error::{AppError, Result};
+use crate::indexer::parser::{self, Definition};
+
+/// Symbol category shared by the export formats, derived from the tree-sitter
+/// node kind of a definition.
+#[derive(Clone, Copy, Debug, PartialEq, Eq)]
+pub enum SymbolKind {
+    Function,
+    Method,
+    Constructor,
+    Class,
+    Struct,
+    Enum,
+    Interface,
+    Trait,
+    Type,
+    TypeAlias,
+    Union,
+    Object,
+    Module,
+    Namespace,
+    Macro,
+    Constant,
+    Variable,
+    Property,
+    /// `impl` blocks, type-class instances and the like: scopes for their
+    /// members rather than symbols of their own
+    Implementation,
+}
+
+impl SymbolKind {
+    pub fn classify(language: &str, node_kind: &str, in_type: bool) -> Self {
+        use SymbolKind::*;
+        match node_kind {
+            "method_definition" | "method" | "singleton_method" | "method_declaration" => Method,
+            "constructor_declaration" | "secondary_constructor" => Constructor,
+            "function_item"
+            | "function_definition"
+            | "function_declaration"
+            | "function"
+            | "generator_function_declaration"
+            | "arrow_function"
+            | "function_expression"
+            | "lambda"
+            | "value_declaration"
+            | "decorated_definition" => {
+                if in_type { Method } else { Function }
+            }
+            // Haskell type classes play the role of interfaces
+            "class" if language == "haskell" => Interface,
+            "class_declaration" | "class_definition" | "class" | "record_declaration"
+            | "singleton_class" | "exception_definition" => Class,
+            "struct_item" | "struct_declaration" => Struct,
+            "enum_item" | "enum_declaration" | "enum_definition" => Enum,
+            "interface_declaration" | "annotation_type_declaration" => Interface,
+            "trait_item" | "trait_definition" => Trait,
+            "type_item" | "type_alias_declaration" | "type_alias" | "type_synomym" => TypeAlias,
+            "union_item" => Union,
+            "object_declaration" | "object_definition" | "companion_object" => Object,
+            "mod_item" | "module" | "module_defn" => Module,
+            "namespace" => Namespace,
+            "macro_definition" => Macro,
+            "const_item" | "const_declaration" | "const_spec" => Constant,
+            "property_declaration" => Property,
+            "impl_item" | "instance_decl" | "given_definition" | "extension_definition" => {
+                Implementation
+            }
+            "static_item" | "var_declaration" | "var_spec" => Variable,
+            // type_spec, type_defn, type_definition, data_type, newtype,
+            // type_family, delegate_declaration, ...
+            _ => Type,
+        }
+    }
+
+    /// Kinds whose members are methods and whose SCIP descriptor is a type.
+    pub fn is_type(self) -> bool {
+        use SymbolKind::*;
+        matches!(
+            self,
+            Class | Struct | Enum | Interface | Trait | Type | TypeAlias | Union | Object
+                | Implementation
+        )
+    }
+
+    pub fn is_callable(self) -> bool {
+        matches!(self, SymbolKind::Function | SymbolKind::Method | SymbolKind::Constructor)
+    }
+
+    /// Name of the kind as stored in the index and shown by `mh outline`.
+    pub fn as_str(self) -> &'static str {
+        use SymbolKind::*;
+        match self {
+            Function => "function",
+            Method => "method",
+            Constructor => "constructor",
+            Class => "class",
+            Struct => "struct",
+            Enum => "enum",
+            Interface => "interface",
+            Trait => "trait",
+            Type => "type",
+            TypeAlias => "type_alias",
+            Union => "union",
+            Object => "object",
+            Module => "module",
+            Namespace => "namespace",
+            Macro => "macro",
+            Constant => "constant",
+            Variable => "variable",
+            Property => "property",
+            Implementation => "implementation",
+        }
+    }
+}
+
+/// Kind of a definition, taking its innermost enclosing definition into account.
+pub fn definition_kind(def: &Definition) -> SymbolKind {
+    let in_type = def.scope.last().is_some_and(|(_, kind)| {
+        SymbolKind::classify(def.language, kind, false).is_type()
+    });
+    SymbolKind::classify(def.language, &def.node_kind, in_type)
+}
+
+/// Human-readable language name, as ctags and editors spell it.
+pub fn display_language(language: &str) -> &str {
+    match language {
+        "rust" => "Rust",
+        "python" => "Python",
+        "java" => "Java",
+        "csharp" => "C#",
+        "scala" => "Scala",
+        "haskell" => "Haskell",
+        "javascript" => "JavaScript",
+        "typescript" => "TypeScript",
+        "tsx" => "TSX",
+        "go" => "Go",
+        "ruby" => "Ruby",
+        "fsharp" => "F#",
+        "kotlin" => "Kotlin",
+        other => other,
+    }
+}
+
+/// One export format. Files are passed in path order; formats that can stream
+/// write as they go, the rest buffer until `finish`.
+pub trait Exporter {
+    fn file(
+        &mut self,
+        out: &mut dyn Write,
+        path: &str,
+        content: &str,
+        definitions: &[Definition],
+    ) -> io::Result<()>;
+
+    fn finish(&mut self, out: &mut dyn Write) -> io::Result<()>;
+}
+
+pub async fn export_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: ExportArgs,
+) -> Result<()> {
+    let overlay = overlay::current(target_dir);
+    let store = Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay)
+        .await?
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("No index found. Run `index` first.")))?;
+    let mut files: Vec<String> = store.list_files().await?.into_iter().collect();
+    files.sort();
+
+    let project = target_dir
+        .file_name()
+        .and_then(|n| n.to_str())
+        .unwrap_or("project");
+    let mut exporter: Box<dyn Exporter> = match args.format {
+        ExportFormat::Ctags => Box::new(ctags::Ctags::new()),
+        ExportFormat::Scip => Box::new(scip::Scip::new(project, target_dir)),
+        ExportFormat::Lsif => Box::new(lsif::Lsif::new(project, target_dir)),
+    };
+
+    // Paths inside the export are relative to the project root, so by default
+    // the file goes there too
+    let output = args.output.unwrap_or_else(|| target_dir.join(default_output(&args.format)));
+    let to_stdout = output.as_os_str() == "-";
+    let mut out: Box<dyn Write> = if to_stdout {
+        Box::new(BufWriter::new(io::stdout().lock()))
+    } else {
+        Box::new(BufWriter::new(File::create(&output)?))
+    };
+
+    let mut symbols = 0;
+    for rel in &files {
+        // The index may be stale; files deleted since are skipped
+        let Ok(content) = std::fs::read_to_string(target_dir.join(rel)) else {
+            tracing::warn!("Skipping unreadable file: {rel}");
+            continue;
+        };
+        let definitions = parser::parse_definitions(Path::new(rel), &content);
+        symbols += definitions.len();
+        exporter.file(&mut out, rel, &content, &definitions)?;
+    }
+    exporter.finish(&mut out)?;
+    out.flush()?;
+
+    if !to_stdout {
+        println!(
+            "Exported {symbols} definition(s) from {} file(s) to {}",
+            files.len(),
+            output.display()
+        );
+    }
+    Ok(())
+}
+
+fn default_output(format: &ExportFormat) -> &'static str {
+    match format {
+        ExportFormat::Ctags => "tags",
+        ExportFormat::Scip => "index.scip",
+        ExportFormat::Lsif => "dump.lsif",
+    }
+}
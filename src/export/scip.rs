@@ -0,0 +1,227 @@
+use std::collections::{HashMap, HashSet};
+use std::io::{self, Write};
+use std::path::Path;
+
+use crate::export::{Exporter, SymbolKind, definition_kind};
+use crate::indexer::parser::Definition;
+use crate::protobuf::Encoder;
+
+#[cfg(test)]
+#[path = "scip_tests.rs"]
+mod scip_tests;
+
+/// `SymbolRole.Definition`
+const ROLE_DEFINITION: i32 = 1;
+/// `PositionEncoding.UTF8CodeUnitOffsetFromLineStart` / `TextEncoding.UTF8`:
+/// tree-sitter columns are byte offsets
+const ENCODING_UTF8: i32 = 1;
+
+/// SCIP index (https://github.com/sourcegraph/scip), written one document at a
+/// time: repeated protobuf fields may be split across the stream, so each
+/// `Index.documents` entry is emitted as soon as its file is parsed.
+pub struct Scip {
+    symbol_prefix: String,
+    project_root: String,
+    metadata_written: bool,
+}
+
+impl Scip {
+    pub fn new(project: &str, target_dir: &Path) -> Self {
+        Self {
+            symbol_prefix: symbol_prefix(project),
+            project_root: format!("file://{}", target_dir.display()),
+            metadata_written: false,
+        }
+    }
+
+    fn write_metadata(&mut self, out: &mut dyn Write) -> io::Result<()> {
+        if self.metadata_written {
+            return Ok(());
+        }
+        self.metadata_written = true;
+        let mut index = Encoder::new();
+        index.message(1, |metadata| {
+            metadata.message(2, |tool| {
+                tool.string(1, "maharajah");
+                tool.string(2, env!("CARGO_PKG_VERSION"));
+            });
+            metadata.string(3, &self.project_root);
+            metadata.int32(4, ENCODING_UTF8);
+        });
+        out.write_all(&index.finish())
+    }
+}
+
+impl Exporter for Scip {
+    fn file(
+        &mut self,
+        out: &mut dyn Write,
+        path: &str,
+        _content: &str,
+        definitions: &[Definition],
+    ) -> io::Result<()> {
+        self.write_metadata(out)?;
+        let symbols = document_symbols(&self.symbol_prefix, path, definitions);
+        let language = definitions.first().map_or("", |d| language_name(d.language));
+
+        let mut index = Encoder::new();
+        index.message(2, |doc| {
+            doc.string(1, path);
+            for (def, symbol) in definitions.iter().zip(&symbols) {
+                let Some(symbol) = symbol else { continue };
+                doc.message(2, |occurrence| {
+                    occurrence.packed_int32(1, &range(def.name_start, def.name_end));
+                    occurrence.string(2, symbol);
+                    occurrence.int32(3, ROLE_DEFINITION);
+                    occurrence.packed_int32(7, &range(def.start, def.end));
+                });
+            }
+            let mut described = HashSet::new();
+            for (def, symbol) in definitions.iter().zip(&symbols) {
+                let Some(symbol) = symbol else { continue };
+                if !described.insert(symbol) {
+                    continue;
+                }
+                doc.message(3, |info| {
+                    info.string(1, symbol);
+                    if let Some(summary) = &def.summary {
+                        info.string(3, summary);
+                    }
+                    info.int32(5, kind_number(definition_kind(def)));
+                    info.string(6, &def.symbol);
+                });
+            }
+            doc.string(4, language);
+            doc.int32(6, ENCODING_UTF8);
+        });
+        out.write_all(&index.finish())
+    }
+
+    fn finish(&mut self, out: &mut dyn Write) -> io::Result<()> {
+        // An index of an empty project still needs its metadata
+        self.write_metadata(out)
+    }
+}
+
+/// `<scheme> <manager> <package> <version> ` — the part of every symbol that
+/// identifies this project. Manager and version are unknown, hence `.`.
+pub fn symbol_prefix(project: &str) -> String {
+    format!("maharajah . {} . ", project.replace(' ', "  "))
+}
+
+/// Global SCIP symbols for the definitions of one document, e.g.
+/// ``maharajah . app . src/`lib.rs`/Parser#parse().``. Definitions that only
+/// scope their members (`impl` blocks and the like) have no symbol. Repeated
+/// callables (overloads) are told apart with a `(+n)` disambiguator.
+pub fn document_symbols(prefix: &str, path: &str, definitions: &[Definition]) -> Vec<Option<String>> {
+    let mut base = prefix.to_string();
+    for segment in path.split('/') {
+        base.push_str(&escape(segment));
+        base.push('/');
+    }
+
+    let mut seen: HashMap<String, usize> = HashMap::new();
+    definitions
+        .iter()
+        .map(|def| {
+            let kind = definition_kind(def);
+            if kind == SymbolKind::Implementation {
+                return None;
+            }
+            let mut symbol = base.clone();
+            for (name, node_kind) in &def.scope {
+                let scope_kind = SymbolKind::classify(def.language, node_kind, false);
+                symbol.push_str(&descriptor(name, scope_kind, ""));
+            }
+            let count = seen.entry(format!("{symbol}{}", def.symbol)).or_insert(0);
+            let disambiguator = if *count > 0 && kind.is_callable() {
+                format!("+{count}")
+            } else {
+                String::new()
+            };
+            *count += 1;
+            symbol.push_str(&descriptor(&def.symbol, kind, &disambiguator));
+            Some(symbol)
+        })
+        .collect()
+}
+
+fn descriptor(name: &str, kind: SymbolKind, disambiguator: &str) -> String {
+    let name = escape(name);
+    if kind.is_type() {
+        format!("{name}#")
+    } else if kind.is_callable() {
+        format!("{name}({disambiguator}).")
+    } else {
+        match kind {
+            SymbolKind::Module | SymbolKind::Namespace => format!("{name}/"),
+            SymbolKind::Macro => format!("{name}!"),
+            _ => format!("{name}."),
+        }
+    }
+}
+
+/// Names outside SCIP's simple-identifier alphabet are wrapped in backticks.
+fn escape(name: &str) -> String {
+    let simple = !name.is_empty()
+        && name.chars().all(|c| c.is_alphanumeric() || matches!(c, '_' | '+' | '-' | '$'));
+    if simple {
+        name.to_string()
+    } else {
+        format!("`{}`", name.replace('`', "``"))
+    }
+}
+
+/// `[line, start, end]` on one line, `[start line, start, end line, end]` otherwise.
+fn range(start: (u32, u32), end: (u32, u32)) -> Vec<i32> {
+    if start.0 == end.0 {
+        vec![start.0 as i32, start.1 as i32, end.1 as i32]
+    } else {
+        vec![start.0 as i32, start.1 as i32, end.0 as i32, end.1 as i32]
+    }
+}
+
+/// `SymbolInformation.Kind` values from scip.proto.
+fn kind_number(kind: SymbolKind) -> i32 {
+    match kind {
+        SymbolKind::Class => 7,
+        SymbolKind::Constant => 8,
+        SymbolKind::Constructor => 9,
+        SymbolKind::Enum => 11,
+        SymbolKind::Function => 17,
+        SymbolKind::Interface => 21,
+        SymbolKind::Macro => 25,
+        SymbolKind::Method => 26,
+        SymbolKind::Module => 29,
+        SymbolKind::Namespace => 30,
+        SymbolKind::Object => 33,
+        SymbolKind::Property => 41,
+        SymbolKind::Struct => 49,
+        SymbolKind::Trait => 53,
+        SymbolKind::Type => 54,
+        SymbolKind::TypeAlias => 55,
+        SymbolKind::Union => 59,
+        SymbolKind::Variable => 61,
+        SymbolKind::Implementation => 0,
+    }
+}
+
+/// `Language` enum names from scip.proto, used as `Document.language`.
+fn language_name(language: &str) -> &'static str {
+    match language {
+        "rust" => "Rust",
+        "python" => "Python",
+        "java" => "Java",
+        "csharp" => "CSharp",
+        "scala" => "Scala",
+        "haskell" => "Haskell",
+        "javascript" => "JavaScript",
+        "typescript" => "TypeScript",
+        "tsx" => "TypeScriptReact",
+        "go" => "Go",
+        "ruby" => "Ruby",
+        "fsharp" => "FSharp",
+        "kotlin" => "Kotlin",
+        _ => "",
+    }
+}
@@ -0,0 +1,123 @@
+/// SCIP export tests: the written index decodes back into its metadata,
+/// documents and definition symbols.
+
+#[cfg(test)]
+mod scip_tests {
+    use std::path::Path;
+
+    use crate::export::Exporter;
+    use crate::export::scip::Scip;
+    use crate::indexer::parser::Definition;
+    use crate::protobuf::Decoder;
+    use crate::symbols::scip::read_index;
+
+    fn def(symbol: &str, node_kind: &str, scope: &[(&str, &str)], start: u32, end: u32) -> Definition {
+        Definition {
+            language: "rust",
+            symbol: symbol.to_string(),
+            node_kind: node_kind.to_string(),
+            scope: scope.iter().map(|(n, k)| (n.to_string(), k.to_string())).collect(),
+            start: (start, 0),
+            end: (end, 1),
+            name_start: (start, 7),
+            name_end: (start, 7 + symbol.len() as u32),
+            summary: None,
+        }
+    }
+
+    fn export(definitions: &[Definition]) -> Vec<u8> {
+        let mut scip = Scip::new("my app", Path::new("/work/app"));
+        let mut out = Vec::new();
+        scip.file(&mut out, "src/lib.rs", "", definitions).unwrap();
+        scip.finish(&mut out).unwrap();
+        out
+    }
+
+    #[test]
+    fn metadata_is_written_once_before_the_documents() {
+        let bytes = export(&[def("Parser", "struct_item", &[], 0, 2)]);
+        let mut index = Decoder::new(&bytes);
+        let mut fields = Vec::new();
+        while let Some((field, value)) = index.next_field().unwrap() {
+            fields.push(field);
+            if field != 1 {
+                continue;
+            }
+            let mut metadata = Decoder::new(value.as_bytes());
+            let mut tool_name = "";
+            let mut project_root = "";
+            let mut encoding = 0;
+            while let Some((field, value)) = metadata.next_field().unwrap() {
+                match field {
+                    2 => {
+                        let mut tool = Decoder::new(value.as_bytes());
+                        while let Some((field, value)) = tool.next_field().unwrap() {
+                            if field == 1 {
+                                tool_name = value.as_str().unwrap();
+                            }
+                        }
+                    }
+                    3 => project_root = value.as_str().unwrap(),
+                    4 => encoding = value.as_i32(),
+                    _ => {}
+                }
+            }
+            assert_eq!(tool_name, "maharajah");
+            assert_eq!(project_root, "file:///work/app");
+            assert_eq!(encoding, 1);
+        }
+        assert_eq!(fields, vec![1, 2]);
+    }
+
+    #[test]
+    fn definitions_decode_to_their_symbols() {
+        let bytes = export(&[
+            def("Parser", "struct_item", &[], 0, 2),
+            def("Parser", "impl_item", &[], 4, 12),
+            def("parse", "function_item", &[("Parser", "impl_item")], 5, 7),
+            def("parse", "function_item", &[("Parser", "impl_item")], 9, 11),
+        ]);
+        let mut records = Vec::new();
+        let documents = read_index(&bytes, |r| {
+            records.extend(r);
+            Ok(())
+        })
+        .unwrap();
+
+        assert_eq!(documents, 1);
+        let decoded: Vec<(&str, &str, &str, u32, u32, bool)> = records
+            .iter()
+            .map(|r| {
+                (
+                    r.symbol.as_str(),
+                    r.name.as_str(),
+                    r.file_path.as_str(),
+                    r.line,
+                    r.end_line,
+                    r.is_definition,
+                )
+            })
+            .collect();
+        // The impl block only scopes its methods and has no symbol; the
+        // second `parse` is told apart as an overload
+        assert_eq!(
+            decoded,
+            vec![
+                ("maharajah . my  app . src/`lib.rs`/Parser#", "Parser", "src/lib.rs", 0, 2, true),
+                ("maharajah . my  app . src/`lib.rs`/Parser#parse().", "parse", "src/lib.rs", 5, 7, true),
+                ("maharajah . my  app . src/`lib.rs`/Parser#parse(+1).", "parse", "src/lib.rs", 9, 11, true),
+            ]
+        );
+        assert!(records.iter().all(|r| r.column == 7 && r.enclosing_symbol.is_none()));
+    }
+
+    #[test]
+    fn an_empty_project_still_has_metadata() {
+        let mut scip = Scip::new("app", Path::new("/work/app"));
+        let mut out = Vec::new();
+        scip.finish(&mut out).unwrap();
+        let mut index = Decoder::new(&out);
+        assert!(matches!(index.next_field().unwrap(), Some((1, _))));
+        assert!(index.next_field().unwrap().is_none());
+    }
+}
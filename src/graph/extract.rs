@@ -0,0 +1,254 @@
+use std::path::Path;
+
+use tree_sitter::{Parser, Query, QueryCursor, StreamingIterator};
+
+use crate::indexer::parser::grammar_for;
+use crate::routes::extract::{capture, unquote};
+
+#[cfg(test)]
+#[path = "extract_tests.rs"]
+mod extract_tests;
+
+/// An import statement found in a source file.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Import {
+    /// Imported module, package or path, normalised per language:
+    /// - rust: a `::` path with `use` groups expanded; `mod x;` → `self::x`
+    /// - python: a dotted module (`a.b.c`, relative `..a.b`); `from a import b` → `a.b`
+    /// - javascript/typescript/tsx/go: the module specifier as written
+    /// - java/kotlin/scala: a dotted name; wildcards end in `.*`
+    /// - csharp/haskell: the namespace or module name
+    /// - ruby: the required path; `require_relative` paths start with `./`
+    pub target: String,
+    /// 0-based line of the statement
+    pub line: u32,
+}
+
+/// Queries recognising imports, per language. Captures:
+/// - `@import` — module specifier or path, taken as written (string literals are unquoted)
+/// - `@decl`   — whole declaration, normalised by `declaration_targets`
+/// - `@from` / `@name` — Python `from <from> import <name>`
+/// - `@module` — Rust `mod <module>;` declared in another file
+/// - `@relative` — Ruby `require_relative` path
+const QUERIES: &[(&str, &str)] = &[
+    (
+        "rust",
+        r#"
+        (use_declaration argument: (_) @decl)
+        (mod_item name: (identifier) @module !body)
+        "#,
+    ),
+    (
+        "python",
+        r#"
+        (import_statement name: [(dotted_name) (aliased_import)] @import)
+        (import_from_statement
+          module_name: (_) @from
+          name: [(dotted_name) (aliased_import)] @name)
+        (import_from_statement module_name: (_) @from (wildcard_import))
+        "#,
+    ),
+    ("javascript", JS_QUERY),
+    ("typescript", JS_QUERY),
+    ("tsx", JS_QUERY),
+    ("go", r#"(import_spec path: (interpreted_string_literal) @import)"#),
+    ("java", r#"(import_declaration) @decl"#),
+    ("kotlin", r#"(import_header) @decl"#),
+    ("scala", r#"(import_declaration) @decl"#),
+    ("csharp", r#"(using_directive) @decl"#),
+    ("haskell", r#"(import module: (_) @import)"#),
+    (
+        "ruby",
+        r#"
+        (call
+          method: (identifier) @_fn
+          arguments: (argument_list . (string (string_content) @import))
+          (#eq? @_fn "require"))
+        (call
+          method: (identifier) @_fn
+          arguments: (argument_list . (string (string_content) @relative))
+          (#eq? @_fn "require_relative"))
+        "#,
+    ),
+];
+
+const JS_QUERY: &str = r#"
+    (import_statement source: (string) @import)
+    (export_statement source: (string) @import)
+    (call_expression
+      function: (identifier) @_fn
+      arguments: (arguments . (string) @import)
+      (#eq? @_fn "require"))
+    (call_expression
+      function: (import)
+      arguments: (arguments . (string) @import))
+"#;
+
+/// Extract the imports of a file, in source order. Returns an empty list for
+/// unsupported languages.
+#[tracing::instrument(skip_all, fields(path = %path.display()))]
+pub fn extract_imports(path: &Path, content: &str) -> Vec<Import> {
+    let Some((language, lang_name, _)) = grammar_for(path) else {
+        return vec![];
+    };
+    let Some((_, source)) = QUERIES.iter().find(|(lang, _)| *lang == lang_name) else {
+        return vec![];
+    };
+    let query = match Query::new(&language, source) {
+        Ok(q) => q,
+        Err(e) => {
+            tracing::warn!("import query for {lang_name} is invalid: {e}");
+            return vec![];
+        }
+    };
+
+    let mut parser = Parser::new();
+    if parser.set_language(&language).is_err() {
+        return vec![];
+    }
+    let Some(tree) = parser.parse(content, None) else {
+        return vec![];
+    };
+
+    let mut imports = Vec::new();
+    let mut cursor = QueryCursor::new();
+    let mut matches = cursor.matches(&query, tree.root_node(), content.as_bytes());
+    while let Some(m) = matches.next() {
+        let Some(node) = m.captures.first().map(|c| c.node) else {
+            continue;
+        };
+        let line = node.start_position().row as u32;
+        let text = |name| capture(&query, m, name).map(|n| &content[n.byte_range()]);
+
+        let targets = if let Some(decl) = text("decl") {
+            declaration_targets(lang_name, decl)
+        } else if let Some(module) = text("module") {
+            vec![format!("self::{module}")]
+        } else if let Some(from) = text("from") {
+            let module = match text("name") {
+                Some(name) if from.ends_with('.') => format!("{from}{}", strip_alias(name)),
+                Some(name) => format!("{from}.{}", strip_alias(name)),
+                None => from.to_string(),
+            };
+            vec![module]
+        } else if let Some(path) = text("relative") {
+            vec![format!("./{path}")]
+        } else if let Some(import) = text("import") {
+            vec![strip_alias(&unquote(import)).to_string()]
+        } else {
+            vec![]
+        };
+        imports.extend(
+            targets
+                .into_iter()
+                .filter(|t| !t.is_empty())
+                .map(|target| Import { target, line }),
+        );
+    }
+
+    imports.sort_by(|a, b| (a.line, &a.target).cmp(&(b.line, &b.target)));
+    imports.dedup();
+    imports
+}
+
+/// Import targets of a whole declaration: keywords, aliases and the trailing
+/// `;` removed, `{...}` groups expanded.
+fn declaration_targets(language: &str, decl: &str) -> Vec<String> {
+    let decl = decl.trim().trim_end_matches(';');
+    match language {
+        "rust" => expand_groups(decl, "::"),
+        "csharp" => {
+            let body = strip_keywords(decl, &["global", "using", "static"]);
+            // using Alias = Some.Namespace;
+            let body = body.split_once('=').map_or(body, |(_, target)| target.trim());
+            vec![body.to_string()]
+        }
+        // java, kotlin, scala
+        _ => {
+            let body = strip_keywords(decl, &["import", "static"]);
+            expand_groups(body, ".")
+                .into_iter()
+                .map(|t| match t.strip_suffix("._") {
+                    Some(package) => format!("{package}.*"),
+                    None => t,
+                })
+                .collect()
+        }
+    }
+}
+
+fn strip_keywords<'a>(mut text: &'a str, keywords: &[&str]) -> &'a str {
+    loop {
+        text = text.trim_start();
+        let Some(rest) = keywords.iter().find_map(|k| {
+            text.strip_prefix(k).filter(|r| r.starts_with(char::is_whitespace))
+        }) else {
+            return text.trim();
+        };
+        text = rest;
+    }
+}
+
+/// `a as b`, `a => b` → `a`.
+fn strip_alias(target: &str) -> &str {
+    let target = target.split(" as ").next().unwrap_or(target);
+    target.split("=>").next().unwrap_or(target).trim()
+}
+
+/// Expand `a::{b, c::{d, self}}` into `a::b`, `a::c::d`, `a::c`, with aliases
+/// removed. `sep` is the path separator of the language.
+fn expand_groups(path: &str, sep: &str) -> Vec<String> {
+    let compact: String = path.split_whitespace().collect::<Vec<_>>().join(" ");
+    let mut out = Vec::new();
+    expand_into("", compact.trim(), sep, &mut out);
+    out
+}
+
+fn expand_into(prefix: &str, path: &str, sep: &str, out: &mut Vec<String>) {
+    let join = |rest: &str| {
+        if prefix.is_empty() {
+            rest.to_string()
+        } else if rest.is_empty() || rest == "self" {
+            prefix.to_string()
+        } else {
+            format!("{prefix}{sep}{rest}")
+        }
+    };
+    let Some(open) = path.find('{') else {
+        out.push(join(strip_alias(path)));
+        return;
+    };
+    let Some(body) = path[open + 1..].strip_suffix('}') else {
+        // Unbalanced: keep what precedes the group
+        out.push(join(path[..open].trim_end_matches(sep)));
+        return;
+    };
+    let head = path[..open].trim().trim_end_matches(sep);
+    let prefix = join(head);
+    for item in split_top_level(body) {
+        let item = item.trim();
+        if !item.is_empty() {
+            expand_into(&prefix, item, sep, out);
+        }
+    }
+}
+
+/// Split on commas that are not nested inside braces.
+fn split_top_level(body: &str) -> Vec<&str> {
+    let mut parts = Vec::new();
+    let mut depth = 0usize;
+    let mut start = 0;
+    for (i, c) in body.char_indices() {
+        match c {
+            '{' => depth += 1,
+            '}' => depth = depth.saturating_sub(1),
+            ',' if depth == 0 => {
+                parts.push(&body[start..i]);
+                start = i + 1;
+            }
+            _ => {}
+        }
+    }
+    parts.push(&body[start..]);
+    parts
+}
@@ -0,0 +1,105 @@
+/// Import extractor tests: declarations are normalised per language so the
+/// resolver sees one target per imported module.
+
+#[cfg(test)]
+mod extract_tests {
+    use crate::graph::extract::extract_imports;
+    use std::path::Path;
+
+    fn targets(file: &str, content: &str) -> Vec<String> {
+        extract_imports(Path::new(file), content).into_iter().map(|i| i.target).collect()
+    }
+
+    #[test]
+    fn rust_use_groups_are_expanded_and_mod_declarations_recorded() {
+        let content = r#"
+mod parser;
+mod inline { fn f() {} }
+
+use std::path::Path;
+use crate::db::{routes::RouteRecord, store::{self, Store}};
+use super::walker as w;
+"#;
+        assert_eq!(
+            targets("src/indexer/mod.rs", content),
+            vec![
+                "self::parser",
+                "std::path::Path",
+                "crate::db::routes::RouteRecord",
+                "crate::db::store",
+                "crate::db::store::Store",
+                "super::walker",
+            ]
+        );
+    }
+
+    #[test]
+    fn python_absolute_relative_and_from_imports() {
+        let content = r#"
+import os.path as p
+from . import models
+from ..core.db import Session, engine as e
+from pkg.util import *
+"#;
+        assert_eq!(
+            targets("app/views.py", content),
+            vec!["os.path", ".models", "..core.db.Session", "..core.db.engine", "pkg.util"]
+        );
+    }
+
+    #[test]
+    fn javascript_imports_reexports_and_require() {
+        let content = r#"
+import { a } from "./a";
+export * from '../b';
+const c = require("./c");
+const d = await import("./d.js");
+"#;
+        assert_eq!(targets("src/index.js", content), vec!["./a", "../b", "./c", "./d.js"]);
+    }
+
+    #[test]
+    fn go_import_specs() {
+        let content = r#"
+package main
+
+import (
+	"fmt"
+	store "example.com/app/internal/store"
+)
+"#;
+        assert_eq!(targets("main.go", content), vec!["fmt", "example.com/app/internal/store"]);
+    }
+
+    #[test]
+    fn java_and_csharp_declarations() {
+        let java = r#"
+import java.util.List;
+import static org.junit.Assert.assertEquals;
+import com.example.model.*;
+"#;
+        assert_eq!(
+            targets("App.java", java),
+            vec!["java.util.List", "org.junit.Assert.assertEquals", "com.example.model.*"]
+        );
+
+        let csharp = r#"
+using System.Text;
+using static System.Math;
+using Json = Newtonsoft.Json;
+"#;
+        assert_eq!(
+            targets("App.cs", csharp),
+            vec!["System.Text", "System.Math", "Newtonsoft.Json"]
+        );
+    }
+
+    #[test]
+    fn ruby_require_and_require_relative() {
+        let content = r#"
+require "json"
+require_relative "lib/helper"
+"#;
+        assert_eq!(targets("app.rb", content), vec!["json", "./lib/helper"]);
+    }
+}
@@ -0,0 +1,268 @@
+pub mod extract;
+pub mod resolve;
+
+use std::collections::{BTreeMap, BTreeSet, HashMap, HashSet};
+use std::fs::File;
+use std::io::{self, BufWriter, Write};
+use std::path::Path;
+
+use serde::Serialize;
+
+use crate::cli::{GraphArgs, GraphFormat, GraphLevel};
+use crate::config::AppConfig;
+use crate::db::overlay;
+use crate::db::store::Store;
+use crate::embed::nomic::NomicEmbedder;
+use crate::error::{AppError, Result};
+use crate::graph::resolve::Resolver;
+use crate::rag::retriever::{self, SearchMode, SearchOptions};
+
+/// Chunks retrieved per requested file with `--query`; several top chunks
+/// usually come from the same file.
+const CHUNKS_PER_FILE: usize = 5;
+
+/// Files whose presence marks a directory as the root of a module (crate,
+/// package, project) for `--level module`.
+const MANIFESTS: &[&str] = &[
+    "Cargo.toml",
+    "package.json",
+    "go.mod",
+    "pyproject.toml",
+    "setup.py",
+    "pom.xml",
+    "build.gradle",
+    "build.gradle.kts",
+    "build.sbt",
+    "Gemfile",
+    "stack.yaml",
+];
+
+/// Manifest extensions with project-specific names (`App.csproj`, `lib.cabal`).
+const MANIFEST_EXTENSIONS: &[&str] = &["csproj", "fsproj", "cabal", "gemspec"];
+
+/// A dependency graph: nodes are files, directories or modules, and an edge
+/// counts the imports from one node into another.
+struct Graph {
+    nodes: BTreeSet<String>,
+    edges: BTreeMap<(String, String), usize>,
+}
+
+#[derive(Serialize)]
+struct JsonGraph<'a> {
+    level: &'a str,
+    nodes: Vec<&'a str>,
+    edges: Vec<JsonEdge<'a>>,
+}
+
+#[derive(Serialize)]
+struct JsonEdge<'a> {
+    from: &'a str,
+    to: &'a str,
+    /// Number of import statements behind the edge
+    imports: usize,
+}
+
+/// Write the project's dependency graph, built from the imports recorded at
+/// index time, optionally restricted to the files most relevant to a query.
+pub async fn graph_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: GraphArgs,
+) -> Result<()> {
+    let overlay = overlay::current(target_dir);
+    let store = Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay)
+        .await?
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("No index found. Run `index` first.")))?;
+
+    let focus = match &args.query {
+        Some(query) => Some(relevant_files(config, &store, target_dir, query, args.top).await?),
+        None => None,
+    };
+    let files = store.list_files().await?;
+    let resolver = Resolver::new(target_dir, &files);
+
+    let mut file_graph = Graph { nodes: BTreeSet::new(), edges: BTreeMap::new() };
+    if let Some(focus) = &focus {
+        file_graph.nodes.extend(focus.iter().cloned());
+    }
+    let in_focus = |f: &str| focus.as_ref().is_none_or(|focus| focus.contains(f));
+    for import in store.imports().all().await? {
+        if !in_focus(&import.file_path) {
+            continue;
+        }
+        for to in resolver.resolve(&import.file_path, &import.language, &import.target) {
+            if !in_focus(&to) {
+                continue;
+            }
+            file_graph.nodes.insert(import.file_path.clone());
+            file_graph.nodes.insert(to.clone());
+            *file_graph.edges.entry((import.file_path.clone(), to)).or_default() += 1;
+        }
+    }
+
+    let graph = match args.level {
+        GraphLevel::File => file_graph,
+        GraphLevel::Dir => group(file_graph, |f| {
+            f.rsplit_once('/').map_or(".", |(dir, _)| dir).to_string()
+        }),
+        GraphLevel::Module => {
+            let mut roots = HashMap::new();
+            group(file_graph, |f| module_root(target_dir, f, &mut roots))
+        }
+    };
+
+    let to_stdout = args.output.as_ref().is_none_or(|o| o.as_os_str() == "-");
+    let mut out: Box<dyn Write> = match &args.output {
+        Some(path) if !to_stdout => Box::new(BufWriter::new(File::create(path)?)),
+        _ => Box::new(BufWriter::new(io::stdout().lock())),
+    };
+    match args.format {
+        GraphFormat::Dot => write_dot(&mut out, &graph)?,
+        GraphFormat::Mermaid => write_mermaid(&mut out, &graph)?,
+        GraphFormat::Json => {
+            let json = JsonGraph {
+                level: args.level.as_str(),
+                nodes: graph.nodes.iter().map(String::as_str).collect(),
+                edges: graph
+                    .edges
+                    .iter()
+                    .map(|((from, to), &imports)| JsonEdge { from, to, imports })
+                    .collect(),
+            };
+            serde_json::to_writer_pretty(&mut out, &json)
+                .map_err(|e| AppError::Other(e.into()))?;
+            writeln!(out)?;
+        }
+    }
+    out.flush()?;
+
+    if let Some(path) = args.output.filter(|_| !to_stdout) {
+        println!(
+            "Wrote {} node(s) and {} edge(s) to {}",
+            graph.nodes.len(),
+            graph.edges.len(),
+            path.display()
+        );
+    }
+    Ok(())
+}
+
+/// The `top` distinct files of the best-matching chunks for `query`.
+async fn relevant_files(
+    config: &AppConfig,
+    store: &Store,
+    target_dir: &Path,
+    query: &str,
+    top: usize,
+) -> Result<HashSet<String>> {
+    let plan = retriever::plan_search(
+        config,
+        target_dir,
+        SearchMode::Find,
+        query,
+        &SearchOptions::default(),
+    )
+    .await?;
+    let prompt = plan.prompt.clone();
+    let vector = tokio::task::spawn_blocking(move || NomicEmbedder::load()?.embed_prompt(&prompt))
+        .await
+        .map_err(|e| AppError::Other(e.into()))?
+        .map_err(|e| AppError::Embed(e.to_string()))?;
+
+    let results =
+        retriever::search(store, &vector, SearchMode::Find, top * CHUNKS_PER_FILE, &plan).await?;
+    let mut files = HashSet::new();
+    for r in results {
+        if files.len() == top {
+            break;
+        }
+        files.insert(r.file_path);
+    }
+    Ok(files)
+}
+
+/// Collapse file nodes into groups, dropping edges within a group.
+fn group(graph: Graph, mut group_of: impl FnMut(&str) -> String) -> Graph {
+    let mut groups: HashMap<String, String> = HashMap::new();
+    let mut lookup = |f: &str| {
+        groups.entry(f.to_string()).or_insert_with(|| group_of(f)).clone()
+    };
+    let nodes = graph.nodes.iter().map(|f| lookup(f)).collect();
+    let mut edges = BTreeMap::new();
+    for ((from, to), count) in graph.edges {
+        let (from, to) = (lookup(&from), lookup(&to));
+        if from != to {
+            *edges.entry((from, to)).or_default() += count;
+        }
+    }
+    Graph { nodes, edges }
+}
+
+/// The nearest directory above `file` holding a build manifest, or "." for
+/// the project root. Results are cached per directory in `roots`.
+fn module_root(target_dir: &Path, file: &str, roots: &mut HashMap<String, String>) -> String {
+    let mut dir = file.rsplit_once('/').map_or("", |(dir, _)| dir);
+    let mut visited = Vec::new();
+    let root = loop {
+        if let Some(root) = roots.get(dir) {
+            break root.clone();
+        }
+        visited.push(dir.to_string());
+        if is_module_root(&target_dir.join(dir)) {
+            break if dir.is_empty() { ".".to_string() } else { dir.to_string() };
+        }
+        if dir.is_empty() {
+            break ".".to_string();
+        }
+        dir = dir.rsplit_once('/').map_or("", |(parent, _)| parent);
+    };
+    for d in visited {
+        roots.insert(d, root.clone());
+    }
+    root
+}
+
+fn is_module_root(dir: &Path) -> bool {
+    if MANIFESTS.iter().any(|m| dir.join(m).is_file()) {
+        return true;
+    }
+    std::fs::read_dir(dir).is_ok_and(|entries| {
+        entries.flatten().any(|e| {
+            e.path()
+                .extension()
+                .and_then(|x| x.to_str())
+                .is_some_and(|x| MANIFEST_EXTENSIONS.contains(&x))
+        })
+    })
+}
+
+fn write_dot(out: &mut dyn Write, graph: &Graph) -> io::Result<()> {
+    let quote = |s: &str| format!("\"{}\"", s.replace('\\', "\\\\").replace('"', "\\\""));
+    writeln!(out, "digraph dependencies {{")?;
+    writeln!(out, "  rankdir=LR;")?;
+    writeln!(out, "  node [shape=box, fontname=\"monospace\"];")?;
+    for node in &graph.nodes {
+        writeln!(out, "  {};", quote(node))?;
+    }
+    for ((from, to), count) in &graph.edges {
+        let label = if *count > 1 { format!(" [label=\"{count}\"]") } else { String::new() };
+        writeln!(out, "  {} -> {}{label};", quote(from), quote(to))?;
+    }
+    writeln!(out, "}}")
+}
+
+fn write_mermaid(out: &mut dyn Write, graph: &Graph) -> io::Result<()> {
+    // Mermaid ids can't contain path characters, so nodes are numbered
+    let ids: HashMap<&str, usize> =
+        graph.nodes.iter().enumerate().map(|(i, n)| (n.as_str(), i)).collect();
+    writeln!(out, "graph LR")?;
+    for (i, node) in graph.nodes.iter().enumerate() {
+        writeln!(out, "  n{i}[\"{}\"]", node.replace('"', "#quot;"))?;
+    }
+    for ((from, to), count) in &graph.edges {
+        let arrow = if *count > 1 { format!("-->|{count}|") } else { "-->".to_string() };
+        writeln!(out, "  n{} {arrow} n{}", ids[from.as_str()], ids[to.as_str()])?;
+    }
+    Ok(())
+}
@@ -0,0 +1,335 @@
+use std::collections::{HashMap, HashSet};
+use std::path::Path;
+
+#[cfg(test)]
+#[path = "resolve_tests.rs"]
+mod resolve_tests;
+
+/// Maps recorded import targets to indexed project files. Imports that name
+/// external packages, or project code the conventions below can't locate,
+/// resolve to nothing.
+pub struct Resolver<'a> {
+    /// Indexed files by directory ("" for the project root)
+    dirs: HashMap<&'a str, Vec<&'a str>>,
+    /// Indexed files by file name, for suffix lookups
+    by_name: HashMap<&'a str, Vec<&'a str>>,
+    files: &'a HashSet<String>,
+    /// Directories containing a go.mod, with the module path it declares
+    go_modules: Vec<(String, String)>,
+}
+
+const JS_EXTENSIONS: &[&str] = &[".ts", ".tsx", ".js", ".jsx", ".mjs", ".cjs"];
+const JVM_EXTENSIONS: &[&str] = &[".java", ".kt", ".scala"];
+
+impl<'a> Resolver<'a> {
+    /// `files` are the indexed paths, relative to `target_dir`; go.mod files
+    /// are read from disk.
+    pub fn new(target_dir: &Path, files: &'a HashSet<String>) -> Self {
+        let mut dirs: HashMap<&str, Vec<&str>> = HashMap::new();
+        let mut by_name: HashMap<&str, Vec<&str>> = HashMap::new();
+        for f in files {
+            dirs.entry(dir_of(f)).or_default().push(f);
+            by_name.entry(file_name(f)).or_default().push(f);
+        }
+        for paths in dirs.values_mut().chain(by_name.values_mut()) {
+            paths.sort();
+        }
+
+        let mut go_modules = Vec::new();
+        let mut checked = HashSet::new();
+        for dir in dirs.keys().filter(|d| dirs[*d].iter().any(|f| f.ends_with(".go"))) {
+            for ancestor in ancestors(dir) {
+                if !checked.insert(ancestor) {
+                    break;
+                }
+                let go_mod = target_dir.join(ancestor).join("go.mod");
+                if let Some(module) = std::fs::read_to_string(go_mod).ok().and_then(|c| {
+                    c.lines()
+                        .find_map(|l| l.trim().strip_prefix("module "))
+                        .map(|m| m.trim().trim_matches('"').to_string())
+                }) {
+                    go_modules.push((ancestor.to_string(), module));
+                }
+            }
+        }
+        // Nested modules first, so the most specific module path wins
+        go_modules.sort_by(|a, b| b.1.len().cmp(&a.1.len()));
+
+        Self { dirs, by_name, files, go_modules }
+    }
+
+    /// Project files an import of `target` from `from` refers to.
+    pub fn resolve(&self, from: &str, language: &str, target: &str) -> Vec<String> {
+        let found = match language {
+            "rust" => self.rust(from, target).into_iter().collect(),
+            "python" => self.python(from, target).into_iter().collect(),
+            "javascript" | "typescript" | "tsx" => self.javascript(from, target).into_iter().collect(),
+            "go" => self.go(target),
+            "java" | "kotlin" | "scala" => self.jvm(from, target),
+            "csharp" => self.namespace(from, target, ".cs"),
+            "haskell" => self.by_suffix(&format!("{}.hs", target.replace('.', "/")), from).into_iter().collect(),
+            "ruby" => self.ruby(from, target).into_iter().collect(),
+            _ => vec![],
+        };
+        found.into_iter().filter(|f| f != from).collect()
+    }
+
+    fn exists(&self, path: &str) -> Option<String> {
+        self.files.contains(path).then(|| path.to_string())
+    }
+
+    /// `crate::`, `self::` and `super::` paths are resolved against the
+    /// module tree under the file's `src/` directory; other paths are tried
+    /// relative to the current module, then to the crate root. The longest
+    /// prefix naming a module file wins, since the tail may name an item.
+    fn rust(&self, from: &str, target: &str) -> Option<String> {
+        let segs: Vec<&str> =
+            target.split("::").filter(|s| !s.is_empty() && *s != "*").collect();
+        let (src_root, module) = rust_module(from);
+
+        let (bases, rest): (Vec<Vec<&str>>, &[&str]) = match segs.first() {
+            Some(&"crate") => (vec![vec![]], &segs[1..]),
+            Some(&"self") => (vec![module.clone()], &segs[1..]),
+            Some(&"super") => {
+                let ups = segs.iter().take_while(|s| **s == "super").count();
+                let base = module[..module.len().saturating_sub(ups)].to_vec();
+                (vec![base], &segs[ups..])
+            }
+            _ => (vec![module.clone(), vec![]], &segs[..]),
+        };
+        let anchored = segs.first().is_some_and(|s| matches!(*s, "crate" | "self" | "super"));
+
+        for base in bases {
+            for k in (0..=rest.len()).rev() {
+                if k == 0 && !anchored {
+                    break;
+                }
+                let mut path = base.clone();
+                path.extend_from_slice(&rest[..k]);
+                let candidates = if path.is_empty() {
+                    vec![join(src_root, "lib.rs"), join(src_root, "main.rs")]
+                } else {
+                    let stem = join(src_root, &path.join("/"));
+                    vec![format!("{stem}.rs"), format!("{stem}/mod.rs")]
+                };
+                if let Some(found) = candidates.iter().find_map(|c| self.exists(c)) {
+                    return Some(found);
+                }
+            }
+        }
+        None
+    }
+
+    /// Relative imports are resolved from the file's package; absolute ones
+    /// by path suffix, so `src/` layouts are found too.
+    fn python(&self, from: &str, target: &str) -> Option<String> {
+        let dots = target.chars().take_while(|c| *c == '.').count();
+        let segs: Vec<&str> = target[dots..].split('.').filter(|s| !s.is_empty()).collect();
+        if dots > 0 {
+            let mut base = dir_of(from);
+            for _ in 1..dots {
+                base = dir_of(base);
+            }
+            for k in (0..=segs.len()).rev() {
+                let stem = join(base, &segs[..k].join("/"));
+                let candidates =
+                    [format!("{stem}.py"), join(&stem, "__init__.py")];
+                if let Some(found) = candidates.iter().find_map(|c| self.exists(c)) {
+                    return Some(found);
+                }
+            }
+            return None;
+        }
+        (1..=segs.len()).rev().find_map(|k| {
+            let stem = segs[..k].join("/");
+            self.by_suffix(&format!("{stem}.py"), from)
+                .or_else(|| self.by_suffix(&format!("{stem}/__init__.py"), from))
+        })
+    }
+
+    /// Only relative specifiers are resolved; packages and path aliases are
+    /// treated as external.
+    fn javascript(&self, from: &str, target: &str) -> Option<String> {
+        if !(target.starts_with("./") || target.starts_with("../")) {
+            return None;
+        }
+        let base = normalize(&join(dir_of(from), target))?;
+        let mut candidates = vec![base.clone()];
+        candidates.extend(JS_EXTENSIONS.iter().map(|ext| format!("{base}{ext}")));
+        // TypeScript ESM imports name the compiled file: './util.js' → util.ts
+        if let Some(stem) = [".js", ".jsx", ".mjs"].iter().find_map(|e| base.strip_suffix(e)) {
+            candidates.extend([".ts", ".tsx"].iter().map(|ext| format!("{stem}{ext}")));
+        }
+        candidates.extend(JS_EXTENSIONS.iter().map(|ext| format!("{base}/index{ext}")));
+        candidates.iter().find_map(|c| self.exists(c))
+    }
+
+    /// A package import refers to every non-test file of the package
+    /// directory, located through the project's go.mod module paths.
+    fn go(&self, target: &str) -> Vec<String> {
+        for (dir, module) in &self.go_modules {
+            let Some(rest) = target.strip_prefix(module.as_str()) else {
+                continue;
+            };
+            if !(rest.is_empty() || rest.starts_with('/')) {
+                continue;
+            }
+            let package = join(dir, rest.trim_start_matches('/'));
+            return self
+                .dirs
+                .get(package.as_str())
+                .into_iter()
+                .flatten()
+                .filter(|f| f.ends_with(".go") && !f.ends_with("_test.go"))
+                .map(|f| f.to_string())
+                .collect();
+        }
+        vec![]
+    }
+
+    /// `a.b.C` is the file `a/b/C.<ext>` (a nested or static member import
+    /// falls back to its enclosing class); `a.b.*` is every file of `a/b`.
+    fn jvm(&self, from: &str, target: &str) -> Vec<String> {
+        let segs: Vec<&str> = target.split('.').collect();
+        if let Some((_, package)) = segs.split_last().filter(|(last, _)| **last == "*") {
+            let suffix = package.join("/");
+            return self
+                .dirs_ending_with(&suffix)
+                .into_iter()
+                .flat_map(|d| self.dirs[d].iter())
+                .filter(|f| JVM_EXTENSIONS.iter().any(|ext| f.ends_with(ext)))
+                .map(|f| f.to_string())
+                .collect();
+        }
+        (2..=segs.len())
+            .rev()
+            .find_map(|k| {
+                let stem = segs[..k].join("/");
+                JVM_EXTENSIONS
+                    .iter()
+                    .find_map(|ext| self.by_suffix(&format!("{stem}{ext}"), from))
+            })
+            .into_iter()
+            .collect()
+    }
+
+    /// Namespaces don't name files, so by convention a namespace is the
+    /// directory whose path ends with it, or with its tail when the root
+    /// namespace is the project name. The directory closest to the importer wins.
+    fn namespace(&self, from: &str, target: &str, extension: &str) -> Vec<String> {
+        let segs: Vec<&str> = target.split('.').collect();
+        for drop in 0..segs.len() {
+            let suffix = segs[drop..].join("/");
+            let Some(dir) = self
+                .dirs_ending_with(&suffix)
+                .into_iter()
+                .filter(|d| self.dirs[*d].iter().any(|f| f.ends_with(extension)))
+                .max_by_key(|d| (common_prefix(d, from), std::cmp::Reverse(d.len())))
+            else {
+                continue;
+            };
+            return self.dirs[dir]
+                .iter()
+                .filter(|f| f.ends_with(extension))
+                .map(|f| f.to_string())
+                .collect();
+        }
+        vec![]
+    }
+
+    fn ruby(&self, from: &str, target: &str) -> Option<String> {
+        let with_ext =
+            if target.ends_with(".rb") { target.to_string() } else { format!("{target}.rb") };
+        if target.starts_with("./") || target.starts_with("../") {
+            return normalize(&join(dir_of(from), &with_ext)).and_then(|p| self.exists(&p));
+        }
+        self.by_suffix(&with_ext, from)
+    }
+
+    /// The indexed file whose path is `suffix` or ends with `/suffix`,
+    /// preferring the one sharing the longest directory prefix with `from`.
+    fn by_suffix(&self, suffix: &str, from: &str) -> Option<String> {
+        self.by_name
+            .get(file_name(suffix))?
+            .iter()
+            .filter(|f| **f == suffix || f.ends_with(&format!("/{suffix}")))
+            .max_by_key(|f| (common_prefix(f, from), std::cmp::Reverse(f.len())))
+            .map(|f| f.to_string())
+    }
+
+    fn dirs_ending_with(&self, suffix: &str) -> Vec<&'a str> {
+        let mut dirs: Vec<&str> = self
+            .dirs
+            .keys()
+            .copied()
+            .filter(|d| *d == suffix || d.ends_with(&format!("/{suffix}")))
+            .collect();
+        dirs.sort();
+        dirs
+    }
+}
+
+/// The `src/` directory of a Rust file and the module path of the file within
+/// it: `app/src/db/mod.rs` → (`app/src`, [`db`]).
+fn rust_module(file: &str) -> (&str, Vec<&str>) {
+    let parts: Vec<&str> = file.split('/').collect();
+    let (root_len, rel) = match parts.iter().rposition(|p| *p == "src") {
+        Some(i) if i + 1 < parts.len() => (i + 1, &parts[i + 1..]),
+        _ => (parts.len() - 1, &parts[parts.len() - 1..]),
+    };
+    let src_root = if root_len == 0 {
+        ""
+    } else {
+        // Byte length of the first `root_len` components plus separators
+        &file[..parts[..root_len].iter().map(|p| p.len() + 1).sum::<usize>() - 1]
+    };
+
+    let mut module: Vec<&str> = rel.to_vec();
+    let last = module.pop().unwrap_or("");
+    let is_root = module.is_empty() && matches!(last, "main.rs" | "lib.rs");
+    if last != "mod.rs" && !is_root {
+        module.push(last.strip_suffix(".rs").unwrap_or(last));
+    }
+    (src_root, module)
+}
+
+fn dir_of(path: &str) -> &str {
+    path.rsplit_once('/').map_or("", |(dir, _)| dir)
+}
+
+fn file_name(path: &str) -> &str {
+    path.rsplit_once('/').map_or(path, |(_, name)| name)
+}
+
+fn join(dir: &str, rest: &str) -> String {
+    match (dir.is_empty(), rest.is_empty()) {
+        (true, _) => rest.to_string(),
+        (false, true) => dir.to_string(),
+        (false, false) => format!("{dir}/{rest}"),
+    }
+}
+
+/// Resolve `.` and `..` components; `None` if the path leaves the project.
+fn normalize(path: &str) -> Option<String> {
+    let mut parts: Vec<&str> = Vec::new();
+    for part in path.split('/') {
+        match part {
+            "" | "." => {}
+            ".." => {
+                parts.pop()?;
+            }
+            p => parts.push(p),
+        }
+    }
+    Some(parts.join("/"))
+}
+
+/// `a/b/c` → `a/b`, `a`, `` (the project root).
+fn ancestors(dir: &str) -> impl Iterator<Item = &str> {
+    std::iter::successors(Some(dir), |d| (!d.is_empty()).then(|| dir_of(d)))
+}
+
+/// Number of leading path components two paths share.
+fn common_prefix(a: &str, b: &str) -> usize {
+    a.split('/').zip(b.split('/')).take_while(|(x, y)| x == y).count()
+}
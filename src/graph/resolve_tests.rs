@@ -0,0 +1,273 @@
+/// Import resolution tests: each language's targets are mapped onto a small
+/// set of indexed project files, and external imports resolve to nothing.
+
+#[cfg(test)]
+mod resolve_tests {
+    use crate::graph::resolve::{Resolver, normalize, rust_module};
+    use std::collections::HashSet;
+    use std::path::Path;
+
+    fn files(paths: &[&str]) -> HashSet<String> {
+        paths.iter().map(|p| p.to_string()).collect()
+    }
+
+    const RUST: &[&str] = &[
+        "app/src/lib.rs",
+        "app/src/config.rs",
+        "app/src/db/mod.rs",
+        "app/src/db/store.rs",
+        "app/src/indexer/mod.rs",
+        "app/src/indexer/parser.rs",
+    ];
+
+    #[test]
+    fn rust_anchored_paths_resolve_against_the_module_tree() {
+        let files = files(RUST);
+        let r = Resolver::new(Path::new(""), &files);
+        let from = "app/src/indexer/mod.rs";
+        assert_eq!(r.resolve(from, "rust", "crate::db::store::Store"), vec!["app/src/db/store.rs"]);
+        assert_eq!(r.resolve(from, "rust", "self::parser"), vec!["app/src/indexer/parser.rs"]);
+        assert_eq!(r.resolve("app/src/db/store.rs", "rust", "crate::Error"), vec!["app/src/lib.rs"]);
+
+        let from = "app/src/indexer/parser.rs";
+        // The tail may name an item of the parent module
+        assert_eq!(r.resolve(from, "rust", "super::Indexer"), vec!["app/src/indexer/mod.rs"]);
+        assert_eq!(
+            r.resolve(from, "rust", "super::super::config::AppConfig"),
+            vec!["app/src/config.rs"]
+        );
+    }
+
+    #[test]
+    fn rust_unanchored_paths_try_the_current_module_then_the_crate_root() {
+        let files = files(RUST);
+        let r = Resolver::new(Path::new(""), &files);
+        assert_eq!(r.resolve("app/src/db/mod.rs", "rust", "store::Store"), vec!["app/src/db/store.rs"]);
+        assert_eq!(r.resolve("app/src/lib.rs", "rust", "db::store"), vec!["app/src/db/store.rs"]);
+        assert!(r.resolve("app/src/lib.rs", "rust", "std::path::Path").is_empty());
+    }
+
+    #[test]
+    fn an_import_of_the_importing_file_is_dropped() {
+        let files = files(RUST);
+        let r = Resolver::new(Path::new(""), &files);
+        assert!(r.resolve("app/src/db/store.rs", "rust", "self::Store").is_empty());
+    }
+
+    #[test]
+    fn rust_module_splits_off_the_src_directory() {
+        assert_eq!(rust_module("app/src/db/mod.rs"), ("app/src", vec!["db"]));
+        assert_eq!(rust_module("app/src/db/store.rs"), ("app/src", vec!["db", "store"]));
+        assert_eq!(rust_module("src/main.rs"), ("src", vec![]));
+        // The innermost `src` is the crate's
+        assert_eq!(rust_module("a/src/x/src/y.rs"), ("a/src/x/src", vec!["y"]));
+        // Without a `src` directory the file's own directory is the root
+        assert_eq!(rust_module("examples/demo.rs"), ("examples", vec!["demo"]));
+        assert_eq!(rust_module("build.rs"), ("", vec!["build"]));
+    }
+
+    #[test]
+    fn rust_module_slices_multibyte_paths_on_byte_offsets() {
+        assert_eq!(rust_module("crates/größe/src/db/mod.rs"), ("crates/größe/src", vec!["db"]));
+        assert_eq!(rust_module("ünïcode/src/lib.rs"), ("ünïcode/src", vec![]));
+    }
+
+    const PYTHON: &[&str] = &[
+        "pkg/__init__.py",
+        "pkg/models.py",
+        "pkg/sub/__init__.py",
+        "pkg/sub/views.py",
+        "src/tools/cli.py",
+        "tests/test_models.py",
+    ];
+
+    #[test]
+    fn python_relative_imports_resolve_from_the_package() {
+        let files = files(PYTHON);
+        let r = Resolver::new(Path::new(""), &files);
+        assert_eq!(r.resolve("pkg/sub/views.py", "python", "..models"), vec!["pkg/models.py"]);
+        assert_eq!(r.resolve("pkg/sub/views.py", "python", "."), vec!["pkg/sub/__init__.py"]);
+        assert_eq!(r.resolve("pkg/sub/__init__.py", "python", ".views.render"), vec!["pkg/sub/views.py"]);
+    }
+
+    #[test]
+    fn python_absolute_imports_resolve_by_suffix() {
+        let files = files(PYTHON);
+        let r = Resolver::new(Path::new(""), &files);
+        let from = "tests/test_models.py";
+        assert_eq!(r.resolve(from, "python", "pkg.models.User"), vec!["pkg/models.py"]);
+        assert_eq!(r.resolve(from, "python", "pkg.sub"), vec!["pkg/sub/__init__.py"]);
+        assert_eq!(r.resolve(from, "python", "tools.cli"), vec!["src/tools/cli.py"]);
+        assert!(r.resolve(from, "python", "os.path").is_empty());
+    }
+
+    const JS: &[&str] = &[
+        "web/src/app.ts",
+        "web/src/util.ts",
+        "web/src/components/index.tsx",
+        "web/src/lib/api.js",
+    ];
+
+    #[test]
+    fn javascript_relative_specifiers_try_extensions_and_index_files() {
+        let files = files(JS);
+        let r = Resolver::new(Path::new(""), &files);
+        let from = "web/src/app.ts";
+        assert_eq!(r.resolve(from, "typescript", "./util"), vec!["web/src/util.ts"]);
+        // An ESM import names the compiled file
+        assert_eq!(r.resolve(from, "typescript", "./util.js"), vec!["web/src/util.ts"]);
+        assert_eq!(r.resolve(from, "typescript", "./components"), vec!["web/src/components/index.tsx"]);
+        assert_eq!(r.resolve(from, "typescript", "../src/lib/api"), vec!["web/src/lib/api.js"]);
+    }
+
+    #[test]
+    fn javascript_packages_aliases_and_paths_outside_the_project_are_external() {
+        let files = files(JS);
+        let r = Resolver::new(Path::new(""), &files);
+        let from = "web/src/app.ts";
+        assert!(r.resolve(from, "javascript", "react").is_empty());
+        assert!(r.resolve(from, "javascript", "@/util").is_empty());
+        assert!(r.resolve(from, "javascript", "../../../util").is_empty());
+    }
+
+    #[test]
+    fn normalize_resolves_dots_and_rejects_escaping_the_root() {
+        assert_eq!(normalize("./a/./b/../c").as_deref(), Some("a/c"));
+        assert_eq!(normalize("a/b/../..").as_deref(), Some(""));
+        assert_eq!(normalize("a/../../b"), None);
+        assert_eq!(normalize(".."), None);
+    }
+
+    #[test]
+    fn go_packages_resolve_through_go_mod_module_paths() {
+        let dir = std::env::temp_dir().join(format!("mh-resolve-{}", std::process::id()));
+        std::fs::create_dir_all(dir.join("tools")).unwrap();
+        std::fs::write(dir.join("go.mod"), "module example.com/app\n\ngo 1.22\n").unwrap();
+        std::fs::write(dir.join("tools/go.mod"), "module \"example.com/app/tools\"\n").unwrap();
+
+        let files = files(&[
+            "main.go",
+            "internal/store/store.go",
+            "internal/store/sql.go",
+            "internal/store/store_test.go",
+            "tools/gen/gen.go",
+        ]);
+        let r = Resolver::new(&dir, &files);
+        let resolved = |target| r.resolve("main.go", "go", target);
+
+        // Every non-test file of the package
+        assert_eq!(
+            resolved("example.com/app/internal/store"),
+            vec!["internal/store/sql.go", "internal/store/store.go"]
+        );
+        // The nested module's path wins over its parent's
+        assert_eq!(resolved("example.com/app/tools/gen"), vec!["tools/gen/gen.go"]);
+        assert!(resolved("example.com/apple").is_empty());
+        assert!(resolved("fmt").is_empty());
+
+        std::fs::remove_dir_all(&dir).unwrap();
+    }
+
+    const JVM: &[&str] = &[
+        "core/src/main/java/com/acme/model/User.java",
+        "core/src/main/java/com/acme/model/Order.java",
+        "core/src/main/resources/com/acme/model/schema.sql",
+        "core/src/main/kotlin/com/acme/util/Strings.kt",
+        "web/src/main/scala/com/acme/web/Routes.scala",
+    ];
+
+    #[test]
+    fn jvm_imports_resolve_classes_members_and_wildcards() {
+        let files = files(JVM);
+        let r = Resolver::new(Path::new(""), &files);
+        let from = "web/src/main/scala/com/acme/web/Routes.scala";
+        let user = "core/src/main/java/com/acme/model/User.java";
+        assert_eq!(r.resolve(from, "scala", "com.acme.model.User"), vec![user]);
+        // A nested class falls back to its enclosing class
+        assert_eq!(r.resolve(from, "java", "com.acme.model.User.Role"), vec![user]);
+        assert_eq!(
+            r.resolve(from, "kotlin", "com.acme.util.Strings.capitalize"),
+            vec!["core/src/main/kotlin/com/acme/util/Strings.kt"]
+        );
+        // Every source file of the package, not its resources
+        assert_eq!(
+            r.resolve(from, "java", "com.acme.model.*"),
+            vec!["core/src/main/java/com/acme/model/Order.java", user]
+        );
+        assert!(r.resolve(from, "java", "java.util.List").is_empty());
+    }
+
+    const CSHARP: &[&str] = &[
+        "MyApp/Program.cs",
+        "MyApp/Services/Mailer.cs",
+        "src/Acme.Core/Models/User.cs",
+        "src/Acme.Core/Models/Order.cs",
+        "src/Acme.Web/Controllers/UserController.cs",
+        "tests/Acme.Tests/UserTests.cs",
+        "tests/Acme.Tests/Models/Fakes.cs",
+    ];
+
+    #[test]
+    fn csharp_namespaces_resolve_to_directories() {
+        let files = files(CSHARP);
+        let r = Resolver::new(Path::new(""), &files);
+        assert_eq!(
+            r.resolve("MyApp/Program.cs", "csharp", "MyApp.Services"),
+            vec!["MyApp/Services/Mailer.cs"]
+        );
+        assert!(r.resolve("MyApp/Program.cs", "csharp", "System.Text").is_empty());
+    }
+
+    #[test]
+    fn csharp_namespace_tails_prefer_the_directory_closest_to_the_importer() {
+        let files = files(CSHARP);
+        let r = Resolver::new(Path::new(""), &files);
+        assert_eq!(
+            r.resolve("src/Acme.Web/Controllers/UserController.cs", "csharp", "Acme.Core.Models"),
+            vec!["src/Acme.Core/Models/Order.cs", "src/Acme.Core/Models/User.cs"]
+        );
+        assert_eq!(
+            r.resolve("tests/Acme.Tests/UserTests.cs", "csharp", "Acme.Core.Models"),
+            vec!["tests/Acme.Tests/Models/Fakes.cs"]
+        );
+    }
+
+    #[test]
+    fn haskell_modules_resolve_by_path_suffix() {
+        let files = files(&["app/Main.hs", "src/Data/Graph.hs", "src/Data/Graph/Internal.hs"]);
+        let r = Resolver::new(Path::new(""), &files);
+        assert_eq!(r.resolve("app/Main.hs", "haskell", "Data.Graph"), vec!["src/Data/Graph.hs"]);
+        assert_eq!(
+            r.resolve("app/Main.hs", "haskell", "Data.Graph.Internal"),
+            vec!["src/Data/Graph/Internal.hs"]
+        );
+        assert!(r.resolve("app/Main.hs", "haskell", "Data.Map").is_empty());
+    }
+
+    #[test]
+    fn ruby_requires_resolve_relative_paths_and_load_path_suffixes() {
+        let files = files(&[
+            "lib/acme.rb",
+            "lib/acme/client.rb",
+            "lib/acme/errors.rb",
+            "spec/acme/client_spec.rb",
+        ]);
+        let r = Resolver::new(Path::new(""), &files);
+        let from = "lib/acme/client.rb";
+        assert_eq!(r.resolve(from, "ruby", "./errors"), vec!["lib/acme/errors.rb"]);
+        assert_eq!(r.resolve(from, "ruby", "../acme.rb"), vec!["lib/acme.rb"]);
+        assert_eq!(
+            r.resolve("spec/acme/client_spec.rb", "ruby", "acme/client"),
+            vec!["lib/acme/client.rb"]
+        );
+        assert!(r.resolve(from, "ruby", "json").is_empty());
+        assert!(r.resolve(from, "ruby", "../../../errors").is_empty());
+    }
+
+    #[test]
+    fn unsupported_languages_resolve_nothing() {
+        let files = files(RUST);
+        let r = Resolver::new(Path::new(""), &files);
+        assert!(r.resolve("app/src/lib.rs", "fsharp", "crate::db").is_empty());
+    }
+}
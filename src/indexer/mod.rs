@@ -2,16 +2,61 @@ pub mod chunker;
 pub mod parser;
 pub mod walker;
 
+use std::collections::{HashMap, HashSet};
 use std::path::{Path, PathBuf};
 use std::sync::Arc;
 
 use sha2::{Digest, Sha256};
+use tracing::Instrument;
 
+use crate::calls::extract::{Function, extract_calls, scope_separator};
 use crate::cli::IndexArgs;
-use crate::config::AppConfig;
-use crate::db::store::{ChunkRecord, Store};
+use crate::config::{AppConfig, HeaderField, PreprocessConfig};
+use crate::config_usage::extract::{Usage, extract_usages};
+use crate::db::calls::CallRecord;
+use crate::db::config_usages::ConfigUsageRecord;
+use crate::db::definitions::DefinitionRecord;
+use crate::db::imports::ImportRecord;
+use crate::db::overlay;
+use crate::db::routes::RouteRecord;
+use crate::db::store::{ChunkRecord, LocationRecord, Store};
+use crate::embed::header::{ChunkContext, header, scope_entry};
 use crate::embed::nomic::NomicEmbedder;
+use crate::embed::preprocess::preprocess;
+use crate::export::definition_kind;
+use crate::graph::extract::extract_imports;
 use crate::error::{AppError, Result};
+use crate::indexer::parser::{Chunk, Definition, parse_definitions};
+use crate::routes::extract::extract_routes;
+
+/// Per-run indexing settings resolved from config and CLI overrides.
+pub struct IndexOptions {
+    pub max_chunk_lines: usize,
+    pub max_file_bytes: u64,
+    pub max_batch_chunks: usize,
+    pub header: Vec<HeaderField>,
+    pub preprocess: PreprocessConfig,
+}
+
+impl IndexOptions {
+    pub fn from_config(config: &AppConfig) -> Self {
+        Self {
+            max_chunk_lines: config.index.max_chunk_lines,
+            max_file_bytes: config.index.max_file_bytes,
+            // A zero batch size would never make progress
+            max_batch_chunks: config.index.max_batch_chunks.max(1),
+            header: config.embed.header.clone(),
+            preprocess: config.embed.preprocess.clone(),
+        }
+    }
+}
+
+/// Counters reported at the end of an indexing pass.
+pub struct IndexSummary {
+    pub found: usize,
+    pub indexed: usize,
+    pub skipped: usize,
+}
 
 pub async fn run(
     config: &AppConfig,
@@ -23,47 +68,38 @@ pub async fn run(
         db_path,
         config.db.embedding_dim,
         &config.db.table_name,
+        &overlay::current(target_dir),
         args.reindex,
     )
     .await?;
 
-    let embedder = Arc::new(
-        tokio::task::spawn_blocking(NomicEmbedder::load)
-            .await
-            .map_err(|e| AppError::Other(e.into()))?
-            .map_err(|e| AppError::Embed(e.to_string()))?,
-    );
-
     let mut exclude = args.exclude.clone();
     exclude.extend_from_slice(&config.index.default_excludes);
-    let files = walker::collect_files(
+    let files = walker::walk_files(
         target_dir,
         &args.include,
         &exclude,
         &config.index.default_extensions,
     );
 
-    let total = files.len();
-    let max_chunk_lines = args.chunk_lines.unwrap_or(config.index.max_chunk_lines);
-    let (indexed, skipped) = index_files(
-        &store,
-        embedder,
-        target_dir,
-        &files,
-        args.reindex,
-        max_chunk_lines,
-    )
-    .await?;
+    let mut options = IndexOptions::from_config(config);
+    if let Some(lines) = args.chunk_lines {
+        options.max_chunk_lines = lines;
+    }
+    let embedder = LazyEmbedder::default();
+    let summary =
+        index_files(&store, None, &embedder, target_dir, files, args.reindex, &options).await?;
 
     println!(
-        "Done. {total} files found: {indexed} indexed, {skipped} skipped (unchanged or binary)."
+        "Done. {} files found: {} indexed, {} skipped (unchanged, binary or too large).",
+        summary.found, summary.indexed, summary.skipped
     );
 
     Ok(())
 }
 
 /// Incrementally refresh the index for the target directory using default settings.
-/// Returns (files_indexed, files_skipped).
+/// The model is only loaded if a file has changed. Returns (files_indexed, files_skipped).
 pub async fn refresh(
     config: &AppConfig,
     db_path: &Path,
@@ -73,149 +109,469 @@ pub async fn refresh(
         db_path,
         config.db.embedding_dim,
         &config.db.table_name,
+        &overlay::current(target_dir),
         false,
     )
     .await?;
 
-    let embedder = Arc::new(
-        tokio::task::spawn_blocking(NomicEmbedder::load)
-            .await
-            .map_err(|e| AppError::Other(e.into()))?
-            .map_err(|e| AppError::Embed(e.to_string()))?,
+    let files = walker::walk_files(
+        target_dir,
+        &[],
+        &config.index.default_excludes,
+        &config.index.default_extensions,
     );
 
-    let files = walker::collect_files(
+    let options = IndexOptions::from_config(config);
+    let embedder = LazyEmbedder::default();
+    let summary = index_files(&store, None, &embedder, target_dir, files, false, &options).await?;
+    Ok((summary.indexed, summary.skipped))
+}
+
+/// Index the target directory into a separate `store` with `options`,
+/// taking the vectors of chunks already embedded in `cache` instead of
+/// embedding them again. `mh tune` builds its chunk-size variants this way.
+pub async fn index_with_cache(
+    config: &AppConfig,
+    store: &Store,
+    cache: &Store,
+    embedder: Arc<NomicEmbedder>,
+    target_dir: &Path,
+    options: &IndexOptions,
+) -> Result<IndexSummary> {
+    let files = walker::walk_files(
         target_dir,
         &[],
         &config.index.default_excludes,
         &config.index.default_extensions,
     );
+    let embedder = LazyEmbedder::loaded(embedder);
+    index_files(store, Some(cache), &embedder, target_dir, files, false, options).await
+}
 
-    index_files(&store, embedder, target_dir, &files, false, config.index.max_chunk_lines).await
+/// The embedding model, loaded the first time a chunk needs embedding, so a
+/// refresh that finds every file unchanged never loads it.
+#[derive(Default)]
+pub struct LazyEmbedder(tokio::sync::OnceCell<Arc<NomicEmbedder>>);
+
+impl LazyEmbedder {
+    /// An embedder that is already loaded.
+    pub fn loaded(embedder: Arc<NomicEmbedder>) -> Self {
+        Self(tokio::sync::OnceCell::new_with(Some(embedder)))
+    }
+
+    async fn get(&self) -> Result<Arc<NomicEmbedder>> {
+        let embedder = self
+            .0
+            .get_or_try_init(|| async {
+                let embedder = tokio::task::spawn_blocking(NomicEmbedder::load)
+                    .await
+                    .map_err(|e| AppError::Other(e.into()))?
+                    .map_err(|e| AppError::Embed(e.to_string()))?;
+                Ok::<_, AppError>(Arc::new(embedder))
+            })
+            .await?;
+        Ok(Arc::clone(embedder))
+    }
 }
 
+#[tracing::instrument(skip_all)]
 async fn index_files(
     store: &Store,
-    embedder: Arc<NomicEmbedder>,
+    cache: Option<&Store>,
+    embedder: &LazyEmbedder,
     target_dir: &Path,
-    files: &[PathBuf],
+    mut files: impl Iterator<Item = PathBuf>,
     reindex: bool,
-    max_chunk_lines: usize,
-) -> Result<(usize, usize)> {
-    // Detect files that were removed from disk since the last index run.
+    options: &IndexOptions,
+) -> Result<IndexSummary> {
+    let mut summary = IndexSummary { found: 0, indexed: 0, skipped: 0 };
+    // Only relative path strings are retained — needed afterwards to detect
+    // files that were removed from disk since the last index run.
+    let mut on_disk_paths: HashSet<String> = HashSet::new();
+
+    while let Some(path) = tracing::trace_span!("walk").in_scope(|| files.next()) {
+        summary.found += 1;
+        let rel_path = path
+            .strip_prefix(target_dir)
+            .unwrap_or(&path)
+            .to_string_lossy()
+            .into_owned();
+        let span = tracing::info_span!("index_file", path = %rel_path);
+        match index_file(store, cache, embedder, &path, &rel_path, reindex, options)
+            .instrument(span)
+            .await?
+        {
+            FileOutcome::Indexed => summary.indexed += 1,
+            FileOutcome::Skipped => summary.skipped += 1,
+            FileOutcome::Unreadable => {}
+        }
+        on_disk_paths.insert(rel_path);
+    }
+
     let indexed_paths = store.list_files().await?;
-    let on_disk_paths: std::collections::HashSet<String> = files
-        .iter()
-        .map(|p| {
-            p.strip_prefix(target_dir)
-                .unwrap_or(p)
-                .to_string_lossy()
-                .into_owned()
-        })
-        .collect();
     for removed in indexed_paths.difference(&on_disk_paths) {
         store.delete_file(removed).await?;
         tracing::info!("removed from index (file deleted): {removed}");
     }
 
-    let mut indexed = 0usize;
-    let mut skipped = 0usize;
-
-    for path in files {
-        let file_bytes = match std::fs::read(path) {
-            Ok(b) => b,
-            Err(e) => {
-                eprintln!("Warning: could not read {}: {}", path.display(), e);
-                continue;
-            }
-        };
+    Ok(summary)
+}
 
-        let current_hash = compute_hash(&file_bytes);
+enum FileOutcome {
+    Indexed,
+    /// Unchanged since the last run, binary, too large, or produced no chunks.
+    Skipped,
+    /// Could not be read from disk; a warning has already been printed.
+    Unreadable,
+}
 
-        // Use path relative to target_dir as the stored key
-        let rel_path = path
-            .strip_prefix(target_dir)
-            .unwrap_or(path)
-            .to_string_lossy()
-            .into_owned();
+/// Parse, embed and store a single file. `rel_path` (relative to the target
+/// directory) is the key stored in the index.
+async fn index_file(
+    store: &Store,
+    cache: Option<&Store>,
+    embedder: &LazyEmbedder,
+    path: &Path,
+    rel_path: &str,
+    reindex: bool,
+    options: &IndexOptions,
+) -> Result<FileOutcome> {
+    // Check the size before reading so multi-megabyte generated files are
+    // never loaded into memory at all.
+    let size = match std::fs::metadata(path) {
+        Ok(m) => m.len(),
+        Err(e) => {
+            eprintln!("Warning: could not read {}: {}", path.display(), e);
+            return Ok(FileOutcome::Unreadable);
+        }
+    };
+    if size > options.max_file_bytes {
+        tracing::info!(
+            "skipped: {rel_path} ({size} bytes exceeds max_file_bytes = {})",
+            options.max_file_bytes
+        );
+        // The file may have been indexed before it grew past the limit
+        if store.get_file_hash(rel_path).await?.is_some() {
+            store.delete_file(rel_path).await?;
+        }
+        return Ok(FileOutcome::Skipped);
+    }
 
-        if !reindex {
-            if let Some(stored_hash) = store.get_file_hash(&rel_path).await? {
-                if stored_hash == current_hash {
-                    skipped += 1;
-                    continue;
-                }
-                // Hash changed — remove stale chunks
-                store.delete_file(&rel_path).await?;
-            }
+    let file_bytes = match std::fs::read(path) {
+        Ok(b) => b,
+        Err(e) => {
+            eprintln!("Warning: could not read {}: {}", path.display(), e);
+            return Ok(FileOutcome::Unreadable);
         }
+    };
 
-        let content = match String::from_utf8(file_bytes) {
-            Ok(s) => s,
-            Err(_) => {
-                // Skip binary files
-                skipped += 1;
-                continue;
-            }
-        };
+    let current_hash = compute_hash(&file_bytes);
 
-        let chunks = parser::parse_file(path, &content, max_chunk_lines);
-        if chunks.is_empty() {
-            skipped += 1;
-            continue;
+    if !reindex {
+        if let Some(stored_hash) = store.get_file_hash(rel_path).await? {
+            if stored_hash == current_hash {
+                return Ok(FileOutcome::Skipped);
+            }
+            // Hash changed, or an earlier run was interrupted before the
+            // file was stamped — remove stale chunks
+            store.delete_file(rel_path).await?;
         }
+        // Another branch already indexed this exact file
+        if store.adopt_file(rel_path, &current_hash).await? {
+            return Ok(FileOutcome::Indexed);
+        }
+    }
 
-        // Embed all chunks for this file in one spawn_blocking call
-        let emb = Arc::clone(&embedder);
-        let contents: Vec<String> = chunks.iter().map(|c| c.content.clone()).collect();
-        let summaries: Vec<Option<String>> = chunks.iter().map(|c| c.summary.clone()).collect();
-
-        let (vectors, summary_vectors): (Vec<Option<Vec<f32>>>, Vec<Option<Vec<f32>>>) =
-            tokio::task::spawn_blocking(move || {
-                let vecs: Vec<Option<Vec<f32>>> =
-                    contents.iter().map(|c| emb.embed_code(c).ok()).collect();
-                let svecs: Vec<Option<Vec<f32>>> = summaries
-                    .iter()
-                    .map(|s| s.as_deref().and_then(|text| emb.embed_query(text).ok()))
-                    .collect();
-                (vecs, svecs)
-            })
-            .await
-            .map_err(|e| AppError::Other(e.into()))?;
+    let content = match String::from_utf8(file_bytes) {
+        Ok(s) => s,
+        // Skip binary files
+        Err(_) => return Ok(FileOutcome::Skipped),
+    };
 
-        let mut records = Vec::with_capacity(chunks.len());
-        for ((chunk, vector_opt), summary_vector) in
-            chunks.into_iter().zip(vectors).zip(summary_vectors)
-        {
-            let vector = match vector_opt {
-                Some(v) => v,
-                None => {
-                    eprintln!("Warning: embed failed for {}", rel_path);
-                    continue;
-                }
+    let mut chunks = parser::parse_file(path, &content, options.max_chunk_lines);
+    let routes: Vec<RouteRecord> = extract_routes(path, &content)
+        .into_iter()
+        .map(|r| RouteRecord {
+            file_path: rel_path.to_string(),
+            framework: r.framework.to_string(),
+            method: r.method,
+            path: r.path,
+            handler: r.handler,
+            line: r.line,
+        })
+        .collect();
+    let usages = extract_usages(path, &content);
+    let language = chunks.first().map(|c| c.language.clone()).unwrap_or_default();
+    let imports: Vec<ImportRecord> = extract_imports(path, &content)
+        .into_iter()
+        .map(|i| ImportRecord {
+            file_path: rel_path.to_string(),
+            language: language.clone(),
+            target: i.target,
+            line: i.line,
+        })
+        .collect();
+    let calls = call_records(rel_path, &language, extract_calls(path, &content));
+    let definitions = parse_definitions(path, &content);
+    drop(content);
+    let with_scope = options.header.contains(&HeaderField::Scope);
+    let mut headers: Vec<String> = chunks
+        .iter()
+        .map(|c| {
+            let scope = if with_scope { chunk_scope(&definitions, c) } else { vec![] };
+            let context = ChunkContext {
+                file_path: rel_path,
+                language: &c.language,
+                scope: &scope,
+                summary: c.summary.as_deref(),
             };
+            header(&options.header, &context)
+        })
+        .collect();
+    let mut keys: Vec<String> =
+        chunks.iter().zip(&headers).map(|(c, h)| chunk_key(c, h)).collect();
+    let usages = config_usages(rel_path, &chunks, &keys, usages);
+    let definitions = definition_records(rel_path, &definitions);
+    if chunks.is_empty() {
+        return Ok(FileOutcome::Skipped);
+    }
 
-            records.push(ChunkRecord {
+    // Embed and insert in batches of at most `max_batch_chunks` so a file that
+    // produces thousands of chunks never holds all of their vectors at once.
+    let mut written = 0usize;
+    while !chunks.is_empty() {
+        let take = options.max_batch_chunks.min(chunks.len());
+        let batch: Vec<Chunk> = chunks.drain(..take).collect();
+        let batch_headers: Vec<String> = headers.drain(..take).collect();
+
+        // Content already stored (vendored copies, generated clients, the same
+        // file on another branch) only needs a new location, not an embedding.
+        let hashes: Vec<String> = keys.drain(..take).collect();
+        let known = store.known_content_hashes(&hashes).await?;
+
+        let mut locations = Vec::with_capacity(batch.len());
+        let mut to_embed = Vec::new();
+        let mut queued: HashSet<String> = HashSet::new();
+        for ((chunk, hash), header) in batch.into_iter().zip(hashes).zip(batch_headers) {
+            locations.push(LocationRecord {
                 id: format!("{}:{}", rel_path, chunk.start_line),
-                file_path: rel_path.clone(),
-                file_hash: current_hash.clone(),
-                language: chunk.language,
-                symbol: chunk.symbol,
-                content: chunk.content,
+                content_hash: hash.clone(),
+                file_path: rel_path.to_string(),
+                // Stamped once every row of the file is stored (see below)
+                file_hash: String::new(),
+                symbol: chunk.symbol.clone(),
                 start_line: chunk.start_line,
                 end_line: chunk.end_line,
-                vector,
-                summary: chunk.summary,
-                summary_vector,
             });
+            if !known.contains(&hash) && queued.insert(hash.clone()) {
+                to_embed.push((chunk, hash, header));
+            }
         }
 
-        store.insert(&records).await?;
-        tracing::info!("indexed: {rel_path} ({} chunks)", records.len());
-        indexed += 1;
+        let records =
+            embed_batch(embedder, cache, to_embed, rel_path, &current_hash, &options.preprocess)
+                .await?;
+
+        // Drop locations whose content failed to embed — they would point at
+        // a chunk row that doesn't exist.
+        let embedded: HashSet<&str> = records.iter().map(|r| r.content_hash.as_str()).collect();
+        locations.retain(|l| known.contains(&l.content_hash) || embedded.contains(l.content_hash.as_str()));
+
+        if let Err(e) = store.insert(&records, &locations).await {
+            if written > 0 {
+                let _ = store.delete_file(rel_path).await;
+            }
+            return Err(e);
+        }
+        written += locations.len();
+    }
+    // The file hash is written last: until then the locations carry an empty
+    // hash, so a run killed part-way leaves a file that never matches on the
+    // next run and is indexed again from scratch.
+    let stored: Result<()> = async {
+        store.routes().add(&routes).await?;
+        store.config_usages().add(&usages).await?;
+        store.imports().add(&imports).await?;
+        store.calls().add(&calls).await?;
+        store.definitions().add(&definitions).await?;
+        store.stamp_file(rel_path, &current_hash).await
+    }
+    .await;
+    if let Err(e) = stored {
+        let _ = store.delete_file(rel_path).await;
+        return Err(e);
     }
 
-    Ok((indexed, skipped))
+    tracing::info!("indexed: {rel_path} ({written} chunks)");
+    Ok(FileOutcome::Indexed)
+}
+
+/// Attach each config usage to the innermost chunk containing its line.
+/// `keys` are the chunks' row keys, in the same order.
+fn config_usages(
+    rel_path: &str,
+    chunks: &[Chunk],
+    keys: &[String],
+    usages: Vec<Usage>,
+) -> Vec<ConfigUsageRecord> {
+    usages
+        .into_iter()
+        .map(|u| {
+            let chunk = chunks
+                .iter()
+                .zip(keys)
+                .filter(|(c, _)| c.start_line <= u.line && u.line <= c.end_line)
+                .min_by_key(|(c, _)| c.end_line - c.start_line);
+            ConfigUsageRecord {
+                file_path: rel_path.to_string(),
+                kind: u.kind.as_str().to_string(),
+                key: u.key,
+                line: u.line,
+                content_hash: chunk.map(|(_, key)| key.clone()),
+            }
+        })
+        .collect()
+}
+
+/// Definitions enclosing a chunk, outermost first. The definition a chunk
+/// was cut from encloses it when it was split by lines.
+fn chunk_scope(definitions: &[Definition], chunk: &Chunk) -> Vec<String> {
+    definitions
+        .iter()
+        .filter(|d| {
+            d.start.0 <= chunk.start_line
+                && chunk.end_line <= d.end.0
+                && (d.start.0, d.end.0) != (chunk.start_line, chunk.end_line)
+        })
+        .map(|d| scope_entry(&d.node_kind, &d.symbol))
+        .collect()
+}
+
+/// Outline rows for a file's definitions.
+fn definition_records(rel_path: &str, definitions: &[Definition]) -> Vec<DefinitionRecord> {
+    definitions
+        .iter()
+        .map(|d| {
+            let scope: Vec<&str> = d.scope.iter().map(|(name, _)| name.as_str()).collect();
+            DefinitionRecord {
+                file_path: rel_path.to_string(),
+                language: d.language.to_string(),
+                name: d.symbol.clone(),
+                scope: scope.join(scope_separator(d.language)),
+                kind: definition_kind(d).as_str().to_string(),
+                start_line: d.start.0,
+                end_line: d.end.0,
+                summary: d.summary.clone(),
+            }
+        })
+        .collect()
+}
+
+/// One row per definition, with an empty callee, followed by its calls.
+fn call_records(rel_path: &str, language: &str, functions: Vec<Function>) -> Vec<CallRecord> {
+    let mut records = Vec::new();
+    for f in functions {
+        let record = |callee: String, qualifier: String, line: u32| CallRecord {
+            file_path: rel_path.to_string(),
+            language: language.to_string(),
+            caller: f.name.clone(),
+            caller_line: f.start_line,
+            caller_end_line: f.end_line,
+            callee,
+            qualifier,
+            line,
+        };
+        records.push(record(String::new(), String::new(), f.start_line));
+        records.extend(f.calls.iter().map(|c| record(c.callee.clone(), c.qualifier.clone(), c.line)));
+    }
+    records
+}
+
+/// Embed one batch of new, unique chunks on a blocking thread and turn them
+/// into records. Chunks whose embedding fails are dropped with a warning.
+/// The model sees the header followed by the preprocessed text; records keep
+/// the original content. Chunks found in `cache` reuse its vectors.
+async fn embed_batch(
+    embedder: &LazyEmbedder,
+    cache: Option<&Store>,
+    batch: Vec<(Chunk, String, String)>,
+    rel_path: &str,
+    file_hash: &str,
+    preprocess_config: &PreprocessConfig,
+) -> Result<Vec<ChunkRecord>> {
+    if batch.is_empty() {
+        return Ok(Vec::new());
+    }
+
+    let mut cached = match cache {
+        Some(cache) => {
+            let hashes: Vec<String> = batch.iter().map(|(_, hash, _)| hash.clone()).collect();
+            cache.embeddings_for(&hashes).await?
+        }
+        None => HashMap::new(),
+    };
+    let (hits, batch): (Vec<_>, Vec<_>) =
+        batch.into_iter().partition(|(_, hash, _)| cached.contains_key(hash));
+
+    // The model is only loaded once a chunk isn't in the cache. The current
+    // span is re-entered on the blocking thread so per-chunk embed spans
+    // nest under this file in traces.
+    let embedded: Vec<(Chunk, String, Option<Vec<f32>>, Option<Vec<f32>>)> = if batch.is_empty() {
+        Vec::new()
+    } else {
+        let emb = embedder.get().await?;
+        let preprocess_config = preprocess_config.clone();
+        let span = tracing::Span::current();
+        tokio::task::spawn_blocking(move || {
+            let _entered = span.enter();
+            batch
+                .into_iter()
+                .map(|(chunk, hash, header)| {
+                    let text = preprocess(&chunk.content, &chunk.language, &preprocess_config);
+                    let vector = emb.embed_code(&(header + &text)).ok();
+                    let summary_vector = chunk
+                        .summary
+                        .as_deref()
+                        .and_then(|text| emb.embed_query(text).ok());
+                    (chunk, hash, vector, summary_vector)
+                })
+                .collect()
+        })
+        .await
+        .map_err(|e| AppError::Other(e.into()))?
+    };
+    let reused = hits.into_iter().map(|(chunk, hash, _)| {
+        let (vector, summary_vector) = cached.remove(&hash).expect("partitioned on cache hits");
+        (chunk, hash, Some(vector), summary_vector)
+    });
+
+    let mut records = Vec::with_capacity(embedded.len());
+    for (chunk, content_hash, vector_opt, summary_vector) in embedded.into_iter().chain(reused) {
+        let vector = match vector_opt {
+            Some(v) => v,
+            None => {
+                eprintln!("Warning: embed failed for {}", rel_path);
+                continue;
+            }
+        };
+
+        records.push(ChunkRecord {
+            id: format!("{}:{}", rel_path, chunk.start_line),
+            content_hash,
+            file_path: rel_path.to_string(),
+            file_hash: file_hash.to_string(),
+            language: chunk.language,
+            symbol: chunk.symbol,
+            content: chunk.content,
+            start_line: chunk.start_line,
+            end_line: chunk.end_line,
+            vector,
+            summary: chunk.summary,
+            summary_vector,
+        });
+    }
+
+    Ok(records)
 }
 
 fn compute_hash(data: &[u8]) -> String {
@@ -224,3 +580,29 @@ fn compute_hash(data: &[u8]) -> String {
     let result = hasher.finalize();
     result.iter().map(|b| format!("{:02x}", b)).collect()
 }
+
+/// Content hash keying a chunk row. Copies share a row only when everything
+/// stored on it and the header its vector was embedded with are identical:
+/// the same body with a different doc comment, in another language, or —
+/// with `path` in the header — in another file gets a row of its own.
+pub(crate) fn chunk_key(chunk: &Chunk, header: &str) -> String {
+    let mut data = Vec::with_capacity(chunk.content.len() + header.len() + 64);
+    let parts = [
+        Some(chunk.language.as_str()),
+        chunk.summary.as_deref(),
+        Some(header),
+        Some(chunk.content.as_str()),
+    ];
+    for part in parts {
+        // Length-prefixed, so no two different chunks give the same input
+        match part {
+            Some(p) => {
+                data.push(1);
+                data.extend_from_slice(&(p.len() as u64).to_le_bytes());
+                data.extend_from_slice(p.as_bytes());
+            }
+            None => data.push(0),
+        }
+    }
+    compute_hash(&data)
+}
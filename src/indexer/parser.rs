@@ -21,6 +21,26 @@ pub struct Chunk {
     pub summary: Option<String>,
 }
 
+/// A named symbol definition with the source positions that code-navigation
+/// formats need. Unlike chunks, definitions are never split and include
+/// nested definitions such as methods inside classes.
+pub struct Definition {
+    pub language: &'static str,
+    pub symbol: String,
+    /// Raw tree-sitter node kind (e.g. "function_item")
+    pub node_kind: String,
+    /// (name, node kind) of the enclosing definitions, outermost first
+    pub scope: Vec<(String, String)>,
+    /// Extent of the whole definition as 0-based (line, byte column)
+    pub start: (u32, u32),
+    pub end: (u32, u32),
+    /// Extent of the name
+    pub name_start: (u32, u32),
+    pub name_end: (u32, u32),
+    /// Extracted docstring or preceding comment block, if available
+    pub summary: Option<String>,
+}
+
 // ── per-language node kinds that represent meaningful top-level definitions ───
 
 const RUST_KINDS: &[&str] = &[
@@ -41,6 +61,7 @@ const PYTHON_KINDS: &[&str] = &[
     "function_definition",
     "class_definition",
     "decorated_definition",
+    "lambda",
 ];
 
 const JAVA_KINDS: &[&str] = &[
@@ -93,6 +114,7 @@ const JS_KINDS: &[&str] = &[
     "class_declaration",
     "method_definition",
     "arrow_function",
+    "function_expression",
     "generator_function_declaration",
 ];
 
@@ -101,6 +123,7 @@ const TS_KINDS: &[&str] = &[
     "class_declaration",
     "method_definition",
     "arrow_function",
+    "function_expression",
     "generator_function_declaration",
     "interface_declaration",
     "type_alias_declaration",
@@ -138,107 +161,140 @@ const KOTLIN_KINDS: &[&str] = &[
 
 // ─────────────────────────────────────────────────────────────────────────────
 
+/// Grammar, language name and definition node kinds for a file, chosen by
+/// extension. `None` for unsupported files.
+pub(crate) fn grammar_for(path: &Path) -> Option<(Language, &'static str, &'static [&'static str])> {
+    let ext = path.extension().and_then(|e| e.to_str()).unwrap_or("");
+    let grammar: (Language, &'static str, &'static [&'static str]) = match ext {
+        "rs" => (tree_sitter_rust::LANGUAGE.into(), "rust", RUST_KINDS),
+        "py" => (tree_sitter_python::LANGUAGE.into(), "python", PYTHON_KINDS),
+        "java" => (tree_sitter_java::LANGUAGE.into(), "java", JAVA_KINDS),
+        "cs" => (tree_sitter_c_sharp::LANGUAGE.into(), "csharp", CSHARP_KINDS),
+        "scala" | "sc" => (tree_sitter_scala::LANGUAGE.into(), "scala", SCALA_KINDS),
+        "hs" => (tree_sitter_haskell::LANGUAGE.into(), "haskell", HASKELL_KINDS),
+        "js" | "cjs" | "mjs" | "jsx" => {
+            (tree_sitter_javascript::LANGUAGE.into(), "javascript", JS_KINDS)
+        }
+        "ts" => (tree_sitter_typescript::LANGUAGE_TYPESCRIPT.into(), "typescript", TS_KINDS),
+        "tsx" => (tree_sitter_typescript::LANGUAGE_TSX.into(), "tsx", TS_KINDS),
+        "go" => (tree_sitter_go::LANGUAGE.into(), "go", GO_KINDS),
+        "rb" => (tree_sitter_ruby::LANGUAGE.into(), "ruby", RUBY_KINDS),
+        "fs" | "fsx" => (tree_sitter_fsharp::LANGUAGE_FSHARP.into(), "fsharp", FSHARP_KINDS),
+        "kt" | "kts" => (tree_sitter_kotlin::LANGUAGE.into(), "kotlin", KOTLIN_KINDS),
+        _ => return None,
+    };
+    Some(grammar)
+}
+
+#[tracing::instrument(skip_all, fields(path = %path.display(), bytes = content.len()))]
 pub fn parse_file(path: &Path, content: &str, max_chunk_lines: usize) -> Vec<Chunk> {
-    let ext = path
-        .extension()
-        .and_then(|e| e.to_str())
-        .unwrap_or("")
-        .to_string();
-
-    match ext.as_str() {
-        "rs" => parse_with_grammar(
-            content,
-            tree_sitter_rust::LANGUAGE.into(),
-            "rust",
-            RUST_KINDS,
-            max_chunk_lines,
-        ),
-        "py" => parse_with_grammar(
-            content,
-            tree_sitter_python::LANGUAGE.into(),
-            "python",
-            PYTHON_KINDS,
-            max_chunk_lines,
-        ),
-        "java" => parse_with_grammar(
-            content,
-            tree_sitter_java::LANGUAGE.into(),
-            "java",
-            JAVA_KINDS,
-            max_chunk_lines,
-        ),
-        "cs" => parse_with_grammar(
-            content,
-            tree_sitter_c_sharp::LANGUAGE.into(),
-            "csharp",
-            CSHARP_KINDS,
-            max_chunk_lines,
-        ),
-        "scala" | "sc" => parse_with_grammar(
-            content,
-            tree_sitter_scala::LANGUAGE.into(),
-            "scala",
-            SCALA_KINDS,
-            max_chunk_lines,
-        ),
-        "hs" => parse_with_grammar(
-            content,
-            tree_sitter_haskell::LANGUAGE.into(),
-            "haskell",
-            HASKELL_KINDS,
-            max_chunk_lines,
-        ),
-        "js" | "cjs" | "mjs" | "jsx" => parse_with_grammar(
-            content,
-            tree_sitter_javascript::LANGUAGE.into(),
-            "javascript",
-            JS_KINDS,
-            max_chunk_lines,
-        ),
-        "ts" => parse_with_grammar(
-            content,
-            tree_sitter_typescript::LANGUAGE_TYPESCRIPT.into(),
-            "typescript",
-            TS_KINDS,
-            max_chunk_lines,
-        ),
-        "tsx" => parse_with_grammar(
-            content,
-            tree_sitter_typescript::LANGUAGE_TSX.into(),
-            "tsx",
-            TS_KINDS,
-            max_chunk_lines,
-        ),
-        "go" => parse_with_grammar(
-            content,
-            tree_sitter_go::LANGUAGE.into(),
-            "go",
-            GO_KINDS,
-            max_chunk_lines,
-        ),
-        "rb" => parse_with_grammar(
-            content,
-            tree_sitter_ruby::LANGUAGE.into(),
-            "ruby",
-            RUBY_KINDS,
-            max_chunk_lines,
-        ),
-        "fs" | "fsx" => parse_with_grammar(
-            content,
-            tree_sitter_fsharp::LANGUAGE_FSHARP.into(),
-            "fsharp",
-            FSHARP_KINDS,
-            max_chunk_lines,
-        ),
-        "kt" | "kts" => parse_with_grammar(
-            content,
-            tree_sitter_kotlin::LANGUAGE.into(),
-            "kotlin",
-            KOTLIN_KINDS,
-            max_chunk_lines,
-        ),
-        _ => vec![],
+    match grammar_for(path) {
+        Some((language, lang_name, kinds)) => {
+            parse_with_grammar(content, language, lang_name, kinds, max_chunk_lines)
+        }
+        None => vec![],
+    }
+}
+
+/// Node kinds that name definitions but are too fine-grained to be chunks of
+/// their own: the specs inside Go's grouped `type`/`const`/`var` declarations.
+fn nested_definition_kinds_for(lang: &str) -> &'static [&'static str] {
+    match lang {
+        "go" => &["type_spec", "const_spec", "var_spec"],
+        _ => &[],
+    }
+}
+
+/// Function expressions, which have no name of their own: they are named
+/// after the variable, property or assignment target they are bound to.
+fn anonymous_function_kinds_for(lang: &str) -> &'static [&'static str] {
+    match lang {
+        "javascript" | "typescript" | "tsx" => &["arrow_function", "function_expression"],
+        "python" => &["lambda"],
+        _ => &[],
+    }
+}
+
+/// Collect every named definition in a file, in source order. Returns an
+/// empty list for unsupported files or when the file can't be parsed.
+#[tracing::instrument(skip_all, fields(path = %path.display()))]
+pub fn parse_definitions(path: &Path, content: &str) -> Vec<Definition> {
+    let Some((language, lang_name, kinds)) = grammar_for(path) else {
+        return vec![];
+    };
+    let mut parser = Parser::new();
+    if parser.set_language(&language).is_err() {
+        return vec![];
+    }
+    let Some(tree) = parser.parse(content, None) else {
+        return vec![];
+    };
+
+    let nested_kinds = nested_definition_kinds_for(lang_name);
+    let anonymous_kinds = anonymous_function_kinds_for(lang_name);
+    let prune_kinds = prune_kinds_for(lang_name);
+    let point = |p: tree_sitter::Point| (p.row as u32, p.column as u32);
+
+    let mut definitions = Vec::new();
+    // Enclosing scopes are kept as an arena of (parent, name, kind) so stack
+    // entries can refer to their scope by index
+    let mut scopes: Vec<(Option<usize>, String, String)> = Vec::new();
+    let mut stack = vec![(tree.root_node(), None::<usize>)];
+    while let Some((node, scope)) = stack.pop() {
+        if prune_kinds.contains(&node.kind()) {
+            continue;
+        }
+
+        let mut child_scope = scope;
+        if kinds.contains(&node.kind()) || nested_kinds.contains(&node.kind()) {
+            // Functions passed to calls stay anonymous: callbacks aren't symbols
+            let span = if anonymous_kinds.contains(&node.kind()) {
+                binding_span(&node, false).or_else(|| own_name_span(&node))
+            } else {
+                name_span(&node, content)
+            };
+            if let Some((name_node, range)) = span {
+                let symbol = content[range.clone()].to_string();
+                // A name narrower than its node (F#) starts on the same line
+                let (line, column) = point(name_node.start_position());
+                let offset = (range.start - name_node.start_byte()) as u32;
+                let name_start = (line, column + offset);
+                let name_end = (name_start.0, name_start.1 + range.len() as u32);
+
+                let mut path = Vec::new();
+                let mut next = scope;
+                while let Some(i) = next {
+                    let (parent, name, kind) = &scopes[i];
+                    path.push((name.clone(), kind.clone()));
+                    next = *parent;
+                }
+                path.reverse();
+
+                definitions.push(Definition {
+                    language: lang_name,
+                    symbol: symbol.clone(),
+                    node_kind: node.kind().to_string(),
+                    scope: path,
+                    start: point(node.start_position()),
+                    end: point(node.end_position()),
+                    name_start,
+                    name_end,
+                    summary: is_summary_kind(lang_name, node.kind())
+                        .then(|| extract_comment(node, content, lang_name))
+                        .flatten(),
+                });
+                scopes.push((scope, symbol, node.kind().to_string()));
+                child_scope = Some(scopes.len() - 1);
+            }
+        }
+
+        // Push in reverse so children are visited in source order
+        let mut cursor = node.walk();
+        let children: Vec<_> = node.children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev().map(|c| (c, child_scope)));
     }
+
+    definitions
 }
 
 /// Generic tree-sitter parser: walks the AST and collects nodes whose kind is in
@@ -286,8 +342,11 @@ fn prune_kinds_for(lang: &str) -> &'static [&'static str] {
     }
 }
 
+/// Walks the tree with an explicit work stack rather than recursion: generated
+/// code and long expression chains can nest thousands of levels deep and would
+/// otherwise overflow the thread stack.
 fn collect_chunks(
-    node: tree_sitter::Node,
+    root: tree_sitter::Node,
     content: &str,
     lang_name: &str,
     interesting_kinds: &[&str],
@@ -295,55 +354,70 @@ fn collect_chunks(
     max_chunk_lines: usize,
     chunks: &mut Vec<Chunk>,
 ) {
-    if interesting_kinds.contains(&node.kind()) {
-        let start_line = node.start_position().row as u32;
-        let end_line = node.end_position().row as u32;
-        let node_content = &content[node.byte_range()];
-        let symbol = get_node_name(&node, content);
-        let line_count = (end_line - start_line + 1) as usize;
-
-        let summary = if is_summary_kind(lang_name, node.kind()) {
-            extract_comment(node, content, lang_name)
-        } else {
-            None
-        };
+    let mut stack = vec![root];
+    while let Some(node) = stack.pop() {
+        if interesting_kinds.contains(&node.kind()) {
+            push_node_chunks(node, content, lang_name, max_chunk_lines, chunks);
+            // Don't descend into matched nodes
+            continue;
+        }
 
-        if line_count > max_chunk_lines {
-            let sub = chunker::split_by_lines(
-                node_content,
-                &symbol,
-                lang_name,
-                start_line,
-                max_chunk_lines,
-                node.kind(),
-                summary.as_deref(),
-            );
-            chunks.extend(sub);
-        } else {
-            chunks.push(Chunk {
-                language: lang_name.to_string(),
-                symbol,
-                content: node_content.to_string(),
-                start_line,
-                end_line,
-                node_kind: node.kind().to_string(),
-                summary,
-            });
+        // Don't descend into pruned node kinds — they may contain sub-nodes whose
+        // kind collides with interesting_kinds but represent something different
+        // (e.g. Haskell `function` type-expressions inside `signature` nodes).
+        if prune_kinds.contains(&node.kind()) {
+            continue;
         }
-        // Don't recurse into matched nodes
-        return;
-    }
 
-    // Don't recurse into pruned node kinds — they may contain sub-nodes whose
-    // kind collides with interesting_kinds but represent something different
-    // (e.g. Haskell `function` type-expressions inside `signature` nodes).
-    if prune_kinds.contains(&node.kind()) {
-        return;
+        // Push in reverse so children are visited in source order
+        let mut cursor = node.walk();
+        let children: Vec<_> = node.children(&mut cursor).collect();
+        stack.extend(children.into_iter().rev());
     }
+}
 
-    let mut cursor = node.walk();
-    for child in node.children(&mut cursor) {
-        collect_chunks(child, content, lang_name, interesting_kinds, prune_kinds, max_chunk_lines, chunks);
+/// Emit the chunk(s) for a matched definition node, splitting it by lines when
+/// it exceeds `max_chunk_lines`.
+fn push_node_chunks(
+    node: tree_sitter::Node,
+    content: &str,
+    lang_name: &str,
+    max_chunk_lines: usize,
+    chunks: &mut Vec<Chunk>,
+) {
+    let start_line = node.start_position().row as u32;
+    let end_line = node.end_position().row as u32;
+    let node_content = &content[node.byte_range()];
+    let symbol = get_node_name(&node, content, lang_name);
+    let line_count = (end_line - start_line + 1) as usize;
+
+    let summary = if is_summary_kind(lang_name, node.kind()) {
+        extract_comment(node, content, lang_name)
+    } else {
+        None
+    };
+
+    if line_count > max_chunk_lines {
+        let sub = chunker::split_by_lines(
+            node_content,
+            &symbol,
+            lang_name,
+            start_line,
+            max_chunk_lines,
+            node.kind(),
+            summary.as_deref(),
+        );
+        chunks.extend(sub);
+    } else {
+        chunks.push(Chunk {
+            language: lang_name.to_string(),
+            symbol,
+            content: node_content.to_string(),
+            start_line,
+            end_line,
+            node_kind: node.kind().to_string(),
+            summary,
+        });
     }
 }
 
@@ -365,6 +439,7 @@ fn is_summary_kind(lang: &str, kind: &str) -> bool {
                 | "class_declaration"
                 | "method_definition"
                 | "arrow_function"
+                | "function_expression"
                 | "generator_function_declaration"
         ),
         "typescript" | "tsx" => matches!(
@@ -373,6 +448,7 @@ fn is_summary_kind(lang: &str, kind: &str) -> bool {
                 | "class_declaration"
                 | "method_definition"
                 | "arrow_function"
+                | "function_expression"
                 | "generator_function_declaration"
                 | "interface_declaration"
         ),
@@ -689,37 +765,149 @@ fn strip_xml_tags(s: &str) -> String {
 
 /// Try to extract a human-readable name for a node by looking for its first
 /// identifier-like child.  Returns an empty string if none is found.
-fn get_node_name(node: &tree_sitter::Node, content: &str) -> String {
+fn get_node_name(node: &tree_sitter::Node, content: &str, lang: &str) -> String {
+    if anonymous_function_kinds_for(lang).contains(&node.kind()) {
+        return binding_span(node, true)
+            .or_else(|| own_name_span(node))
+            .map(|(_, range)| content[range].to_string())
+            .or_else(|| call_name(node, content))
+            .unwrap_or_default();
+    }
+    if let Some((_, range)) = name_span(node, content) {
+        return content[range].to_string();
+    }
+    // Go: `var handler = func(...) {...}` is named after its one spec; a
+    // grouped declaration defines several names and stays unnamed
+    if matches!(node.kind(), "var_declaration" | "const_declaration") {
+        let mut cursor = node.walk();
+        let specs: Vec<_> =
+            node.named_children(&mut cursor).filter(|c| c.kind().ends_with("_spec")).collect();
+        if let [spec] = &specs[..] {
+            if let Some(name) = spec.child_by_field_name("name") {
+                return content[name.byte_range()].to_string();
+            }
+        }
+    }
+    String::new()
+}
+
+/// The name a function expression is bound to: the variable, property, class
+/// field or assignment target it is the value of. With `through_calls`, a
+/// function that is a call's only argument takes what the call is bound to
+/// (`const handler = wrap(async (req) => {...})`). A callback beside other
+/// arguments (`jobs = sorted(items, key=lambda item: item.priority)`) is not
+/// what the call returns, so it isn't named after the result.
+fn binding_span<'t>(
+    node: &tree_sitter::Node<'t>,
+    through_calls: bool,
+) -> Option<(tree_sitter::Node<'t>, std::ops::Range<usize>)> {
+    let mut parent = node.parent()?;
+    while matches!(
+        parent.kind(),
+        "parenthesized_expression" | "as_expression" | "satisfies_expression" | "non_null_expression"
+    ) {
+        parent = parent.parent()?;
+    }
+    let name = match parent.kind() {
+        "variable_declarator" | "public_field_definition" => parent.child_by_field_name("name"),
+        "pair" => parent.child_by_field_name("key"),
+        "field_definition" => parent.child_by_field_name("property"),
+        "assignment_expression" | "assignment" => parent.child_by_field_name("left"),
+        "arguments" | "argument_list" | "keyword_argument" if through_calls => {
+            let args = call_arguments(node)?;
+            let mut cursor = args.walk();
+            if args.named_children(&mut cursor).filter(|a| a.kind() != "comment").count() != 1 {
+                return None;
+            }
+            return binding_span(&args.parent()?, true);
+        }
+        _ => None,
+    }?;
+    Some((name, name.byte_range()))
+}
+
+/// Argument list of the call `node` is passed to, positionally or as a
+/// keyword argument (Python `key=lambda x: ...`).
+fn call_arguments<'t>(node: &tree_sitter::Node<'t>) -> Option<tree_sitter::Node<'t>> {
+    let mut parent = node.parent()?;
+    if parent.kind() == "keyword_argument" {
+        parent = parent.parent()?;
+    }
+    matches!(parent.kind(), "arguments" | "argument_list")
+        .then_some(parent)
+        .filter(|args| args.parent().is_some_and(|c| matches!(c.kind(), "call_expression" | "call")))
+}
+
+/// The name written in a named function expression (`function g() {}`).
+/// Arrow functions and lambdas have none.
+fn own_name_span<'t>(
+    node: &tree_sitter::Node<'t>,
+) -> Option<(tree_sitter::Node<'t>, std::ops::Range<usize>)> {
+    node.child_by_field_name("name").map(|n| (n, n.byte_range()))
+}
+
+/// Name for a function passed to a call: the called expression, followed by
+/// the first argument when that is a string (`app.get('/x')`,
+/// `describe('parser')`).
+fn call_name(node: &tree_sitter::Node, content: &str) -> Option<String> {
+    let args = call_arguments(node)?;
+    let callee = args.parent()?.child_by_field_name("function")?;
+    // A callee spread over lines (`app\n  .get`) is written on one
+    let callee: String = content[callee.byte_range()].split_whitespace().collect();
+    let label = args.named_child(0).filter(|a| {
+        a.id() != node.id()
+            && matches!(
+                a.kind(),
+                "string" | "template_string" | "interpreted_string_literal" | "raw_string_literal"
+            )
+    });
+    Some(match label {
+        Some(label) => format!("{callee}({})", &content[label.byte_range()]),
+        None => callee,
+    })
+}
+
+/// Locate the name of a node: the child node holding it, and the name's byte
+/// range within `content` (narrower than the child for F# declaration heads).
+fn name_span<'t>(
+    node: &tree_sitter::Node<'t>,
+    content: &str,
+) -> Option<(tree_sitter::Node<'t>, std::ops::Range<usize>)> {
     let mut cursor = node.walk();
     for child in node.children(&mut cursor) {
         match child.kind() {
             // Most languages: identifier or type-identifier node kinds
             "identifier" | "type_identifier" | "simple_identifier" | "name" => {
-                return content[child.byte_range()].to_string();
+                return Some((child, child.byte_range()));
             }
             // Ruby: class/module names are `constant` nodes
             "constant" => {
-                return content[child.byte_range()].to_string();
+                return Some((child, child.byte_range()));
             }
             // Haskell: function names are `variable` nodes
             "variable" => {
-                return content[child.byte_range()].to_string();
+                return Some((child, child.byte_range()));
             }
             // F#: function name is the first word of function_declaration_left /
             // value_declaration_left (e.g. "pow (b: int) (e: int)" → "pow")
             "function_declaration_left" | "value_declaration_left" => {
                 let text = &content[child.byte_range()];
-                return text.split_whitespace().next().unwrap_or("").to_string();
+                let start = text.find(|c: char| !c.is_whitespace())?;
+                let len = text[start..]
+                    .find(char::is_whitespace)
+                    .unwrap_or(text.len() - start);
+                let begin = child.start_byte() + start;
+                return Some((child, begin..begin + len));
             }
-            // F#: value_declaration wraps function_or_value_defn — delegate one level down
-            "function_or_value_defn" => {
-                let name = get_node_name(&child, content);
-                if !name.is_empty() {
-                    return name;
+            // F#: value_declaration wraps function_or_value_defn, Kotlin:
+            // property_declaration wraps variable_declaration — delegate one level down
+            "function_or_value_defn" | "variable_declaration" => {
+                if let Some(span) = name_span(&child, content) {
+                    return Some(span);
                 }
             }
             _ => continue,
         }
     }
-    String::new()
+    None
 }
@@ -9,7 +9,7 @@
 
 #[cfg(test)]
 mod parser_tests {
-    use crate::indexer::parser::parse_file;
+    use crate::indexer::parser::{parse_definitions, parse_file};
     use std::path::Path;
 
     fn symbols(chunks: &[crate::indexer::parser::Chunk]) -> Vec<&str> {
@@ -586,4 +586,145 @@ mod parser_tests {
             assert_no_summary_for(&chunks, "add", "kotlin plain // comment");
         }
     }
+
+    // ── Definitions for export ───────────────────────────────────────────────
+
+    #[test]
+    fn definitions_include_nested_symbols_with_scope_and_name_position() {
+        let src = concat!(
+            "struct Stack;\n",
+            "impl Stack {\n",
+            "    /// Push a value.\n",
+            "    fn push(&mut self) {}\n",
+            "}\n",
+        );
+        let defs = parse_definitions(Path::new("t.rs"), src);
+        let push = defs.iter().find(|d| d.symbol == "push").expect("missing 'push'");
+        assert_eq!(push.scope, vec![("Stack".to_string(), "impl_item".to_string())]);
+        assert_eq!(push.name_start, (3, 7));
+        assert_eq!(push.name_end, (3, 11));
+        assert_eq!(push.start.0, 3);
+        assert_eq!(push.summary.as_deref(), Some("Push a value."));
+    }
+
+    // ── Anonymous functions named from their binding ─────────────────────────
+
+    #[test]
+    fn javascript_function_expressions_take_their_binding_name() {
+        let src = concat!(
+            "export const handler = async (req) => {\n",
+            "  return req;\n",
+            "};\n",
+            "const double = x => x * 2;\n",
+            "module.exports.legacy = function () {};\n",
+            "const routes = { list: () => [] };\n",
+            "const wrapped = wrap(async (req) => req);\n",
+            "const total = items.reduce((sum, n) => sum + n, 0);\n",
+            "app.get('/users', (req, res) => {\n",
+            "  res.send([]);\n",
+            "});\n",
+            "app.listen(() => {});\n",
+        );
+        let syms: Vec<String> = parse_file(Path::new("t.js"), src, 80)
+            .into_iter()
+            .map(|c| c.symbol)
+            .collect();
+        for expected in [
+            "handler",
+            "double",
+            "module.exports.legacy",
+            "list",
+            "wrapped",
+            "app.get('/users')",
+            "app.listen",
+        ] {
+            assert!(syms.iter().any(|s| s == expected), "missing '{expected}' in {syms:?}");
+        }
+        // A single parameter is not the function's name
+        assert!(!syms.iter().any(|s| s == "x"), "parameter used as name: {syms:?}");
+        // Only a wrapper's sole argument is named after the call's result
+        assert!(syms.iter().any(|s| s == "items.reduce"), "missing 'items.reduce' in {syms:?}");
+        assert!(!syms.iter().any(|s| s == "total"), "callback named after the result: {syms:?}");
+    }
+
+    #[test]
+    fn typescript_class_field_arrows_are_named_and_are_definitions() {
+        let src = concat!(
+            "export class Api {\n",
+            "  fetch = async (id: string): Promise<void> => {};\n",
+            "}\n",
+            "export const handler = (async (req: Request) => req) as Handler;\n",
+            "[1, 2].map((n) => n);\n",
+        );
+        let defs = parse_definitions(Path::new("t.ts"), src);
+        let fetch = defs.iter().find(|d| d.symbol == "fetch").expect("missing 'fetch'");
+        assert_eq!(fetch.scope, vec![("Api".to_string(), "class_declaration".to_string())]);
+        assert!(defs.iter().any(|d| d.symbol == "handler"), "missing 'handler'");
+        // Callbacks are not definitions
+        assert_eq!(defs.len(), 3, "got {:?}", defs.iter().map(|d| &d.symbol).collect::<Vec<_>>());
+
+        let chunks = parse_file(Path::new("t.ts"), src, 80);
+        assert!(symbols(&chunks).contains(&"handler"), "got {:?}", symbols(&chunks));
+    }
+
+    #[test]
+    fn go_function_literals_take_their_variable_name() {
+        let src = concat!(
+            "package t\n",
+            "var handler = func(w http.ResponseWriter, r *http.Request) {\n",
+            "}\n",
+            "var (\n",
+            "    a = 1\n",
+            "    b = 2\n",
+            ")\n",
+        );
+        let chunks = parse_file(Path::new("t.go"), src, 80);
+        let syms = symbols(&chunks);
+        assert!(syms.contains(&"handler"), "got {syms:?}");
+        assert!(!syms.contains(&"a"), "grouped declaration named after one spec: {syms:?}");
+    }
+
+    #[test]
+    fn kotlin_lambdas_take_their_property_name() {
+        let src = concat!(
+            "val handler = { x: Int -> x * 2 }\n",
+            "val greet = fun(name: String): String { return name }\n",
+        );
+        let chunks = parse_file(Path::new("t.kt"), src, 80);
+        let syms = symbols(&chunks);
+        assert!(syms.contains(&"handler") && syms.contains(&"greet"), "got {syms:?}");
+    }
+
+    #[test]
+    fn python_lambdas_take_their_binding_name() {
+        let src = concat!(
+            "handler = lambda event, context: event\n",
+            "app.add_handler(\"start\", lambda update: None)\n",
+            "jobs = sorted(items, key=lambda item: item.priority)\n",
+        );
+        let chunks = parse_file(Path::new("t.py"), src, 80);
+        let syms = symbols(&chunks);
+        for expected in ["handler", "app.add_handler(\"start\")", "sorted"] {
+            assert!(syms.contains(&expected), "missing '{expected}' in {syms:?}");
+        }
+        // A key function is not the sorted list it is passed to build
+        assert!(!syms.contains(&"jobs"), "callback named after the call result: {syms:?}");
+        let defs = parse_definitions(Path::new("t.py"), src);
+        let names: Vec<&str> = defs.iter().map(|d| d.symbol.as_str()).collect();
+        assert_eq!(names, vec!["handler"]);
+    }
+
+    #[test]
+    fn go_grouped_type_specs_are_definitions() {
+        let src = concat!(
+            "package t\n",
+            "type (\n",
+            "    A struct{}\n",
+            "    B int\n",
+            ")\n",
+        );
+        let defs = parse_definitions(Path::new("t.go"), src);
+        let names: Vec<&str> = defs.iter().map(|d| d.symbol.as_str()).collect();
+        assert!(names.contains(&"A") && names.contains(&"B"), "got {names:?}");
+    }
 }
@@ -3,18 +3,25 @@ use std::path::{Path, PathBuf};
 use glob::Pattern;
 use walkdir::WalkDir;
 
-/// Collect all indexable files under `root`.
+#[cfg(test)]
+#[path = "walker_tests.rs"]
+mod walker_tests;
+
+/// Lazily walk all indexable files under `root`.
 ///
 /// If `include` globs are provided, only files matching at least one pattern are kept.
 /// If no include globs are given, files whose extension is in `default_exts` are kept.
 /// Files matching any `exclude` glob are always dropped.
 /// Hidden directories (starting with `.`) are skipped.
-pub fn collect_files(
+///
+/// Paths are yielded as the directory tree is traversed, so indexing can start
+/// before the walk finishes and the full file list is never held in memory.
+pub fn walk_files(
     root: &Path,
     include: &[String],
     exclude: &[String],
     default_exts: &[String],
-) -> Vec<PathBuf> {
+) -> impl Iterator<Item = PathBuf> {
     let include_patterns: Vec<Pattern> = include
         .iter()
         .filter_map(|g| Pattern::new(g).ok())
@@ -23,27 +30,17 @@ pub fn collect_files(
         .iter()
         .filter_map(|g| Pattern::new(g).ok())
         .collect();
+    let prune_patterns = exclude_patterns.clone();
 
     WalkDir::new(root)
         .into_iter()
-        .filter_entry(|e| {
-            if e.file_type().is_dir() {
-                let name = e.file_name().to_str().unwrap_or("");
-                if name.starts_with('.') {
-                    return false;
-                }
-                // Prune directories covered by any exclude pattern
-                let rel = e.path().strip_prefix(root).unwrap_or(e.path());
-                let probe = format!("{}/x", rel.to_string_lossy());
-                if exclude_patterns.iter().any(|p| p.matches(&probe)) {
-                    return false;
-                }
-            }
-            true
+        .filter_entry(move |e| {
+            let rel = e.path().strip_prefix(root).unwrap_or(e.path());
+            !(e.file_type().is_dir() && skips_dir(rel, &prune_patterns))
         })
         .filter_map(|e| e.ok())
         .filter(|e| e.file_type().is_file())
-        .filter_map(|e| {
+        .filter_map(move |e| {
             let path = e.path();
 
             // Get path relative to root for glob matching
@@ -75,5 +72,13 @@ pub fn collect_files(
 
             Some(path.to_path_buf())
         })
-        .collect()
+}
+
+/// Whether walks skip the directory at `rel`, relative to the root: it is
+/// hidden or covered by an exclude pattern.
+pub fn skips_dir(rel: &Path, exclude: &[Pattern]) -> bool {
+    let hidden = rel.file_name().and_then(|n| n.to_str()).is_some_and(|n| n.starts_with('.'));
+    // A directory is covered when a file inside it would be
+    let probe = format!("{}/x", rel.to_string_lossy());
+    hidden || exclude.iter().any(|p| p.matches(&probe))
 }
@@ -0,0 +1,33 @@
+/// Walker tests: hidden directories and those covered by an exclude pattern
+/// are skipped.
+
+#[cfg(test)]
+mod walker_tests {
+    use crate::indexer::walker::skips_dir;
+    use glob::Pattern;
+    use std::path::Path;
+
+    fn patterns(globs: &[&str]) -> Vec<Pattern> {
+        globs.iter().map(|g| Pattern::new(g).unwrap()).collect()
+    }
+
+    #[test]
+    fn hidden_directories_are_skipped() {
+        assert!(skips_dir(Path::new(".git"), &[]));
+        assert!(skips_dir(Path::new("web/.next"), &[]));
+        assert!(!skips_dir(Path::new("src"), &[]));
+        assert!(!skips_dir(Path::new(""), &[]));
+    }
+
+    #[test]
+    fn directories_covered_by_an_exclude_are_skipped() {
+        let exclude = patterns(&["**/target/**", "**/node_modules/**", "vendor/**"]);
+        assert!(skips_dir(Path::new("target"), &exclude));
+        assert!(skips_dir(Path::new("crates/core/target"), &exclude));
+        assert!(skips_dir(Path::new("web/node_modules"), &exclude));
+        assert!(skips_dir(Path::new("vendor"), &exclude));
+        // Anchored patterns only match at the root
+        assert!(!skips_dir(Path::new("src/vendor"), &exclude));
+        assert!(!skips_dir(Path::new("src/targets"), &exclude));
+    }
+}
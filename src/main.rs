@@ -1,17 +1,28 @@
+mod calls;
 mod cli;
 mod config;
+mod config_usage;
+mod coverage;
 mod db;
 mod embed;
 mod error;
+mod export;
+mod graph;
 mod indexer;
+mod outline;
+mod profile;
+mod protobuf;
 mod rag;
+mod routes;
 mod server;
+mod symbols;
 
 use anyhow::Result;
 use clap::Parser;
 use cli::{Cli, Commands, DbAction};
+use db::overlay;
 use db::store::Store;
-use tracing_subscriber::{fmt, EnvFilter};
+use tracing_subscriber::{filter::Targets, fmt, prelude::*, EnvFilter};
 
 #[tokio::main]
 async fn main() -> Result<()> {
@@ -23,7 +34,26 @@ async fn main() -> Result<()> {
         2 => "debug",
         _ => "trace",
     };
-    fmt().with_env_filter(EnvFilter::new(filter)).init();
+
+    // The trace file only receives spans from this crate — lancedb and candle
+    // are heavily instrumented and would drown out the indexing pipeline.
+    // The guard flushes the file on drop, so it must live until main returns.
+    let (chrome_layer, _trace_guard) = match cli.trace_out.as_ref() {
+        Some(path) => {
+            let (layer, guard) = tracing_chrome::ChromeLayerBuilder::new()
+                .file(path)
+                .include_args(true)
+                .build();
+            let targets = Targets::new().with_target(env!("CARGO_CRATE_NAME"), tracing::Level::TRACE);
+            (Some(layer.with_filter(targets)), Some(guard))
+        }
+        None => (None, None),
+    };
+
+    tracing_subscriber::registry()
+        .with(fmt::layer().with_filter(EnvFilter::new(filter)))
+        .with(chrome_layer)
+        .init();
 
     // 1. Resolve target directory (canonicalize to absolute path so the walker
     //    never receives "." as root, which would be excluded as a hidden dir)
@@ -59,18 +89,71 @@ async fn main() -> Result<()> {
         Commands::Query(args) => {
             rag::retriever::query_cmd(&cfg, &db_path, &target_dir, args).await?;
         }
+        Commands::Repl(args) => {
+            rag::repl::repl_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Export(args) => {
+            export::export_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::ImportScip(args) => {
+            symbols::import_scip_cmd(&cfg, &db_path, args).await?;
+        }
+        Commands::Def(args) => {
+            symbols::def_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Callers(args) => {
+            symbols::callers_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Coverage(args) => {
+            coverage::coverage_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Profile(args) => {
+            profile::profile_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Routes(args) => {
+            routes::routes_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::ConfigUsage(args) => {
+            config_usage::config_usage_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Graph(args) => {
+            graph::graph_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Path(args) => {
+            calls::path_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Outline(args) => {
+            outline::outline_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
+        Commands::Tune(args) => {
+            rag::tune::tune_cmd(&cfg, &db_path, &target_dir, args).await?;
+        }
         Commands::Db(args) => {
+            let overlay = overlay::current(&target_dir);
             match args.action {
                 DbAction::Stats => {
-                    match Store::try_open(&db_path, cfg.db.embedding_dim, &cfg.db.table_name)
+                    match Store::try_open(&db_path, cfg.db.embedding_dim, &cfg.db.table_name, &overlay)
                         .await?
                     {
                         None => println!("No index found. Run `index` first."),
                         Some(store) => {
-                            let chunks = store.count_rows().await?;
+                            // Both counted in this overlay: other checkouts share the rows
+                            let unique = store.count_unique().await?;
+                            let chunks = store.count_locations().await?;
+                            let rows = store.count_rows().await?;
                             let files = store.count_files().await?;
+                            let saved = chunks.saturating_sub(unique);
+                            let saved_pct = if chunks > 0 {
+                                saved as f64 * 100.0 / chunks as f64
+                            } else {
+                                0.0
+                            };
+                            println!("Overlay       : {}", store.overlay());
                             println!("Files indexed : {files}");
                             println!("Total chunks  : {chunks}");
+                            println!("Unique chunks : {unique}");
+                            println!("Dedup savings : {saved} duplicate chunk(s) not embedded ({saved_pct:.1}%)");
+                            println!("Stored rows   : {rows} (all overlays)");
                             println!("Embedding dim : {}", cfg.db.embedding_dim);
                         }
                     }
@@ -79,7 +162,7 @@ async fn main() -> Result<()> {
                     if !yes {
                         println!("Pass --yes to confirm clearing all indexed data.");
                     } else {
-                        match Store::try_open(&db_path, cfg.db.embedding_dim, &cfg.db.table_name)
+                        match Store::try_open(&db_path, cfg.db.embedding_dim, &cfg.db.table_name, &overlay)
                             .await?
                         {
                             None => println!("No index found. Nothing to clear."),
@@ -90,6 +173,34 @@ async fn main() -> Result<()> {
                         }
                     }
                 }
+                DbAction::Overlays => {
+                    match Store::try_open(&db_path, cfg.db.embedding_dim, &cfg.db.table_name, &overlay)
+                        .await?
+                    {
+                        None => println!("No index found. Run `index` first."),
+                        Some(store) => {
+                            for (name, files) in store.list_overlays().await? {
+                                let marker = if name == overlay { "*" } else { " " };
+                                println!("{marker} {name} ({files} file(s))");
+                            }
+                        }
+                    }
+                }
+                DbAction::DropOverlay { name } => {
+                    if name == overlay {
+                        println!("`{name}` is the current checkout's overlay; use `db clear` or `index --reindex` instead.");
+                    } else {
+                        match Store::try_open(&db_path, cfg.db.embedding_dim, &cfg.db.table_name, &overlay)
+                            .await?
+                        {
+                            None => println!("No index found. Nothing to drop."),
+                            Some(store) => {
+                                store.drop_overlay(&name).await?;
+                                println!("Overlay `{name}` dropped.");
+                            }
+                        }
+                    }
+                }
             }
         }
         Commands::Config => {
@@ -0,0 +1,114 @@
+use std::path::{Component, Path, PathBuf};
+
+use serde::Serialize;
+
+use crate::calls::extract::scope_separator;
+use crate::cli::{OutlineArgs, OutputFormat};
+use crate::config::AppConfig;
+use crate::db::definitions::DefinitionRecord;
+use crate::db::overlay;
+use crate::db::store::Store;
+use crate::error::{AppError, Result};
+
+#[derive(Serialize)]
+pub struct JsonDefinition<'a> {
+    pub name: &'a str,
+    /// Enclosing definitions, e.g. "Store" for a method of `Store`
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub scope: Option<&'a str>,
+    pub kind: &'a str,
+    pub start_line: u32,
+    pub end_line: u32,
+    pub summary: Option<&'a str>,
+}
+
+impl<'a> From<&'a DefinitionRecord> for JsonDefinition<'a> {
+    fn from(d: &'a DefinitionRecord) -> Self {
+        JsonDefinition {
+            name: &d.name,
+            scope: (!d.scope.is_empty()).then_some(d.scope.as_str()),
+            kind: &d.kind,
+            start_line: d.start_line,
+            end_line: d.end_line,
+            summary: d.summary.as_deref(),
+        }
+    }
+}
+
+/// Definitions of an indexed file, outer ones before those they contain, or
+/// `None` when the file is not in the index.
+pub async fn file_outline(store: &Store, file_path: &str) -> Result<Option<Vec<DefinitionRecord>>> {
+    if store.get_file_hash(file_path).await?.is_none() {
+        return Ok(None);
+    }
+    store.definitions().in_file(file_path).await.map(Some)
+}
+
+/// Print the symbols of a file — kinds, line ranges and summaries — as
+/// recorded in the index.
+pub async fn outline_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: OutlineArgs,
+) -> Result<()> {
+    let overlay = overlay::current(target_dir);
+    let store = Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay)
+        .await?
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("No index found. Run `index` first.")))?;
+
+    let file_path = index_path(target_dir, &args.file);
+    let definitions = file_outline(&store, &file_path).await?.ok_or_else(|| {
+        AppError::Other(anyhow::anyhow!("{file_path} is not in the index"))
+    })?;
+
+    match args.format {
+        OutputFormat::Text => {
+            if definitions.is_empty() {
+                println!("No definitions found in {file_path}.");
+            }
+            for d in &definitions {
+                let depth = if d.scope.is_empty() {
+                    0
+                } else {
+                    d.scope.split(scope_separator(&d.language)).count()
+                };
+                let summary = d
+                    .summary
+                    .as_deref()
+                    .and_then(|s| s.lines().map(str::trim).find(|l| !l.is_empty()))
+                    .map(|s| format!("  — {s}"))
+                    .unwrap_or_default();
+                println!(
+                    "{}{} {}  {}-{}{summary}",
+                    "  ".repeat(depth),
+                    d.kind,
+                    d.name,
+                    d.start_line + 1,
+                    d.end_line + 1
+                );
+            }
+        }
+        OutputFormat::Json => {
+            let json: Vec<JsonDefinition> = definitions.iter().map(JsonDefinition::from).collect();
+            println!(
+                "{}",
+                serde_json::to_string_pretty(&json).map_err(|e| AppError::Other(e.into()))?
+            );
+        }
+    }
+    Ok(())
+}
+
+/// Path of `file` as the index records it: relative to `target_dir`. An
+/// existing file is resolved from the working directory, anything else is
+/// taken as relative to `target_dir` already.
+fn index_path(target_dir: &Path, file: &Path) -> String {
+    let relative = std::fs::canonicalize(file)
+        .ok()
+        .and_then(|abs| abs.strip_prefix(target_dir).ok().map(Path::to_path_buf))
+        .unwrap_or_else(|| {
+            file.components().filter(|c| !matches!(c, Component::CurDir)).collect::<PathBuf>()
+        });
+    relative.to_string_lossy().into_owned()
+}
@@ -0,0 +1,208 @@
+pub mod samples;
+
+use std::collections::{HashMap, HashSet};
+use std::path::Path;
+
+use crate::calls::extract::scope_separator;
+use crate::cli::{ProfileAction, ProfileArgs};
+use crate::config::AppConfig;
+use crate::coverage::index_path;
+use crate::db::definitions::DefinitionRecord;
+use crate::db::overlay;
+use crate::db::profile::{ProfileRecord, ProfileTable};
+use crate::db::store::{self, LocationRecord, Store};
+use crate::error::{AppError, Result};
+use crate::profile::samples::{Frame, name_parts};
+
+/// Hottest chunks listed after an import.
+const SHOW_HOTTEST: usize = 5;
+
+pub async fn profile_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: ProfileArgs,
+) -> Result<()> {
+    match args.action {
+        ProfileAction::Import { path } => import(config, db_path, target_dir, &path).await,
+    }
+}
+
+/// Replace the per-chunk hotness with that of a runtime profile.
+///
+/// Each sample's time is charged to the innermost frame on its stack that
+/// resolves to an indexed chunk, so time spent in libraries counts against the
+/// project code that called them; every chunk on the stack gets the sample's
+/// time in its total.
+async fn import(config: &AppConfig, db_path: &Path, target_dir: &Path, path: &Path) -> Result<()> {
+    let bytes = std::fs::read(path).map_err(|e| {
+        AppError::Other(anyhow::anyhow!("cannot read {}: {e}", path.display()))
+    })?;
+    let (profile, format) = samples::parse(&bytes)
+        .map_err(|e| AppError::Other(anyhow::anyhow!("{}: {e}", path.display())))?;
+
+    let overlay = overlay::current(target_dir);
+    let store = Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay)
+        .await?
+        .ok_or_else(|| AppError::Other(anyhow::anyhow!("No index found. Run `index` first.")))?;
+    let indexed = store.list_files().await?;
+
+    let mut frame_files: HashMap<&str, Option<String>> = HashMap::new();
+    for frame in &profile.frames {
+        if let Some(file) = &frame.file {
+            frame_files
+                .entry(file.as_str())
+                .or_insert_with(|| index_path(file, target_dir, &indexed));
+        }
+    }
+    let names: HashSet<String> = profile
+        .frames
+        .iter()
+        .filter(|f| f.line.is_none() || f.file.is_none())
+        .filter_map(|f| name_parts(&f.name).pop())
+        .collect();
+    let names: Vec<String> = names.into_iter().collect();
+    let definitions = store.definitions().named(&names).await?;
+
+    let mut files: HashSet<String> = frame_files.values().flatten().cloned().collect();
+    files.extend(definitions.iter().map(|d| d.file_path.clone()));
+    let files: Vec<String> = files.into_iter().collect();
+    let chunks = Chunks::new(store.locations_in_files(&files).await?, definitions);
+
+    let frame_chunks: Vec<Option<usize>> = profile
+        .frames
+        .iter()
+        .map(|f| {
+            let file = f.file.as_deref().map(|file| frame_files[file].as_deref());
+            chunks.resolve(f, file)
+        })
+        .collect();
+
+    let mut self_weight: HashMap<usize, u64> = HashMap::new();
+    let mut total_weight: HashMap<usize, u64> = HashMap::new();
+    let mut resolved = 0u64;
+    for sample in &profile.samples {
+        let stack: Vec<usize> = sample.stack.iter().filter_map(|&f| frame_chunks[f]).collect();
+        let Some(&innermost) = stack.first() else {
+            continue;
+        };
+        *self_weight.entry(innermost).or_default() += sample.weight;
+        resolved += sample.weight;
+        let distinct: HashSet<usize> = stack.into_iter().collect();
+        for chunk in distinct {
+            *total_weight.entry(chunk).or_default() += sample.weight;
+        }
+    }
+
+    let all = profile.total_weight() as f64;
+    let percent = |w: u64| (w as f64 * 100.0 / all) as f32;
+    let hottest = self_weight.values().copied().max().unwrap_or(0);
+    let mut records: Vec<ProfileRecord> = total_weight
+        .iter()
+        .map(|(&chunk, &total)| {
+            let location = &chunks.locations[chunk];
+            let own = self_weight.get(&chunk).copied().unwrap_or(0);
+            ProfileRecord {
+                id: location.id.clone(),
+                content_hash: location.content_hash.clone(),
+                file_path: location.file_path.clone(),
+                self_percent: percent(own),
+                total_percent: percent(total),
+                score: if hottest > 0 { own as f32 / hottest as f32 } else { 0.0 },
+            }
+        })
+        .collect();
+    records.sort_by(|a, b| b.self_percent.total_cmp(&a.self_percent).then(a.id.cmp(&b.id)));
+
+    let conn = store::connect(db_path).await?;
+    ProfileTable::replace(&conn, &config.db.table_name, &records).await?;
+
+    println!(
+        "Imported {format} profile: {} chunk(s) on sampled stacks, {:.0}% of samples attributed to indexed code.",
+        records.len(),
+        percent(resolved)
+    );
+    for r in records.iter().take(SHOW_HOTTEST).filter(|r| r.self_percent > 0.0) {
+        println!("  {:>5.1}%  {}", r.self_percent, r.id);
+    }
+    Ok(())
+}
+
+/// Chunk locations of the files a profile touches, and the definitions its
+/// file-less frames may name.
+struct Chunks {
+    locations: Vec<LocationRecord>,
+    by_file: HashMap<String, Vec<usize>>,
+    by_name: HashMap<String, Vec<DefinitionRecord>>,
+}
+
+impl Chunks {
+    fn new(locations: Vec<LocationRecord>, definitions: Vec<DefinitionRecord>) -> Self {
+        let mut by_file: HashMap<String, Vec<usize>> = HashMap::new();
+        for (i, l) in locations.iter().enumerate() {
+            by_file.entry(l.file_path.clone()).or_default().push(i);
+        }
+        let mut by_name: HashMap<String, Vec<DefinitionRecord>> = HashMap::new();
+        for d in definitions {
+            by_name.entry(d.name.clone()).or_default().push(d);
+        }
+        Self { locations, by_file, by_name }
+    }
+
+    /// The chunk a frame ran in. `file` is `None` for frames without a
+    /// source file, and `Some(None)` for files outside the index — library
+    /// code, which is never matched by name.
+    fn resolve(&self, frame: &Frame, file: Option<Option<&str>>) -> Option<usize> {
+        match (file, frame.line) {
+            (Some(None), _) => None,
+            (Some(Some(file)), Some(line)) => self.innermost(file, line),
+            (Some(Some(file)), None) => self.named(&frame.name, Some(file)),
+            (None, _) => self.named(&frame.name, None),
+        }
+    }
+
+    /// The smallest chunk in `file` containing `line`.
+    fn innermost(&self, file: &str, line: u32) -> Option<usize> {
+        self.by_file
+            .get(file)?
+            .iter()
+            .copied()
+            .filter(|&i| (self.locations[i].start_line..=self.locations[i].end_line).contains(&line))
+            .min_by_key(|&i| self.locations[i].end_line - self.locations[i].start_line)
+    }
+
+    /// The chunk of the one definition a function name can mean. The name's
+    /// qualifier must agree with the definition's scope, or for top-level
+    /// definitions with the module (file or directory) it is in; unqualified
+    /// names only match when a single definition has them.
+    fn named(&self, name: &str, file: Option<&str>) -> Option<usize> {
+        let mut parts = name_parts(name);
+        let name = parts.pop()?;
+        let qualifier = parts.pop();
+        let mut candidates = self
+            .by_name
+            .get(&name)?
+            .iter()
+            .filter(|d| file.is_none_or(|f| d.file_path == f))
+            .filter(|d| qualifier.as_deref().is_none_or(|q| qualifies(d, q)));
+        match (candidates.next(), candidates.next()) {
+            (Some(d), None) => self.innermost(&d.file_path, d.start_line),
+            _ => None,
+        }
+    }
+}
+
+/// Whether a definition can be the one `qualifier::name` refers to.
+fn qualifies(d: &DefinitionRecord, qualifier: &str) -> bool {
+    if !d.scope.is_empty() {
+        return d.scope.rsplit(scope_separator(&d.language)).next() == Some(qualifier);
+    }
+    let path = Path::new(&d.file_path);
+    let stem = path.file_stem().and_then(|s| s.to_str());
+    // A crate root's functions are qualified by the crate's name
+    if d.language == "rust" && matches!(stem, Some("main" | "lib")) {
+        return true;
+    }
+    stem == Some(qualifier)
+        || path.parent().is_some_and(|dir| dir.iter().any(|c| c.to_str() == Some(qualifier)))
+}
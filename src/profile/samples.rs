@@ -0,0 +1,365 @@
+use std::collections::HashMap;
+use std::io::Read;
+
+use serde_json::Value;
+
+use crate::error::{AppError, Result};
+use crate::protobuf::Decoder;
+
+#[cfg(test)]
+#[path = "samples_tests.rs"]
+mod samples_tests;
+
+/// A function in a stack, with its source position when the profiler knows it.
+#[derive(Clone, PartialEq, Eq, Hash, Debug)]
+pub struct Frame {
+    pub name: String,
+    pub file: Option<String>,
+    /// 0-based
+    pub line: Option<u32>,
+}
+
+/// A stack and how much was spent in it (samples, or the profile's unit).
+pub struct Sample {
+    /// Indices into `Profile::frames`, innermost first
+    pub stack: Vec<usize>,
+    pub weight: u64,
+}
+
+#[derive(Default)]
+pub struct Profile {
+    pub frames: Vec<Frame>,
+    pub samples: Vec<Sample>,
+    interned: HashMap<Frame, usize>,
+}
+
+impl Profile {
+    fn frame(&mut self, frame: Frame) -> usize {
+        if let Some(&i) = self.interned.get(&frame) {
+            return i;
+        }
+        self.frames.push(frame.clone());
+        self.interned.insert(frame, self.frames.len() - 1);
+        self.frames.len() - 1
+    }
+
+    pub fn total_weight(&self) -> u64 {
+        self.samples.iter().map(|s| s.weight).sum()
+    }
+}
+
+/// Parse a pprof profile (gzipped or not), folded stacks (`perf script |
+/// stackcollapse-perf.pl`, py-spy, async-profiler) or a Chrome `.cpuprofile`,
+/// telling them apart by content. Returns the profile and its format's name.
+pub fn parse(bytes: &[u8]) -> Result<(Profile, &'static str)> {
+    let parsed = if bytes.starts_with(&[0x1f, 0x8b]) {
+        let mut raw = Vec::new();
+        flate2::read::GzDecoder::new(bytes)
+            .read_to_end(&mut raw)
+            .map_err(|e| AppError::Other(anyhow::anyhow!("invalid gzip data: {e}")))?;
+        (parse_pprof(&raw)?, "pprof")
+    } else if let Ok(text) = std::str::from_utf8(bytes) {
+        match text.trim_start().chars().next() {
+            Some('{') => (parse_cpuprofile(text)?, "Chrome CPU profile"),
+            _ => (parse_folded(text), "folded stacks"),
+        }
+    } else {
+        (parse_pprof(bytes)?, "pprof")
+    };
+    if parsed.0.total_weight() == 0 {
+        return Err(AppError::Other(anyhow::anyhow!("no samples found (read as {})", parsed.1)));
+    }
+    Ok(parsed)
+}
+
+/// Lines of `frame;frame;frame count`, outermost frame first. A frame may
+/// carry its position in parentheses, as py-spy writes them
+/// (`handle (app/views.py:42)`).
+fn parse_folded(text: &str) -> Profile {
+    let mut profile = Profile::default();
+    for line in text.lines() {
+        let Some((stack, count)) = line.trim_end().rsplit_once(' ') else {
+            continue;
+        };
+        let Ok(weight) = count.parse::<u64>() else {
+            continue;
+        };
+        let mut frames: Vec<usize> = stack
+            .split(';')
+            .filter(|f| !f.is_empty())
+            .map(|f| profile.frame(folded_frame(f)))
+            .collect();
+        frames.reverse();
+        profile.samples.push(Sample { stack: frames, weight });
+    }
+    profile
+}
+
+fn folded_frame(text: &str) -> Frame {
+    let text = text.trim();
+    let positioned = text.strip_suffix(')').and_then(|t| t.rsplit_once(" (")).and_then(
+        |(name, position)| {
+            let (file, line) = position.rsplit_once(':')?;
+            Some((name, file, line.parse::<u32>().ok()?))
+        },
+    );
+    if let Some((name, file, line)) = positioned {
+        return Frame {
+            name: name.to_string(),
+            file: Some(file.to_string()),
+            line: line.checked_sub(1),
+        };
+    }
+    // perf marks kernel, JIT and inlined frames with a suffix
+    let name = ["_[k]", "_[j]", "_[i]"]
+        .iter()
+        .find_map(|s| text.strip_suffix(s))
+        .unwrap_or(text);
+    Frame { name: name.to_string(), file: None, line: None }
+}
+
+/// V8's `.cpuprofile`: a call tree of `nodes` and the node of each sample.
+/// Samples in the idle, program and garbage-collector pseudo-nodes are left
+/// out, so shares are of the time spent running JavaScript.
+fn parse_cpuprofile(text: &str) -> Result<Profile> {
+    let json: Value = serde_json::from_str(text)
+        .map_err(|e| AppError::Other(anyhow::anyhow!("invalid CPU profile JSON: {e}")))?;
+    let nodes = json.get("nodes").and_then(Value::as_array).ok_or_else(|| {
+        AppError::Other(anyhow::anyhow!("unrecognised JSON profile: expected a Chrome .cpuprofile"))
+    })?;
+
+    let mut profile = Profile::default();
+    // Node id → (frame, parent node id)
+    let mut tree: HashMap<u64, (Option<usize>, Option<u64>)> = HashMap::new();
+    for node in nodes {
+        let Some(id) = node.get("id").and_then(Value::as_u64) else {
+            continue;
+        };
+        let call = node.get("callFrame");
+        let name = call.and_then(|c| c.get("functionName")).and_then(Value::as_str).unwrap_or("");
+        let url = call.and_then(|c| c.get("url")).and_then(Value::as_str).unwrap_or("");
+        let line = call.and_then(|c| c.get("lineNumber")).and_then(Value::as_i64);
+        let frame = (!name.starts_with('(')).then(|| {
+            profile.frame(Frame {
+                name: name.to_string(),
+                file: url_path(url),
+                line: line.and_then(|l| u32::try_from(l).ok()),
+            })
+        });
+        tree.entry(id).or_insert((None, None)).0 = frame;
+        for child in node.get("children").and_then(Value::as_array).into_iter().flatten() {
+            if let Some(child) = child.as_u64() {
+                tree.entry(child).or_insert((None, None)).1 = Some(id);
+            }
+        }
+    }
+
+    let mut counts: HashMap<u64, u64> = HashMap::new();
+    for sample in json.get("samples").and_then(Value::as_array).into_iter().flatten() {
+        if let Some(id) = sample.as_u64() {
+            *counts.entry(id).or_default() += 1;
+        }
+    }
+    for (leaf, weight) in counts {
+        let mut stack = Vec::new();
+        let mut node = Some(leaf);
+        while let Some((frame, parent)) = node.and_then(|n| tree.get(&n)) {
+            stack.extend(*frame);
+            node = *parent;
+        }
+        if !stack.is_empty() {
+            profile.samples.push(Sample { stack, weight });
+        }
+    }
+    Ok(profile)
+}
+
+/// Path of a script URL: `file:///app/src/a.js` → `/app/src/a.js`,
+/// `webpack://app/./src/a.js` → `./src/a.js`. Built-ins (`node:fs`) have none.
+fn url_path(url: &str) -> Option<String> {
+    if url.is_empty() {
+        return None;
+    }
+    let Some((scheme, rest)) = url.split_once("://") else {
+        return (!url.contains(':')).then(|| url.to_string());
+    };
+    if scheme == "file" {
+        return Some(rest.to_string());
+    }
+    rest.split_once('/').map(|(_, path)| path.to_string())
+}
+
+// pprof `Profile` message fields
+const PROFILE_SAMPLE_TYPE: u32 = 1;
+const PROFILE_SAMPLE: u32 = 2;
+const PROFILE_LOCATION: u32 = 4;
+const PROFILE_FUNCTION: u32 = 5;
+const PROFILE_STRING_TABLE: u32 = 6;
+
+/// A pprof `Profile` protobuf. Inlined functions of a location become frames
+/// of their own. Samples are weighed by the last sample type (CPU time in Go
+/// and pprof-rs profiles).
+fn parse_pprof(bytes: &[u8]) -> Result<Profile> {
+    let mut strings: Vec<String> = Vec::new();
+    let mut sample_types = 0usize;
+    let mut raw_samples: Vec<(Vec<u64>, Vec<u64>)> = Vec::new();
+    // Location id → (function id, 1-based line), innermost first
+    let mut locations: HashMap<u64, Vec<(u64, i64)>> = HashMap::new();
+    // Function id → (name, file) string indices
+    let mut functions: HashMap<u64, (u64, u64)> = HashMap::new();
+
+    let mut message = Decoder::new(bytes);
+    while let Some((field, value)) = message.next_field()? {
+        match field {
+            PROFILE_SAMPLE_TYPE => sample_types += 1,
+            PROFILE_SAMPLE => {
+                let (mut location_ids, mut values) = (Vec::new(), Vec::new());
+                let mut sample = Decoder::new(value.as_bytes());
+                while let Some((field, value)) = sample.next_field()? {
+                    match field {
+                        1 => location_ids.extend(value.varints()?),
+                        2 => values.extend(value.varints()?),
+                        _ => {}
+                    }
+                }
+                raw_samples.push((location_ids, values));
+            }
+            PROFILE_LOCATION => {
+                let (mut id, mut lines) = (0, Vec::new());
+                let mut location = Decoder::new(value.as_bytes());
+                while let Some((field, value)) = location.next_field()? {
+                    match field {
+                        1 => id = value.as_u64(),
+                        4 => {
+                            let (mut function, mut line) = (0, 0);
+                            let mut entry = Decoder::new(value.as_bytes());
+                            while let Some((field, value)) = entry.next_field()? {
+                                match field {
+                                    1 => function = value.as_u64(),
+                                    2 => line = value.as_u64() as i64,
+                                    _ => {}
+                                }
+                            }
+                            lines.push((function, line));
+                        }
+                        _ => {}
+                    }
+                }
+                locations.insert(id, lines);
+            }
+            PROFILE_FUNCTION => {
+                let (mut id, mut name, mut file) = (0, 0, 0);
+                let mut function = Decoder::new(value.as_bytes());
+                while let Some((field, value)) = function.next_field()? {
+                    match field {
+                        1 => id = value.as_u64(),
+                        2 => name = value.as_u64(),
+                        4 => file = value.as_u64(),
+                        _ => {}
+                    }
+                }
+                functions.insert(id, (name, file));
+            }
+            PROFILE_STRING_TABLE => strings.push(value.as_str()?.to_string()),
+            _ => {}
+        }
+    }
+
+    let string = |i: u64| strings.get(i as usize).map_or("", String::as_str);
+    let mut profile = Profile::default();
+    let mut frames_of: HashMap<u64, Vec<usize>> = HashMap::new();
+    for (location_ids, values) in raw_samples {
+        let weight = match sample_types {
+            0 => values.last().copied(),
+            n => values.get(n - 1).copied(),
+        };
+        // Values are int64; negative ones (diffs) carry no heat
+        let Some(weight) = weight.filter(|&w| (w as i64) > 0) else {
+            continue;
+        };
+        let mut stack = Vec::new();
+        for id in location_ids {
+            let frames = frames_of.entry(id).or_insert_with(|| {
+                locations
+                    .get(&id)
+                    .into_iter()
+                    .flatten()
+                    .filter_map(|&(function, line)| {
+                        let &(name, file) = functions.get(&function)?;
+                        let file = string(file);
+                        Some(profile.frame(Frame {
+                            name: string(name).to_string(),
+                            file: (!file.is_empty()).then(|| file.to_string()),
+                            line: u32::try_from(line - 1).ok(),
+                        }))
+                    })
+                    .collect()
+            });
+            stack.extend(frames.iter());
+        }
+        profile.samples.push(Sample { stack, weight });
+    }
+    Ok(profile)
+}
+
+/// Components of a function name, outermost first, without argument lists,
+/// generic arguments, Rust symbol hashes or closures:
+/// `app::db::Store::search::h0123456789abcdef` and `<app::db::Store as Search>::search`
+/// give `[app, db, Store, search]`, Go's `pkg.(*Store).Search` `[pkg, Store, Search]`.
+pub fn name_parts(name: &str) -> Vec<String> {
+    let mut name = name.trim();
+    // Trailing argument list: `Store::search(int, char*)`
+    if name.ends_with(')') {
+        let mut depth = 0;
+        for (i, c) in name.char_indices().rev() {
+            match c {
+                ')' => depth += 1,
+                '(' => depth -= 1,
+                _ => {}
+            }
+            if depth == 0 {
+                if i > 0 && !name[..i].ends_with('.') {
+                    name = name[..i].trim_end();
+                }
+                break;
+            }
+        }
+    }
+
+    let mut plain = String::with_capacity(name.len());
+    let mut depth = 0usize;
+    let mut qualified_self = name.starts_with('<');
+    for c in name.chars() {
+        match c {
+            '<' => depth += 1,
+            '>' => {
+                depth = depth.saturating_sub(1);
+                qualified_self &= depth > 0;
+            }
+            // `<T as Trait>`: keep T
+            _ if qualified_self && depth == 1 => {
+                plain.push(c);
+                if plain.ends_with(" as ") {
+                    plain.truncate(plain.len() - 4);
+                    qualified_self = false;
+                }
+            }
+            '(' | ')' | '*' | '&' => {}
+            _ if depth == 0 => plain.push(c),
+            _ => {}
+        }
+    }
+
+    plain
+        .split([':', '.', '/', '#', '$', ' '])
+        .filter(|p| !p.is_empty() && !p.starts_with('{') && !is_symbol_hash(p))
+        .map(str::to_string)
+        .collect()
+}
+
+/// Rust's legacy mangling appends `h` and 16 hex digits to every path.
+fn is_symbol_hash(part: &str) -> bool {
+    part.len() == 17
+        && part.starts_with('h')
+        && part[1..].chars().all(|c| c.is_ascii_hexdigit())
+}
@@ -0,0 +1,160 @@
+/// Profile parsing: every format yields stacks of frames, innermost first,
+/// with the weight spent in them; function names reduce to their components.
+
+#[cfg(test)]
+mod samples_tests {
+    use crate::profile::samples::{Frame, Profile, name_parts, parse};
+    use crate::protobuf::Encoder;
+
+    fn frame(name: &str, file: Option<&str>, line: Option<u32>) -> Frame {
+        Frame { name: name.to_string(), file: file.map(str::to_string), line }
+    }
+
+    /// Each sample's stack as frames, with its weight, heaviest first.
+    fn stacks(profile: &Profile) -> Vec<(Vec<Frame>, u64)> {
+        let mut stacks: Vec<(Vec<Frame>, u64)> = profile
+            .samples
+            .iter()
+            .map(|s| (s.stack.iter().map(|&f| profile.frames[f].clone()).collect(), s.weight))
+            .collect();
+        stacks.sort_by(|a, b| b.1.cmp(&a.1));
+        stacks
+    }
+
+    #[test]
+    fn folded_stacks_are_innermost_first() {
+        let text = concat!(
+            "main;app::run;app::db::Store::search 30\n",
+            "main;handle (app/views.py:42) 5\n",
+            "main;memcpy_[k] 2\n",
+        );
+        let (profile, format) = parse(text.as_bytes()).unwrap();
+        assert_eq!(format, "folded stacks");
+        let stacks = stacks(&profile);
+        assert_eq!(
+            stacks[0],
+            (
+                vec![
+                    frame("app::db::Store::search", None, None),
+                    frame("app::run", None, None),
+                    frame("main", None, None),
+                ],
+                30
+            )
+        );
+        assert_eq!(stacks[1].0[0], frame("handle", Some("app/views.py"), Some(41)));
+        assert_eq!(stacks[2].0[0], frame("memcpy", None, None));
+    }
+
+    #[test]
+    fn cpuprofile_samples_walk_up_the_call_tree() {
+        let text = r#"{
+            "nodes": [
+                {"id": 1, "callFrame": {"functionName": "(root)", "url": "", "lineNumber": -1}, "children": [2, 3]},
+                {"id": 2, "callFrame": {"functionName": "handler", "url": "file:///app/src/server.js", "lineNumber": 9}, "children": [4]},
+                {"id": 3, "callFrame": {"functionName": "(idle)", "url": "", "lineNumber": -1}},
+                {"id": 4, "callFrame": {"functionName": "", "url": "webpack://app/./src/util.js", "lineNumber": 0}}
+            ],
+            "samples": [4, 4, 2, 3],
+            "timeDeltas": [0, 100, 100, 100]
+        }"#;
+        let (profile, format) = parse(text.as_bytes()).unwrap();
+        assert_eq!(format, "Chrome CPU profile");
+        let handler = frame("handler", Some("/app/src/server.js"), Some(9));
+        assert_eq!(
+            stacks(&profile),
+            vec![
+                (vec![frame("", Some("./src/util.js"), Some(0)), handler.clone()], 2),
+                (vec![handler], 1),
+            ]
+        );
+    }
+
+    #[test]
+    fn pprof_locations_expand_inlined_frames() {
+        let mut profile = Encoder::new();
+        for (kind, unit) in [(1, 2), (3, 4)] {
+            profile.message(1, |t| {
+                t.uint64(1, kind);
+                t.uint64(2, unit);
+            });
+        }
+        profile.message(2, |s| {
+            s.uint64(1, 1);
+            s.uint64(1, 2);
+            s.uint64(2, 1);
+            s.uint64(2, 10_000_000);
+        });
+        // Location 1: `search` inlined into `run`
+        profile.message(4, |l| {
+            l.uint64(1, 1);
+            l.message(4, |line| {
+                line.uint64(1, 1);
+                line.uint64(2, 42);
+            });
+            l.message(4, |line| {
+                line.uint64(1, 2);
+                line.uint64(2, 7);
+            });
+        });
+        profile.message(4, |l| {
+            l.uint64(1, 2);
+            l.message(4, |line| {
+                line.uint64(1, 3);
+                line.uint64(2, 10);
+            });
+        });
+        for (id, name, file) in [(1, 5, 7), (2, 6, 7), (3, 8, 9)] {
+            profile.message(5, |f| {
+                f.uint64(1, id);
+                f.uint64(2, name);
+                f.uint64(4, file);
+            });
+        }
+        profile.message(6, |_| {});
+        for s in [
+            "samples",
+            "count",
+            "cpu",
+            "nanoseconds",
+            "app::db::Store::search",
+            "app::run",
+            "/work/app/src/db/store.rs",
+            "main",
+            "/work/app/src/main.rs",
+        ] {
+            profile.string(6, s);
+        }
+
+        let (profile, format) = parse(&profile.finish()).unwrap();
+        assert_eq!(format, "pprof");
+        assert_eq!(
+            stacks(&profile),
+            vec![(
+                vec![
+                    frame("app::db::Store::search", Some("/work/app/src/db/store.rs"), Some(41)),
+                    frame("app::run", Some("/work/app/src/db/store.rs"), Some(6)),
+                    frame("main", Some("/work/app/src/main.rs"), Some(9)),
+                ],
+                10_000_000
+            )]
+        );
+    }
+
+    #[test]
+    fn empty_profiles_are_errors() {
+        assert!(parse(b"not a profile\n").is_err());
+        assert!(parse(br#"{"nodes": [], "samples": []}"#).is_err());
+    }
+
+    #[test]
+    fn function_names_reduce_to_their_components() {
+        assert_eq!(name_parts("app::db::Store::search::h0123456789abcdef"), ["app", "db", "Store", "search"]);
+        assert_eq!(name_parts("<app::db::Store as app::Search>::search"), ["app", "db", "Store", "search"]);
+        assert_eq!(name_parts("app::run::{{closure}}"), ["app", "run"]);
+        assert_eq!(name_parts("github.com/acme/pay.(*Retrier).Do"), ["github", "com", "acme", "pay", "Retrier", "Do"]);
+        assert_eq!(name_parts("com.acme.Retrier.retry(int, java.lang.String)"), ["com", "acme", "Retrier", "retry"]);
+        assert_eq!(name_parts("Vec<T>::push"), ["Vec", "push"]);
+        assert_eq!(name_parts("Retrier#retry"), ["Retrier", "retry"]);
+    }
+}
@@ -0,0 +1,197 @@
+//! Minimal protobuf wire-format support for the interchange formats maharajah
+//! reads and writes (SCIP). Message layouts live with each format.
+
+use crate::error::{AppError, Result};
+
+#[cfg(test)]
+#[path = "protobuf_tests.rs"]
+mod protobuf_tests;
+
+const WIRE_VARINT: u32 = 0;
+const WIRE_FIXED64: u32 = 1;
+const WIRE_LEN: u32 = 2;
+const WIRE_FIXED32: u32 = 5;
+
+/// Builds a protobuf message field by field. Scalar fields equal to their
+/// proto3 default (0, empty string) are omitted, as protoc-generated encoders do.
+#[derive(Default)]
+pub struct Encoder {
+    buf: Vec<u8>,
+}
+
+impl Encoder {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn finish(self) -> Vec<u8> {
+        self.buf
+    }
+
+    pub fn uint64(&mut self, field: u32, value: u64) {
+        if value != 0 {
+            self.key(field, WIRE_VARINT);
+            self.varint(value);
+        }
+    }
+
+    /// `int32` and enum fields. Negative values take ten bytes, per the spec.
+    pub fn int32(&mut self, field: u32, value: i32) {
+        self.uint64(field, i64::from(value) as u64);
+    }
+
+    pub fn string(&mut self, field: u32, value: &str) {
+        self.bytes(field, value.as_bytes());
+    }
+
+    pub fn bytes(&mut self, field: u32, value: &[u8]) {
+        if !value.is_empty() {
+            self.key(field, WIRE_LEN);
+            self.varint(value.len() as u64);
+            self.buf.extend_from_slice(value);
+        }
+    }
+
+    /// A `repeated int32` field in packed encoding.
+    pub fn packed_int32(&mut self, field: u32, values: &[i32]) {
+        let mut packed = Encoder::new();
+        for &v in values {
+            packed.varint(i64::from(v) as u64);
+        }
+        self.bytes(field, &packed.buf);
+    }
+
+    /// An embedded message, built by `build`. Written even when empty, since
+    /// presence is meaningful for message fields and repeated entries.
+    pub fn message(&mut self, field: u32, build: impl FnOnce(&mut Encoder)) {
+        let mut inner = Encoder::new();
+        build(&mut inner);
+        self.key(field, WIRE_LEN);
+        self.varint(inner.buf.len() as u64);
+        self.buf.extend_from_slice(&inner.buf);
+    }
+
+    fn key(&mut self, field: u32, wire_type: u32) {
+        self.varint(u64::from(field << 3 | wire_type));
+    }
+
+    fn varint(&mut self, mut value: u64) {
+        while value >= 0x80 {
+            self.buf.push((value as u8 & 0x7f) | 0x80);
+            value >>= 7;
+        }
+        self.buf.push(value as u8);
+    }
+}
+
+/// A decoded field value. Length-delimited values borrow from the input.
+#[derive(Clone, Copy, Debug)]
+pub enum Value<'a> {
+    Varint(u64),
+    Fixed64(u64),
+    Bytes(&'a [u8]),
+    Fixed32(u32),
+}
+
+impl<'a> Value<'a> {
+    pub fn as_u64(self) -> u64 {
+        match self {
+            Value::Varint(v) | Value::Fixed64(v) => v,
+            Value::Fixed32(v) => u64::from(v),
+            Value::Bytes(_) => 0,
+        }
+    }
+
+    /// `int32` and enum fields, which are sign-extended to 64 bits on the wire.
+    pub fn as_i32(self) -> i32 {
+        self.as_u64() as i64 as i32
+    }
+
+    pub fn as_bytes(self) -> &'a [u8] {
+        match self {
+            Value::Bytes(b) => b,
+            _ => &[],
+        }
+    }
+
+    pub fn as_str(self) -> Result<&'a str> {
+        std::str::from_utf8(self.as_bytes())
+            .map_err(|e| AppError::Other(anyhow::anyhow!("invalid UTF-8 in protobuf string: {e}")))
+    }
+
+    /// A `repeated` varint field occurrence: packed (all values in one
+    /// length-delimited field) or a single unpacked value.
+    pub fn varints(self) -> Result<Vec<u64>> {
+        match self {
+            Value::Bytes(b) => {
+                let mut decoder = Decoder::new(b);
+                let mut values = Vec::new();
+                while !decoder.is_empty() {
+                    values.push(decoder.varint()?);
+                }
+                Ok(values)
+            }
+            other => Ok(vec![other.as_u64()]),
+        }
+    }
+}
+
+/// Reads the fields of one protobuf message in wire order.
+pub struct Decoder<'a> {
+    buf: &'a [u8],
+}
+
+impl<'a> Decoder<'a> {
+    pub fn new(buf: &'a [u8]) -> Self {
+        Self { buf }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.buf.is_empty()
+    }
+
+    /// The next `(field number, value)`, or `None` at the end of the message.
+    pub fn next_field(&mut self) -> Result<Option<(u32, Value<'a>)>> {
+        if self.buf.is_empty() {
+            return Ok(None);
+        }
+        let key = self.varint()?;
+        let field = (key >> 3) as u32;
+        let value = match (key & 7) as u32 {
+            WIRE_VARINT => Value::Varint(self.varint()?),
+            WIRE_FIXED64 => Value::Fixed64(u64::from_le_bytes(self.take(8)?.try_into().unwrap())),
+            WIRE_LEN => {
+                let len = self.varint()? as usize;
+                Value::Bytes(self.take(len)?)
+            }
+            WIRE_FIXED32 => Value::Fixed32(u32::from_le_bytes(self.take(4)?.try_into().unwrap())),
+            other => {
+                return Err(AppError::Other(anyhow::anyhow!(
+                    "unsupported protobuf wire type {other} for field {field}"
+                )));
+            }
+        };
+        Ok(Some((field, value)))
+    }
+
+    fn take(&mut self, len: usize) -> Result<&'a [u8]> {
+        if len > self.buf.len() {
+            return Err(AppError::Other(anyhow::anyhow!("truncated protobuf message")));
+        }
+        let (head, rest) = self.buf.split_at(len);
+        self.buf = rest;
+        Ok(head)
+    }
+
+    fn varint(&mut self) -> Result<u64> {
+        let mut value = 0u64;
+        for shift in (0..64).step_by(7) {
+            let byte = *self.take(1)?.first().unwrap();
+            value |= u64::from(byte & 0x7f) << shift;
+            if byte & 0x80 == 0 {
+                return Ok(value);
+            }
+        }
+        Err(AppError::Other(anyhow::anyhow!("malformed protobuf varint")))
+    }
+}
@@ -0,0 +1,126 @@
+/// Protobuf tests: messages built with the `Encoder` decode field by field
+/// to the same values, and malformed input is an error rather than a panic.
+
+#[cfg(test)]
+mod protobuf_tests {
+    use crate::protobuf::{Decoder, Encoder, Value};
+
+    /// Every `(field, value)` of a message.
+    fn fields(bytes: &[u8]) -> Vec<(u32, Value<'_>)> {
+        let mut decoder = Decoder::new(bytes);
+        let mut fields = Vec::new();
+        while let Some(field) = decoder.next_field().unwrap() {
+            fields.push(field);
+        }
+        fields
+    }
+
+    #[test]
+    fn scalars_round_trip() {
+        let mut e = Encoder::new();
+        e.uint64(1, 300);
+        e.int32(2, -5);
+        e.string(3, "naïve");
+        e.uint64(4, u64::MAX);
+        let bytes = e.finish();
+
+        let fields = fields(&bytes);
+        assert_eq!(fields.len(), 4);
+        assert_eq!((fields[0].0, fields[0].1.as_u64()), (1, 300));
+        assert_eq!((fields[1].0, fields[1].1.as_i32()), (2, -5));
+        assert_eq!((fields[2].0, fields[2].1.as_str().unwrap()), (3, "naïve"));
+        assert_eq!((fields[3].0, fields[3].1.as_u64()), (4, u64::MAX));
+    }
+
+    #[test]
+    fn varints_use_seven_bits_per_byte() {
+        let mut e = Encoder::new();
+        e.uint64(1, 300);
+        assert_eq!(e.finish(), vec![0x08, 0xac, 0x02]);
+
+        // Negative int32 values are sign-extended to ten bytes
+        let mut e = Encoder::new();
+        e.int32(1, -1);
+        assert_eq!(e.finish().len(), 11);
+    }
+
+    #[test]
+    fn default_scalars_are_omitted_but_empty_messages_are_not() {
+        let mut e = Encoder::new();
+        e.uint64(1, 0);
+        e.int32(2, 0);
+        e.string(3, "");
+        e.packed_int32(4, &[]);
+        e.message(5, |_| {});
+        assert_eq!(e.finish(), vec![0x2a, 0x00]);
+    }
+
+    #[test]
+    fn packed_and_unpacked_repeated_fields_decode_alike() {
+        let mut e = Encoder::new();
+        e.packed_int32(1, &[3, 0, 150, -2]);
+        e.int32(1, 7);
+        let bytes = e.finish();
+
+        let fields = fields(&bytes);
+        let values: Vec<i32> = fields
+            .iter()
+            .flat_map(|(_, v)| v.varints().unwrap())
+            .map(|v| v as i64 as i32)
+            .collect();
+        assert_eq!(values, vec![3, 0, 150, -2, 7]);
+    }
+
+    #[test]
+    fn nested_messages_round_trip() {
+        let mut e = Encoder::new();
+        e.message(1, |outer| {
+            outer.string(1, "src/lib.rs");
+            outer.message(2, |inner| inner.int32(3, 1));
+            outer.message(2, |inner| inner.int32(3, 2));
+        });
+        let bytes = e.finish();
+
+        let outer = fields(&bytes);
+        assert_eq!(outer.len(), 1);
+        let inner = fields(outer[0].1.as_bytes());
+        assert_eq!(inner[0].1.as_str().unwrap(), "src/lib.rs");
+        let roles: Vec<i32> = inner[1..]
+            .iter()
+            .map(|(field, v)| {
+                assert_eq!(*field, 2);
+                fields(v.as_bytes())[0].1.as_i32()
+            })
+            .collect();
+        assert_eq!(roles, vec![1, 2]);
+    }
+
+    #[test]
+    fn fixed_width_fields_are_read() {
+        // field 1 fixed64 = 1, field 2 fixed32 = 2
+        let bytes = [0x09, 1, 0, 0, 0, 0, 0, 0, 0, 0x15, 2, 0, 0, 0];
+        let fields = fields(&bytes);
+        assert!(matches!(fields[0], (1, Value::Fixed64(1))));
+        assert!(matches!(fields[1], (2, Value::Fixed32(2))));
+    }
+
+    #[test]
+    fn truncated_input_is_an_error() {
+        let mut e = Encoder::new();
+        e.string(1, "truncated");
+        let bytes = e.finish();
+        assert!(Decoder::new(&bytes[..bytes.len() - 1]).next_field().is_err());
+        // A key without its value
+        assert!(Decoder::new(&[0x08]).next_field().is_err());
+    }
+
+    #[test]
+    fn malformed_varints_and_wire_types_are_errors() {
+        assert!(Decoder::new(&[0x08, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01])
+            .next_field()
+            .is_err());
+        // Wire type 3 (start group) is not supported
+        assert!(Decoder::new(&[0x0b]).next_field().is_err());
+        assert!(Value::Bytes(&[0xff]).as_str().is_err());
+    }
+}
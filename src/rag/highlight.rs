@@ -0,0 +1,200 @@
+use std::collections::HashSet;
+use std::sync::Arc;
+
+use crate::config::HighlightConfig;
+use crate::db::store::SearchResult;
+use crate::embed::nomic::{EmbedMode, NomicEmbedder};
+use crate::error::{AppError, Result};
+
+#[cfg(test)]
+#[path = "highlight_tests.rs"]
+mod highlight_tests;
+
+/// Prompt words that say nothing about where to look in a chunk.
+const STOPWORDS: &[&str] = &[
+    "a", "an", "and", "are", "as", "at", "be", "by", "code", "do", "does", "for", "from", "how",
+    "in", "is", "it", "of", "on", "or", "that", "the", "this", "to", "what", "when", "where",
+    "which", "who", "why", "with",
+];
+
+/// A run of consecutive lines of a chunk, as offsets into its content.
+struct Window {
+    start: usize,
+    /// Exclusive
+    end: usize,
+    /// Share of the prompt words found in the window
+    lexical: f32,
+}
+
+/// Lowercased words of a prompt for lexical matching: identifiers as a whole
+/// and split at `_` and case changes (`parseFile` → `parsefile`, `parse`,
+/// `file`), without stopwords.
+pub fn query_terms(prompt: &str) -> HashSet<String> {
+    let mut terms = words(prompt);
+    terms.retain(|t| !STOPWORDS.contains(&t.as_str()));
+    terms
+}
+
+fn words(text: &str) -> HashSet<String> {
+    let mut words = HashSet::new();
+    for ident in text.split(|c: char| !(c.is_alphanumeric() || c == '_')) {
+        if ident.len() > 1 {
+            words.insert(ident.to_lowercase());
+        }
+        let mut part = String::new();
+        let mut prev_lower = false;
+        for c in ident.chars() {
+            if c == '_' || (c.is_uppercase() && prev_lower) {
+                if part.len() > 1 {
+                    words.insert(std::mem::take(&mut part));
+                }
+                part.clear();
+            }
+            if c != '_' {
+                part.extend(c.to_lowercase());
+            }
+            prev_lower = c.is_lowercase() || c.is_ascii_digit();
+        }
+        if part.len() > 1 {
+            words.insert(part);
+        }
+    }
+    words
+}
+
+/// Set `highlight_lines` on each result to its most relevant window of
+/// `config.window_lines` lines. Windows are prefiltered by the prompt words
+/// they contain; the `config.candidates` best are embedded with `embed` — in
+/// one call for all results — and ranked by cosine similarity to `query`
+/// plus `config.lexical_weight` times their lexical overlap.
+pub async fn highlight<F, Fut>(
+    results: &mut [SearchResult],
+    terms: &HashSet<String>,
+    query: &[f32],
+    config: &HighlightConfig,
+    embed: F,
+) -> Result<()>
+where
+    F: FnOnce(Vec<String>) -> Fut,
+    Fut: Future<Output = Result<Vec<Vec<f32>>>>,
+{
+    if !config.enabled {
+        return Ok(());
+    }
+    let window_lines = config.window_lines.max(1);
+
+    let candidates: Vec<Vec<Window>> = results
+        .iter()
+        .map(|r| candidate_windows(&r.content, terms, window_lines, config.candidates.max(1)))
+        .collect();
+    // A single candidate (short chunks) needs no embedding
+    let texts: Vec<String> = results
+        .iter()
+        .zip(&candidates)
+        .filter(|(_, windows)| windows.len() > 1)
+        .flat_map(|(r, windows)| {
+            let lines: Vec<&str> = r.content.lines().collect();
+            windows.iter().map(move |w| lines[w.start..w.end].join("\n"))
+        })
+        .collect();
+    let expected = texts.len();
+    let mut vectors = if texts.is_empty() { Vec::new() } else { embed(texts).await? }.into_iter();
+    if vectors.len() != expected {
+        return Err(AppError::Embed(format!(
+            "expected {expected} window embeddings, got {}",
+            vectors.len()
+        )));
+    }
+
+    for (r, windows) in results.iter_mut().zip(candidates) {
+        let best = if windows.len() > 1 {
+            windows
+                .iter()
+                .map(|w| {
+                    let vector = vectors.next().unwrap_or_default();
+                    let cosine: f32 = vector.iter().zip(query).map(|(a, b)| a * b).sum();
+                    (w, cosine + config.lexical_weight * w.lexical)
+                })
+                .max_by(|a, b| a.1.total_cmp(&b.1))
+                .map(|(w, _)| w)
+        } else {
+            windows.first()
+        };
+        if let Some(w) = best {
+            r.highlight_lines = (w.start..w.end).map(|i| r.start_line + i as u32).collect();
+        }
+    }
+    Ok(())
+}
+
+/// Up to `max` non-overlapping windows: those containing prompt words, most
+/// words first, then windows spread evenly over the rest of the chunk.
+fn candidate_windows(
+    content: &str,
+    terms: &HashSet<String>,
+    window_lines: usize,
+    max: usize,
+) -> Vec<Window> {
+    let line_words: Vec<HashSet<String>> = content.lines().map(words).collect();
+    let n = line_words.len();
+    if n == 0 {
+        return vec![];
+    }
+    if n <= window_lines {
+        return vec![Window { start: 0, end: n, lexical: 0.0 }];
+    }
+
+    let lexical = |start: usize| {
+        if terms.is_empty() {
+            return 0.0;
+        }
+        let found = terms
+            .iter()
+            .filter(|t| line_words[start..start + window_lines].iter().any(|l| l.contains(*t)))
+            .count();
+        found as f32 / terms.len() as f32
+    };
+    let mut scored: Vec<Window> = (0..=n - window_lines)
+        .map(|start| Window { start, end: start + window_lines, lexical: lexical(start) })
+        .filter(|w| w.lexical > 0.0)
+        .collect();
+    scored.sort_by(|a, b| b.lexical.total_cmp(&a.lexical).then(a.start.cmp(&b.start)));
+
+    let mut chosen: Vec<Window> = Vec::new();
+    let overlaps = |chosen: &[Window], start: usize| {
+        chosen.iter().any(|w| start < w.end && w.start < start + window_lines)
+    };
+    for w in scored {
+        if chosen.len() == max {
+            break;
+        }
+        if !overlaps(&chosen, w.start) {
+            chosen.push(w);
+        }
+    }
+    // Prompt words can be missing from the most relevant lines entirely
+    let stride = (n - window_lines + 1).div_ceil(max).max(window_lines);
+    for start in (0..=n - window_lines).step_by(stride) {
+        if chosen.len() == max {
+            break;
+        }
+        if !overlaps(&chosen, start) {
+            chosen.push(Window { start, end: start + window_lines, lexical: 0.0 });
+        }
+    }
+    chosen
+}
+
+/// Embed window texts as code, batched like the server's embedder actor
+/// does, on a blocking thread.
+pub async fn embed_windows(
+    embedder: Arc<NomicEmbedder>,
+    texts: Vec<String>,
+) -> Result<Vec<Vec<f32>>> {
+    let embeddings =
+        tokio::task::spawn_blocking(move || embedder.embed_texts(&texts, EmbedMode::Code))
+            .await
+            .map_err(|e| AppError::Other(e.into()))?
+            .map_err(|e| AppError::Embed(e.to_string()))?;
+    Ok(embeddings.into_iter().map(|e| e.vector).collect())
+}
@@ -0,0 +1,166 @@
+/// Line highlight tests: prompt words, candidate windows and the choice of
+/// the most relevant window, with embeddings stubbed out.
+
+#[cfg(test)]
+mod highlight_tests {
+    use crate::config::HighlightConfig;
+    use crate::db::store::SearchResult;
+    use crate::error::Result;
+    use crate::rag::highlight::{candidate_windows, highlight, query_terms, words};
+    use std::collections::HashSet;
+
+    fn set(words: &[&str]) -> HashSet<String> {
+        words.iter().map(|w| w.to_string()).collect()
+    }
+
+    fn config() -> HighlightConfig {
+        HighlightConfig { enabled: true, window_lines: 3, candidates: 2, lexical_weight: 0.5 }
+    }
+
+    fn result(start_line: u32, content: &str) -> SearchResult {
+        let end_line = start_line + content.lines().count() as u32 - 1;
+        SearchResult {
+            language: "rust".to_string(),
+            ..SearchResult::for_test("src/lib.rs", start_line, end_line, content)
+        }
+    }
+
+    /// Ten lines; "retry" is on the seventh (offset 6), "backoff" on the second.
+    const CHUNK: &str = "fn send() {\n    let backoff = 2;\n    let a = 1;\n    let b = 2;\n    \
+                         let c = 3;\n    let d = 4;\n    retry(a);\n    let e = 5;\n    \
+                         let f = 6;\n}";
+
+    /// Windows as (start, end, lexical) for comparison.
+    fn spans(content: &str, terms: &HashSet<String>, max: usize) -> Vec<(usize, usize, f32)> {
+        candidate_windows(content, terms, 3, max)
+            .into_iter()
+            .map(|w| (w.start, w.end, w.lexical))
+            .collect()
+    }
+
+    #[test]
+    fn words_split_identifiers_at_underscores_and_case_changes() {
+        assert_eq!(words("parseFile"), set(&["parsefile", "parse", "file"]));
+        assert_eq!(words("MAX_LEN"), set(&["max_len", "max", "len"]));
+        assert_eq!(words("v2Parser"), set(&["v2parser", "v2", "parser"]));
+        // A run of capitals is one word
+        assert_eq!(words("HTTPServer"), set(&["httpserver"]));
+    }
+
+    #[test]
+    fn words_drop_single_characters_and_split_at_punctuation() {
+        assert_eq!(words("a.b(x, y_z)"), set(&["y_z"]));
+        assert_eq!(words("store.get(key)"), set(&["store", "get", "key"]));
+    }
+
+    #[test]
+    fn query_terms_drop_stopwords() {
+        assert_eq!(
+            query_terms("how does the Parser handle errors"),
+            set(&["parser", "handle", "errors"])
+        );
+    }
+
+    #[test]
+    fn short_chunks_are_one_window() {
+        assert_eq!(spans("a\nb", &set(&["retry"]), 4), vec![(0, 2, 0.0)]);
+        assert!(spans("", &set(&["retry"]), 4).is_empty());
+    }
+
+    #[test]
+    fn windows_with_prompt_words_come_first_without_overlapping() {
+        // Windows at 4, 5 and 6 all contain "retry"; the first wins and the
+        // others overlap it, so the second candidate is spread from the top
+        assert_eq!(spans(CHUNK, &set(&["retry"]), 2), vec![(4, 7, 1.0), (0, 3, 0.0)]);
+        // A window with more of the words ranks higher, whatever its position
+        assert_eq!(spans(CHUNK, &set(&["retry", "let"]), 2), vec![(4, 7, 1.0), (0, 3, 0.5)]);
+        // Ties go to the earlier window
+        assert_eq!(
+            spans(CHUNK, &set(&["retry", "backoff"]), 2),
+            vec![(0, 3, 0.5), (4, 7, 0.5)]
+        );
+    }
+
+    #[test]
+    fn without_prompt_words_windows_are_spread_over_the_chunk() {
+        assert_eq!(
+            spans(CHUNK, &HashSet::new(), 3),
+            vec![(0, 3, 0.0), (3, 6, 0.0), (6, 9, 0.0)]
+        );
+        assert_eq!(spans(CHUNK, &set(&["unrelated"]), 1), vec![(0, 3, 0.0)]);
+    }
+
+    /// Stub embedder: windows mentioning `word` point along the query, all
+    /// others away from it.
+    async fn embed_toward(word: &str, texts: Vec<String>) -> Result<Vec<Vec<f32>>> {
+        Ok(texts
+            .iter()
+            .map(|t| if t.contains(word) { vec![1.0, 0.0] } else { vec![0.0, 1.0] })
+            .collect())
+    }
+
+    #[tokio::test]
+    async fn the_window_most_similar_to_the_query_is_highlighted() {
+        let mut results = vec![result(10, CHUNK)];
+        highlight(&mut results, &set(&["retry"]), &[1.0, 0.0], &config(), |texts| {
+            embed_toward("retry", texts)
+        })
+        .await
+        .unwrap();
+        assert_eq!(results[0].highlight_lines, vec![14, 15, 16]);
+    }
+
+    #[tokio::test]
+    async fn similarity_can_outweigh_prompt_words() {
+        // The "retry" window holds every prompt word (0.5 × 1.0), but the
+        // spread window at the top is the one embedded like the query (1.0)
+        let mut results = vec![result(10, CHUNK)];
+        highlight(&mut results, &set(&["retry"]), &[1.0, 0.0], &config(), |texts| {
+            embed_toward("backoff", texts)
+        })
+        .await
+        .unwrap();
+        assert_eq!(results[0].highlight_lines, vec![10, 11, 12]);
+    }
+
+    #[tokio::test]
+    async fn every_result_is_embedded_in_one_call_and_short_ones_not_at_all() {
+        let mut results = vec![result(1, CHUNK), result(40, "fn tiny() {}"), result(60, CHUNK)];
+        let mut embedded = 0;
+        highlight(&mut results, &set(&["retry"]), &[1.0, 0.0], &config(), |texts| {
+            embedded = texts.len();
+            embed_toward("retry", texts)
+        })
+        .await
+        .unwrap();
+        assert_eq!(embedded, 4);
+        assert_eq!(results[0].highlight_lines, vec![5, 6, 7]);
+        assert_eq!(results[1].highlight_lines, vec![40]);
+        assert_eq!(results[2].highlight_lines, vec![64, 65, 66]);
+    }
+
+    #[tokio::test]
+    async fn disabled_highlighting_embeds_nothing() {
+        let mut results = vec![result(1, CHUNK)];
+        let config = HighlightConfig { enabled: false, ..config() };
+        let mut embedded = false;
+        highlight(&mut results, &set(&["retry"]), &[1.0, 0.0], &config, |texts| {
+            embedded = true;
+            embed_toward("retry", texts)
+        })
+        .await
+        .unwrap();
+        assert!(!embedded);
+        assert!(results[0].highlight_lines.is_empty());
+    }
+
+    #[tokio::test]
+    async fn a_short_embedding_reply_is_an_error() {
+        let mut results = vec![result(1, CHUNK)];
+        let outcome = highlight(&mut results, &set(&["retry"]), &[1.0, 0.0], &config(), |texts| {
+            embed_toward("retry", texts[1..].to_vec())
+        })
+        .await;
+        assert!(outcome.is_err());
+    }
+}
@@ -1 +1,7 @@
+pub mod highlight;
+pub mod ranking;
+pub mod recent;
+pub mod refine;
+pub mod repl;
 pub mod retriever;
+pub mod tune;
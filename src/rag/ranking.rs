@@ -0,0 +1,83 @@
+use std::collections::BTreeMap;
+
+use glob::Pattern;
+
+use crate::db::store::SearchResult;
+use crate::error::{AppError, Result};
+
+#[cfg(test)]
+#[path = "ranking_tests.rs"]
+mod ranking_tests;
+
+/// Glob-based score multipliers applied to results after retrieval.
+#[derive(Default)]
+pub struct PathBoosts {
+    rules: Vec<(Pattern, f32)>,
+}
+
+impl PathBoosts {
+    /// Build the rule set from the `[ranking.paths]` config, with per-request
+    /// `overrides` replacing config entries for the same glob. When
+    /// `use_config` is false only the overrides apply.
+    pub fn new(
+        config: &BTreeMap<String, f32>,
+        overrides: &BTreeMap<String, f32>,
+        use_config: bool,
+    ) -> Result<Self> {
+        let mut merged: BTreeMap<&str, f32> = BTreeMap::new();
+        if use_config {
+            merged.extend(config.iter().map(|(g, m)| (g.as_str(), *m)));
+        }
+        merged.extend(overrides.iter().map(|(g, m)| (g.as_str(), *m)));
+
+        let rules = merged
+            .into_iter()
+            // A multiplier of 1.0 is how a request switches a config rule off
+            .filter(|(_, m)| *m != 1.0)
+            .map(|(g, m)| {
+                if m.is_nan() || m <= 0.0 {
+                    return Err(AppError::Other(anyhow::anyhow!(
+                        "boost for '{g}' must be a positive number, got {m}"
+                    )));
+                }
+                let pattern = Pattern::new(g)
+                    .map_err(|e| AppError::Other(anyhow::anyhow!("invalid boost glob '{g}': {e}")))?;
+                Ok((pattern, m))
+            })
+            .collect::<Result<Vec<_>>>()?;
+
+        Ok(Self { rules })
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.rules.is_empty()
+    }
+
+    /// Product of the multipliers of every rule matching `path`.
+    pub fn multiplier(&self, path: &str) -> f32 {
+        self.rules
+            .iter()
+            .filter(|(p, _)| p.matches(path))
+            .map(|(_, m)| *m)
+            .product()
+    }
+}
+
+/// Scale each result's score by `multiplier` and re-sort best first. A
+/// multiplier above 1.0 always moves a result up: for distance scores
+/// (`higher_is_better == false`) the distance is divided instead.
+pub fn rerank<F>(results: &mut [SearchResult], higher_is_better: bool, multiplier: F)
+where
+    F: Fn(&SearchResult) -> f32,
+{
+    for r in results.iter_mut() {
+        let m = multiplier(r);
+        if m != 1.0 {
+            r.score = if higher_is_better { r.score * m } else { r.score / m };
+        }
+    }
+    results.sort_by(|a, b| {
+        let ord = a.score.partial_cmp(&b.score).unwrap_or(std::cmp::Ordering::Equal);
+        if higher_is_better { ord.reverse() } else { ord }
+    });
+}
@@ -0,0 +1,82 @@
+/// Path boost tests: how config rules and per-request overrides combine, and
+/// how multipliers move results for both score directions.
+
+#[cfg(test)]
+mod ranking_tests {
+    use std::collections::BTreeMap;
+
+    use crate::db::store::SearchResult;
+    use crate::rag::ranking::{PathBoosts, rerank};
+
+    fn result(file_path: &str, score: f32) -> SearchResult {
+        SearchResult { score, ..SearchResult::for_test(file_path, 1, 1, "") }
+    }
+
+    fn rules(entries: &[(&str, f32)]) -> BTreeMap<String, f32> {
+        entries.iter().map(|(g, m)| (g.to_string(), *m)).collect()
+    }
+
+    fn paths(results: &[SearchResult]) -> Vec<&str> {
+        results.iter().map(|r| r.file_path.as_str()).collect()
+    }
+
+    #[test]
+    fn an_override_replaces_the_config_rule_for_the_same_glob() {
+        let config = rules(&[("**/generated/**", 0.5)]);
+        let boosts = PathBoosts::new(&config, &rules(&[("**/generated/**", 2.0)]), true).unwrap();
+        assert_eq!(boosts.multiplier("src/generated/api.rs"), 2.0);
+    }
+
+    #[test]
+    fn an_override_of_one_switches_a_config_rule_off() {
+        let config = rules(&[("**/generated/**", 0.5)]);
+        let boosts = PathBoosts::new(&config, &rules(&[("**/generated/**", 1.0)]), true).unwrap();
+        assert!(boosts.is_empty());
+        assert_eq!(boosts.multiplier("src/generated/api.rs"), 1.0);
+    }
+
+    #[test]
+    fn without_config_only_the_overrides_apply() {
+        let config = rules(&[("**/generated/**", 0.5)]);
+        let boosts = PathBoosts::new(&config, &rules(&[("src/**", 1.5)]), false).unwrap();
+        assert_eq!(boosts.multiplier("src/generated/api.rs"), 1.5);
+        assert_eq!(boosts.multiplier("lib/generated/api.rs"), 1.0);
+
+        let boosts = PathBoosts::new(&config, &BTreeMap::new(), false).unwrap();
+        assert!(boosts.is_empty());
+    }
+
+    #[test]
+    fn the_multipliers_of_every_matching_glob_are_multiplied() {
+        let config = rules(&[("src/**", 2.0), ("**/generated/**", 0.5), ("**/*.rs", 3.0)]);
+        let boosts = PathBoosts::new(&config, &BTreeMap::new(), true).unwrap();
+        assert_eq!(boosts.multiplier("src/generated/api.rs"), 3.0);
+        assert_eq!(boosts.multiplier("src/main.rs"), 6.0);
+        assert_eq!(boosts.multiplier("docs/index.md"), 1.0);
+    }
+
+    #[test]
+    fn invalid_boosts_are_rejected() {
+        let none = BTreeMap::new();
+        assert!(PathBoosts::new(&rules(&[("src/**", 0.0)]), &none, true).is_err());
+        assert!(PathBoosts::new(&rules(&[("src/**", -2.0)]), &none, true).is_err());
+        assert!(PathBoosts::new(&none, &rules(&[("src/**", f32::NAN)]), true).is_err());
+        assert!(PathBoosts::new(&none, &rules(&[("src/[", 2.0)]), true).is_err());
+    }
+
+    #[test]
+    fn a_boost_moves_a_distance_result_up() {
+        let mut results = vec![result("a.rs", 1.0), result("b.rs", 1.5)];
+        rerank(&mut results, false, |r| if r.file_path == "b.rs" { 2.0 } else { 1.0 });
+        assert_eq!(paths(&results), vec!["b.rs", "a.rs"]);
+        assert_eq!(results[0].score, 0.75);
+    }
+
+    #[test]
+    fn a_penalty_moves_a_similarity_result_down() {
+        let mut results = vec![result("a.rs", 0.04), result("b.rs", 0.03)];
+        rerank(&mut results, true, |r| if r.file_path == "a.rs" { 0.5 } else { 1.0 });
+        assert_eq!(paths(&results), vec!["b.rs", "a.rs"]);
+        assert_eq!(results[1].score, 0.02);
+    }
+}
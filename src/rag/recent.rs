@@ -0,0 +1,176 @@
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+use std::time::{SystemTime, UNIX_EPOCH};
+
+use crate::config::RecentConfig;
+use crate::error::{AppError, Result};
+
+#[cfg(test)]
+#[path = "recent_tests.rs"]
+mod recent_tests;
+
+/// Files the user is currently working on, with how long ago each was touched.
+///
+/// In a git checkout the working set is the files with uncommitted changes
+/// (aged by mtime) plus files in the user's own recent commits (aged by commit
+/// time). Plain mtimes are not trusted there, since a checkout or rebase
+/// touches every file it rewrites. Outside git, file mtimes are used directly.
+pub struct WorkingSet {
+    /// Age in hours, keyed by path relative to the target directory
+    ages: HashMap<String, f64>,
+    /// Set outside git: ages are read from file mtimes on demand
+    mtime_root: Option<PathBuf>,
+    max_boost: f32,
+    half_life_hours: f32,
+}
+
+impl WorkingSet {
+    /// Detect the working set on a blocking thread: `git` runs and files
+    /// are stat'ed.
+    pub async fn detect(target_dir: &Path, config: &RecentConfig) -> Result<Self> {
+        let target_dir = target_dir.to_path_buf();
+        let config = config.clone();
+        tokio::task::spawn_blocking(move || Self::scan(&target_dir, &config))
+            .await
+            .map_err(|e| AppError::Other(e.into()))
+    }
+
+    fn scan(target_dir: &Path, config: &RecentConfig) -> Self {
+        let mut set = Self {
+            ages: HashMap::new(),
+            mtime_root: None,
+            max_boost: config.max_boost,
+            half_life_hours: config.half_life_hours,
+        };
+
+        // Path of target_dir inside the repository, e.g. "crates/core/"
+        let Some(prefix) = git(target_dir, &["rev-parse", "--show-prefix"]) else {
+            set.mtime_root = Some(target_dir.to_path_buf());
+            return set;
+        };
+        let prefix = prefix.trim().to_string();
+        let now = now_secs();
+
+        if let Some(status) = git(
+            target_dir,
+            &["status", "--porcelain=v1", "-z", "--untracked-files=all", "--", "."],
+        ) {
+            for repo_path in parse_status(&status) {
+                let Some(rel) = repo_path.strip_prefix(&prefix) else { continue };
+                let age = mtime_age_hours(&target_dir.join(rel), now).unwrap_or(0.0);
+                set.touch(rel, age);
+            }
+        }
+
+        let author = git(target_dir, &["config", "user.email"])
+            .or_else(|| git(target_dir, &["config", "user.name"]))
+            .map(|a| a.trim().to_string())
+            .filter(|a| !a.is_empty());
+        if let Some(author) = author {
+            let since = format!("--since={} days ago", config.commit_days);
+            let author = format!("--author={author}");
+            // The author is matched literally, not as a regex
+            if let Some(log) = git(
+                target_dir,
+                &[
+                    "log",
+                    "--fixed-strings",
+                    &author,
+                    &since,
+                    "--relative",
+                    "--name-only",
+                    "--format=%x00%ct",
+                ],
+            ) {
+                for (committed_at, rel) in parse_log(&log) {
+                    let age = (now - committed_at).max(0) as f64 / 3600.0;
+                    set.touch(&rel, age);
+                }
+            }
+        }
+
+        set
+    }
+
+    /// Record that `rel_path` was touched `age_hours` ago, keeping the most recent.
+    fn touch(&mut self, rel_path: &str, age_hours: f64) {
+        self.ages
+            .entry(rel_path.to_string())
+            .and_modify(|a| *a = a.min(age_hours))
+            .or_insert(age_hours);
+    }
+
+    /// Score multiplier for a result in `rel_path`: `max_boost` for a file
+    /// touched just now, halving its excess over 1.0 every `half_life_hours`.
+    pub fn multiplier(&self, rel_path: &str) -> f32 {
+        let age = match &self.mtime_root {
+            Some(root) => mtime_age_hours(&root.join(rel_path), now_secs()),
+            None => self.ages.get(rel_path).copied(),
+        };
+        let Some(age) = age else { return 1.0 };
+        let half_life = f64::from(self.half_life_hours.max(f32::EPSILON));
+        let decay = 0.5f64.powf(age / half_life) as f32;
+        1.0 + (self.max_boost - 1.0) * decay
+    }
+}
+
+/// Run `git -C dir <args>`, returning stdout on success.
+fn git(dir: &Path, args: &[&str]) -> Option<String> {
+    let output = Command::new("git").arg("-C").arg(dir).args(args).output().ok()?;
+    if !output.status.success() {
+        return None;
+    }
+    String::from_utf8(output.stdout).ok()
+}
+
+/// Paths (relative to the repository root) from `git status --porcelain=v1 -z`.
+fn parse_status(status: &str) -> Vec<String> {
+    let mut paths = Vec::new();
+    let mut entries = status.split('\0');
+    while let Some(entry) = entries.next() {
+        if entry.len() < 4 {
+            continue;
+        }
+        let (code, path) = entry.split_at(3);
+        // Deleted files can't be search results
+        if code.contains('D') {
+            continue;
+        }
+        paths.push(path.to_string());
+        // Renames and copies are followed by the original path
+        if code.starts_with('R') || code.starts_with('C') {
+            entries.next();
+        }
+    }
+    paths
+}
+
+/// (commit timestamp, path) pairs from `git log --name-only --format=%x00%ct`.
+fn parse_log(log: &str) -> Vec<(i64, String)> {
+    let mut touched = Vec::new();
+    for commit in log.split('\0').filter(|c| !c.trim().is_empty()) {
+        let mut lines = commit.lines();
+        let Some(Ok(ts)) = lines.next().map(|l| l.trim().parse::<i64>()) else { continue };
+        touched.extend(
+            lines
+                .map(str::trim)
+                .filter(|l| !l.is_empty())
+                .map(|l| (ts, l.to_string())),
+        );
+    }
+    touched
+}
+
+fn mtime_age_hours(path: &Path, now: i64) -> Option<f64> {
+    let modified = std::fs::metadata(path).ok()?.modified().ok()?;
+    let secs = modified.duration_since(UNIX_EPOCH).ok()?.as_secs() as i64;
+    Some((now - secs).max(0) as f64 / 3600.0)
+}
+
+fn now_secs() -> i64 {
+    SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.as_secs() as i64)
+        .unwrap_or(0)
+}
@@ -0,0 +1,72 @@
+/// Working-set tests: paths read from `git status` and `git log` output, and
+/// the boost decaying with a file's age.
+
+#[cfg(test)]
+mod recent_tests {
+    use std::collections::HashMap;
+
+    use crate::rag::recent::{WorkingSet, parse_log, parse_status};
+
+    #[test]
+    fn changed_and_untracked_files_are_listed() {
+        let status = " M src/main.rs\0A  src/new.rs\0MM src/both.rs\0?? notes.md\0";
+        assert_eq!(
+            parse_status(status),
+            vec!["src/main.rs", "src/new.rs", "src/both.rs", "notes.md"]
+        );
+    }
+
+    #[test]
+    fn deleted_files_are_skipped() {
+        let status = " D src/gone.rs\0D  src/staged_gone.rs\0 M src/kept.rs\0";
+        assert_eq!(parse_status(status), vec!["src/kept.rs"]);
+    }
+
+    #[test]
+    fn renames_and_copies_list_only_the_new_path() {
+        let status = "R  src/new_name.rs\0src/old_name.rs\0C  src/copy.rs\0src/orig.rs\0 M a.rs\0";
+        assert_eq!(parse_status(status), vec!["src/new_name.rs", "src/copy.rs", "a.rs"]);
+    }
+
+    #[test]
+    fn paths_keep_their_spaces() {
+        assert_eq!(parse_status("?? docs/release notes.md\0"), vec!["docs/release notes.md"]);
+    }
+
+    #[test]
+    fn empty_status_lists_nothing() {
+        assert!(parse_status("").is_empty());
+    }
+
+    #[test]
+    fn log_paths_carry_their_commit_time() {
+        let log = "\u{0}1700003600\n\nsrc/a.rs\nsrc/b.rs\n\u{0}1700000000\n\nsrc/a.rs\n";
+        assert_eq!(
+            parse_log(log),
+            vec![
+                (1_700_003_600, "src/a.rs".to_string()),
+                (1_700_003_600, "src/b.rs".to_string()),
+                (1_700_000_000, "src/a.rs".to_string()),
+            ]
+        );
+    }
+
+    #[test]
+    fn commits_without_files_or_a_timestamp_are_skipped() {
+        let log = "\u{0}1700003600\n\u{0}not-a-time\n\nsrc/a.rs\n\u{0}1700000000\n\nsrc/b.rs\n";
+        assert_eq!(parse_log(log), vec![(1_700_000_000, "src/b.rs".to_string())]);
+    }
+
+    #[test]
+    fn the_boost_halves_every_half_life() {
+        let set = WorkingSet {
+            ages: HashMap::from([("fresh.rs".to_string(), 0.0), ("day_old.rs".to_string(), 24.0)]),
+            mtime_root: None,
+            max_boost: 1.5,
+            half_life_hours: 24.0,
+        };
+        assert_eq!(set.multiplier("fresh.rs"), 1.5);
+        assert_eq!(set.multiplier("day_old.rs"), 1.25);
+        assert_eq!(set.multiplier("untouched.rs"), 1.0);
+    }
+}
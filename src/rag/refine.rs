@@ -0,0 +1,144 @@
+use std::collections::{HashMap, VecDeque};
+use std::sync::Arc;
+use std::time::{SystemTime, UNIX_EPOCH};
+
+use crate::db::store::{SearchResult, Store};
+use crate::error::{AppError, Result};
+use crate::rag::retriever::{self, SearchMode, SearchPlan};
+
+#[cfg(test)]
+#[path = "refine_tests.rs"]
+mod refine_tests;
+
+/// How a follow-up prompt narrows a previous result set.
+#[derive(Clone, Copy, Debug, Default, serde::Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum RefineMode {
+    /// Re-rank only the previous results against the follow-up prompt
+    #[default]
+    Rerank,
+    /// Search the whole index near the previous results' centroid, pulled
+    /// towards the follow-up prompt
+    Centroid,
+}
+
+/// Narrow `previous` with a follow-up query `vector`.
+///
+/// Both modes score by vector distance, so refined results are reported like
+/// `find` results (lower is better) whatever mode produced `previous`. The
+/// plan's filters and boosts apply as for a fresh search.
+pub async fn refine(
+    store: &Store,
+    previous: &[SearchResult],
+    vector: &[f32],
+    mode: RefineMode,
+    limit: usize,
+    plan: &SearchPlan,
+) -> Result<Vec<SearchResult>> {
+    let hashes: Vec<String> = previous.iter().map(|r| r.content_hash.clone()).collect();
+    let vectors = store.vectors_for(&hashes).await?;
+    if vectors.is_empty() {
+        return Err(AppError::Other(anyhow::anyhow!(
+            "none of the previous results are still in the index"
+        )));
+    }
+
+    match mode {
+        RefineMode::Rerank => {
+            let mut results: Vec<SearchResult> = previous
+                .iter()
+                .filter_map(|r| {
+                    let v = vectors.get(&r.content_hash)?;
+                    let mut r = r.clone();
+                    r.score = squared_distance(vector, v);
+                    Some(r)
+                })
+                .collect();
+            results.sort_by(|a, b| a.score.partial_cmp(&b.score).unwrap_or(std::cmp::Ordering::Equal));
+            plan.apply(&mut results, SearchMode::Find);
+            results.truncate(limit);
+            Ok(results)
+        }
+        RefineMode::Centroid => {
+            let target = blend(vector, &centroid(vectors.values()));
+            retriever::search(store, &target, SearchMode::Find, limit, plan).await
+        }
+    }
+}
+
+/// Squared L2 distance, matching the metric of the vector index.
+fn squared_distance(a: &[f32], b: &[f32]) -> f32 {
+    a.iter().zip(b).map(|(x, y)| (x - y) * (x - y)).sum()
+}
+
+/// Normalized mean of a set of vectors.
+fn centroid<'a>(vectors: impl Iterator<Item = &'a Vec<f32>>) -> Vec<f32> {
+    let mut sum: Vec<f32> = Vec::new();
+    for v in vectors {
+        if sum.is_empty() {
+            sum = vec![0.0; v.len()];
+        }
+        for (s, x) in sum.iter_mut().zip(v) {
+            *s += x;
+        }
+    }
+    normalize(sum)
+}
+
+/// Normalized sum of the query and the centroid, weighting both equally so the
+/// search stays in the neighbourhood of the previous results.
+fn blend(query: &[f32], centroid: &[f32]) -> Vec<f32> {
+    normalize(query.iter().zip(centroid).map(|(q, c)| q + c).collect())
+}
+
+fn normalize(mut v: Vec<f32>) -> Vec<f32> {
+    let norm = v.iter().map(|x| x * x).sum::<f32>().sqrt();
+    if norm > 0.0 {
+        v.iter_mut().for_each(|x| *x /= norm);
+    }
+    v
+}
+
+/// Recent result sets, addressable by id so that a later request can refine
+/// them. Holds at most `capacity` sets, evicting the oldest.
+pub struct ResultSessions {
+    capacity: usize,
+    /// Distinguishes ids across server restarts
+    epoch: u64,
+    next: u64,
+    order: VecDeque<String>,
+    sets: HashMap<String, Arc<Vec<SearchResult>>>,
+}
+
+impl ResultSessions {
+    pub fn new(capacity: usize) -> Self {
+        Self {
+            capacity: capacity.max(1),
+            epoch: SystemTime::now()
+                .duration_since(UNIX_EPOCH)
+                .map(|d| d.as_secs())
+                .unwrap_or(0),
+            next: 0,
+            order: VecDeque::new(),
+            sets: HashMap::new(),
+        }
+    }
+
+    /// Remember `results`, returning the id to refine them by.
+    pub fn insert(&mut self, results: Arc<Vec<SearchResult>>) -> String {
+        self.next += 1;
+        let id = format!("{:x}-{}", self.epoch, self.next);
+        while self.order.len() >= self.capacity {
+            if let Some(old) = self.order.pop_front() {
+                self.sets.remove(&old);
+            }
+        }
+        self.order.push_back(id.clone());
+        self.sets.insert(id.clone(), results);
+        id
+    }
+
+    pub fn get(&self, id: &str) -> Option<Arc<Vec<SearchResult>>> {
+        self.sets.get(id).cloned()
+    }
+}
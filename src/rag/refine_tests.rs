@@ -0,0 +1,73 @@
+/// Refinement tests: the centroid target a follow-up searches around, and
+/// the bounded store of result sets that `/refine` addresses by id.
+
+#[cfg(test)]
+mod refine_tests {
+    use std::sync::Arc;
+
+    use crate::db::store::SearchResult;
+    use crate::rag::refine::{ResultSessions, blend, centroid, normalize, squared_distance};
+
+    fn close(a: &[f32], b: &[f32]) -> bool {
+        a.len() == b.len() && a.iter().zip(b).all(|(x, y)| (x - y).abs() < 1e-6)
+    }
+
+    fn set(file_path: &str) -> Arc<Vec<SearchResult>> {
+        Arc::new(vec![SearchResult::for_test(file_path, 1, 1, "")])
+    }
+
+    #[test]
+    fn the_centroid_is_the_normalized_mean() {
+        let vectors = [vec![2.0, 0.0], vec![0.0, 2.0]];
+        let half = std::f32::consts::FRAC_1_SQRT_2;
+        assert!(close(&centroid(vectors.iter()), &[half, half]));
+    }
+
+    #[test]
+    fn the_centroid_of_nothing_is_empty() {
+        assert!(centroid(std::iter::empty()).is_empty());
+    }
+
+    #[test]
+    fn the_target_lies_halfway_between_query_and_centroid() {
+        let target = blend(&[1.0, 0.0], &[0.0, 1.0]);
+        let half = std::f32::consts::FRAC_1_SQRT_2;
+        assert!(close(&target, &[half, half]));
+        assert!((squared_distance(&target, &target)).abs() < 1e-12);
+    }
+
+    #[test]
+    fn a_zero_vector_stays_zero() {
+        assert_eq!(normalize(vec![0.0, 0.0]), vec![0.0, 0.0]);
+    }
+
+    #[test]
+    fn squared_distance_is_not_rooted() {
+        assert_eq!(squared_distance(&[0.0, 0.0], &[3.0, 4.0]), 25.0);
+    }
+
+    #[test]
+    fn the_oldest_set_is_evicted_at_capacity() {
+        let mut sessions = ResultSessions::new(2);
+        let first = sessions.insert(set("a.rs"));
+        let second = sessions.insert(set("b.rs"));
+        // Reading a set does not keep it alive
+        assert!(sessions.get(&first).is_some());
+        let third = sessions.insert(set("c.rs"));
+
+        assert!(sessions.get(&first).is_none());
+        assert_eq!(sessions.get(&second).unwrap()[0].file_path, "b.rs");
+        assert_eq!(sessions.get(&third).unwrap()[0].file_path, "c.rs");
+    }
+
+    #[test]
+    fn ids_are_unique_and_a_zero_capacity_keeps_one_set() {
+        let mut sessions = ResultSessions::new(0);
+        let first = sessions.insert(set("a.rs"));
+        let second = sessions.insert(set("a.rs"));
+        assert_ne!(first, second);
+        assert!(sessions.get(&first).is_none());
+        assert!(sessions.get(&second).is_some());
+        assert!(sessions.get("unknown").is_none());
+    }
+}
@@ -0,0 +1,189 @@
+use std::io::Write;
+use std::path::Path;
+use std::sync::Arc;
+
+use tokio::io::{AsyncBufReadExt, BufReader};
+
+use crate::cli::{OutputFormat, ReplArgs};
+use crate::config::AppConfig;
+use crate::db::overlay;
+use crate::db::store::{SearchResult, Store};
+use crate::embed::nomic::NomicEmbedder;
+use crate::error::{AppError, Result};
+use crate::indexer;
+use crate::rag::highlight;
+use crate::rag::refine::{self, RefineMode};
+use crate::rag::retriever::{self, SearchMode, SearchOptions};
+
+const HELP: &str = "\
+Commands:
+  <prompt>           search (same as find)
+  find <prompt>      search content vectors
+  query <prompt>     search content and summary vectors
+  refine <prompt>    re-rank the current results against a follow-up prompt
+  near <prompt>      search near the current results, steered by a follow-up prompt
+  back               return to the previous results
+  help               show this help
+  quit               leave the session";
+
+/// A search, or a refinement of the current results.
+#[derive(Clone, Copy)]
+enum Step<'a> {
+    Search(SearchMode, &'a str),
+    Refine(RefineMode, &'a str),
+}
+
+/// State shared by every step of a session.
+struct Session<'a> {
+    config: &'a AppConfig,
+    target_dir: &'a Path,
+    store: Store,
+    embedder: Arc<NomicEmbedder>,
+    options: SearchOptions,
+    limit: usize,
+}
+
+pub async fn repl_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: ReplArgs,
+) -> Result<()> {
+    // Refresh once up front; the session then searches a fixed snapshot
+    let (refreshed, _) = indexer::refresh(config, db_path, target_dir).await?;
+    if refreshed > 0 {
+        println!("[auto-refresh: {refreshed} file(s) updated]");
+    }
+
+    let embedder = tokio::task::spawn_blocking(NomicEmbedder::load)
+        .await
+        .map_err(|e| AppError::Other(e.into()))?
+        .map_err(|e| AppError::Embed(e.to_string()))?;
+
+    let store = Store::open_or_create(
+        db_path,
+        config.db.embedding_dim,
+        &config.db.table_name,
+        &overlay::current(target_dir),
+        false,
+    )
+    .await?;
+
+    let session = Session {
+        config,
+        target_dir,
+        store,
+        embedder: Arc::new(embedder),
+        options: SearchOptions {
+            paths: args.paths,
+            languages: args.languages,
+            boost_recent: args.boost_recent,
+            ..Default::default()
+        },
+        limit: args.limit,
+    };
+
+    println!("{HELP}\n");
+    // Each entry is a result set with the mode that scored it
+    let mut history: Vec<(SearchMode, Vec<SearchResult>)> = Vec::new();
+    let mut lines = BufReader::new(tokio::io::stdin()).lines();
+
+    loop {
+        print!("mh> ");
+        std::io::stdout().flush().map_err(|e| AppError::Other(e.into()))?;
+        let Some(line) = lines.next_line().await.map_err(|e| AppError::Other(e.into()))? else {
+            break;
+        };
+        let line = line.trim();
+        if line.is_empty() {
+            continue;
+        }
+
+        let (command, rest) = line
+            .split_once(char::is_whitespace)
+            .map_or((line, ""), |(c, r)| (c, r.trim()));
+        let step = match command {
+            "quit" | "exit" => break,
+            "help" => {
+                println!("{HELP}");
+                continue;
+            }
+            "back" => {
+                history.pop();
+                match history.last() {
+                    Some((mode, results)) => show(results.clone(), *mode)?,
+                    None => println!("No earlier results."),
+                }
+                continue;
+            }
+            "find" => Step::Search(SearchMode::Find, rest),
+            "query" => Step::Search(SearchMode::Query, rest),
+            "refine" => Step::Refine(RefineMode::Rerank, rest),
+            "near" => Step::Refine(RefineMode::Centroid, rest),
+            _ => Step::Search(SearchMode::Find, line),
+        };
+
+        let current = history.last().map(|(_, results)| results.as_slice());
+        match session.run(step, current).await {
+            Ok((mode, results)) => {
+                show(results.clone(), mode)?;
+                history.push((mode, results));
+            }
+            // A failed step leaves the session usable
+            Err(e) => eprintln!("error: {e}"),
+        }
+    }
+
+    Ok(())
+}
+
+impl Session<'_> {
+    async fn run(
+        &self,
+        step: Step<'_>,
+        current: Option<&[SearchResult]>,
+    ) -> Result<(SearchMode, Vec<SearchResult>)> {
+        let (mode, prompt) = match step {
+            Step::Search(mode, prompt) => (mode, prompt),
+            // Follow-up prompts use the find template: refined results are distances
+            Step::Refine(_, prompt) => (SearchMode::Find, prompt),
+        };
+        if prompt.is_empty() {
+            return Err(AppError::Other(anyhow::anyhow!("missing prompt")));
+        }
+
+        let plan =
+            retriever::plan_search(self.config, self.target_dir, mode, prompt, &self.options)
+                .await?;
+        let embedder = Arc::clone(&self.embedder);
+        let rendered = plan.prompt.clone();
+        let vector = tokio::task::spawn_blocking(move || embedder.embed_prompt(&rendered))
+            .await
+            .map_err(|e| AppError::Other(e.into()))?
+            .map_err(|e| AppError::Embed(e.to_string()))?;
+
+        let mut results = match step {
+            Step::Search(..) => retriever::search(&self.store, &vector, mode, self.limit, &plan).await?,
+            Step::Refine(refine_mode, _) => {
+                let current = current
+                    .filter(|r| !r.is_empty())
+                    .ok_or_else(|| AppError::Other(anyhow::anyhow!("no results to refine")))?;
+                refine::refine(&self.store, current, &vector, refine_mode, self.limit, &plan).await?
+            }
+        };
+        let embedder = Arc::clone(&self.embedder);
+        highlight::highlight(&mut results, &plan.terms, &vector, &self.config.highlight, |texts| {
+            highlight::embed_windows(embedder, texts)
+        })
+        .await?;
+        Ok((mode, results))
+    }
+}
+
+fn show(results: Vec<SearchResult>, mode: SearchMode) -> Result<()> {
+    if results.is_empty() {
+        println!("No results found.");
+        return Ok(());
+    }
+    retriever::print_results(results, &OutputFormat::Text, mode)
+}
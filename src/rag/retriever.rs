@@ -1,162 +1,530 @@
-use std::collections::HashMap;
+use std::collections::{BTreeMap, HashMap, HashSet};
 use std::path::Path;
+use std::sync::Arc;
 
+use glob::Pattern;
 use serde::Serialize;
 
 use crate::cli::{FindArgs, OutputFormat};
-use crate::config::AppConfig;
+use crate::config::{AppConfig, DEFAULT_QUERY_TEMPLATE, RetrievalConfig};
+use crate::config_usage;
+use crate::db::coverage::ChunkCoverage;
+use crate::db::profile::ChunkHotness;
+use crate::db::overlay;
 use crate::db::store::{SearchResult, Store};
 use crate::embed::nomic::NomicEmbedder;
 use crate::error::{AppError, Result};
 use crate::indexer;
+use crate::rag::highlight;
+use crate::rag::ranking::{self, PathBoosts};
+use crate::rag::recent::WorkingSet;
+use crate::symbols::scip;
+
+#[cfg(test)]
+#[path = "retriever_tests.rs"]
+mod retriever_tests;
+
+/// Candidates fetched per requested result when post-retrieval filters or
+/// re-ranking are active, so that filtering doesn't starve the result list and
+/// boosted results from just below the cut can move up.
+pub(crate) const CANDIDATE_OVERFETCH: usize = 5;
+
+/// Maximum number of duplicate locations listed per result in text output.
+const ALSO_AT_SHOWN: usize = 3;
 
 #[derive(Serialize)]
 struct JsonResult {
     rank: usize,
     file_path: String,
+    language: String,
     start_line: u32,
     end_line: u32,
     symbol: String,
     score: f32,
     content: String,
     summary: Option<String>,
+    also_at: Vec<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    qualified_symbol: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    coverage: Option<ChunkCoverage>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    hotness: Option<ChunkHotness>,
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    highlight_lines: Vec<u32>,
 }
 
-pub async fn find_cmd(
-    config: &AppConfig,
-    db_path: &Path,
-    target_dir: &Path,
-    args: FindArgs,
-) -> Result<()> {
-    // Auto-refresh changed files before searching
-    let (refreshed, _) = indexer::refresh(config, db_path, target_dir).await?;
-    if refreshed > 0 {
-        println!("[auto-refresh: {refreshed} file(s) updated]");
+#[derive(Clone, Copy, Debug, Default, serde::Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum SearchMode {
+    /// Content vectors only
+    #[default]
+    Find,
+    /// Content and summary vectors, merged with RRF
+    Query,
+}
+
+impl SearchMode {
+    /// Key used for this mode in `search.templates`.
+    pub fn as_str(self) -> &'static str {
+        match self {
+            SearchMode::Find => "find",
+            SearchMode::Query => "query",
+        }
     }
 
-    // Load embedder and embed the query in one spawn_blocking call
-    let prompt = args.prompt.clone();
-    let vector = tokio::task::spawn_blocking(move || {
-        NomicEmbedder::load()?.embed_query(&prompt)
-    })
-    .await
-    .map_err(|e| AppError::Other(e.into()))?
-    .map_err(|e| AppError::Embed(e.to_string()))?;
+    /// RRF scores grow with relevance; `find` reports a distance.
+    pub fn higher_is_better(self) -> bool {
+        matches!(self, SearchMode::Query)
+    }
 
-    let store = Store::open_or_create(
-        db_path,
-        config.db.embedding_dim,
-        &config.db.table_name,
-        false,
-    )
-    .await?;
+    pub fn score_label(self) -> &'static str {
+        match self {
+            SearchMode::Find => "dist",
+            SearchMode::Query => "rrf",
+        }
+    }
+}
 
-    let results = store.search(&vector, args.limit).await?;
-    let results: Vec<_> = results.into_iter()
-        .filter(|r| args.min_score.map_or(true, |t| r.score >= t))
-        .collect();
+/// Result filters applied after vector retrieval.
+#[derive(Default)]
+pub struct SearchFilter {
+    paths: Vec<Pattern>,
+    languages: Vec<String>,
+    /// Only chunks of which the coverage report shows no line executed
+    uncovered: bool,
+    /// Only chunks on at least this percentage of the profile's samples
+    hot: Option<f32>,
+}
 
-    if results.is_empty() {
-        println!("No results found.");
-        return Ok(());
+impl SearchFilter {
+    pub fn is_empty(&self) -> bool {
+        self.paths.is_empty() && self.languages.is_empty() && !self.uncovered && self.hot.is_none()
     }
 
-    match args.format {
-        OutputFormat::Text => {
-            for (i, r) in results.iter().enumerate() {
-                let symbol_display = if r.symbol.is_empty() {
-                    String::new()
-                } else {
-                    format!("  {}", r.symbol)
-                };
-                println!(
-                    "[{}] dist:{:.4}  {}:{}-{}{}",
-                    i + 1,
-                    r.score,
-                    r.file_path,
-                    r.start_line,
-                    r.end_line,
-                    symbol_display
-                );
-                if let Some(ref s) = r.summary {
-                    println!("  summary: {}", s);
-                }
-                let preview: String = r
-                    .content
-                    .lines()
-                    .take(3)
-                    .map(|l| format!("  {}", l))
-                    .collect::<Vec<_>>()
-                    .join("\n");
-                println!("{}", preview);
-                println!();
+    pub fn matches(&self, r: &SearchResult) -> bool {
+        (self.paths.is_empty() || self.matches_path(&r.file_path))
+            && (self.languages.is_empty()
+                || self.languages.iter().any(|l| l.eq_ignore_ascii_case(&r.language)))
+            && (!self.uncovered || r.coverage.is_some_and(|c| c.covered_lines == 0))
+            && self.hot.is_none_or(|min| r.hotness.is_some_and(|h| h.total_percent >= min))
+    }
+
+    fn matches_path(&self, path: &str) -> bool {
+        self.paths.iter().any(|p| p.matches(path))
+    }
+
+    /// Point a result whose primary location is outside the path globs at the
+    /// first of its other locations inside them, so a duplicate is kept when
+    /// any copy matches. Copies have the same length, so only the position
+    /// changes.
+    fn relocate(&self, r: &mut SearchResult) {
+        if self.paths.is_empty() || self.matches_path(&r.file_path) {
+            return;
+        }
+        let found = r.also_at.iter().enumerate().find_map(|(i, location)| {
+            let (path, line) = location.rsplit_once(':')?;
+            let line: u32 = line.parse().ok()?;
+            self.matches_path(path).then(|| (i, path.to_string(), line))
+        });
+        let Some((i, path, line)) = found else {
+            return;
+        };
+        r.also_at.remove(i);
+        r.also_at.insert(0, format!("{}:{}", r.file_path, r.start_line));
+        r.id = format!("{path}:{line}");
+        r.end_line = line + (r.end_line - r.start_line);
+        r.start_line = line;
+        r.file_path = path;
+    }
+}
+
+/// Per-request search settings shared by the CLI and the HTTP server.
+#[derive(Default)]
+pub struct SearchOptions {
+    /// Named intent from `[search.intents]`
+    pub intent: Option<String>,
+    /// Path globs; replace the intent's defaults when non-empty
+    pub paths: Vec<String>,
+    /// Languages; replace the intent's defaults when non-empty
+    pub languages: Vec<String>,
+    /// Path boosts layered over `[ranking.paths]`
+    pub boosts: BTreeMap<String, f32>,
+    /// Ignore `[ranking.paths]`
+    pub no_boosts: bool,
+    /// Boost files in the user's current working set
+    pub boost_recent: bool,
+    /// Only return chunks reading this environment variable or config key
+    /// (`*`: any environment variable)
+    pub uses_env: Option<String>,
+    /// Only return chunks the imported coverage report shows no test executing
+    pub uncovered: bool,
+    /// Only return chunks on at least this percentage of the imported
+    /// profile's samples
+    pub hot: Option<f32>,
+    /// Boost chunks by their share of the imported profile's samples
+    pub boost_hot: bool,
+}
+
+impl From<&FindArgs> for SearchOptions {
+    fn from(args: &FindArgs) -> Self {
+        Self {
+            intent: args.intent.clone(),
+            paths: args.paths.clone(),
+            languages: args.languages.clone(),
+            boosts: args.boosts.iter().cloned().collect(),
+            no_boosts: args.no_boosts,
+            boost_recent: args.boost_recent,
+            uses_env: args.uses_env.clone(),
+            uncovered: args.uncovered,
+            hot: args.hot,
+            boost_hot: args.boost_hot,
+        }
+    }
+}
+
+/// A prompt with its instruction template applied, plus the filters and
+/// ranking adjustments implied by the request.
+pub struct SearchPlan {
+    pub prompt: String,
+    pub filter: SearchFilter,
+    pub boosts: PathBoosts,
+    pub recent: Option<WorkingSet>,
+    /// Lowercased identifiers from the prompt and the `symbol_match`
+    /// multiplier for results whose precise symbol is one of them
+    pub symbol_match: Option<(HashSet<String>, f32)>,
+    /// The `hot_boost` multiplier for the hottest chunk, when boosting by the
+    /// imported profile
+    pub hot_boost: Option<f32>,
+    /// Only keep chunks reading this setting (see `config_usage::key_matches`)
+    pub uses_env: Option<String>,
+    /// Prompt words matched against result lines by `highlight`
+    pub terms: HashSet<String>,
+    /// Weights of the RRF merge in `query`
+    pub retrieval: RetrievalConfig,
+}
+
+impl SearchPlan {
+    fn reranks(&self) -> bool {
+        !self.boosts.is_empty() || self.recent.is_some() || self.hot_boost.is_some()
+    }
+
+    /// Combined ranking multiplier for a result.
+    fn multiplier(&self, r: &SearchResult) -> f32 {
+        let recent = self.recent.as_ref().map_or(1.0, |w| w.multiplier(&r.file_path));
+        let symbol = match (&self.symbol_match, &r.qualified_symbol) {
+            (Some((terms, factor)), Some(q))
+                if terms.contains(&scip::symbol_name(q).to_lowercase()) =>
+            {
+                *factor
             }
+            _ => 1.0,
+        };
+        // Scaled by the chunk's own time relative to the hottest chunk
+        let hot = match (self.hot_boost, r.hotness) {
+            (Some(factor), Some(h)) => 1.0 + (factor - 1.0) * h.score,
+            _ => 1.0,
+        };
+        self.boosts.multiplier(&r.file_path) * recent * symbol * hot
+    }
+
+    /// Drop results outside the filter and apply ranking multipliers to the
+    /// rest, which must already be sorted best first.
+    pub fn apply(&self, results: &mut Vec<SearchResult>, mode: SearchMode) {
+        for r in results.iter_mut() {
+            self.filter.relocate(r);
         }
-        OutputFormat::Json => {
-            let json_results: Vec<JsonResult> = results
-                .into_iter()
-                .enumerate()
-                .map(|(i, r)| JsonResult {
-                    rank: i + 1,
-                    file_path: r.file_path,
-                    start_line: r.start_line,
-                    end_line: r.end_line,
-                    symbol: r.symbol,
-                    score: r.score,
-                    content: r.content,
-                    summary: r.summary,
-                })
-                .collect();
-            println!(
-                "{}",
-                serde_json::to_string_pretty(&json_results)
-                    .map_err(|e| crate::error::AppError::Other(e.into()))?
-            );
+        results.retain(|r| self.filter.matches(r));
+        let symbols_attached = results.iter().any(|r| r.qualified_symbol.is_some());
+        if self.reranks() || (self.symbol_match.is_some() && symbols_attached) {
+            ranking::rerank(results, mode.higher_is_better(), |r| self.multiplier(r));
         }
     }
+}
 
-    Ok(())
+/// Resolve the instruction template, filters and boosts for a search, and
+/// detect the working set when `boost_recent` is set. `target_dir` locates
+/// the working set.
+pub async fn plan_search(
+    config: &AppConfig,
+    target_dir: &Path,
+    mode: SearchMode,
+    prompt: &str,
+    options: &SearchOptions,
+) -> Result<SearchPlan> {
+    let mut plan = resolve_plan(config, mode, prompt, options)?;
+    if options.boost_recent {
+        plan.recent = Some(WorkingSet::detect(target_dir, &config.ranking.recent).await?);
+    }
+    Ok(plan)
 }
 
-pub(crate) fn rrf_merge(
-    content_results: Vec<SearchResult>,
-    summary_results: Vec<SearchResult>,
+/// Resolve the instruction template, filters and boosts for a search, without
+/// the working set: `boost_recent` is left to `plan_search`. An intent
+/// supplies a template and filters; explicit `paths`/`languages` take
+/// precedence over the intent's defaults.
+pub fn resolve_plan(
+    config: &AppConfig,
+    mode: SearchMode,
+    prompt: &str,
+    options: &SearchOptions,
+) -> Result<SearchPlan> {
+    let (template, mut path_globs, mut langs) = match options.intent.as_deref() {
+        Some(name) => {
+            let intent = config.search.intents.get(name).ok_or_else(|| {
+                let known: Vec<&str> = config.search.intents.keys().map(String::as_str).collect();
+                AppError::Other(anyhow::anyhow!(
+                    "unknown intent '{name}' (configured: {})",
+                    known.join(", ")
+                ))
+            })?;
+            (intent.template.as_str(), intent.paths.clone(), intent.languages.clone())
+        }
+        None => (
+            config
+                .search
+                .templates
+                .get(mode.as_str())
+                .map(String::as_str)
+                .unwrap_or(DEFAULT_QUERY_TEMPLATE),
+            Vec::new(),
+            Vec::new(),
+        ),
+    };
+    if !options.paths.is_empty() {
+        path_globs = options.paths.clone();
+    }
+    if !options.languages.is_empty() {
+        langs = options.languages.clone();
+    }
+
+    let paths = path_globs
+        .iter()
+        .map(|g| {
+            Pattern::new(g)
+                .map_err(|e| AppError::Other(anyhow::anyhow!("invalid path glob '{g}': {e}")))
+        })
+        .collect::<Result<Vec<_>>>()?;
+
+    let boosts = PathBoosts::new(&config.ranking.paths, &options.boosts, !options.no_boosts)?;
+    let symbol_match = (config.ranking.symbol_match != 1.0)
+        .then(|| (prompt_identifiers(prompt), config.ranking.symbol_match));
+
+    Ok(SearchPlan {
+        prompt: render_template(template, prompt),
+        filter: SearchFilter {
+            paths,
+            languages: langs,
+            uncovered: options.uncovered,
+            hot: options.hot,
+        },
+        boosts,
+        recent: None,
+        symbol_match,
+        hot_boost: options.boost_hot.then_some(config.ranking.hot_boost),
+        uses_env: options.uses_env.clone(),
+        terms: highlight::query_terms(prompt),
+        retrieval: config.retrieval.clone(),
+    })
+}
+
+/// Lowercased identifier-like words of a prompt; `Parser::parse` yields both
+/// `parser` and `parse`.
+fn prompt_identifiers(prompt: &str) -> HashSet<String> {
+    prompt
+        .split(|c: char| !(c.is_alphanumeric() || c == '_'))
+        .filter(|w| w.len() > 1)
+        .map(str::to_lowercase)
+        .collect()
+}
+
+/// Substitute `query` for `{query}` in an instruction template. A template
+/// without the placeholder is treated as a prefix.
+pub fn render_template(template: &str, query: &str) -> String {
+    if template.contains("{query}") {
+        template.replace("{query}", query)
+    } else {
+        format!("{template}{query}")
+    }
+}
+
+/// Vector hits for one query, best first, before merging, filtering and
+/// re-ranking. `mh tune` ranks the same candidates under many settings.
+#[derive(Clone)]
+pub struct Candidates {
+    content: Vec<SearchResult>,
+    /// Summary-vector hits, for `query`
+    summary: Option<Vec<SearchResult>>,
+}
+
+impl Candidates {
+    /// Drop the chunk text, which ranking doesn't read, so copies are cheap.
+    pub fn without_text(mut self) -> Self {
+        for r in self.content.iter_mut().chain(self.summary.iter_mut().flatten()) {
+            r.content.clear();
+            r.summary = None;
+        }
+        self
+    }
+}
+
+/// Retrieve up to `limit` results for an embedded query, applying the plan's
+/// filters and ranking multipliers. Results are tagged with their precise
+/// symbol when a SCIP index has been imported, their coverage when a
+/// coverage report has, and their hotness when a profile has.
+pub async fn search(
+    store: &Store,
+    vector: &[f32],
+    mode: SearchMode,
     limit: usize,
-) -> Vec<SearchResult> {
-    const K: f32 = 60.0;
-    let mut scores: HashMap<String, (SearchResult, f32)> = HashMap::new();
+    plan: &SearchPlan,
+) -> Result<Vec<SearchResult>> {
+    let fetch = fetch_count(store, limit, plan);
+    let candidates = fetch_candidates(store, vector, mode, fetch, plan).await?;
+    Ok(rank(candidates, mode, limit, fetch, plan))
+}
+
+/// Hits retrieved per vector column for `limit` results: more when results
+/// may be filtered out or moved up from below the cut.
+pub fn fetch_count(store: &Store, limit: usize, plan: &SearchPlan) -> usize {
+    let symbol_ranking = plan.symbol_match.is_some() && store.symbols().is_some();
+    if plan.filter.is_empty() && !plan.reranks() && !symbol_ranking {
+        limit
+    } else {
+        limit * CANDIDATE_OVERFETCH
+    }
+}
 
-    for (rank, r) in content_results.into_iter().enumerate() {
-        let rrf = 1.0 / (K + (rank + 1) as f32);
-        scores.entry(r.id.clone()).and_modify(|(_, s)| *s += rrf).or_insert((r, rrf));
+/// Retrieve `fetch` hits per vector column that `mode` searches. With
+/// `uses_env`, `uncovered` or `hot`, only the chunks that can pass them are
+/// searched, so the nearest hits aren't all filtered out afterwards.
+pub async fn fetch_candidates(
+    store: &Store,
+    vector: &[f32],
+    mode: SearchMode,
+    fetch: usize,
+    plan: &SearchPlan,
+) -> Result<Candidates> {
+    if plan.filter.uncovered && store.coverage().is_none() {
+        return Err(AppError::Other(anyhow::anyhow!(
+            "No coverage imported. Run `coverage import` first."
+        )));
     }
-    for (rank, r) in summary_results.into_iter().enumerate() {
-        let rrf = 1.0 / (K + (rank + 1) as f32);
-        scores.entry(r.id.clone()).and_modify(|(_, s)| *s += rrf).or_insert((r, rrf));
+    if (plan.filter.hot.is_some() || plan.hot_boost.is_some()) && store.profile().is_none() {
+        return Err(AppError::Other(anyhow::anyhow!(
+            "No profile imported. Run `profile import` first."
+        )));
     }
+    // Each prefilter narrows the content hashes searched; the filters still
+    // run on the results, as a hash may be covered or hot at one location only
+    let mut prefilters: Vec<HashSet<String>> = Vec::new();
+    if let Some(wanted) = &plan.uses_env {
+        let usages = store.config_usages().all().await?;
+        prefilters.push(
+            usages
+                .into_iter()
+                .filter(|u| config_usage::key_matches(&u.kind, &u.key, wanted))
+                .filter_map(|u| u.content_hash)
+                .collect(),
+        );
+    }
+    if let (true, Some(coverage)) = (plan.filter.uncovered, store.coverage()) {
+        prefilters.push(coverage.uncovered().await?.into_iter().collect());
+    }
+    if let (Some(min), Some(profile)) = (plan.filter.hot, store.profile()) {
+        prefilters.push(profile.hot(min).await?.into_iter().collect());
+    }
+    let only: Option<Vec<String>> =
+        prefilters.into_iter().reduce(|a, b| &a & &b).map(|hashes| hashes.into_iter().collect());
+    let only = only.as_deref();
+    let (mut content, mut summary) = match mode {
+        SearchMode::Find => (store.search(vector, fetch, only).await?, None),
+        SearchMode::Query => {
+            let (content, summary) = tokio::try_join!(
+                store.search(vector, fetch, only),
+                store.search_by_summary(vector, fetch, only)
+            )?;
+            (content, Some(summary))
+        }
+    };
 
-    let mut merged: Vec<(SearchResult, f32)> = scores.into_values().collect();
-    merged.sort_by(|a, b| b.1.partial_cmp(&a.1).unwrap_or(std::cmp::Ordering::Equal));
-    merged.truncate(limit);
-    merged.into_iter().map(|(mut r, rrf_score)| { r.score = rrf_score; r }).collect()
+    store.attach_symbols(&mut content).await?;
+    store.attach_coverage(&mut content).await?;
+    store.attach_hotness(&mut content).await?;
+    if let Some(summary) = summary.as_mut() {
+        store.attach_symbols(summary).await?;
+        store.attach_coverage(summary).await?;
+        store.attach_hotness(summary).await?;
+    }
+    Ok(Candidates { content, summary })
+}
+
+/// Merge, filter and re-rank candidates into the best `limit` results. Only
+/// the first `fetch` hits of each column are used, as if no more had been
+/// retrieved.
+pub fn rank(
+    candidates: Candidates,
+    mode: SearchMode,
+    limit: usize,
+    fetch: usize,
+    plan: &SearchPlan,
+) -> Vec<SearchResult> {
+    let Candidates { mut content, summary } = candidates;
+    content.truncate(fetch);
+    let mut results = match summary {
+        Some(mut summary) => {
+            summary.truncate(fetch);
+            rrf_merge(content, summary, fetch, &plan.retrieval)
+        }
+        None => content,
+    };
+    plan.apply(&mut results, mode);
+    results.truncate(limit);
+    results
+}
+
+pub async fn find_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: FindArgs,
+) -> Result<()> {
+    search_cmd(config, db_path, target_dir, args, SearchMode::Find).await
 }
 
 pub async fn query_cmd(
     config: &AppConfig,
-    db_path: &std::path::Path,
-    target_dir: &std::path::Path,
+    db_path: &Path,
+    target_dir: &Path,
+    args: FindArgs,
+) -> Result<()> {
+    search_cmd(config, db_path, target_dir, args, SearchMode::Query).await
+}
+
+async fn search_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
     args: FindArgs,
+    mode: SearchMode,
 ) -> Result<()> {
+    // Resolve the intent first so a typo fails before the model is loaded
+    let plan =
+        plan_search(config, target_dir, mode, &args.prompt, &SearchOptions::from(&args)).await?;
+
     // Auto-refresh changed files before searching
     let (refreshed, _) = indexer::refresh(config, db_path, target_dir).await?;
     if refreshed > 0 {
         println!("[auto-refresh: {refreshed} file(s) updated]");
     }
 
-    // Load embedder and embed the query in one spawn_blocking call
-    let prompt = args.prompt.clone();
-    let vector = tokio::task::spawn_blocking(move || {
-        NomicEmbedder::load()?.embed_query(&prompt)
+    // Load embedder and embed the query in one spawn_blocking call; the
+    // embedder is kept for highlighting
+    let prompt = plan.prompt.clone();
+    let (embedder, vector) = tokio::task::spawn_blocking(move || {
+        let embedder = NomicEmbedder::load()?;
+        let vector = embedder.embed_prompt(&prompt)?;
+        anyhow::Ok((Arc::new(embedder), vector))
     })
     .await
     .map_err(|e| AppError::Other(e.into()))?
@@ -166,14 +534,13 @@ pub async fn query_cmd(
         db_path,
         config.db.embedding_dim,
         &config.db.table_name,
+        &overlay::current(target_dir),
         false,
     )
     .await?;
 
-    let content_results = store.search(&vector, args.limit).await?;
-    let summary_results = store.search_by_summary(&vector, args.limit).await?;
-    let results = rrf_merge(content_results, summary_results, args.limit);
-    let results: Vec<_> = results.into_iter()
+    let results = search(&store, &vector, mode, args.limit, &plan).await?;
+    let mut results: Vec<_> = results.into_iter()
         .filter(|r| args.min_score.map_or(true, |t| r.score >= t))
         .collect();
 
@@ -182,7 +549,16 @@ pub async fn query_cmd(
         return Ok(());
     }
 
-    match args.format {
+    highlight::highlight(&mut results, &plan.terms, &vector, &config.highlight, |texts| {
+        highlight::embed_windows(embedder, texts)
+    })
+    .await?;
+
+    print_results(results, &args.format, mode)
+}
+
+pub fn print_results(results: Vec<SearchResult>, format: &OutputFormat, mode: SearchMode) -> Result<()> {
+    match format {
         OutputFormat::Text => {
             for (i, r) in results.iter().enumerate() {
                 let symbol_display = if r.symbol.is_empty() {
@@ -191,24 +567,63 @@ pub async fn query_cmd(
                     format!("  {}", r.symbol)
                 };
                 println!(
-                    "[{}] rrf:{:.4}  {}:{}-{}{}",
+                    "[{}] {}:{:.4}  {}:{}-{}{}",
                     i + 1,
+                    mode.score_label(),
                     r.score,
                     r.file_path,
                     r.start_line,
                     r.end_line,
                     symbol_display
                 );
+                if let Some(ref q) = r.qualified_symbol {
+                    println!("  symbol: {}", q);
+                }
+                if let Some(c) = r.coverage {
+                    println!(
+                        "  coverage: {:.0}% ({}/{} lines)",
+                        c.percent, c.covered_lines, c.coverable_lines
+                    );
+                }
+                if let Some(h) = r.hotness {
+                    println!(
+                        "  hot: {:.1}% self, {:.1}% total samples",
+                        h.self_percent, h.total_percent
+                    );
+                }
                 if let Some(ref s) = r.summary {
                     println!("  summary: {}", s);
                 }
-                let preview: String = r
-                    .content
-                    .lines()
-                    .take(3)
-                    .map(|l| format!("  {}", l))
-                    .collect::<Vec<_>>()
-                    .join("\n");
+                if !r.also_at.is_empty() {
+                    let shown: Vec<&str> =
+                        r.also_at.iter().take(ALSO_AT_SHOWN).map(String::as_str).collect();
+                    let more = r.also_at.len().saturating_sub(ALSO_AT_SHOWN);
+                    let suffix = if more > 0 { format!(", +{more} more") } else { String::new() };
+                    println!(
+                        "  also at {} location(s): {}{}",
+                        r.also_at.len(),
+                        shown.join(", "),
+                        suffix
+                    );
+                }
+                let preview: String = match (r.highlight_lines.first(), r.highlight_lines.last()) {
+                    (Some(&first), Some(&last)) => r
+                        .content
+                        .lines()
+                        .zip(r.start_line..)
+                        .skip((first - r.start_line) as usize)
+                        .take((last - first + 1) as usize)
+                        .map(|(l, n)| format!("  {n:>5}| {l}"))
+                        .collect::<Vec<_>>()
+                        .join("\n"),
+                    _ => r
+                        .content
+                        .lines()
+                        .take(3)
+                        .map(|l| format!("  {}", l))
+                        .collect::<Vec<_>>()
+                        .join("\n"),
+                };
                 println!("{}", preview);
                 println!();
             }
@@ -220,21 +635,51 @@ pub async fn query_cmd(
                 .map(|(i, r)| JsonResult {
                     rank: i + 1,
                     file_path: r.file_path,
+                    language: r.language,
                     start_line: r.start_line,
                     end_line: r.end_line,
                     symbol: r.symbol,
                     score: r.score,
                     content: r.content,
                     summary: r.summary,
+                    also_at: r.also_at,
+                    qualified_symbol: r.qualified_symbol,
+                    coverage: r.coverage,
+                    hotness: r.hotness,
+                    highlight_lines: r.highlight_lines,
                 })
                 .collect();
             println!(
                 "{}",
                 serde_json::to_string_pretty(&json_results)
-                    .map_err(|e| crate::error::AppError::Other(e.into()))?
+                    .map_err(|e| AppError::Other(e.into()))?
             );
         }
     }
 
     Ok(())
 }
+
+pub(crate) fn rrf_merge(
+    content_results: Vec<SearchResult>,
+    summary_results: Vec<SearchResult>,
+    limit: usize,
+    retrieval: &RetrievalConfig,
+) -> Vec<SearchResult> {
+    let mut scores: HashMap<String, (SearchResult, f32)> = HashMap::new();
+
+    for (results, weight) in [
+        (content_results, retrieval.content_weight),
+        (summary_results, retrieval.summary_weight),
+    ] {
+        for (rank, r) in results.into_iter().enumerate() {
+            let rrf = weight / (retrieval.rrf_k + (rank + 1) as f32);
+            scores.entry(r.id.clone()).and_modify(|(_, s)| *s += rrf).or_insert((r, rrf));
+        }
+    }
+
+    let mut merged: Vec<(SearchResult, f32)> = scores.into_values().collect();
+    merged.sort_by(|a, b| b.1.partial_cmp(&a.1).unwrap_or(std::cmp::Ordering::Equal));
+    merged.truncate(limit);
+    merged.into_iter().map(|(mut r, rrf_score)| { r.score = rrf_score; r }).collect()
+}
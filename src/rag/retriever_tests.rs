@@ -0,0 +1,142 @@
+/// Search planning tests: where the prompt lands in an instruction template,
+/// how intents resolve, and how explicit filters combine with an intent's.
+
+#[cfg(test)]
+mod retriever_tests {
+    use std::collections::BTreeMap;
+
+    use crate::config::{AppConfig, DEFAULT_QUERY_TEMPLATE, IntentConfig};
+    use crate::db::store::SearchResult;
+    use crate::rag::retriever::{
+        SearchMode, SearchOptions, SearchPlan, render_template, resolve_plan,
+    };
+
+    fn result(file_path: &str, language: &str) -> SearchResult {
+        SearchResult {
+            language: language.to_string(),
+            ..SearchResult::for_test(file_path, 1, 1, "")
+        }
+    }
+
+    fn config() -> AppConfig {
+        let mut config = AppConfig::default();
+        config.search.intents = BTreeMap::from([(
+            "tests".to_string(),
+            IntentConfig {
+                template: "Find tests for: {query}".to_string(),
+                paths: vec!["tests/**".to_string()],
+                languages: vec!["rust".to_string()],
+            },
+        )]);
+        config
+    }
+
+    fn plan(config: &AppConfig, mode: SearchMode, options: &SearchOptions) -> SearchPlan {
+        resolve_plan(config, mode, "open the store", options).unwrap()
+    }
+
+    #[test]
+    fn the_placeholder_is_replaced_wherever_it_appears() {
+        assert_eq!(render_template("Code for: {query}", "parse"), "Code for: parse");
+        assert_eq!(render_template("{query} (tests only)", "parse"), "parse (tests only)");
+        assert_eq!(render_template("{query} / {query}", "x"), "x / x");
+    }
+
+    #[test]
+    fn a_template_without_the_placeholder_is_a_prefix() {
+        assert_eq!(render_template("search_query: ", "parse"), "search_query: parse");
+        assert_eq!(render_template("", "parse"), "parse");
+    }
+
+    #[test]
+    fn each_mode_uses_its_own_template() {
+        let mut config = config();
+        config.search.templates.insert("query".into(), "Explain: {query}".into());
+        let options = SearchOptions::default();
+
+        assert_eq!(
+            plan(&config, SearchMode::Find, &options).prompt,
+            render_template(DEFAULT_QUERY_TEMPLATE, "open the store")
+        );
+        assert_eq!(plan(&config, SearchMode::Query, &options).prompt, "Explain: open the store");
+    }
+
+    #[test]
+    fn a_mode_without_a_template_falls_back_to_the_default() {
+        let mut config = config();
+        config.search.templates.clear();
+        let plan = plan(&config, SearchMode::Query, &SearchOptions::default());
+        assert_eq!(plan.prompt, render_template(DEFAULT_QUERY_TEMPLATE, "open the store"));
+        assert!(plan.filter.is_empty());
+    }
+
+    #[test]
+    fn an_intent_supplies_its_template_and_filters() {
+        let options = SearchOptions { intent: Some("tests".into()), ..Default::default() };
+        let plan = plan(&config(), SearchMode::Find, &options);
+
+        assert_eq!(plan.prompt, "Find tests for: open the store");
+        assert!(plan.filter.matches(&result("tests/store.rs", "rust")));
+        assert!(!plan.filter.matches(&result("src/store.rs", "rust")));
+        assert!(!plan.filter.matches(&result("tests/store.py", "python")));
+    }
+
+    #[test]
+    fn explicit_filters_replace_the_intents_defaults() {
+        let options = SearchOptions {
+            intent: Some("tests".into()),
+            paths: vec!["src/**".into()],
+            ..Default::default()
+        };
+        let plan = plan(&config(), SearchMode::Find, &options);
+
+        // The template and the languages still come from the intent
+        assert_eq!(plan.prompt, "Find tests for: open the store");
+        assert!(plan.filter.matches(&result("src/store.rs", "rust")));
+        assert!(!plan.filter.matches(&result("tests/store.rs", "rust")));
+        assert!(!plan.filter.matches(&result("src/store.py", "python")));
+
+        let options = SearchOptions {
+            intent: Some("tests".into()),
+            languages: vec!["Python".into()],
+            ..Default::default()
+        };
+        let plan = plan(&config(), SearchMode::Find, &options);
+        assert!(plan.filter.matches(&result("tests/store.py", "python")));
+        assert!(!plan.filter.matches(&result("tests/store.rs", "rust")));
+    }
+
+    #[test]
+    fn a_duplicate_is_kept_at_its_first_location_matching_the_path_filter() {
+        let options = SearchOptions { paths: vec!["vendor/**".into()], ..Default::default() };
+        let plan = plan(&config(), SearchMode::Find, &options);
+        let mut r = result("src/stack.rs", "rust");
+        r.start_line = 3;
+        r.end_line = 10;
+        r.also_at = vec!["tests/stack.rs:1".into(), "vendor/stack.rs:20".into()];
+        let mut results = vec![r, result("src/other.rs", "rust")];
+
+        plan.apply(&mut results, SearchMode::Find);
+
+        assert_eq!(results.len(), 1);
+        let r = &results[0];
+        assert_eq!(r.id, "vendor/stack.rs:20");
+        assert_eq!((r.file_path.as_str(), r.start_line, r.end_line), ("vendor/stack.rs", 20, 27));
+        assert_eq!(r.also_at, vec!["src/stack.rs:3", "tests/stack.rs:1"]);
+    }
+
+    #[test]
+    fn an_unknown_intent_names_the_configured_ones() {
+        let options = SearchOptions { intent: Some("docs".into()), ..Default::default() };
+        let err = resolve_plan(&config(), SearchMode::Find, "x", &options)
+            .err()
+            .expect("unknown intent");
+        assert_eq!(err.to_string(), "unknown intent 'docs' (configured: tests)");
+    }
+
+    #[test]
+    fn an_invalid_path_glob_is_rejected() {
+        let options = SearchOptions { paths: vec!["src/[".into()], ..Default::default() };
+        assert!(resolve_plan(&config(), SearchMode::Find, "x", &options).is_err());
+    }
+}
@@ -0,0 +1,603 @@
+use std::collections::{HashMap, HashSet};
+use std::path::Path;
+use std::sync::Arc;
+use std::time::{SystemTime, UNIX_EPOCH};
+
+use serde::Deserialize;
+use toml_edit::{DocumentMut, InlineTable, Item, Table, Value};
+
+use crate::cli::{TuneArgs, TuneMetric, TuneStrategy};
+use crate::config::AppConfig;
+use crate::db::overlay;
+use crate::db::store::{SearchResult, Store};
+use crate::embed::nomic::NomicEmbedder;
+use crate::error::{AppError, Result};
+use crate::indexer::{self, IndexOptions};
+use crate::rag::retriever::{self, CANDIDATE_OVERFETCH, Candidates, SearchMode, SearchOptions};
+
+#[cfg(test)]
+#[path = "tune_tests.rs"]
+mod tune_tests;
+
+/// Values tried for each tuned setting, besides its configured value.
+const RRF_K: &[f32] = &[10.0, 30.0, 60.0, 100.0];
+const CONTENT_WEIGHTS: &[f32] = &[0.5, 1.0, 1.5, 2.0];
+const SUMMARY_WEIGHTS: &[f32] = &[0.0, 0.5, 1.0, 1.5];
+const SYMBOL_MATCH: &[f32] = &[1.0, 1.25, 1.5, 2.0];
+/// For `[ranking.paths]` rules that penalise, and those that boost
+const PATH_PENALTIES: &[f32] = &[0.3, 0.5, 0.7, 1.0];
+const PATH_BOOSTS: &[f32] = &[1.0, 1.2, 1.5, 2.0];
+
+/// Grids larger than this must be sampled with `--strategy random`.
+const MAX_GRID: usize = 20_000;
+
+/// One line of the golden file.
+#[derive(Deserialize)]
+struct GoldenLine {
+    query: String,
+    /// Relevant hits: a file path, or `path:line` for the chunk containing
+    /// that 1-based line
+    expected: Vec<String>,
+    /// `find` or `query`
+    #[serde(default)]
+    mode: Option<String>,
+    #[serde(default)]
+    intent: Option<String>,
+}
+
+struct GoldenCase {
+    query: String,
+    expected: Vec<Expected>,
+    mode: SearchMode,
+    intent: Option<String>,
+}
+
+impl GoldenCase {
+    fn options(&self) -> SearchOptions {
+        SearchOptions { intent: self.intent.clone(), ..SearchOptions::default() }
+    }
+}
+
+struct Expected {
+    path: String,
+    /// 0-based
+    line: Option<u32>,
+}
+
+impl Expected {
+    fn parse(s: &str) -> Self {
+        let s = s.trim().trim_start_matches("./");
+        let line = s
+            .rsplit_once(':')
+            .and_then(|(path, line)| Some((path, line.parse::<u32>().ok()?.checked_sub(1)?)));
+        match line {
+            Some((path, line)) => Expected { path: path.to_string(), line: Some(line) },
+            None => Expected { path: s.to_string(), line: None },
+        }
+    }
+
+    fn matches(&self, r: &SearchResult) -> bool {
+        match self.line {
+            Some(line) => r.file_path == self.path && r.start_line <= line && line <= r.end_line,
+            None => {
+                r.file_path == self.path
+                    || r.also_at.iter().any(|a| a.rsplit_once(':').is_some_and(|(p, _)| p == self.path))
+            }
+        }
+    }
+}
+
+/// A tuned setting.
+#[derive(Clone, PartialEq)]
+enum Param {
+    RrfK,
+    ContentWeight,
+    SummaryWeight,
+    SymbolMatch,
+    PathBoost(String),
+    ChunkLines,
+}
+
+impl Param {
+    /// Key in maharajah.toml.
+    fn key(&self) -> String {
+        match self {
+            Param::RrfK => "retrieval.rrf_k".into(),
+            Param::ContentWeight => "retrieval.content_weight".into(),
+            Param::SummaryWeight => "retrieval.summary_weight".into(),
+            Param::SymbolMatch => "ranking.symbol_match".into(),
+            Param::PathBoost(glob) => format!("ranking.paths.\"{glob}\""),
+            Param::ChunkLines => "index.max_chunk_lines".into(),
+        }
+    }
+}
+
+/// A setting and the values tried for it.
+struct Dimension {
+    param: Param,
+    values: Vec<f32>,
+    current: f32,
+}
+
+impl Dimension {
+    fn new(param: Param, current: f32, tried: &[f32]) -> Self {
+        let mut values = tried.to_vec();
+        values.push(current);
+        values.sort_by(|a, b| a.total_cmp(b));
+        values.dedup();
+        Self { param, values, current }
+    }
+}
+
+/// Ranking quality of one setting, averaged over the golden queries.
+#[derive(Clone, Copy, Default)]
+struct Metrics {
+    mrr: f64,
+    recall: f64,
+    hit_rate: f64,
+}
+
+impl Metrics {
+    fn get(&self, metric: TuneMetric) -> f64 {
+        match metric {
+            TuneMetric::Mrr => self.mrr,
+            TuneMetric::Recall => self.recall,
+            TuneMetric::HitRate => self.hit_rate,
+        }
+    }
+}
+
+/// A setting with its metrics and the rank of each query's first relevant hit.
+#[derive(Clone)]
+struct Evaluation {
+    point: Vec<f32>,
+    metrics: Metrics,
+    first_hits: Vec<Option<usize>>,
+}
+
+/// Search the golden queries under many retrieval settings, report the best
+/// and write it to the project `maharajah.toml`.
+pub async fn tune_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: TuneArgs,
+) -> Result<()> {
+    if args.k == 0 {
+        return Err(AppError::Other(anyhow::anyhow!("-k must be at least 1")));
+    }
+    let cases = read_golden(&args.golden)?;
+
+    let (refreshed, _) = indexer::refresh(config, db_path, target_dir).await?;
+    if refreshed > 0 {
+        println!("[auto-refresh: {refreshed} file(s) updated]");
+    }
+    let overlay = overlay::current(target_dir);
+    let store = Store::open_or_create(
+        db_path,
+        config.db.embedding_dim,
+        &config.db.table_name,
+        &overlay,
+        false,
+    )
+    .await?;
+    let embedder = Arc::new(
+        tokio::task::spawn_blocking(NomicEmbedder::load)
+            .await
+            .map_err(|e| AppError::Other(e.into()))?
+            .map_err(|e| AppError::Embed(e.to_string()))?,
+    );
+
+    // Queries are embedded once: only the ranking depends on tuned settings
+    let mut prompts = Vec::with_capacity(cases.len());
+    let mut plans = Vec::with_capacity(cases.len());
+    for case in &cases {
+        let plan =
+            retriever::plan_search(config, target_dir, case.mode, &case.query, &case.options())
+                .await?;
+        prompts.push(plan.prompt.clone());
+        plans.push(plan);
+    }
+    let emb = Arc::clone(&embedder);
+    let vectors = tokio::task::spawn_blocking(move || {
+        prompts.iter().map(|p| emb.embed_prompt(p)).collect::<anyhow::Result<Vec<_>>>()
+    })
+    .await
+    .map_err(|e| AppError::Other(e.into()))?
+    .map_err(|e| AppError::Embed(e.to_string()))?;
+
+    // Other chunk sizes are indexed into scratch databases, kept between
+    // runs, embedding only chunks the main index doesn't have
+    let current_lines = config.index.max_chunk_lines;
+    let mut scratch: Vec<(usize, Store)> = Vec::new();
+    for &lines in args.chunk_lines.iter().filter(|&&l| l != current_lines) {
+        if lines == 0 || scratch.iter().any(|(l, _)| *l == lines) {
+            continue;
+        }
+        let path = db_path.with_file_name("tune").join(format!("lines-{lines}"));
+        let variant = Store::open_or_create(
+            &path,
+            config.db.embedding_dim,
+            &config.db.table_name,
+            &overlay,
+            false,
+        )
+        .await?;
+        let mut options = IndexOptions::from_config(config);
+        options.max_chunk_lines = lines;
+        println!("Indexing with {lines}-line chunks into {} ...", path.display());
+        let summary = indexer::index_with_cache(
+            config,
+            &variant,
+            &store,
+            Arc::clone(&embedder),
+            target_dir,
+            &options,
+        )
+        .await?;
+        println!("  {} file(s) indexed, {} unchanged.", summary.indexed, summary.skipped);
+        scratch.push((lines, variant));
+    }
+    let store_for =
+        |lines: usize| scratch.iter().find(|(l, _)| *l == lines).map_or(&store, |(_, s)| s);
+
+    let fetch = args.k * CANDIDATE_OVERFETCH;
+    let mut candidates: HashMap<usize, Vec<Candidates>> = HashMap::new();
+    for lines in std::iter::once(current_lines).chain(scratch.iter().map(|(l, _)| *l)) {
+        let mut per_case = Vec::with_capacity(cases.len());
+        for ((case, plan), vector) in cases.iter().zip(&plans).zip(&vectors) {
+            let c = retriever::fetch_candidates(store_for(lines), vector, case.mode, fetch, plan)
+                .await?;
+            per_case.push(c.without_text());
+        }
+        candidates.insert(lines, per_case);
+    }
+
+    let dims = dimensions(config, &cases, store.symbols().is_some(), &candidates);
+    if dims.is_empty() {
+        println!("Nothing to tune: no `query` cases, path rules, SCIP symbols or --chunk-lines.");
+        return Ok(());
+    }
+    let evaluate = |point: &[f32]| -> Result<Evaluation> {
+        let tuned = configure(config, &dims, point);
+        let lines = tuned.index.max_chunk_lines;
+        let mut first_hits = Vec::with_capacity(cases.len());
+        let mut metrics = Metrics::default();
+        for (case, c) in cases.iter().zip(&candidates[&lines]) {
+            // Golden cases don't boost the working set, which needs no detecting
+            let plan = retriever::resolve_plan(&tuned, case.mode, &case.query, &case.options())?;
+            let fetch = retriever::fetch_count(store_for(lines), args.k, &plan);
+            let results = retriever::rank(c.clone(), case.mode, args.k, fetch, &plan);
+            let first = results.iter().position(|r| case.expected.iter().any(|e| e.matches(r)));
+            let found = case.expected.iter().filter(|e| results.iter().any(|r| e.matches(r))).count();
+            metrics.mrr += first.map_or(0.0, |i| 1.0 / (i + 1) as f64);
+            metrics.recall += found as f64 / case.expected.len() as f64;
+            metrics.hit_rate += if first.is_some() { 1.0 } else { 0.0 };
+            first_hits.push(first);
+        }
+        let n = cases.len() as f64;
+        metrics.mrr /= n;
+        metrics.recall /= n;
+        metrics.hit_rate /= n;
+        Ok(Evaluation { point: point.to_vec(), metrics, first_hits })
+    };
+
+    let baseline: Vec<f32> = dims.iter().map(|d| d.current).collect();
+    let changes =
+        |point: &[f32]| point.iter().zip(&baseline).filter(|(a, b)| a != b).count();
+    let current = evaluate(&baseline)?;
+    let mut best = current.clone();
+    let mut tried = 1usize;
+    let mut consider = |e: Evaluation| {
+        let (score, best_score) = (e.metrics.get(args.metric), best.metrics.get(args.metric));
+        // On a tie the setting closer to the current config wins
+        if score > best_score + 1e-9
+            || (score > best_score - 1e-9 && changes(&e.point) < changes(&best.point))
+        {
+            best = e;
+        }
+    };
+
+    let grid: usize = dims.iter().map(|d| d.values.len()).product();
+    match args.strategy {
+        TuneStrategy::Grid => {
+            if grid > MAX_GRID {
+                return Err(AppError::Other(anyhow::anyhow!(
+                    "the grid has {grid} settings (limit {MAX_GRID}); use --strategy random"
+                )));
+            }
+            let mut index = vec![0usize; dims.len()];
+            loop {
+                let point: Vec<f32> = dims.iter().zip(&index).map(|(d, &i)| d.values[i]).collect();
+                if point != baseline {
+                    consider(evaluate(&point)?);
+                    tried += 1;
+                }
+                if !advance(&mut index, &dims) {
+                    break;
+                }
+            }
+        }
+        TuneStrategy::Random => {
+            let seed = args.seed.unwrap_or_else(|| {
+                SystemTime::now().duration_since(UNIX_EPOCH).map_or(0, |d| d.as_nanos() as u64)
+            });
+            for point in sample(&dims, &baseline, args.trials, &mut SplitMix(seed)) {
+                consider(evaluate(&point)?);
+                tried += 1;
+            }
+            println!("Seed: {seed}");
+        }
+    }
+
+    report(&args, &cases, &dims, &current, &best, tried);
+
+    let changed: Vec<(&Dimension, f32)> = dims
+        .iter()
+        .zip(&best.point)
+        .filter(|(d, v)| d.current != **v)
+        .map(|(d, v)| (d, *v))
+        .collect();
+    if changed.is_empty() {
+        println!("\nThe current settings are already the best found.");
+        return Ok(());
+    }
+    if args.dry_run {
+        println!("\n--dry-run: maharajah.toml not changed.");
+        return Ok(());
+    }
+    let path = target_dir.join("maharajah.toml");
+    write_settings(&path, &changed)?;
+    println!("\nWritten to {}.", path.display());
+    if changed.iter().any(|(d, _)| d.param == Param::ChunkLines) {
+        println!("Run `mh index --reindex` to rebuild the index with the new chunk size.");
+    }
+    Ok(())
+}
+
+fn read_golden(path: &Path) -> Result<Vec<GoldenCase>> {
+    let text = std::fs::read_to_string(path).map_err(|e| {
+        AppError::Other(anyhow::anyhow!("cannot read {}: {e}", path.display()))
+    })?;
+    let mut cases = Vec::new();
+    for (n, line) in text.lines().enumerate() {
+        if line.trim().is_empty() {
+            continue;
+        }
+        let invalid = |msg: String| {
+            AppError::Other(anyhow::anyhow!("{}:{}: {msg}", path.display(), n + 1))
+        };
+        let golden: GoldenLine =
+            serde_json::from_str(line).map_err(|e| invalid(e.to_string()))?;
+        if golden.expected.is_empty() {
+            return Err(invalid("`expected` is empty".into()));
+        }
+        let mode = match golden.mode.as_deref() {
+            None | Some("query") => SearchMode::Query,
+            Some("find") => SearchMode::Find,
+            Some(other) => return Err(invalid(format!("unknown mode '{other}'"))),
+        };
+        cases.push(GoldenCase {
+            query: golden.query,
+            expected: golden.expected.iter().map(|e| Expected::parse(e)).collect(),
+            mode,
+            intent: golden.intent,
+        });
+    }
+    if cases.is_empty() {
+        return Err(AppError::Other(anyhow::anyhow!("{} has no queries", path.display())));
+    }
+    Ok(cases)
+}
+
+/// Settings worth tuning for these queries: RRF only affects `query`, and
+/// `symbol_match` only applies once a SCIP index has been imported.
+fn dimensions(
+    config: &AppConfig,
+    cases: &[GoldenCase],
+    has_symbols: bool,
+    candidates: &HashMap<usize, Vec<Candidates>>,
+) -> Vec<Dimension> {
+    let mut dims = Vec::new();
+    if cases.iter().any(|c| matches!(c.mode, SearchMode::Query)) {
+        let r = &config.retrieval;
+        dims.push(Dimension::new(Param::RrfK, r.rrf_k, RRF_K));
+        dims.push(Dimension::new(Param::ContentWeight, r.content_weight, CONTENT_WEIGHTS));
+        dims.push(Dimension::new(Param::SummaryWeight, r.summary_weight, SUMMARY_WEIGHTS));
+    }
+    if has_symbols {
+        dims.push(Dimension::new(Param::SymbolMatch, config.ranking.symbol_match, SYMBOL_MATCH));
+    }
+    for (glob, &factor) in &config.ranking.paths {
+        let tried = if factor < 1.0 { PATH_PENALTIES } else { PATH_BOOSTS };
+        dims.push(Dimension::new(Param::PathBoost(glob.clone()), factor, tried));
+    }
+    if candidates.len() > 1 {
+        let mut lines: Vec<f32> = candidates.keys().map(|&l| l as f32).collect();
+        lines.sort_by(|a, b| a.total_cmp(b));
+        dims.push(Dimension {
+            param: Param::ChunkLines,
+            values: lines,
+            current: config.index.max_chunk_lines as f32,
+        });
+    }
+    dims
+}
+
+/// `config` with the settings of `point`.
+fn configure(config: &AppConfig, dims: &[Dimension], point: &[f32]) -> AppConfig {
+    let mut tuned = config.clone();
+    for (d, &v) in dims.iter().zip(point) {
+        match &d.param {
+            Param::RrfK => tuned.retrieval.rrf_k = v,
+            Param::ContentWeight => tuned.retrieval.content_weight = v,
+            Param::SummaryWeight => tuned.retrieval.summary_weight = v,
+            Param::SymbolMatch => tuned.ranking.symbol_match = v,
+            Param::PathBoost(glob) => {
+                tuned.ranking.paths.insert(glob.clone(), v);
+            }
+            Param::ChunkLines => tuned.index.max_chunk_lines = v as usize,
+        }
+    }
+    tuned
+}
+
+fn report(
+    args: &TuneArgs,
+    cases: &[GoldenCase],
+    dims: &[Dimension],
+    current: &Evaluation,
+    best: &Evaluation,
+    tried: usize,
+) {
+    let strategy = match args.strategy {
+        TuneStrategy::Grid => "grid",
+        TuneStrategy::Random => "random",
+    };
+    println!("\n{} golden queries, {tried} setting(s) tried ({strategy} search)\n", cases.len());
+    println!("{:<14} {:>8} {:>8} {:>8}", "metric", "current", "best", "delta");
+    let k = args.k;
+    for (name, metric) in [
+        (format!("MRR@{k}"), TuneMetric::Mrr),
+        (format!("Recall@{k}"), TuneMetric::Recall),
+        (format!("Hit@{k}"), TuneMetric::HitRate),
+    ] {
+        let (before, after) = (current.metrics.get(metric), best.metrics.get(metric));
+        let marker = if metric == args.metric { " *" } else { "" };
+        println!("{name:<14} {before:>8.3} {after:>8.3} {:>+8.3}{marker}", after - before);
+    }
+
+    let changed: Vec<String> = dims
+        .iter()
+        .zip(&best.point)
+        .filter(|(d, v)| d.current != **v)
+        .map(|(d, v)| format!("  {:<32} {} → {v}", d.param.key(), d.current))
+        .collect();
+    if !changed.is_empty() {
+        println!("\nChanged settings:");
+        for line in changed {
+            println!("{line}");
+        }
+    }
+
+    let rank = |r: Option<usize>| r.map_or("-".to_string(), |i| (i + 1).to_string());
+    let moved: Vec<String> = cases
+        .iter()
+        .zip(current.first_hits.iter().zip(&best.first_hits))
+        .filter(|(_, (a, b))| a != b)
+        .map(|(case, (&a, &b))| {
+            let better = b.is_some() && (a.is_none() || b < a);
+            let arrow = if better { "↑" } else { "↓" };
+            format!("  {arrow} {:<48} first hit {} → {}", case.query, rank(a), rank(b))
+        })
+        .collect();
+    if !moved.is_empty() {
+        println!("\nQueries whose first relevant hit moved:");
+        for line in moved {
+            println!("{line}");
+        }
+    }
+}
+
+/// Set the changed keys in the project config, keeping its comments and
+/// layout.
+fn write_settings(path: &Path, changed: &[(&Dimension, f32)]) -> Result<()> {
+    let text = if path.exists() {
+        std::fs::read_to_string(path).map_err(|e| AppError::Other(e.into()))?
+    } else {
+        String::new()
+    };
+    let mut doc: DocumentMut = text.parse().map_err(|e| {
+        AppError::Other(anyhow::anyhow!("cannot parse {}: {e}", path.display()))
+    })?;
+    for (d, v) in changed {
+        // Through the shortest decimal form, so 1.2 isn't written as 1.2000000476837158
+        let float = Value::from(v.to_string().parse::<f64>().unwrap_or(*v as f64));
+        match &d.param {
+            Param::RrfK => set(&mut doc, &["retrieval"], "rrf_k", float),
+            Param::ContentWeight => set(&mut doc, &["retrieval"], "content_weight", float),
+            Param::SummaryWeight => set(&mut doc, &["retrieval"], "summary_weight", float),
+            Param::SymbolMatch => set(&mut doc, &["ranking"], "symbol_match", float),
+            Param::PathBoost(glob) => set(&mut doc, &["ranking", "paths"], glob, float),
+            Param::ChunkLines => {
+                set(&mut doc, &["index"], "max_chunk_lines", Value::from(*v as i64))
+            }
+        }
+    }
+    std::fs::write(path, doc.to_string()).map_err(|e| AppError::Other(e.into()))
+}
+
+/// Set `key` in the nested `tables`, adding missing ones as `[table]`
+/// sections and keeping the comment after a replaced value.
+fn set(doc: &mut DocumentMut, tables: &[&str], key: &str, new: Value) {
+    let mut item = doc.as_item_mut();
+    for &name in tables {
+        if item.get(name).is_none() {
+            item[name] = if item.is_inline_table() {
+                Item::Value(Value::InlineTable(InlineTable::new()))
+            } else {
+                let mut table = Table::new();
+                table.set_implicit(true);
+                Item::Table(table)
+            };
+        }
+        item = &mut item[name];
+    }
+    let slot = &mut item[key];
+    match slot.as_value_mut() {
+        Some(old) => {
+            let decor = old.decor().clone();
+            *old = new;
+            *old.decor_mut() = decor;
+        }
+        None => *slot = Item::Value(new),
+    }
+}
+
+/// Move `index` to the next point of the grid, like an odometer; false once
+/// it has wrapped around to the first.
+fn advance(index: &mut [usize], dims: &[Dimension]) -> bool {
+    for (i, d) in index.iter_mut().zip(dims) {
+        *i += 1;
+        if *i < d.values.len() {
+            return true;
+        }
+        *i = 0;
+    }
+    false
+}
+
+/// `trials` distinct random points other than `baseline`, which is in the
+/// grid, or every other point when the grid has fewer.
+fn sample(
+    dims: &[Dimension],
+    baseline: &[f32],
+    trials: usize,
+    rng: &mut SplitMix,
+) -> Vec<Vec<f32>> {
+    let grid: usize = dims.iter().map(|d| d.values.len()).product();
+    let mut seen: HashSet<Vec<u32>> = HashSet::new();
+    seen.insert(baseline.iter().map(|v| v.to_bits()).collect());
+    let trials = trials.min(grid.saturating_sub(1));
+    let mut points = Vec::with_capacity(trials);
+    while points.len() < trials {
+        let point: Vec<f32> = dims.iter().map(|d| d.values[rng.below(d.values.len())]).collect();
+        if seen.insert(point.iter().map(|v| v.to_bits()).collect()) {
+            points.push(point);
+        }
+    }
+    points
+}
+
+/// splitmix64: enough randomness to sample a search space.
+struct SplitMix(u64);
+
+impl SplitMix {
+    fn below(&mut self, n: usize) -> usize {
+        self.0 = self.0.wrapping_add(0x9E37_79B9_7F4A_7C15);
+        let mut z = self.0;
+        z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+        z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+        ((z ^ (z >> 31)) % n as u64) as usize
+    }
+}
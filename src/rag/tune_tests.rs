@@ -0,0 +1,183 @@
+/// Tuning tests: golden expectations, enumerating and sampling the settings
+/// grid, and writing the winner back to maharajah.toml.
+
+#[cfg(test)]
+mod tune_tests {
+    use crate::db::store::SearchResult;
+    use crate::rag::tune::{Dimension, Expected, Param, SplitMix, advance, sample, write_settings};
+    use std::collections::HashSet;
+
+    fn result(file_path: &str, start_line: u32, end_line: u32, also_at: &[&str]) -> SearchResult {
+        SearchResult {
+            also_at: also_at.iter().map(|a| a.to_string()).collect(),
+            ..SearchResult::for_test(file_path, start_line, end_line, "")
+        }
+    }
+
+    /// Two values for `rrf_k` and three for `content_weight`, currently 60 and 1.
+    fn dims() -> Vec<Dimension> {
+        vec![
+            Dimension::new(Param::RrfK, 60.0, &[10.0]),
+            Dimension::new(Param::ContentWeight, 1.0, &[0.5, 2.0, 1.0]),
+        ]
+    }
+
+    fn baseline(dims: &[Dimension]) -> Vec<f32> {
+        dims.iter().map(|d| d.current).collect()
+    }
+
+    fn bits(point: &[f32]) -> Vec<u32> {
+        point.iter().map(|v| v.to_bits()).collect()
+    }
+
+    #[test]
+    fn expected_paths_take_an_optional_one_based_line() {
+        let e = Expected::parse(" ./src/db/store.rs:12 ");
+        assert_eq!((e.path.as_str(), e.line), ("src/db/store.rs", Some(11)));
+        let e = Expected::parse("src/db/store.rs");
+        assert_eq!((e.path.as_str(), e.line), ("src/db/store.rs", None));
+        // Neither line 0 nor a non-number is a line
+        let e = Expected::parse("src/db/store.rs:0");
+        assert_eq!((e.path.as_str(), e.line), ("src/db/store.rs:0", None));
+        let e = Expected::parse("C:src/lib.rs");
+        assert_eq!((e.path.as_str(), e.line), ("C:src/lib.rs", None));
+    }
+
+    #[test]
+    fn a_line_matches_only_the_chunk_containing_it() {
+        let e = Expected::parse("src/lib.rs:11");
+        assert!(e.matches(&result("src/lib.rs", 10, 20, &[])));
+        assert!(e.matches(&result("src/lib.rs", 0, 10, &[])));
+        assert!(!e.matches(&result("src/lib.rs", 11, 20, &[])));
+        assert!(!e.matches(&result("src/main.rs", 0, 20, &[])));
+        // Copies elsewhere don't count: the line belongs to one location
+        assert!(!e.matches(&result("src/main.rs", 0, 20, &["src/lib.rs:0"])));
+    }
+
+    #[test]
+    fn a_path_matches_any_chunk_of_the_file_or_its_copies() {
+        let e = Expected::parse("src/lib.rs");
+        assert!(e.matches(&result("src/lib.rs", 40, 50, &[])));
+        assert!(e.matches(&result("vendor/lib.rs", 0, 10, &["src/lib.rs:0"])));
+        assert!(!e.matches(&result("vendor/lib.rs", 0, 10, &["src/lib.rs.bak:0"])));
+    }
+
+    #[test]
+    fn dimensions_try_the_current_value_once_in_order() {
+        let d = Dimension::new(Param::ContentWeight, 1.0, &[2.0, 0.5, 1.0]);
+        assert_eq!(d.values, vec![0.5, 1.0, 2.0]);
+        assert_eq!(d.current, 1.0);
+    }
+
+    #[test]
+    fn the_odometer_visits_every_point_once() {
+        let dims = dims();
+        let mut index = vec![0usize; dims.len()];
+        let mut visited = vec![index.clone()];
+        while advance(&mut index, &dims) {
+            visited.push(index.clone());
+        }
+        assert_eq!(
+            visited,
+            vec![vec![0, 0], vec![1, 0], vec![0, 1], vec![1, 1], vec![0, 2], vec![1, 2]]
+        );
+        // and ends back at the first
+        assert_eq!(index, vec![0, 0]);
+    }
+
+    #[test]
+    fn a_grid_without_dimensions_is_one_point() {
+        assert!(!advance(&mut [], &[]));
+    }
+
+    #[test]
+    fn random_trials_are_distinct_and_skip_the_baseline() {
+        let dims = dims();
+        let baseline = baseline(&dims);
+        let points = sample(&dims, &baseline, 3, &mut SplitMix(7));
+        assert_eq!(points.len(), 3);
+        let distinct: HashSet<Vec<u32>> = points.iter().map(|p| bits(p)).collect();
+        assert_eq!(distinct.len(), 3);
+        assert!(!distinct.contains(&bits(&baseline)));
+        for point in &points {
+            assert!(dims.iter().zip(point).all(|(d, v)| d.values.contains(v)));
+        }
+    }
+
+    #[test]
+    fn random_trials_stop_once_the_grid_is_exhausted() {
+        let dims = dims();
+        let baseline = baseline(&dims);
+        // Six points, one of them the baseline
+        let points = sample(&dims, &baseline, 100, &mut SplitMix(7));
+        assert_eq!(points.len(), 5);
+        let single = vec![Dimension::new(Param::RrfK, 60.0, &[])];
+        assert!(sample(&single, &[60.0], 10, &mut SplitMix(7)).is_empty());
+    }
+
+    #[test]
+    fn the_same_seed_samples_the_same_points() {
+        let dims = dims();
+        let baseline = baseline(&dims);
+        assert_eq!(
+            sample(&dims, &baseline, 4, &mut SplitMix(42)),
+            sample(&dims, &baseline, 4, &mut SplitMix(42))
+        );
+    }
+
+    #[test]
+    fn settings_are_written_keeping_comments_and_other_keys() {
+        let path = std::env::temp_dir().join(format!("mh-tune-{}.toml", std::process::id()));
+        std::fs::write(
+            &path,
+            "# project settings\n[retrieval]\nrrf_k = 60.0 # default\nsummary_weight = 1.0\n\n\
+             [ranking.paths]\n\"tests/**\" = 0.5\n",
+        )
+        .unwrap();
+        let (rrf, paths, lines) = (
+            Dimension::new(Param::RrfK, 60.0, &[]),
+            Dimension::new(Param::PathBoost("tests/**".to_string()), 0.5, &[]),
+            Dimension::new(Param::ChunkLines, 60.0, &[]),
+        );
+        let weight = Dimension::new(Param::ContentWeight, 1.0, &[]);
+        write_settings(&path, &[(&rrf, 30.0), (&weight, 1.2), (&paths, 0.3), (&lines, 80.0)])
+            .unwrap();
+
+        let text = std::fs::read_to_string(&path).unwrap();
+        std::fs::remove_file(&path).unwrap();
+        assert!(text.starts_with("# project settings\n[retrieval]\n"));
+        assert!(text.contains("rrf_k = 30.0 # default\n"));
+        assert!(text.contains("summary_weight = 1.0\n"));
+        // Floats in their shortest form, chunk lines as an integer
+        assert!(text.contains("content_weight = 1.2\n"));
+        assert!(text.contains("\"tests/**\" = 0.3\n"));
+        assert!(text.contains("[index]\nmax_chunk_lines = 80\n"));
+    }
+
+    #[test]
+    fn settings_go_inside_an_existing_inline_table() {
+        let path = std::env::temp_dir().join(format!("mh-tune-inl-{}.toml", std::process::id()));
+        std::fs::write(&path, "ranking = { symbol_match = 1.5 }\n").unwrap();
+        let boost = Dimension::new(Param::PathBoost("src/**".to_string()), 1.0, &[]);
+        write_settings(&path, &[(&boost, 1.2)]).unwrap();
+
+        let text = std::fs::read_to_string(&path).unwrap();
+        std::fs::remove_file(&path).unwrap();
+        let doc: toml_edit::DocumentMut = text.parse().unwrap();
+        assert_eq!(doc["ranking"]["symbol_match"].as_float(), Some(1.5));
+        assert_eq!(doc["ranking"]["paths"]["src/**"].as_float(), Some(1.2));
+        assert_eq!(text.lines().count(), 1);
+    }
+
+    #[test]
+    fn settings_create_the_file_when_missing() {
+        let path = std::env::temp_dir().join(format!("mh-tune-new-{}.toml", std::process::id()));
+        let _ = std::fs::remove_file(&path);
+        let k = Dimension::new(Param::RrfK, 60.0, &[]);
+        write_settings(&path, &[(&k, 10.0)]).unwrap();
+
+        let text = std::fs::read_to_string(&path).unwrap();
+        std::fs::remove_file(&path).unwrap();
+        assert_eq!(text, "[retrieval]\nrrf_k = 10.0\n");
+    }
+}
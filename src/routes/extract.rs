@@ -0,0 +1,461 @@
+use std::path::Path;
+
+use tree_sitter::{Node, Parser, Query, QueryCursor, QueryMatch, StreamingIterator};
+
+use crate::indexer::parser::grammar_for;
+
+#[cfg(test)]
+#[path = "extract_tests.rs"]
+mod extract_tests;
+
+/// An HTTP route registration found in a source file.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Route {
+    pub framework: &'static str,
+    /// Upper-case HTTP method, or "ANY"
+    pub method: String,
+    pub path: String,
+    /// Handler expression as written; empty for inline closures and lambdas
+    pub handler: String,
+    /// 0-based line of the registration
+    pub line: u32,
+}
+
+/// A tree-sitter query recognising one framework's route registrations.
+/// Supporting another framework means adding an entry to [`EXTRACTORS`].
+///
+/// Captures understood by [`extract_routes`]:
+/// - `@route`   — the registration; its start line is reported (required).
+///   For builder chains this is the method name, not the whole chain
+/// - `@path`    — string literal holding the path
+/// - `@method`  — name of the registering function or annotation: `get`,
+///   `GetMapping`, `HttpPost`, `MapGet`, ... A name that isn't an HTTP method
+///   (`route`, `RequestMapping`, `HandleFunc`) means any method
+/// - `@methods` — searched for upper-case method names when `@method` doesn't
+///   name one (Flask `methods=["POST"]`, Spring `method = RequestMethod.POST`),
+///   and for the path when there is no `@path`
+/// - `@handler` — the handler expression
+/// - `@prefix` with `@scope` — a path prefix for every route inside `@scope`
+///   (class-level `@RequestMapping`, `[Route]`); `@scope_name` names the class
+struct Extractor {
+    framework: &'static str,
+    languages: &'static [&'static str],
+    query: &'static str,
+}
+
+const EXTRACTORS: &[Extractor] = &[
+    Extractor {
+        framework: "actix-web",
+        languages: &["rust"],
+        query: r#"
+            ; App::new().route("/find", web::post().to(handlers::find))
+            (call_expression
+              function: (field_expression field: (field_identifier) @route)
+              arguments: (arguments
+                .
+                (string_literal) @path
+                .
+                (call_expression
+                  function: (field_expression
+                    value: (call_expression
+                      function: [
+                        (scoped_identifier name: (identifier) @method)
+                        (identifier) @method
+                      ])
+                    field: (field_identifier) @_to)
+                  arguments: (arguments . (_) @handler)))
+              (#eq? @route "route")
+              (#eq? @_to "to"))
+
+            ; #[post("/find")] async fn find(...)
+            (_
+              (attribute_item
+                (attribute
+                  (identifier) @method
+                  arguments: (token_tree . (string_literal) @path) @methods)) @route
+              .
+              (function_item name: (identifier) @handler)
+              (#match? @method "^(get|post|put|delete|patch|head|options|trace|route)$"))
+        "#,
+    },
+    Extractor {
+        framework: "axum",
+        languages: &["rust"],
+        query: r#"
+            ; Router::new().route("/find", post(find))
+            (call_expression
+              function: (field_expression field: (field_identifier) @route)
+              arguments: (arguments
+                .
+                (string_literal) @path
+                .
+                (call_expression
+                  function: [
+                    (identifier) @method
+                    (scoped_identifier name: (identifier) @method)
+                  ]
+                  arguments: (arguments . (_) @handler)))
+              (#eq? @route "route")
+              (#match? @method "^(get|post|put|delete|patch|head|options|trace|any)$"))
+        "#,
+    },
+    Extractor {
+        framework: "express",
+        languages: &["javascript", "typescript", "tsx"],
+        query: r#"
+            ; app.post("/find", auth, find)
+            (call_expression
+              function: (member_expression
+                object: (identifier) @_app
+                property: (property_identifier) @method)
+              arguments: (arguments
+                .
+                [(string) (template_string)] @path
+                (_) @handler
+                .)
+              (#match? @_app "^(app|api|server|router|[A-Za-z]*Router)$")
+              (#match? @method "^(get|post|put|delete|patch|head|options|all)$")) @route
+        "#,
+    },
+    Extractor {
+        framework: "flask",
+        languages: &["python"],
+        query: r#"
+            ; @app.route("/find", methods=["POST"])
+            (decorated_definition
+              (decorator
+                (call
+                  function: (attribute attribute: (identifier) @method)
+                  arguments: (argument_list . (string) @path) @methods))
+              definition: (function_definition name: (identifier) @handler)
+              (#eq? @method "route")) @route
+        "#,
+    },
+    Extractor {
+        framework: "fastapi",
+        languages: &["python"],
+        query: r#"
+            ; @router.post("/find")
+            (decorated_definition
+              (decorator
+                (call
+                  function: (attribute attribute: (identifier) @method)
+                  arguments: (argument_list . (string) @path) @methods))
+              definition: (function_definition name: (identifier) @handler)
+              (#match? @method "^(get|post|put|delete|patch|head|options|trace|api_route)$")) @route
+        "#,
+    },
+    Extractor {
+        framework: "spring",
+        languages: &["java"],
+        query: r#"
+            ; @PostMapping("/find") / @RequestMapping(value = "/find", method = RequestMethod.POST)
+            (method_declaration
+              (modifiers
+                (annotation
+                  name: (identifier) @method
+                  arguments: (annotation_argument_list) @methods))
+              name: (identifier) @handler
+              (#match? @method "^(Get|Post|Put|Delete|Patch|Request)Mapping$")) @route
+
+            (method_declaration
+              (modifiers (marker_annotation name: (identifier) @method))
+              name: (identifier) @handler
+              (#match? @method "^(Get|Post|Put|Delete|Patch|Request)Mapping$")) @route
+
+            ; @RequestMapping("/api") on the controller class
+            (class_declaration
+              (modifiers
+                (annotation
+                  name: (identifier) @_mapping
+                  arguments: (annotation_argument_list) @prefix))
+              name: (identifier) @scope_name
+              (#eq? @_mapping "RequestMapping")) @scope
+        "#,
+    },
+    Extractor {
+        framework: "aspnet",
+        languages: &["csharp"],
+        query: r#"
+            ; [HttpPost("find")] public IActionResult Find(...)
+            (method_declaration
+              (attribute_list
+                (attribute
+                  name: (identifier) @method
+                  (attribute_argument_list)? @methods))
+              name: (identifier) @handler
+              (#match? @method "^(Http(Get|Post|Put|Delete|Patch|Head|Options)|Route)$")) @route
+
+            ; [Route("api/[controller]")] on the controller class
+            (class_declaration
+              (attribute_list
+                (attribute
+                  name: (identifier) @_route
+                  (attribute_argument_list) @prefix))
+              name: (identifier) @scope_name
+              (#eq? @_route "Route")) @scope
+
+            ; app.MapPost("/find", handler)
+            (invocation_expression
+              function: (member_access_expression name: (identifier) @method)
+              arguments: (argument_list
+                .
+                (argument (string_literal) @path)
+                (argument (_) @handler)
+                .)
+              (#match? @method "^Map(Get|Post|Put|Delete|Patch)$")) @route
+        "#,
+    },
+    Extractor {
+        framework: "net/http",
+        languages: &["go"],
+        query: r#"
+            ; mux.HandleFunc("POST /find", find)
+            (call_expression
+              function: (selector_expression field: (field_identifier) @method)
+              arguments: (argument_list
+                .
+                [(interpreted_string_literal) (raw_string_literal)] @path
+                .
+                (_) @handler)
+              (#match? @method "^Handle(Func)?$")) @route
+        "#,
+    },
+];
+
+const HTTP_METHODS: &[&str] = &["GET", "POST", "PUT", "DELETE", "PATCH", "HEAD", "OPTIONS", "TRACE"];
+
+/// Extract the route registrations in a file, in source order. Returns an
+/// empty list for languages without an extractor or unparseable files.
+#[tracing::instrument(skip_all, fields(path = %path.display()))]
+pub fn extract_routes(path: &Path, content: &str) -> Vec<Route> {
+    let Some((language, lang_name, _)) = grammar_for(path) else {
+        return vec![];
+    };
+    let extractors: Vec<&Extractor> =
+        EXTRACTORS.iter().filter(|e| e.languages.contains(&lang_name)).collect();
+    if extractors.is_empty() {
+        return vec![];
+    }
+
+    let mut parser = Parser::new();
+    if parser.set_language(&language).is_err() {
+        return vec![];
+    }
+    let Some(tree) = parser.parse(content, None) else {
+        return vec![];
+    };
+
+    let mut routes = Vec::new();
+    for extractor in extractors {
+        // Queries are tied to grammar versions; a grammar update that renames
+        // a node disables that extractor rather than failing the index run
+        let query = match Query::new(&language, extractor.query) {
+            Ok(q) => q,
+            Err(e) => {
+                tracing::warn!("route extractor {} is invalid: {e}", extractor.framework);
+                continue;
+            }
+        };
+        routes.extend(run_extractor(extractor, &query, tree.root_node(), content));
+    }
+
+    routes.sort_by(|a, b| (a.line, &a.path, &a.method).cmp(&(b.line, &b.path, &b.method)));
+    routes.dedup();
+    routes
+}
+
+fn run_extractor(extractor: &Extractor, query: &Query, root: Node, content: &str) -> Vec<Route> {
+    let text = |node: Node| content[node.byte_range()].to_string();
+
+    // (byte offset, route) pairs, so prefixes can be applied by position
+    let mut found: Vec<(usize, Route)> = Vec::new();
+    // (byte range, prefix) of scopes such as controller classes
+    let mut scopes: Vec<(std::ops::Range<usize>, String)> = Vec::new();
+
+    let mut cursor = QueryCursor::new();
+    let mut matches = cursor.matches(query, root, content.as_bytes());
+    while let Some(m) = matches.next() {
+        let prefix = capture(query, m, "prefix");
+        if let (Some(prefix), Some(scope)) = (prefix, capture(query, m, "scope")) {
+            let mut prefix = path_in(prefix, content).unwrap_or_default();
+            // ASP.NET substitutes the controller name for `[controller]`
+            if let Some(name) = capture(query, m, "scope_name") {
+                let name = text(name);
+                prefix = prefix.replace("[controller]", name.trim_end_matches("Controller"));
+            }
+            scopes.push((scope.byte_range(), prefix));
+            continue;
+        }
+        let Some(route) = capture(query, m, "route") else {
+            continue;
+        };
+
+        let methods_node = capture(query, m, "methods");
+        let mut path = match capture(query, m, "path") {
+            Some(node) => unquote(&text(node)),
+            None => methods_node.and_then(|n| path_in(n, content)).unwrap_or_default(),
+        };
+
+        let mut methods: Vec<String> = Vec::new();
+        // Go 1.22 patterns carry the method: "POST /find"
+        if let Some((method, rest)) = path.split_once(' ') {
+            if HTTP_METHODS.contains(&method) {
+                methods.push(method.to_string());
+                path = rest.trim().to_string();
+            }
+        }
+        if methods.is_empty() {
+            let method = capture(query, m, "method").and_then(|n| normalize_method(&text(n)));
+            if let Some(method) = method {
+                methods.push(method.to_string());
+            }
+        }
+        if methods.is_empty() {
+            if let Some(node) = methods_node {
+                methods = text(node)
+                    .split(|c: char| !c.is_ascii_alphabetic())
+                    .filter(|w| HTTP_METHODS.contains(w))
+                    .map(str::to_string)
+                    .collect();
+                methods.dedup();
+            }
+        }
+        if methods.is_empty() {
+            methods.push("ANY".to_string());
+        }
+
+        let handler = capture(query, m, "handler")
+            .filter(|n| !is_function_literal(n.kind()))
+            .map(|n| text(n).split_whitespace().collect::<Vec<_>>().join(" "))
+            .unwrap_or_default();
+
+        for method in methods {
+            found.push((
+                route.start_byte(),
+                Route {
+                    framework: extractor.framework,
+                    method,
+                    path: path.clone(),
+                    handler: handler.clone(),
+                    line: route.start_position().row as u32,
+                },
+            ));
+        }
+    }
+
+    found
+        .into_iter()
+        .map(|(offset, mut route)| {
+            let innermost = scopes
+                .iter()
+                .filter(|(range, _)| range.contains(&offset))
+                .min_by_key(|(range, _)| range.len());
+            if let Some((_, prefix)) = innermost {
+                route.path = join_path(prefix, &route.path);
+            }
+            if route.path.is_empty() {
+                route.path = "/".to_string();
+            }
+            route
+        })
+        .collect()
+}
+
+/// The first node captured as `name` in a match.
+pub(crate) fn capture<'a>(query: &Query, m: &QueryMatch<'_, 'a>, name: &str) -> Option<Node<'a>> {
+    let index = query.capture_index_for_name(name)?;
+    m.nodes_for_capture_index(index).next()
+}
+
+/// `GetMapping` → GET, `HttpPost` → POST, `MapPut` → PUT, `delete` → DELETE;
+/// `None` for names that don't imply a method.
+fn normalize_method(name: &str) -> Option<&'static str> {
+    let name = name
+        .strip_prefix("Http")
+        .or_else(|| name.strip_prefix("Map"))
+        .unwrap_or(name);
+    let name = name.strip_suffix("Mapping").unwrap_or(name);
+    HTTP_METHODS.iter().find(|m| m.eq_ignore_ascii_case(name)).copied()
+}
+
+fn is_function_literal(kind: &str) -> bool {
+    matches!(
+        kind,
+        "closure_expression"
+            | "arrow_function"
+            | "function_expression"
+            | "function"
+            | "lambda"
+            | "lambda_expression"
+            | "anonymous_method_expression"
+            | "func_literal"
+    )
+}
+
+fn is_string(kind: &str) -> bool {
+    matches!(
+        kind,
+        "string_literal"
+            | "string"
+            | "template_string"
+            | "verbatim_string_literal"
+            | "interpreted_string_literal"
+            | "raw_string_literal"
+    )
+}
+
+/// The path in an argument list: the first positional string, or the
+/// `value`/`path` element of a Java annotation (taking the first of an array).
+fn path_in(node: Node, content: &str) -> Option<String> {
+    if is_string(node.kind()) {
+        return Some(unquote(&content[node.byte_range()]));
+    }
+    let mut cursor = node.walk();
+    for child in node.named_children(&mut cursor) {
+        let found = match child.kind() {
+            "element_value_pair" => {
+                let key = child.child_by_field_name("key").map(|k| &content[k.byte_range()]);
+                match key {
+                    Some("value" | "path") => child
+                        .child_by_field_name("value")
+                        .and_then(|v| path_in(v, content)),
+                    _ => None,
+                }
+            }
+            // C# positional arguments only; `Name = "..."` has two children
+            "attribute_argument" if child.named_child_count() == 1 => path_in(child, content),
+            "element_value_array_initializer" => path_in(child, content),
+            kind if is_string(kind) => path_in(child, content),
+            _ => None,
+        };
+        if found.is_some() {
+            return found;
+        }
+    }
+    None
+}
+
+/// Strip quotes and string prefixes: `"a"`, `'a'`, `` `a` ``, `r#"a"#`, `@"a"`, `f"a"`.
+/// Text that isn't a quoted literal is returned unchanged.
+pub(crate) fn unquote(literal: &str) -> String {
+    let body = literal
+        .trim_start_matches(|c: char| c.is_ascii_alphabetic() || matches!(c, '@' | '$' | '#'))
+        .trim_end_matches('#');
+    for quote in ["\"\"\"", "'''", "\"", "'", "`"] {
+        if let Some(inner) = body.strip_prefix(quote).and_then(|s| s.strip_suffix(quote)) {
+            return inner.to_string();
+        }
+    }
+    literal.to_string()
+}
+
+fn join_path(prefix: &str, path: &str) -> String {
+    let prefix = prefix.trim_end_matches('/');
+    let joined = if path.is_empty() {
+        prefix.to_string()
+    } else {
+        format!("{prefix}/{}", path.trim_start_matches('/'))
+    };
+    if joined.starts_with('/') { joined } else { format!("/{joined}") }
+}
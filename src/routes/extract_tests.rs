@@ -0,0 +1,163 @@
+/// Route extractor tests: each supported framework's registration style yields
+/// the expected (method, path, handler) triples.
+
+#[cfg(test)]
+mod extract_tests {
+    use crate::routes::extract::extract_routes;
+    use std::path::Path;
+
+    fn routes(file: &str, content: &str) -> Vec<(String, String, String)> {
+        extract_routes(Path::new(file), content)
+            .into_iter()
+            .map(|r| (r.method, r.path, r.handler))
+            .collect()
+    }
+
+    fn route(method: &str, path: &str, handler: &str) -> (String, String, String) {
+        (method.to_string(), path.to_string(), handler.to_string())
+    }
+
+    #[test]
+    fn actix_route_builders_and_attributes() {
+        let content = r#"
+fn app() {
+    App::new()
+        .route("/find", web::post().to(handlers::find_handler))
+        .route("/health", web::get().to(|| async { "ok" }));
+}
+
+#[get("/files/{path}")]
+async fn file_chunks(path: web::Path<String>) -> HttpResponse {
+    HttpResponse::Ok().finish()
+}
+"#;
+        let found = extract_routes(Path::new("server.rs"), content);
+        assert!(found.iter().all(|r| r.framework == "actix-web"), "{found:?}");
+        assert_eq!(
+            routes("server.rs", content),
+            vec![
+                route("POST", "/find", "handlers::find_handler"),
+                route("GET", "/health", ""),
+                route("GET", "/files/{path}", "file_chunks"),
+            ]
+        );
+        assert_eq!(found[0].line, 3);
+    }
+
+    #[test]
+    fn axum_method_routers() {
+        let content = r#"
+fn app() -> Router {
+    Router::new().route("/users/:id", get(show_user))
+}
+"#;
+        assert_eq!(routes("app.rs", content), vec![route("GET", "/users/:id", "show_user")]);
+    }
+
+    #[test]
+    fn express_registrations_keep_the_last_argument_as_handler() {
+        let content = r#"
+const router = express.Router();
+app.post('/login', rateLimit, auth.login);
+router.get(`/items/:id`, (req, res) => res.json({}));
+axios.get('/not/a/route', config);
+"#;
+        assert_eq!(
+            routes("server.js", content),
+            vec![route("POST", "/login", "auth.login"), route("GET", "/items/:id", "")]
+        );
+    }
+
+    #[test]
+    fn flask_methods_and_fastapi_verbs() {
+        let content = r#"
+@app.route("/submit", methods=["GET", "POST"])
+def submit():
+    pass
+
+@router.delete("/items/{item_id}")
+async def delete_item(item_id: int):
+    pass
+"#;
+        assert_eq!(
+            routes("app.py", content),
+            vec![
+                route("GET", "/submit", "submit"),
+                route("POST", "/submit", "submit"),
+                route("DELETE", "/items/{item_id}", "delete_item"),
+            ]
+        );
+    }
+
+    #[test]
+    fn spring_mappings_include_the_class_prefix() {
+        let content = r#"
+@RestController
+@RequestMapping("/api/users")
+public class UserController {
+    @GetMapping("/{id}")
+    public User show(@PathVariable long id) { return null; }
+
+    @RequestMapping(value = "/search", method = RequestMethod.POST)
+    public List<User> search(@RequestBody Query q) { return null; }
+}
+"#;
+        assert_eq!(
+            routes("UserController.java", content),
+            vec![
+                route("GET", "/api/users/{id}", "show"),
+                route("POST", "/api/users/search", "search"),
+            ]
+        );
+    }
+
+    #[test]
+    fn aspnet_attribute_routes_and_minimal_apis() {
+        let content = r#"
+[ApiController]
+[Route("api/[controller]")]
+public class OrdersController : ControllerBase
+{
+    [HttpGet("{id}")]
+    public IActionResult Get(int id) => Ok();
+}
+
+public static class Endpoints
+{
+    public static void Map(WebApplication app)
+    {
+        app.MapPost("/orders", CreateOrder);
+    }
+}
+"#;
+        assert_eq!(
+            routes("OrdersController.cs", content),
+            vec![
+                route("GET", "/api/Orders/{id}", "Get"),
+                route("POST", "/orders", "CreateOrder"),
+            ]
+        );
+    }
+
+    #[test]
+    fn go_net_http_patterns_with_methods() {
+        let content = r#"
+package main
+
+func main() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /items/{id}", updateItem)
+	http.Handle("/static/", fileServer)
+}
+"#;
+        assert_eq!(
+            routes("main.go", content),
+            vec![route("POST", "/items/{id}", "updateItem"), route("ANY", "/static/", "fileServer")]
+        );
+    }
+
+    #[test]
+    fn languages_without_extractors_yield_nothing() {
+        assert!(extract_routes(Path::new("Main.hs"), "main = pure ()").is_empty());
+    }
+}
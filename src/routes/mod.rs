@@ -0,0 +1,183 @@
+pub mod extract;
+
+use std::collections::HashMap;
+use std::path::Path;
+
+use serde::Serialize;
+
+use crate::cli::{OutputFormat, RoutesArgs};
+use crate::config::AppConfig;
+use crate::db::overlay;
+use crate::db::routes::RouteRecord;
+use crate::db::store::{LocationRecord, Store};
+use crate::error::{AppError, Result};
+
+#[derive(Serialize)]
+struct JsonRoute<'a> {
+    method: &'a str,
+    path: &'a str,
+    framework: &'a str,
+    file_path: &'a str,
+    line: u32,
+    handler: &'a str,
+    /// Chunk defining the handler (for inline handlers, the chunk containing the route)
+    handler_location: Option<JsonLocation<'a>>,
+}
+
+#[derive(Serialize)]
+struct JsonLocation<'a> {
+    file_path: &'a str,
+    start_line: u32,
+    end_line: u32,
+    symbol: &'a str,
+}
+
+/// List the indexed route registrations, optionally only those serving `--path`.
+pub async fn routes_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: RoutesArgs,
+) -> Result<()> {
+    let overlay = overlay::current(target_dir);
+    let Some(store) =
+        Store::try_open(db_path, config.db.embedding_dim, &config.db.table_name, &overlay).await?
+    else {
+        println!("No index found. Run `index` first.");
+        return Ok(());
+    };
+
+    let mut routes = store.routes().all().await?;
+    if let Some(wanted) = &args.path {
+        routes.retain(|r| path_matches(&r.path, wanted));
+    }
+    routes.sort_by(|a, b| {
+        (&a.path, &a.method, &a.file_path, a.line).cmp(&(&b.path, &b.method, &b.file_path, b.line))
+    });
+    let handlers = handler_locations(&store, &routes).await?;
+
+    match args.format {
+        OutputFormat::Text => {
+            if routes.is_empty() {
+                println!("No routes found.");
+            }
+            for (r, handler) in routes.iter().zip(&handlers) {
+                println!(
+                    "{:<7} {}  {}:{}  [{}]",
+                    r.method,
+                    r.path,
+                    r.file_path,
+                    r.line + 1,
+                    r.framework
+                );
+                let name = if r.handler.is_empty() { "<inline>" } else { r.handler.as_str() };
+                match handler {
+                    Some(l) => println!(
+                        "        -> {name}  {}:{}-{}",
+                        l.file_path,
+                        l.start_line + 1,
+                        l.end_line + 1
+                    ),
+                    None => println!("        -> {name}"),
+                }
+            }
+        }
+        OutputFormat::Json => {
+            let json: Vec<JsonRoute> = routes
+                .iter()
+                .zip(&handlers)
+                .map(|(r, handler)| JsonRoute {
+                    method: &r.method,
+                    path: &r.path,
+                    framework: &r.framework,
+                    file_path: &r.file_path,
+                    line: r.line,
+                    handler: &r.handler,
+                    handler_location: handler.as_ref().map(|l| JsonLocation {
+                        file_path: &l.file_path,
+                        start_line: l.start_line,
+                        end_line: l.end_line,
+                        symbol: &l.symbol,
+                    }),
+                })
+                .collect();
+            println!(
+                "{}",
+                serde_json::to_string_pretty(&json).map_err(|e| AppError::Other(e.into()))?
+            );
+        }
+    }
+    Ok(())
+}
+
+/// The chunk each route's handler lives in: the chunk whose symbol is the
+/// handler's last path segment (preferring the route's own file), or for
+/// inline handlers the innermost chunk containing the registration.
+async fn handler_locations(
+    store: &Store,
+    routes: &[RouteRecord],
+) -> Result<Vec<Option<LocationRecord>>> {
+    let mut names: Vec<String> = routes
+        .iter()
+        .map(|r| handler_name(&r.handler).to_string())
+        .filter(|n| !n.is_empty())
+        .collect();
+    names.sort();
+    names.dedup();
+    let mut by_symbol: HashMap<String, Vec<LocationRecord>> = HashMap::new();
+    for l in store.symbol_locations(&names).await? {
+        by_symbol.entry(l.symbol.clone()).or_default().push(l);
+    }
+
+    let mut by_file: HashMap<String, Vec<LocationRecord>> = HashMap::new();
+    let mut found = Vec::with_capacity(routes.len());
+    for r in routes {
+        let name = handler_name(&r.handler);
+        let location = if name.is_empty() {
+            if !by_file.contains_key(&r.file_path) {
+                let locations = store.file_locations(&r.file_path).await?;
+                by_file.insert(r.file_path.clone(), locations);
+            }
+            by_file[&r.file_path]
+                .iter()
+                .filter(|l| l.start_line <= r.line && r.line <= l.end_line)
+                .min_by_key(|l| l.end_line - l.start_line)
+        } else {
+            by_symbol.get(name).and_then(|candidates| {
+                candidates
+                    .iter()
+                    .find(|l| l.file_path == r.file_path)
+                    .or(candidates.first())
+            })
+        };
+        found.push(location.cloned());
+    }
+    Ok(found)
+}
+
+/// `handlers::find_handler` → `find_handler`, `auth.login` → `login`.
+fn handler_name(handler: &str) -> &str {
+    handler.rsplit(|c| matches!(c, ':' | '.')).next().unwrap_or("").trim()
+}
+
+/// Whether a request path is served by a route pattern. Parameter segments
+/// (`{id}`, `:id`, `<int:id>`) match any one segment; catch-alls (`*`,
+/// `{*rest}`, `{rest...}`) match the remainder.
+fn path_matches(pattern: &str, path: &str) -> bool {
+    let pattern: Vec<&str> = pattern.split('/').filter(|s| !s.is_empty()).collect();
+    let path: Vec<&str> = path.split('/').filter(|s| !s.is_empty()).collect();
+    for (i, p) in pattern.iter().enumerate() {
+        let catch_all = p.starts_with('*') || p.starts_with("{*") || p.ends_with("...}");
+        if catch_all {
+            return true;
+        }
+        let Some(segment) = path.get(i) else {
+            return false;
+        };
+        let parameter = p.starts_with(':') || p.starts_with('{') || p.starts_with('<');
+        if !parameter && p != segment {
+            return false;
+        }
+    }
+    pattern.len() == path.len()
+}
@@ -1,13 +1,19 @@
 use anyhow::Result;
 use tokio::sync::{mpsc, oneshot};
 
-use crate::embed::nomic::NomicEmbedder;
+use crate::embed::nomic::{EmbedMode, Embedding, NomicEmbedder};
 
-pub type EmbedRequest = (String, oneshot::Sender<Result<Vec<f32>>>);
+/// Work for the embedder actor. Each request's texts are embedded together,
+/// in forward passes of texts of similar length.
+pub enum EmbedRequest {
+    /// Search prompts, instruction template already applied
+    Prompts(Vec<String>, oneshot::Sender<Result<Vec<Vec<f32>>>>),
+    /// Texts embedded as code or as queries, with their token counts
+    Texts(Vec<String>, EmbedMode, oneshot::Sender<Result<Vec<Embedding>>>),
+}
 
 /// Spawn a dedicated OS thread that owns the `NomicEmbedder`.
-/// Returns a sender that callers use to embed queries.
-/// Each request is `(query_string, oneshot::Sender<Result<Vec<f32>>>)`.
+/// Returns a sender that callers use to embed queries and texts.
 pub fn spawn_embedder_actor() -> mpsc::Sender<EmbedRequest> {
     let (tx, mut rx) = mpsc::channel::<EmbedRequest>(32);
 
@@ -27,9 +33,15 @@ pub fn spawn_embedder_actor() -> mpsc::Sender<EmbedRequest> {
             .expect("embedder actor runtime");
 
         rt.block_on(async move {
-            while let Some((query, reply_tx)) = rx.recv().await {
-                let result = embedder.embed_query(&query);
-                let _ = reply_tx.send(result);
+            while let Some(request) = rx.recv().await {
+                match request {
+                    EmbedRequest::Prompts(prompts, reply_tx) => {
+                        let _ = reply_tx.send(embedder.embed_prompts(&prompts));
+                    }
+                    EmbedRequest::Texts(texts, mode, reply_tx) => {
+                        let _ = reply_tx.send(embedder.embed_texts(&texts, mode));
+                    }
+                }
             }
         });
     });
@@ -1,9 +1,53 @@
+use std::collections::BTreeMap;
+use std::sync::Arc;
+
 use actix_web::{HttpResponse, Responder, web};
+use serde_json::{Value, json};
 use tokio::sync::oneshot;
 
-use crate::db::store::Store;
-use crate::rag::retriever::rrf_merge;
+use crate::db::coverage::ChunkCoverage;
+use crate::db::profile::ChunkHotness;
+use crate::db::overlay;
+use crate::db::store::{LocationRecord, SearchResult, Store};
+use crate::embed::nomic::{self, EmbedMode};
+use crate::error::AppError;
+use crate::outline::{self, JsonDefinition};
+use crate::rag::highlight;
+use crate::rag::refine::{self, RefineMode};
+use crate::rag::retriever::{self, SearchMode, SearchOptions, SearchPlan};
 use crate::server::AppState;
+use crate::server::embedder_actor::EmbedRequest;
+
+#[cfg(test)]
+#[path = "handlers_tests.rs"]
+mod handlers_tests;
+
+/// Response header carrying the id to pass to `/refine` for a result set.
+const RESULT_ID_HEADER: &str = "X-Result-Id";
+
+/// Most queries accepted by one `/batch` request.
+const MAX_BATCH_QUERIES: usize = 100;
+
+/// Most texts accepted by one `/embed` request; they are embedded together.
+const MAX_EMBED_TEXTS: usize = 64;
+
+/// Result fields that `fields` may select.
+const RESULT_FIELDS: &[&str] = &[
+    "id",
+    "file_path",
+    "language",
+    "start_line",
+    "end_line",
+    "symbol",
+    "content",
+    "score",
+    "summary",
+    "also_at",
+    "qualified_symbol",
+    "coverage",
+    "hotness",
+    "highlight_lines",
+];
 
 #[derive(serde::Deserialize)]
 pub struct SearchRequest {
@@ -11,80 +55,509 @@ pub struct SearchRequest {
     #[serde(default = "default_limit")]
     pub limit: usize,
     pub min_score: Option<f32>,
+    /// Named intent from `[search.intents]`
+    pub intent: Option<String>,
+    /// Path globs; override the intent's defaults when non-empty
+    #[serde(default)]
+    pub paths: Vec<String>,
+    /// Languages; override the intent's defaults when non-empty
+    #[serde(default)]
+    pub languages: Vec<String>,
+    /// Path-glob score multipliers layered over `[ranking.paths]`
+    #[serde(default)]
+    pub boosts: BTreeMap<String, f32>,
+    /// Ignore `[ranking.paths]` for this request
+    #[serde(default)]
+    pub no_boosts: bool,
+    /// Boost results in recently changed files
+    #[serde(default)]
+    pub boost_recent: bool,
+    /// Only return chunks reading this environment variable or config key
+    /// (`*`: any environment variable)
+    pub uses_env: Option<String>,
+    /// Only return chunks the imported coverage report shows no test executing
+    #[serde(default)]
+    pub uncovered: bool,
+    /// Only return chunks on at least this percentage of the imported
+    /// profile's samples
+    pub hot: Option<f32>,
+    /// Boost results by their share of the imported profile's samples
+    #[serde(default)]
+    pub boost_hot: bool,
+    /// Result fields to return; all when absent
+    pub fields: Option<Vec<String>>,
+    /// Trim each result's content to its first lines
+    pub max_content_lines: Option<usize>,
+}
+
+impl SearchRequest {
+    fn options(&self) -> SearchOptions {
+        SearchOptions {
+            intent: self.intent.clone(),
+            paths: self.paths.clone(),
+            languages: self.languages.clone(),
+            boosts: self.boosts.clone(),
+            no_boosts: self.no_boosts,
+            boost_recent: self.boost_recent,
+            uses_env: self.uses_env.clone(),
+            uncovered: self.uncovered,
+            hot: self.hot,
+            boost_hot: self.boost_hot,
+        }
+    }
+
+    /// Reject `fields` naming anything but a result field.
+    fn check_fields(&self) -> Result<(), String> {
+        match self.fields.iter().flatten().find(|f| !RESULT_FIELDS.contains(&f.as_str())) {
+            Some(unknown) => Err(format!(
+                "Unknown field '{unknown}'; expected one of: {}",
+                RESULT_FIELDS.join(", ")
+            )),
+            None => Ok(()),
+        }
+    }
+
+    /// Resolve the search plan, rejecting unknown `fields`.
+    async fn plan(&self, state: &AppState, mode: SearchMode) -> Result<SearchPlan, String> {
+        self.check_fields()?;
+        retriever::plan_search(&state.config, &state.target_dir, mode, &self.query, &self.options())
+            .await
+            .map_err(|e| e.to_string())
+    }
 }
 
 fn default_limit() -> usize {
     10
 }
 
-/// Embed `query` via the actor and open the store, returning both or an error response.
-async fn prepare(
-    state: &AppState,
-    query: &str,
-) -> Result<(Vec<f32>, Store), HttpResponse> {
+#[derive(serde::Deserialize)]
+pub struct RefineRequest {
+    /// `X-Result-Id` of the result set to narrow
+    pub result_id: String,
+    #[serde(default)]
+    pub mode: RefineMode,
+    /// Follow-up query, filters and boosts
+    #[serde(flatten)]
+    pub search: SearchRequest,
+}
+
+#[derive(serde::Deserialize)]
+pub struct BatchQuery {
+    #[serde(default)]
+    pub mode: SearchMode,
+    /// Query, limit, filters and projection, as for `/find` and `/query`
+    #[serde(flatten)]
+    pub search: SearchRequest,
+}
+
+#[derive(serde::Deserialize)]
+pub struct BatchRequest {
+    pub queries: Vec<BatchQuery>,
+}
+
+/// A chunk fetched by id or file: a search result without a score.
+#[derive(serde::Serialize)]
+struct ChunkView<'a> {
+    id: &'a str,
+    file_path: &'a str,
+    language: &'a str,
+    start_line: u32,
+    end_line: u32,
+    symbol: &'a str,
+    content: &'a str,
+    summary: Option<&'a str>,
+    qualified_symbol: Option<&'a str>,
+    coverage: Option<ChunkCoverage>,
+    hotness: Option<ChunkHotness>,
+}
+
+impl<'a> From<&'a SearchResult> for ChunkView<'a> {
+    fn from(r: &'a SearchResult) -> Self {
+        ChunkView {
+            id: &r.id,
+            file_path: &r.file_path,
+            language: &r.language,
+            start_line: r.start_line,
+            end_line: r.end_line,
+            symbol: &r.symbol,
+            content: &r.content,
+            summary: r.summary.as_deref(),
+            qualified_symbol: r.qualified_symbol.as_deref(),
+            coverage: r.coverage,
+            hotness: r.hotness,
+        }
+    }
+}
+
+#[derive(serde::Serialize)]
+struct FileEntry {
+    file_path: String,
+    chunks: usize,
+}
+
+#[derive(serde::Deserialize)]
+pub struct EmbedTextsRequest {
+    pub texts: Vec<String>,
+    /// `code` (verbatim) or `query` (behind the model's task instruction)
+    #[serde(default)]
+    pub mode: EmbedMode,
+}
+
+/// Embed prompts, instruction templates already applied, in one batch of
+/// the embedder actor.
+async fn embed_prompts(state: &AppState, prompts: Vec<String>) -> crate::error::Result<Vec<Vec<f32>>> {
     let (reply_tx, reply_rx) = oneshot::channel();
-    if state.embed_tx.send((query.to_owned(), reply_tx)).await.is_err() {
-        return Err(HttpResponse::InternalServerError().body("Embedder not available"));
+    if state.embed_tx.send(EmbedRequest::Prompts(prompts, reply_tx)).await.is_err() {
+        return Err(AppError::Embed("Embedder not available".to_string()));
     }
-    let vector = match reply_rx.await {
-        Ok(Ok(v)) => v,
-        Ok(Err(e)) => return Err(HttpResponse::InternalServerError().body(e.to_string())),
-        Err(_) => return Err(HttpResponse::InternalServerError().body("Embedder channel closed")),
-    };
+    reply_rx
+        .await
+        .map_err(|_| AppError::Embed("Embedder channel closed".to_string()))?
+        .map_err(|e| AppError::Embed(e.to_string()))
+}
 
-    let store = Store::open_or_create(
+async fn open_store(state: &AppState) -> Result<Store, HttpResponse> {
+    // The checkout can switch branches while the server runs, so the overlay
+    // is detected per request — with git, off the async workers
+    let target_dir = state.target_dir.clone();
+    let overlay = tokio::task::spawn_blocking(move || overlay::current(&target_dir))
+        .await
+        .map_err(|e| HttpResponse::InternalServerError().body(e.to_string()))?;
+    Store::open_or_create(
         &state.db_path,
         state.config.db.embedding_dim,
         &state.config.db.table_name,
+        &overlay,
         false,
     )
     .await
-    .map_err(|e| HttpResponse::InternalServerError().body(e.to_string()))?;
+    .map_err(|e| HttpResponse::InternalServerError().body(e.to_string()))
+}
 
-    Ok((vector, store))
+/// Resolve the search plan, embed its prompt via the actor and open the store,
+/// returning all three or an error response.
+async fn prepare(
+    state: &AppState,
+    body: &SearchRequest,
+    mode: SearchMode,
+) -> Result<(SearchPlan, Vec<f32>, Store), HttpResponse> {
+    let plan = body.plan(state, mode).await.map_err(|e| HttpResponse::BadRequest().body(e))?;
+
+    let vector = embed_prompts(state, vec![plan.prompt.clone()])
+        .await
+        .map_err(|e| HttpResponse::InternalServerError().body(e.to_string()))?
+        .remove(0);
+
+    let store = open_store(state).await?;
+    Ok((plan, vector, store))
+}
+
+async fn search_handler(state: &AppState, body: &SearchRequest, mode: SearchMode) -> HttpResponse {
+    let (plan, vector, store) = match prepare(state, body, mode).await {
+        Ok(v) => v,
+        Err(e) => return e,
+    };
+
+    let results = match retriever::search(&store, &vector, mode, body.limit, &plan).await {
+        Ok(results) => results,
+        Err(e) => return HttpResponse::InternalServerError().body(e.to_string()),
+    };
+    match highlighted(state, &plan, &vector, results).await {
+        Ok(results) => respond(state, body, results),
+        Err(e) => HttpResponse::InternalServerError().body(e.to_string()),
+    }
+}
+
+/// Set `highlight_lines` on results, embedding candidate windows via the actor.
+async fn highlighted(
+    state: &AppState,
+    plan: &SearchPlan,
+    vector: &[f32],
+    mut results: Vec<SearchResult>,
+) -> crate::error::Result<Vec<SearchResult>> {
+    let embed = |texts: Vec<String>| embed_prompts(state, texts);
+    highlight::highlight(&mut results, &plan.terms, vector, &state.config.highlight, embed).await?;
+    Ok(results)
+}
+
+/// Apply `min_score` and remember the result set, whole, for `/refine`,
+/// returning it with its id.
+fn remember(
+    state: &AppState,
+    body: &SearchRequest,
+    results: Vec<SearchResult>,
+) -> Result<(String, Arc<Vec<SearchResult>>), HttpResponse> {
+    let filtered: Arc<Vec<_>> = Arc::new(
+        results
+            .into_iter()
+            .filter(|r| body.min_score.map_or(true, |t| r.score >= t))
+            .collect(),
+    );
+    match state.sessions.lock() {
+        Ok(mut sessions) => Ok((sessions.insert(Arc::clone(&filtered)), filtered)),
+        Err(_) => Err(HttpResponse::InternalServerError().body("Result sessions unavailable")),
+    }
+}
+
+/// Results as JSON with only the requested `fields`, content trimmed to
+/// `max_content_lines`. Trimmed results are marked `content_truncated`.
+fn project(results: &[SearchResult], body: &SearchRequest) -> Vec<Value> {
+    results
+        .iter()
+        .map(|r| {
+            let mut value = serde_json::to_value(r).expect("search results serialize");
+            let Value::Object(fields) = &mut value else {
+                return value;
+            };
+            if let Some(max) = body.max_content_lines.filter(|&m| r.content.lines().count() > m) {
+                let trimmed = r.content.lines().take(max).collect::<Vec<_>>().join("\n");
+                fields.insert("content".to_string(), Value::String(trimmed));
+                fields.insert("content_truncated".to_string(), Value::Bool(true));
+            }
+            if let Some(selected) = &body.fields {
+                fields.retain(|k, _| {
+                    let k = if k == "content_truncated" { "content" } else { k.as_str() };
+                    selected.iter().any(|s| s == k)
+                });
+            }
+            value
+        })
+        .collect()
+}
+
+/// Apply `min_score`, remember the result set for `/refine` and return it,
+/// projected, with its id in the `X-Result-Id` header.
+fn respond(state: &AppState, body: &SearchRequest, results: Vec<SearchResult>) -> HttpResponse {
+    match remember(state, body, results) {
+        Ok((id, results)) => HttpResponse::Ok()
+            .insert_header((RESULT_ID_HEADER, id))
+            .json(project(&results, body)),
+        Err(e) => e,
+    }
 }
 
 pub async fn find_handler(
     state: web::Data<AppState>,
     body: web::Json<SearchRequest>,
 ) -> impl Responder {
-    let (vector, store) = match prepare(&state, &body.query).await {
+    search_handler(&state, &body, SearchMode::Find).await
+}
+
+pub async fn query_handler(
+    state: web::Data<AppState>,
+    body: web::Json<SearchRequest>,
+) -> impl Responder {
+    search_handler(&state, &body, SearchMode::Query).await
+}
+
+/// Narrow an earlier result set with a follow-up query. The refined set gets
+/// its own id, so follow-ups can be chained.
+pub async fn refine_handler(
+    state: web::Data<AppState>,
+    body: web::Json<RefineRequest>,
+) -> impl Responder {
+    let previous = match state.sessions.lock() {
+        Ok(sessions) => sessions.get(&body.result_id),
+        Err(_) => return HttpResponse::InternalServerError().body("Result sessions unavailable"),
+    };
+    let Some(previous) = previous else {
+        return HttpResponse::NotFound().body(format!("Unknown or expired result_id '{}'", body.result_id));
+    };
+
+    let (plan, vector, store) = match prepare(&state, &body.search, SearchMode::Find).await {
         Ok(v) => v,
         Err(e) => return e,
     };
 
-    match store.search(&vector, body.limit).await {
-        Ok(results) => {
-            let filtered: Vec<_> = results.into_iter()
-                .filter(|r| body.min_score.map_or(true, |t| r.score >= t))
-                .collect();
-            HttpResponse::Ok().json(filtered)
+    let results =
+        match refine::refine(&store, &previous, &vector, body.mode, body.search.limit, &plan).await {
+            Ok(results) => results,
+            Err(e) => return HttpResponse::InternalServerError().body(e.to_string()),
+        };
+    match highlighted(&state, &plan, &vector, results).await {
+        Ok(results) => respond(&state, &body.search, results),
+        Err(e) => HttpResponse::InternalServerError().body(e.to_string()),
+    }
+}
+
+/// Run many searches in one request. All prompts are embedded in one
+/// batch; each query keeps its own mode, filters, limit and
+/// projection. Answers come back in query order, each `{result_id, results}`
+/// or `{error}`, so one bad query doesn't fail the rest.
+pub async fn batch_handler(
+    state: web::Data<AppState>,
+    body: web::Json<BatchRequest>,
+) -> impl Responder {
+    if body.queries.len() > MAX_BATCH_QUERIES {
+        return HttpResponse::BadRequest().body(format!(
+            "{} queries given; a batch holds at most {MAX_BATCH_QUERIES}",
+            body.queries.len()
+        ));
+    }
+
+    let mut plans: Vec<Result<SearchPlan, String>> = Vec::with_capacity(body.queries.len());
+    for q in &body.queries {
+        plans.push(q.search.plan(&state, q.mode).await);
+    }
+    let prompts = plans.iter().flatten().map(|p| p.prompt.clone()).collect();
+    let mut vectors = match embed_prompts(&state, prompts).await {
+        Ok(vectors) => vectors.into_iter(),
+        Err(e) => return HttpResponse::InternalServerError().body(e.to_string()),
+    };
+    let store = match open_store(&state).await {
+        Ok(store) => store,
+        Err(e) => return e,
+    };
+
+    let mut answers = Vec::with_capacity(body.queries.len());
+    for (query, plan) in body.queries.iter().zip(plans) {
+        let plan = match plan {
+            Ok(plan) => plan,
+            Err(e) => {
+                answers.push(json!({ "error": e }));
+                continue;
+            }
+        };
+        let vector = vectors.next().expect("one vector per planned query");
+        let results =
+            match retriever::search(&store, &vector, query.mode, query.search.limit, &plan).await {
+                Ok(results) => highlighted(&state, &plan, &vector, results).await,
+                Err(e) => Err(e),
+            };
+        let answer = match results {
+            Ok(results) => match remember(&state, &query.search, results) {
+                Ok((id, results)) => {
+                    json!({ "result_id": id, "results": project(&results, &query.search) })
+                }
+                Err(e) => return e,
+            },
+            Err(e) => json!({ "error": e.to_string() }),
+        };
+        answers.push(answer);
+    }
+    HttpResponse::Ok().json(answers)
+}
+
+/// Embed texts with the server's model, so other tools can reuse it instead
+/// of loading their own. Vectors are L2-normalized and come back in input
+/// order with their token counts and whether they were truncated.
+pub async fn embed_handler(
+    state: web::Data<AppState>,
+    body: web::Json<EmbedTextsRequest>,
+) -> impl Responder {
+    let body = body.into_inner();
+    if body.texts.len() > MAX_EMBED_TEXTS {
+        return HttpResponse::BadRequest().body(format!(
+            "{} texts given; a request holds at most {MAX_EMBED_TEXTS}",
+            body.texts.len()
+        ));
+    }
+
+    let (reply_tx, reply_rx) = oneshot::channel();
+    if state.embed_tx.send(EmbedRequest::Texts(body.texts, body.mode, reply_tx)).await.is_err() {
+        return HttpResponse::InternalServerError().body("Embedder not available");
+    }
+    match reply_rx.await {
+        Ok(Ok(embeddings)) => {
+            // What the model produced, which `db.embedding_dim` may misstate
+            let dimensions =
+                embeddings.first().map_or(state.config.db.embedding_dim, |e| e.vector.len());
+            HttpResponse::Ok().json(json!({
+                "model": nomic::MODEL_ID,
+                "dimensions": dimensions,
+                "embeddings": embeddings,
+            }))
         }
+        Ok(Err(e)) => HttpResponse::InternalServerError().body(e.to_string()),
+        Err(_) => HttpResponse::InternalServerError().body("Embedder channel closed"),
+    }
+}
+
+/// The chunk with the given id (`file_path:start_line`, as in search results).
+pub async fn chunk_handler(state: web::Data<AppState>, id: web::Path<String>) -> impl Responder {
+    let store = match open_store(&state).await {
+        Ok(store) => store,
+        Err(e) => return e,
+    };
+    let location = match store.location(&id).await {
+        Ok(Some(location)) => location,
+        Ok(None) => return HttpResponse::NotFound().body(format!("No chunk with id '{id}'")),
+        Err(e) => return HttpResponse::InternalServerError().body(e.to_string()),
+    };
+    match fetch_chunks(&store, &[location]).await {
+        Ok(chunks) => match chunks.first() {
+            Some(chunk) => HttpResponse::Ok().json(ChunkView::from(chunk)),
+            None => HttpResponse::NotFound().body(format!("No chunk with id '{id}'")),
+        },
         Err(e) => HttpResponse::InternalServerError().body(e.to_string()),
     }
 }
 
-pub async fn query_handler(
+/// The chunks of an indexed file, in line order.
+pub async fn file_chunks_handler(
     state: web::Data<AppState>,
-    body: web::Json<SearchRequest>,
+    path: web::Path<String>,
 ) -> impl Responder {
-    let (vector, store) = match prepare(&state, &body.query).await {
-        Ok(v) => v,
+    let store = match open_store(&state).await {
+        Ok(store) => store,
         Err(e) => return e,
     };
+    let mut locations = match store.file_locations(&path).await {
+        Ok(locations) => locations,
+        Err(e) => return HttpResponse::InternalServerError().body(e.to_string()),
+    };
+    if locations.is_empty() {
+        return HttpResponse::NotFound().body(format!("{path} is not in the index"));
+    }
+    locations.sort_by_key(|l| (l.start_line, l.end_line));
+    match fetch_chunks(&store, &locations).await {
+        Ok(chunks) => HttpResponse::Ok().json(chunks.iter().map(ChunkView::from).collect::<Vec<_>>()),
+        Err(e) => HttpResponse::InternalServerError().body(e.to_string()),
+    }
+}
 
-    let limit = body.limit;
-    let (content_res, summary_res) =
-        tokio::join!(store.search(&vector, limit), store.search_by_summary(&vector, limit));
+/// The symbols of an indexed file, as `mh outline --format json` prints them.
+pub async fn outline_handler(state: web::Data<AppState>, path: web::Path<String>) -> impl Responder {
+    let store = match open_store(&state).await {
+        Ok(store) => store,
+        Err(e) => return e,
+    };
+    match outline::file_outline(&store, &path).await {
+        Ok(Some(definitions)) => HttpResponse::Ok()
+            .json(definitions.iter().map(JsonDefinition::from).collect::<Vec<_>>()),
+        Ok(None) => HttpResponse::NotFound().body(format!("{path} is not in the index")),
+        Err(e) => HttpResponse::InternalServerError().body(e.to_string()),
+    }
+}
 
-    match (content_res, summary_res) {
-        (Ok(content), Ok(summary)) => {
-            let merged = rrf_merge(content, summary, limit);
-            let filtered: Vec<_> = merged.into_iter()
-                .filter(|r| body.min_score.map_or(true, |t| r.score >= t))
+/// Every indexed file with its number of chunks, by path.
+pub async fn files_handler(state: web::Data<AppState>) -> impl Responder {
+    let store = match open_store(&state).await {
+        Ok(store) => store,
+        Err(e) => return e,
+    };
+    match store.chunks_per_file().await {
+        Ok(counts) => {
+            let mut files: Vec<FileEntry> = counts
+                .into_iter()
+                .map(|(file_path, chunks)| FileEntry { file_path, chunks })
                 .collect();
-            HttpResponse::Ok().json(filtered)
+            files.sort_by(|a, b| a.file_path.cmp(&b.file_path));
+            HttpResponse::Ok().json(files)
         }
-        (Err(e), _) | (_, Err(e)) => HttpResponse::InternalServerError().body(e.to_string()),
+        Err(e) => HttpResponse::InternalServerError().body(e.to_string()),
     }
 }
+
+/// The chunks at `locations`, with `qualified_symbol`, `coverage` and
+/// `hotness` set when a SCIP index, coverage report or profile was imported.
+async fn fetch_chunks(
+    store: &Store,
+    locations: &[LocationRecord],
+) -> crate::error::Result<Vec<SearchResult>> {
+    let mut chunks = store.chunks_at(locations).await?;
+    store.attach_symbols(&mut chunks).await?;
+    store.attach_coverage(&mut chunks).await?;
+    store.attach_hotness(&mut chunks).await?;
+    Ok(chunks)
+}
@@ -0,0 +1,83 @@
+/// Search response tests: which result fields a request may select, and how
+/// projection selects fields and trims content.
+
+#[cfg(test)]
+mod handlers_tests {
+    use std::collections::BTreeSet;
+
+    use serde_json::{Value, json};
+
+    use crate::db::coverage::ChunkCoverage;
+    use crate::db::profile::ChunkHotness;
+    use crate::db::store::SearchResult;
+    use crate::server::handlers::{RESULT_FIELDS, SearchRequest, project};
+
+    fn request(body: Value) -> SearchRequest {
+        serde_json::from_value(body).unwrap()
+    }
+
+    /// A result with every optional field set, so all of them serialize.
+    fn result(content: &str) -> SearchResult {
+        SearchResult {
+            summary: Some("Pushes a value".to_string()),
+            also_at: vec!["vendor/stack.rs:3".to_string()],
+            qualified_symbol: Some("rust . stack/Stack#push().".to_string()),
+            coverage: Some(ChunkCoverage { percent: 50.0, covered_lines: 1, coverable_lines: 2 }),
+            hotness: Some(ChunkHotness { score: 1.0, self_percent: 4.0, total_percent: 9.0 }),
+            highlight_lines: vec![4],
+            ..SearchResult::for_test("src/stack.rs", 3, 5, content)
+        }
+    }
+
+    fn keys(value: &Value) -> BTreeSet<&str> {
+        value.as_object().unwrap().keys().map(|k| k.as_str()).collect()
+    }
+
+    #[test]
+    fn every_result_field_is_selectable() {
+        let projected = project(&[result("fn push() {}")], &request(json!({ "query": "q" })));
+        assert_eq!(keys(&projected[0]), RESULT_FIELDS.iter().copied().collect());
+    }
+
+    #[test]
+    fn only_result_fields_may_be_selected() {
+        let known = request(json!({ "query": "q", "fields": ["file_path", "coverage"] }));
+        assert!(known.check_fields().is_ok());
+        let unknown = request(json!({ "query": "q", "fields": ["file_path", "path"] }));
+        let err = unknown.check_fields().unwrap_err();
+        assert!(err.starts_with("Unknown field 'path'"), "{err}");
+        // Internal fields and the truncation marker aren't selectable either
+        for field in ["content_hash", "content_truncated"] {
+            assert!(request(json!({ "query": "q", "fields": [field] })).check_fields().is_err());
+        }
+    }
+
+    #[test]
+    fn fields_select_what_is_returned() {
+        let body = request(json!({ "query": "q", "fields": ["file_path", "start_line"] }));
+        let projected = project(&[result("fn push() {}")], &body);
+        assert_eq!(projected[0], json!({ "file_path": "src/stack.rs", "start_line": 3 }));
+    }
+
+    #[test]
+    fn content_is_trimmed_to_max_lines_and_marked() {
+        let body = request(json!({ "query": "q", "max_content_lines": 2 }));
+        let projected = project(&[result("a\nb\nc"), result("a\nb")], &body);
+        assert_eq!(projected[0]["content"], "a\nb");
+        assert_eq!(projected[0]["content_truncated"], true);
+        // Content within the limit is returned whole and unmarked
+        assert_eq!(projected[1]["content"], "a\nb");
+        assert!(projected[1].get("content_truncated").is_none());
+    }
+
+    #[test]
+    fn the_truncation_marker_follows_content() {
+        let with = request(json!({ "query": "q", "fields": ["content"], "max_content_lines": 1 }));
+        let projected = project(&[result("a\nb")], &with);
+        assert_eq!(projected[0], json!({ "content": "a", "content_truncated": true }));
+
+        let without = request(json!({ "query": "q", "fields": ["id"], "max_content_lines": 1 }));
+        let projected = project(&[result("a\nb")], &without);
+        assert_eq!(projected[0], json!({ "id": "src/stack.rs:3" }));
+    }
+}
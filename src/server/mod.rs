@@ -3,19 +3,26 @@ pub mod handlers;
 pub mod watcher;
 
 use std::path::PathBuf;
+use std::sync::{Arc, Mutex};
 
 use actix_web::{App, HttpServer, web};
 use tokio::sync::mpsc;
 
 use crate::cli::ServerArgs;
 use crate::config::AppConfig;
+use crate::rag::refine::ResultSessions;
 use embedder_actor::EmbedRequest;
 
+/// Number of recent result sets kept for `/refine`.
+const RESULT_SESSIONS: usize = 256;
+
 #[derive(Clone)]
 pub struct AppState {
     pub embed_tx: mpsc::Sender<EmbedRequest>,
     pub db_path: PathBuf,
+    pub target_dir: PathBuf,
     pub config: AppConfig,
+    pub sessions: Arc<Mutex<ResultSessions>>,
 }
 
 pub async fn run_server(
@@ -30,15 +37,23 @@ pub async fn run_server(
     tracing::info!("Loading embedder model...");
     let embed_tx = embedder_actor::spawn_embedder_actor();
 
-    let _watcher = watcher::spawn_watcher(target_dir, db_path.clone(), config.clone())?;
+    let _watcher = watcher::spawn_watcher(target_dir.clone(), db_path.clone(), config.clone())?;
 
-    let state = AppState { embed_tx, db_path, config };
+    let sessions = Arc::new(Mutex::new(ResultSessions::new(RESULT_SESSIONS)));
+    let state = AppState { embed_tx, db_path, target_dir, config, sessions };
 
     HttpServer::new(move || {
         App::new()
             .app_data(web::Data::new(state.clone()))
             .route("/find", web::post().to(handlers::find_handler))
             .route("/query", web::post().to(handlers::query_handler))
+            .route("/refine", web::post().to(handlers::refine_handler))
+            .route("/batch", web::post().to(handlers::batch_handler))
+            .route("/embed", web::post().to(handlers::embed_handler))
+            .route("/chunks/{id:.*}", web::get().to(handlers::chunk_handler))
+            .route("/files", web::get().to(handlers::files_handler))
+            .route("/files/{path:.*}/chunks", web::get().to(handlers::file_chunks_handler))
+            .route("/files/{path:.*}/outline", web::get().to(handlers::outline_handler))
     })
     .bind(&bind_addr)?
     .run()
@@ -1,49 +1,88 @@
-use std::path::PathBuf;
+use std::path::{Path, PathBuf};
 use std::time::Duration;
 
-use notify::{EventKind, RecommendedWatcher, RecursiveMode, Watcher};
+use glob::Pattern;
+use notify::{EventKind, PollWatcher, RecursiveMode, Watcher};
 use tokio::sync::mpsc;
+use tokio::time::{Instant, Interval, MissedTickBehavior};
 
-use crate::config::AppConfig;
+use crate::config::{AppConfig, WatchBackend, WatchConfig};
+use crate::indexer::walker::skips_dir;
 
 const DEBOUNCE_WINDOW: Duration = Duration::from_millis(500);
 
+/// What the watcher reports to the refresh loop.
+enum Signal {
+    /// A file was created, modified or removed
+    Changed,
+    /// Events were lost — a queue overflow or watcher error — so the index
+    /// may have missed changes anywhere in the project
+    Rescan(String),
+}
+
 /// Start watching `target_dir` for file changes and trigger a debounced index
-/// refresh after each burst of events. The returned `RecommendedWatcher` must
-/// be kept alive for as long as watching is needed.
+/// refresh after each burst of events, after lost events, and every
+/// `watch.reconcile_interval_secs`. Each refresh hashes every file, so it
+/// also reconciles changes the watcher never reported; the model is only
+/// loaded when a file has changed. Changes in hidden or excluded directories
+/// are ignored. The returned watcher must be kept alive for as long as
+/// watching is needed.
 pub fn spawn_watcher(
     target_dir: PathBuf,
     db_path: PathBuf,
     config: AppConfig,
-) -> anyhow::Result<RecommendedWatcher> {
-    let (event_tx, mut event_rx) = mpsc::unbounded_channel::<notify::Event>();
-
-    let mut watcher =
-        notify::recommended_watcher(move |res: notify::Result<notify::Event>| {
-            if let Ok(event) = res {
-                match event.kind {
-                    EventKind::Create(_) | EventKind::Modify(_) | EventKind::Remove(_) => {
-                        let _ = event_tx.send(event);
-                    }
-                    _ => {}
-                }
-            }
-        })?;
+) -> anyhow::Result<Box<dyn Watcher + Send>> {
+    let (event_tx, mut event_rx) = mpsc::unbounded_channel::<Signal>();
+    let exclude = &config.index.default_excludes;
+    let ignore = Ignore {
+        root: target_dir.clone(),
+        exclude: exclude.iter().filter_map(|g| Pattern::new(g).ok()).collect(),
+    };
+    let watcher = start_watcher(&target_dir, &config.watch, ignore, event_tx)?;
 
-    watcher.watch(&target_dir, RecursiveMode::Recursive)?;
+    let mut sweep = (config.watch.reconcile_interval_secs > 0).then(|| {
+        let period = Duration::from_secs(config.watch.reconcile_interval_secs);
+        let mut interval = tokio::time::interval_at(Instant::now() + period, period);
+        interval.set_missed_tick_behavior(MissedTickBehavior::Delay);
+        interval
+    });
 
     tokio::spawn(async move {
         loop {
-            // Wait for the first event of a burst
-            if event_rx.recv().await.is_none() {
-                break;
-            }
+            tokio::select! {
+                signal = event_rx.recv() => {
+                    // Wait for the first event of a burst
+                    let Some(first) = signal else {
+                        break;
+                    };
 
-            // Debounce: let the burst settle before triggering a refresh
-            tokio::time::sleep(DEBOUNCE_WINDOW).await;
-            while event_rx.try_recv().is_ok() {}
+                    // Debounce: let the burst settle before triggering a refresh
+                    tokio::time::sleep(DEBOUNCE_WINDOW).await;
+                    let mut lost = match first {
+                        Signal::Rescan(why) => Some(why),
+                        Signal::Changed => None,
+                    };
+                    while let Ok(signal) = event_rx.try_recv() {
+                        if let Signal::Rescan(why) = signal {
+                            lost.get_or_insert(why);
+                        }
+                    }
 
-            tracing::info!("File change detected — triggering index refresh");
+                    match lost {
+                        Some(why) => tracing::warn!(
+                            "File events may have been lost ({why}) — reconciling the index"
+                        ),
+                        None => tracing::info!("File change detected — triggering index refresh"),
+                    }
+                }
+                _ = tick(&mut sweep) => {
+                    tracing::info!("Periodic reconcile — checking all files for missed changes");
+                }
+            }
+            // A refresh is a full sweep, so the next one is due a whole period later
+            if let Some(interval) = sweep.as_mut() {
+                interval.reset();
+            }
 
             // Await directly so a slow refresh naturally gates the next one;
             // no concurrent refresh tasks can pile up.
@@ -57,3 +96,105 @@ pub fn spawn_watcher(
 
     Ok(watcher)
 }
+
+/// Paths whose changes can't affect the index: excluded files and anything
+/// inside a directory the index walk skips.
+#[derive(Clone)]
+struct Ignore {
+    root: PathBuf,
+    exclude: Vec<Pattern>,
+}
+
+impl Ignore {
+    fn ignores(&self, path: &Path) -> bool {
+        let Ok(rel) = path.strip_prefix(&self.root) else {
+            return false;
+        };
+        self.exclude.iter().any(|p| p.matches(&rel.to_string_lossy()))
+            || rel.ancestors().skip(1).any(|dir| skips_dir(dir, &self.exclude))
+    }
+}
+
+/// Watch `dir` with the configured backend. `auto` uses native notifications
+/// and falls back to polling when they can't be set up, e.g. when the inotify
+/// watch limit is exhausted.
+fn start_watcher(
+    dir: &Path,
+    config: &WatchConfig,
+    ignore: Ignore,
+    tx: mpsc::UnboundedSender<Signal>,
+) -> anyhow::Result<Box<dyn Watcher + Send>> {
+    let native = || -> anyhow::Result<Box<dyn Watcher + Send>> {
+        let mut watcher = notify::recommended_watcher(handler(ignore.clone(), tx.clone()))?;
+        watcher.watch(dir, RecursiveMode::Recursive)?;
+        Ok(Box::new(watcher))
+    };
+    // Polling rescans every watched file each interval, so the skipped
+    // top-level directories (`.git`, `target`, `node_modules`, ...) aren't
+    // watched at all. Skipped directories deeper down are still scanned.
+    let poll = || -> anyhow::Result<Box<dyn Watcher + Send>> {
+        let interval = Duration::from_millis(config.poll_interval_ms);
+        let mut watcher = PollWatcher::new(
+            handler(ignore.clone(), tx.clone()),
+            notify::Config::default().with_poll_interval(interval),
+        )?;
+        watcher.watch(dir, RecursiveMode::NonRecursive)?;
+        for entry in std::fs::read_dir(dir)?.filter_map(|e| e.ok()) {
+            let path = entry.path();
+            let rel = path.strip_prefix(dir).unwrap_or(&path);
+            if entry.file_type().is_ok_and(|t| t.is_dir()) && !skips_dir(rel, &ignore.exclude) {
+                watcher.watch(&path, RecursiveMode::Recursive)?;
+            }
+        }
+        tracing::info!("Watching {} by polling every {interval:?}", dir.display());
+        Ok(Box::new(watcher))
+    };
+
+    match config.backend {
+        WatchBackend::Native => native(),
+        WatchBackend::Poll => poll(),
+        WatchBackend::Auto => native().or_else(|e| {
+            tracing::warn!("Native file watching unavailable ({e}); falling back to polling");
+            poll()
+        }),
+    }
+}
+
+/// Forward watcher callbacks as signals. Errors and events flagged for
+/// rescan are forwarded rather than dropped: both mean changes went unseen.
+/// Changes only to ignored paths, such as build output, are dropped.
+fn handler(
+    ignore: Ignore,
+    tx: mpsc::UnboundedSender<Signal>,
+) -> impl FnMut(notify::Result<notify::Event>) + Send + 'static {
+    move |res| {
+        let signal = match res {
+            Err(e) => Signal::Rescan(e.to_string()),
+            Ok(event) if event.need_rescan() => {
+                Signal::Rescan("the event queue overflowed".to_string())
+            }
+            Ok(event)
+                if !event.paths.is_empty() && event.paths.iter().all(|p| ignore.ignores(p)) =>
+            {
+                return;
+            }
+            Ok(event) => match event.kind {
+                EventKind::Create(_) | EventKind::Modify(_) | EventKind::Remove(_) => {
+                    Signal::Changed
+                }
+                _ => return,
+            },
+        };
+        let _ = tx.send(signal);
+    }
+}
+
+/// Next periodic reconcile; never completes when sweeps are disabled.
+async fn tick(sweep: &mut Option<Interval>) {
+    match sweep {
+        Some(interval) => {
+            interval.tick().await;
+        }
+        None => std::future::pending().await,
+    }
+}
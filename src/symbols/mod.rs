@@ -0,0 +1,208 @@
+pub mod scip;
+
+use std::collections::BTreeMap;
+use std::path::Path;
+
+use serde::Serialize;
+
+use crate::cli::{ImportScipArgs, OutputFormat, SymbolArgs};
+use crate::config::AppConfig;
+use crate::db::overlay;
+use crate::db::store::{self, Store};
+use crate::db::symbols::{SymbolRecord, SymbolTable};
+use crate::error::{AppError, Result};
+
+/// Replace the precise symbols with those of a SCIP index.
+pub async fn import_scip_cmd(config: &AppConfig, db_path: &Path, args: ImportScipArgs) -> Result<()> {
+    let bytes = std::fs::read(&args.path)?;
+    let mut records: Vec<SymbolRecord> = Vec::new();
+    let documents = scip::read_index(&bytes, |document| {
+        records.extend(document);
+        Ok(())
+    })?;
+
+    let conn = store::connect(db_path).await?;
+    SymbolTable::replace(&conn, &config.db.table_name, &records).await?;
+
+    let definitions = records.iter().filter(|r| r.is_definition).count();
+    let references = records.len() - definitions;
+    println!(
+        "Imported {definitions} definition(s) and {references} reference(s) from {documents} document(s)."
+    );
+    Ok(())
+}
+
+#[derive(Serialize)]
+struct JsonOccurrence<'a> {
+    symbol: &'a str,
+    name: &'a str,
+    file_path: &'a str,
+    line: u32,
+    column: u32,
+    /// For `callers`: the definition containing the reference
+    #[serde(skip_serializing_if = "Option::is_none")]
+    caller: Option<&'a str>,
+}
+
+/// Print where a symbol is defined.
+pub async fn def_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: SymbolArgs,
+) -> Result<()> {
+    let store = open_store(config, db_path, target_dir).await?;
+    let definitions = resolve(&store, &args.name).await?;
+
+    match args.format {
+        OutputFormat::Text => {
+            for d in &definitions {
+                println!("{}:{}:{}  {}", d.file_path, d.line + 1, d.column + 1, d.symbol);
+            }
+        }
+        OutputFormat::Json => {
+            let json: Vec<_> = definitions.iter().map(|d| occurrence_json(d, None)).collect();
+            print_json(&json)?;
+        }
+    }
+    Ok(())
+}
+
+/// Print the references to a symbol, grouped by the definition they occur in.
+pub async fn callers_cmd(
+    config: &AppConfig,
+    db_path: &Path,
+    target_dir: &Path,
+    args: SymbolArgs,
+) -> Result<()> {
+    let store = open_store(config, db_path, target_dir).await?;
+    let definitions = resolve(&store, &args.name).await?;
+    let mut targets: Vec<String> = definitions.into_iter().map(|d| d.symbol).collect();
+    targets.dedup();
+
+    let symbols = store.symbols().expect("resolve checked for the symbols table");
+    let mut references = symbols.references_to(&targets).await?;
+    references.sort_by(|a, b| a.file_path.cmp(&b.file_path).then(a.line.cmp(&b.line)));
+
+    // Indexers that omit enclosing ranges leave the caller unknown; fall back
+    // to the tree-sitter chunk containing the reference
+    let mut chunk_symbols: BTreeMap<String, Vec<(u32, u32, String)>> = BTreeMap::new();
+    let mut callers = Vec::with_capacity(references.len());
+    for r in &references {
+        let caller = match &r.enclosing_symbol {
+            Some(symbol) => scip::symbol_name(symbol),
+            None => {
+                if !chunk_symbols.contains_key(&r.file_path) {
+                    let spans = store
+                        .file_locations(&r.file_path)
+                        .await?
+                        .into_iter()
+                        .map(|l| (l.start_line, l.end_line, l.symbol))
+                        .collect();
+                    chunk_symbols.insert(r.file_path.clone(), spans);
+                }
+                chunk_symbols[&r.file_path]
+                    .iter()
+                    .filter(|(start, end, _)| *start <= r.line && r.line <= *end)
+                    .min_by_key(|(start, end, _)| end - start)
+                    .map(|(_, _, symbol)| symbol.clone())
+                    .unwrap_or_default()
+            }
+        };
+        callers.push(caller);
+    }
+
+    match args.format {
+        OutputFormat::Text => {
+            if references.is_empty() {
+                println!("No references to '{}' found.", args.name);
+            }
+            let mut current: Option<(&str, &str)> = None;
+            for (r, caller) in references.iter().zip(&callers) {
+                let group = (r.file_path.as_str(), caller.as_str());
+                if current != Some(group) {
+                    let label = if caller.is_empty() { "<top level>" } else { caller };
+                    println!("{label}  ({})", r.file_path);
+                    current = Some(group);
+                }
+                println!("  {}:{}:{}", r.file_path, r.line + 1, r.column + 1);
+            }
+        }
+        OutputFormat::Json => {
+            let json: Vec<_> = references
+                .iter()
+                .zip(&callers)
+                .map(|(r, caller)| occurrence_json(r, Some(caller.as_str())))
+                .collect();
+            print_json(&json)?;
+        }
+    }
+    Ok(())
+}
+
+async fn open_store(config: &AppConfig, db_path: &Path, target_dir: &Path) -> Result<Store> {
+    Store::try_open(
+        db_path,
+        config.db.embedding_dim,
+        &config.db.table_name,
+        &overlay::current(target_dir),
+    )
+        .await?
+        .filter(|s| s.symbols().is_some())
+        .ok_or_else(|| {
+            AppError::Other(anyhow::anyhow!("No precise symbols found. Run `import-scip` first."))
+        })
+}
+
+/// Definitions matching `name`: a full SCIP symbol, a display name, or a
+/// qualified name such as `Parser::parse` or `Parser.parse`, whose leading
+/// parts must match the enclosing descriptors.
+async fn resolve(store: &Store, name: &str) -> Result<Vec<SymbolRecord>> {
+    let symbols = store.symbols().expect("open_store checked for the symbols table");
+    let mut definitions = symbols.definitions_named(name).await?;
+
+    if definitions.is_empty() {
+        let parts: Vec<&str> = name
+            .split(|c: char| matches!(c, ':' | '.' | '#' | '/'))
+            .filter(|p| !p.is_empty())
+            .collect();
+        if let Some((last, scope)) = parts.split_last() {
+            if !scope.is_empty() {
+                definitions = symbols.definitions_named(last).await?;
+                definitions.retain(|d| {
+                    let names = scip::descriptor_names(&d.symbol);
+                    let enclosing = &names[..names.len().saturating_sub(1)];
+                    enclosing.len() >= scope.len()
+                        && enclosing.iter().rev().zip(scope.iter().rev()).all(|(a, b)| a == b)
+                });
+            }
+        }
+    }
+
+    if definitions.is_empty() {
+        return Err(AppError::Other(anyhow::anyhow!(
+            "no definition of '{name}' in the imported SCIP index"
+        )));
+    }
+    definitions.sort_by(|a, b| a.symbol.cmp(&b.symbol).then(a.file_path.cmp(&b.file_path)));
+    Ok(definitions)
+}
+
+fn occurrence_json<'a>(r: &'a SymbolRecord, caller: Option<&'a str>) -> JsonOccurrence<'a> {
+    JsonOccurrence {
+        symbol: &r.symbol,
+        name: &r.name,
+        file_path: &r.file_path,
+        line: r.line,
+        column: r.column,
+        caller,
+    }
+}
+
+fn print_json<T: Serialize>(value: &T) -> Result<()> {
+    println!(
+        "{}",
+        serde_json::to_string_pretty(value).map_err(|e| AppError::Other(e.into()))?
+    );
+    Ok(())
+}
@@ -0,0 +1,272 @@
+use std::collections::HashMap;
+
+use crate::db::symbols::SymbolRecord;
+use crate::error::Result;
+use crate::protobuf::Decoder;
+
+#[cfg(test)]
+#[path = "scip_tests.rs"]
+mod scip_tests;
+
+/// `SymbolRole.Definition`
+const ROLE_DEFINITION: i32 = 1;
+
+/// An occurrence range: 0-based (line, column) start and end.
+#[derive(Clone, Copy)]
+struct Range {
+    start: (u32, u32),
+    end: (u32, u32),
+}
+
+impl Range {
+    /// SCIP encodes ranges as `[line, start, end]` or `[start line, start, end line, end]`.
+    /// Ranges ending before they start are malformed and rejected.
+    fn decode(values: &[u64]) -> Option<Self> {
+        let v: Vec<u32> = values.iter().map(|&x| x as u32).collect();
+        let range = match v.as_slice() {
+            [line, start, end] => Self { start: (*line, *start), end: (*line, *end) },
+            [sl, sc, el, ec] => Self { start: (*sl, *sc), end: (*el, *ec) },
+            _ => return None,
+        };
+        (range.start <= range.end).then_some(range)
+    }
+
+    fn contains(&self, pos: (u32, u32)) -> bool {
+        self.start <= pos && pos <= self.end
+    }
+
+    fn lines(&self) -> u32 {
+        self.end.0 - self.start.0
+    }
+}
+
+struct Occurrence {
+    range: Range,
+    symbol: String,
+    roles: i32,
+    enclosing_range: Option<Range>,
+}
+
+/// Decode a SCIP `Index` and call `f` with the symbol records of each
+/// document in turn. Local symbols (`local N`) are document-private and
+/// skipped. Returns the number of documents read.
+pub fn read_index(bytes: &[u8], mut f: impl FnMut(Vec<SymbolRecord>) -> Result<()>) -> Result<usize> {
+    let mut documents = 0;
+    let mut index = Decoder::new(bytes);
+    while let Some((field, value)) = index.next_field()? {
+        // Index.documents
+        if field == 2 {
+            f(read_document(value.as_bytes())?)?;
+            documents += 1;
+        }
+    }
+    Ok(documents)
+}
+
+fn read_document(bytes: &[u8]) -> Result<Vec<SymbolRecord>> {
+    let mut path = String::new();
+    let mut occurrences = Vec::new();
+    let mut display_names: HashMap<String, String> = HashMap::new();
+
+    let mut doc = Decoder::new(bytes);
+    while let Some((field, value)) = doc.next_field()? {
+        match field {
+            1 => path = value.as_str()?.to_string(),
+            2 => {
+                if let Some(occurrence) = read_occurrence(value.as_bytes())? {
+                    occurrences.push(occurrence);
+                }
+            }
+            3 => {
+                let (symbol, display_name) = read_symbol_information(value.as_bytes())?;
+                if !display_name.is_empty() {
+                    display_names.insert(symbol, display_name);
+                }
+            }
+            _ => {}
+        }
+    }
+
+    // Definitions with an extent, innermost first, to attribute references
+    let mut scopes: Vec<(&Occurrence, Range)> = occurrences
+        .iter()
+        .filter(|o| o.roles & ROLE_DEFINITION != 0)
+        .filter_map(|o| o.enclosing_range.map(|r| (o, r)))
+        .collect();
+    scopes.sort_by_key(|(_, r)| r.lines());
+
+    let records = occurrences
+        .iter()
+        .map(|o| {
+            let is_definition = o.roles & ROLE_DEFINITION != 0;
+            let enclosing_symbol = if is_definition {
+                None
+            } else {
+                scopes
+                    .iter()
+                    .find(|(_, r)| r.contains(o.range.start))
+                    .map(|(def, _)| def.symbol.clone())
+            };
+            let end_line = match (is_definition, o.enclosing_range) {
+                (true, Some(r)) => r.end.0,
+                _ => o.range.end.0,
+            };
+            SymbolRecord {
+                name: display_names
+                    .get(&o.symbol)
+                    .cloned()
+                    .unwrap_or_else(|| symbol_name(&o.symbol)),
+                symbol: o.symbol.clone(),
+                file_path: path.clone(),
+                line: o.range.start.0,
+                column: o.range.start.1,
+                end_line,
+                is_definition,
+                enclosing_symbol,
+            }
+        })
+        .collect();
+    Ok(records)
+}
+
+fn read_occurrence(bytes: &[u8]) -> Result<Option<Occurrence>> {
+    let mut range = Vec::new();
+    let mut enclosing = Vec::new();
+    let mut symbol = "";
+    let mut roles = 0;
+
+    let mut occ = Decoder::new(bytes);
+    while let Some((field, value)) = occ.next_field()? {
+        match field {
+            1 => range.extend(value.varints()?),
+            2 => symbol = value.as_str()?,
+            3 => roles = value.as_i32(),
+            7 => enclosing.extend(value.varints()?),
+            _ => {}
+        }
+    }
+
+    if symbol.is_empty() || symbol.starts_with("local ") {
+        return Ok(None);
+    }
+    let Some(range) = Range::decode(&range) else {
+        return Ok(None);
+    };
+    Ok(Some(Occurrence {
+        range,
+        symbol: symbol.to_string(),
+        roles,
+        enclosing_range: Range::decode(&enclosing),
+    }))
+}
+
+/// `(symbol, display_name)` of a `SymbolInformation` message.
+fn read_symbol_information(bytes: &[u8]) -> Result<(String, String)> {
+    let mut symbol = String::new();
+    let mut display_name = String::new();
+    let mut info = Decoder::new(bytes);
+    while let Some((field, value)) = info.next_field()? {
+        match field {
+            1 => symbol = value.as_str()?.to_string(),
+            6 => display_name = value.as_str()?.to_string(),
+            _ => {}
+        }
+    }
+    Ok((symbol, display_name))
+}
+
+/// Short name of a global SCIP symbol: its last named descriptor.
+pub fn symbol_name(symbol: &str) -> String {
+    descriptor_names(symbol).pop().unwrap_or_default()
+}
+
+/// Names of the descriptors of a global SCIP symbol, outermost first, e.g.
+/// `["src", "lib.rs", "Parser", "parse"]` for
+/// ``scip-rust cargo app 0.1.0 src/`lib.rs`/Parser#parse().``. Parameter and
+/// type-parameter descriptors are left out.
+pub fn descriptor_names(symbol: &str) -> Vec<String> {
+    // Skip scheme, manager, package name and version; "  " is an escaped space
+    let bytes = symbol.as_bytes();
+    let mut i = 0;
+    let mut fields = 0;
+    while i < bytes.len() && fields < 4 {
+        if bytes[i] == b' ' {
+            if bytes.get(i + 1) == Some(&b' ') {
+                i += 2;
+                continue;
+            }
+            fields += 1;
+        }
+        i += 1;
+    }
+
+    let mut names = Vec::new();
+    let mut chars = symbol[i..].chars().peekable();
+    while let Some(&c) = chars.peek() {
+        match c {
+            // `(param)` and `[T]` descriptors: skip to the closing bracket
+            '(' | '[' => {
+                let close = if c == '(' { ')' } else { ']' };
+                for c in chars.by_ref() {
+                    if c == close {
+                        break;
+                    }
+                }
+            }
+            '`' => {
+                chars.next();
+                let mut name = String::new();
+                while let Some(c) = chars.next() {
+                    if c == '`' {
+                        // A doubled backtick is a literal one
+                        if chars.peek() == Some(&'`') {
+                            chars.next();
+                        } else {
+                            break;
+                        }
+                    }
+                    name.push(c);
+                }
+                names.push(name);
+                skip_suffix(&mut chars);
+            }
+            c if is_identifier_char(c) => {
+                let mut name = String::new();
+                while let Some(&c) = chars.peek().filter(|c| is_identifier_char(**c)) {
+                    name.push(c);
+                    chars.next();
+                }
+                names.push(name);
+                skip_suffix(&mut chars);
+            }
+            _ => {
+                chars.next();
+            }
+        }
+    }
+    names
+}
+
+/// Skip a descriptor suffix: `/`, `#`, `.`, `:`, `!` or a method's `(disambiguator).`.
+fn skip_suffix(chars: &mut std::iter::Peekable<std::str::Chars<'_>>) {
+    match chars.peek() {
+        Some('(') => {
+            for c in chars.by_ref() {
+                if c == ')' {
+                    break;
+                }
+            }
+            if chars.peek() == Some(&'.') {
+                chars.next();
+            }
+        }
+        Some('/' | '#' | '.' | ':' | '!') => {
+            chars.next();
+        }
+        _ => {}
+    }
+}
+
+fn is_identifier_char(c: char) -> bool {
+    c.is_alphanumeric() || matches!(c, '_' | '+' | '-' | '$')
+}
@@ -0,0 +1,157 @@
+/// SCIP import tests: documents encoded like a SCIP indexer writes them decode
+/// into symbol records, and descriptor names are read from global symbols.
+
+#[cfg(test)]
+mod scip_tests {
+    use crate::db::symbols::SymbolRecord;
+    use crate::protobuf::Encoder;
+    use crate::symbols::scip::{descriptor_names, read_index, symbol_name};
+
+    const PARSER: &str = "scip-rust cargo app 0.1.0 src/`lib.rs`/Parser#";
+    const PARSE: &str = "scip-rust cargo app 0.1.0 src/`lib.rs`/Parser#parse().";
+    const HELPER: &str = "scip-rust cargo app 0.1.0 src/`lib.rs`/helper().";
+
+    fn occurrence(doc: &mut Encoder, range: &[i32], symbol: &str, roles: i32, enclosing: &[i32]) {
+        doc.message(2, |o| {
+            o.packed_int32(1, range);
+            o.string(2, symbol);
+            o.int32(3, roles);
+            o.packed_int32(7, enclosing);
+        });
+    }
+
+    fn read(bytes: &[u8]) -> Vec<SymbolRecord> {
+        let mut records = Vec::new();
+        read_index(bytes, |r| {
+            records.extend(r);
+            Ok(())
+        })
+        .unwrap();
+        records
+    }
+
+    fn index() -> Vec<u8> {
+        let mut index = Encoder::new();
+        index.message(1, |metadata| metadata.string(3, "file:///app"));
+        index.message(2, |doc| {
+            doc.string(1, "src/lib.rs");
+            occurrence(doc, &[0, 11, 17], PARSER, 1, &[0, 0, 20, 1]);
+            occurrence(doc, &[4, 7, 12], PARSE, 1, &[4, 4, 8, 5]);
+            // A call inside `parse`, which lies inside `Parser`
+            occurrence(doc, &[6, 8, 14], HELPER, 0, &[]);
+            occurrence(doc, &[7, 8, 9], "local 3", 0, &[]);
+            doc.message(3, |info| {
+                info.string(1, PARSE);
+                info.string(6, "Parser::parse");
+            });
+        });
+        index.message(2, |doc| {
+            doc.string(1, "src/util.rs");
+            occurrence(doc, &[2, 3, 9], HELPER, 1, &[2, 0, 2, 20]);
+        });
+        index.finish()
+    }
+
+    #[test]
+    fn documents_decode_into_symbol_records() {
+        let bytes = index();
+        let mut documents = 0;
+        read_index(&bytes, |_| {
+            documents += 1;
+            Ok(())
+        })
+        .unwrap();
+        assert_eq!(documents, 2);
+
+        let records = read(&bytes);
+        let decoded: Vec<(&str, &str, &str, u32, u32, u32, bool)> = records
+            .iter()
+            .map(|r| {
+                (
+                    r.name.as_str(),
+                    r.symbol.as_str(),
+                    r.file_path.as_str(),
+                    r.line,
+                    r.column,
+                    r.end_line,
+                    r.is_definition,
+                )
+            })
+            .collect();
+        // Local symbols are skipped, display names win over descriptor names and
+        // definitions end where their extent does
+        assert_eq!(
+            decoded,
+            vec![
+                ("Parser", PARSER, "src/lib.rs", 0, 11, 20, true),
+                ("Parser::parse", PARSE, "src/lib.rs", 4, 7, 8, true),
+                ("helper", HELPER, "src/lib.rs", 6, 8, 6, false),
+                ("helper", HELPER, "src/util.rs", 2, 3, 2, true),
+            ]
+        );
+    }
+
+    #[test]
+    fn references_are_attributed_to_the_innermost_definition() {
+        let records = read(&index());
+        let call = records.iter().find(|r| !r.is_definition).unwrap();
+        assert_eq!(call.enclosing_symbol.as_deref(), Some(PARSE));
+        assert!(records.iter().filter(|r| r.is_definition).all(|r| r.enclosing_symbol.is_none()));
+    }
+
+    #[test]
+    fn inverted_ranges_are_rejected() {
+        let mut index = Encoder::new();
+        index.message(2, |doc| {
+            doc.string(1, "src/lib.rs");
+            // An extent ending before it starts is ignored, not subtracted
+            occurrence(doc, &[5, 3, 9], PARSER, 1, &[9, 0, 2, 0]);
+            // An occurrence ending before it starts is dropped
+            occurrence(doc, &[6, 9, 1], PARSE, 0, &[]);
+            occurrence(doc, &[6, 8, 14], HELPER, 0, &[]);
+        });
+        let records = read(&index.finish());
+
+        let decoded: Vec<(&str, u32, Option<&str>)> = records
+            .iter()
+            .map(|r| (r.symbol.as_str(), r.end_line, r.enclosing_symbol.as_deref()))
+            .collect();
+        assert_eq!(decoded, vec![(PARSER, 5, None), (HELPER, 6, None)]);
+    }
+
+    #[test]
+    fn truncated_indexes_are_errors() {
+        let bytes = index();
+        assert!(read_index(&bytes[..bytes.len() - 3], |_| Ok(())).is_err());
+    }
+
+    #[test]
+    fn descriptor_names_skip_the_package_and_suffixes() {
+        assert_eq!(descriptor_names(PARSE), vec!["src", "lib.rs", "Parser", "parse"]);
+        assert_eq!(symbol_name(PARSER), "Parser");
+        assert_eq!(symbol_name("scip-rust cargo app 0.1.0 macros/log!"), "log");
+    }
+
+    #[test]
+    fn escaped_spaces_and_backticks_are_unescaped() {
+        assert_eq!(
+            descriptor_names("maharajah . my  app . src/`we``ird name`#"),
+            vec!["src", "we`ird name"]
+        );
+    }
+
+    #[test]
+    fn parameters_type_parameters_and_disambiguators_are_left_out() {
+        assert_eq!(
+            descriptor_names("scip-java maven g:a 1.0 com/Foo#[T]bar(+1).(x)"),
+            vec!["com", "Foo", "bar"]
+        );
+        assert_eq!(descriptor_names("scip-go gomod m v pkg/Type#Field."), vec!["pkg", "Type", "Field"]);
+    }
+
+    #[test]
+    fn a_symbol_without_descriptors_has_no_name() {
+        assert_eq!(symbol_name("scip-rust cargo app 0.1.0 "), "");
+        assert!(descriptor_names("local 4").is_empty());
+    }
+}